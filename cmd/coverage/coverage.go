@@ -0,0 +1,255 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/internal/coverage"
+	"github.com/coreruleset/go-ftw/v2/internal/inventory"
+	"github.com/coreruleset/go-ftw/v2/runner"
+	"github.com/coreruleset/go-ftw/v2/test"
+)
+
+const (
+	dirFlag          = "dir"
+	globFlag         = "glob"
+	includeNologFlag = "include-nolog"
+	outputFlag       = "output"
+	resultsFlag      = "results"
+	rulesDirFlag     = "rules-dir"
+	uncoveredFlag    = "uncovered"
+)
+
+const (
+	textOutput     = "text"
+	jsonOutput     = "json"
+	markdownOutput = "markdown"
+)
+
+// New represents the coverage command
+func New(cmdContext *internal.CommandContext) *cobra.Command {
+	coverageCmd := &cobra.Command{
+		Use:   "coverage",
+		Short: "Show which rules are covered by tests",
+		Long: `Correlate the rules of a rule set with the tests for them. For every rule with an ID, the number of tests expecting the rule
+to be triggered (positive tests) and not to be triggered (negative tests) is shown. Optionally, the results of a run
+(written by 'run -o json') show how often each rule was observed during the run.`,
+		Args: cobra.NoArgs,
+		RunE: runE,
+	}
+
+	coverageCmd.Flags().StringP(rulesDirFlag, "r", "", "recursively find rule files (*.conf) in this directory, e.g. the 'rules' directory of CRS")
+	coverageCmd.Flags().StringP(dirFlag, "d", ".", "recursively find yaml tests in this directory")
+	coverageCmd.Flags().StringP(globFlag, "g", "*.y*ml", "override the filename glob pattern for matching test files")
+	coverageCmd.Flags().String(resultsFlag, "", "file containing the JSON results of a run ('run -o json'), to include the rules observed during the run")
+	coverageCmd.Flags().StringP(outputFlag, "o", textOutput, fmt.Sprintf("output format, one of %q, %q or %q", textOutput, jsonOutput, markdownOutput))
+	coverageCmd.Flags().Bool(includeNologFlag, false, "include rules with the 'nolog' action, which can never be observed in the log")
+	coverageCmd.Flags().Bool(uncoveredFlag, false, "only show rules without positive tests, without negative tests or, with --results, that were never observed")
+	_ = coverageCmd.MarkFlagRequired(rulesDirFlag)
+
+	return coverageCmd
+}
+
+func runE(cmd *cobra.Command, _ []string) error {
+	rulesDir, _ := cmd.Flags().GetString(rulesDirFlag)
+	dir, _ := cmd.Flags().GetString(dirFlag)
+	filenameGlob, _ := cmd.Flags().GetString(globFlag)
+	resultsFile, _ := cmd.Flags().GetString(resultsFlag)
+	outputFormat, _ := cmd.Flags().GetString(outputFlag)
+	includeNolog, _ := cmd.Flags().GetBool(includeNologFlag)
+	uncovered, _ := cmd.Flags().GetBool(uncoveredFlag)
+
+	if !slices.Contains([]string{textOutput, jsonOutput, markdownOutput}, outputFormat) {
+		return fmt.Errorf("invalid --%s %q, must be one of %q, %q or %q", outputFlag, outputFormat, textOutput, jsonOutput, markdownOutput)
+	}
+	cmd.SilenceUsage = true
+
+	rules, err := coverage.ParseRulesDir(rulesDir)
+	if err != nil {
+		return err
+	}
+	if !includeNolog {
+		rules = slices.DeleteFunc(rules, func(rule *coverage.Rule) bool {
+			return rule.NoLog
+		})
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("no rules found in %s", rulesDir)
+	}
+
+	tests, err := test.GetTestsFromFiles(fmt.Sprintf("%s/**/%s", dir, filenameGlob))
+	if err != nil {
+		return err
+	}
+
+	var results *runner.RunStats
+	if resultsFile != "" {
+		if results, err = readResults(resultsFile); err != nil {
+			return err
+		}
+	}
+
+	report := coverage.New(rules, inventory.New(tests, nil), results)
+	if uncovered {
+		report.Rules = report.Uncovered()
+	}
+
+	w := cmd.OutOrStdout()
+	switch outputFormat {
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case markdownOutput:
+		printMarkdown(w, report)
+	default:
+		return printText(w, report)
+	}
+	return nil
+}
+
+func readResults(resultsFile string) (*runner.RunStats, error) {
+	data, err := os.ReadFile(resultsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	results := runner.NewRunStats()
+	if err := json.Unmarshal(data, results); err != nil {
+		return nil, fmt.Errorf("failed to parse results in %s, expected the output of 'run -o json': %w", resultsFile, err)
+	}
+	return results, nil
+}
+
+func printText(w io.Writer, report *coverage.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "RULE\tPL\tPOSITIVE\tNEGATIVE"
+	if report.HasResults {
+		header += "\tOBSERVED"
+	}
+	_, _ = fmt.Fprintln(tw, header+"\tFILE")
+	for _, rule := range report.Rules {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t", rule.RuleId, paranoiaLevel(rule.ParanoiaLevel), rule.PositiveTests, rule.NegativeTests)
+		if report.HasResults {
+			_, _ = fmt.Fprintf(tw, "%d\t", rule.Observed)
+		}
+		_, _ = fmt.Fprintln(tw, rule.File)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(w)
+	header = "PL\tRULES\tPOSITIVE\tNEGATIVE"
+	if report.HasResults {
+		header += "\tOBSERVED"
+	}
+	_, _ = fmt.Fprintln(tw, header)
+	for _, summary := range append(slices.Clone(report.Summaries), report.Total) {
+		level := paranoiaLevel(summary.ParanoiaLevel)
+		if summary == report.Total {
+			level = "all"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s", level, summary.Rules,
+			ratio(summary.WithPositiveTests, summary.Rules), ratio(summary.WithNegativeTests, summary.Rules))
+		if report.HasResults {
+			_, _ = fmt.Fprintf(tw, "\t%s", ratio(summary.Observed, summary.Rules))
+		}
+		_, _ = fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.UnknownRules) > 0 {
+		_, _ = fmt.Fprintf(w, "\nrules referenced by tests but not found in the rules: %s\n", joinIds(report.UnknownRules))
+	}
+	return nil
+}
+
+func printMarkdown(w io.Writer, report *coverage.Report) {
+	_, _ = fmt.Fprintln(w, "## Rule coverage")
+	_, _ = fmt.Fprintln(w)
+	header := "| Paranoia level | Rules | With positive tests | With negative tests |"
+	separator := "|---|---|---|---|"
+	if report.HasResults {
+		header += " Observed |"
+		separator += "---|"
+	}
+	_, _ = fmt.Fprintln(w, header)
+	_, _ = fmt.Fprintln(w, separator)
+	for _, summary := range append(slices.Clone(report.Summaries), report.Total) {
+		level := paranoiaLevel(summary.ParanoiaLevel)
+		if summary == report.Total {
+			level = "**all**"
+		}
+		_, _ = fmt.Fprintf(w, "| %s | %d | %s | %s |", level, summary.Rules,
+			ratio(summary.WithPositiveTests, summary.Rules), ratio(summary.WithNegativeTests, summary.Rules))
+		if report.HasResults {
+			_, _ = fmt.Fprintf(w, " %s |", ratio(summary.Observed, summary.Rules))
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+
+	_, _ = fmt.Fprintln(w)
+	header = "| Rule | Paranoia level | Positive tests | Negative tests |"
+	separator = "|---|---|---|---|"
+	if report.HasResults {
+		header += " Observed |"
+		separator += "---|"
+	}
+	_, _ = fmt.Fprintln(w, header+" File |")
+	_, _ = fmt.Fprintln(w, separator+"---|")
+	for _, rule := range report.Rules {
+		_, _ = fmt.Fprintf(w, "| %d | %s | %s | %s |", rule.RuleId, paranoiaLevel(rule.ParanoiaLevel),
+			markdownCount(rule.PositiveTests), markdownCount(rule.NegativeTests))
+		if report.HasResults {
+			_, _ = fmt.Fprintf(w, " %s |", markdownCount(rule.Observed))
+		}
+		_, _ = fmt.Fprintf(w, " `%s` |\n", rule.File)
+	}
+
+	if len(report.UnknownRules) > 0 {
+		_, _ = fmt.Fprintf(w, "\nRules referenced by tests but not found in the rules: %s\n", joinIds(report.UnknownRules))
+	}
+}
+
+func paranoiaLevel(level int) string {
+	if level == 0 {
+		return "-"
+	}
+	return fmt.Sprint(level)
+}
+
+func ratio(count int, total int) string {
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%.1f%%)", count, float64(count)*100/float64(total))
+}
+
+// markdownCount highlights missing coverage
+func markdownCount(count int) string {
+	if count == 0 {
+		return "**0**"
+	}
+	return fmt.Sprint(count)
+}
+
+func joinIds(ids []uint) string {
+	formatted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		formatted = append(formatted, fmt.Sprint(id))
+	}
+	return strings.Join(formatted, ", ")
+}
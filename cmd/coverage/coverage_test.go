@@ -0,0 +1,170 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/internal/coverage"
+)
+
+var coverageRulesContents = `SecRule TX:DETECTION_PARANOIA_LEVEL "@lt 1" "id:920011,phase:1,pass,nolog,skipAfter:END"
+
+SecRule REQUEST_LINE "@rx foo" \
+    "id:920100,\
+    phase:1,\
+    block,\
+    tag:'paranoia-level/1'"
+
+SecRule REQUEST_HEADERS:Range "@rx bar" \
+    "id:920200,\
+    phase:1,\
+    block,\
+    tag:'paranoia-level/2'"
+`
+
+var coverageTestContents = `---
+meta:
+  author: "go-ftw"
+rule_id: 920100
+tests:
+  - test_id: 1
+    stages:
+      - input:
+          ordered_headers:
+            - name: Host
+              value: localhost
+        output:
+          log:
+            expect_ids: [920100]
+  - test_id: 2
+    stages:
+      - input:
+          ordered_headers:
+            - name: Host
+              value: localhost
+        output:
+          log:
+            no_expect_ids: [920100, 920200]
+`
+
+var coverageResultsContents = `{"run":2,"success":["920100-1","920100-2"],"triggered-rules":{"920100-1":[[920100]],"920100-2":[[]]}}`
+
+type coverageCmdTestSuite struct {
+	suite.Suite
+	rulesDir    string
+	testsDir    string
+	resultsFile string
+}
+
+func TestCoverageCmdTestSuite(t *testing.T) {
+	suite.Run(t, new(coverageCmdTestSuite))
+}
+
+func (s *coverageCmdTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *coverageCmdTestSuite) SetupTest() {
+	tempDir := s.T().TempDir()
+	s.rulesDir = filepath.Join(tempDir, "rules")
+	s.testsDir = filepath.Join(tempDir, "tests")
+	s.resultsFile = filepath.Join(tempDir, "results.json")
+	s.Require().NoError(os.Mkdir(s.rulesDir, 0755))
+	s.Require().NoError(os.Mkdir(s.testsDir, 0755))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.rulesDir, "REQUEST-920-PROTOCOL-ENFORCEMENT.conf"), []byte(coverageRulesContents), 0644))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.testsDir, "920100.yaml"), []byte(coverageTestContents), 0644))
+	s.Require().NoError(os.WriteFile(s.resultsFile, []byte(coverageResultsContents), 0644))
+}
+
+func (s *coverageCmdTestSuite) execute(args ...string) (string, error) {
+	cmd := New(internal.NewCommandContext())
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func (s *coverageCmdTestSuite) TestText() {
+	out, err := s.execute("-r", s.rulesDir, "-d", s.testsDir)
+	s.Require().NoError(err)
+
+	lines := strings.Split(out, "\n")
+	s.Equal([]string{"RULE", "PL", "POSITIVE", "NEGATIVE", "FILE"}, strings.Fields(lines[0]))
+	s.Equal([]string{"920100", "1", "1", "1", filepath.Join(s.rulesDir, "REQUEST-920-PROTOCOL-ENFORCEMENT.conf")}, strings.Fields(lines[1]))
+	s.Equal([]string{"920200", "2", "0", "1"}, strings.Fields(lines[2])[:4])
+	s.Equal("", lines[3])
+	s.Equal([]string{"PL", "RULES", "POSITIVE", "NEGATIVE"}, strings.Fields(lines[4]))
+	s.Equal("1 1 1 (100.0%) 1 (100.0%)", strings.Join(strings.Fields(lines[5]), " "))
+	s.Equal("all 2 1 (50.0%) 2 (100.0%)", strings.Join(strings.Fields(lines[7]), " "))
+	s.NotContains(out, "920011", "rules without logging must not be reported by default")
+}
+
+func (s *coverageCmdTestSuite) TestTextWithResults() {
+	out, err := s.execute("-r", s.rulesDir, "-d", s.testsDir, "--results", s.resultsFile, "--uncovered", "--include-nolog")
+	s.Require().NoError(err)
+
+	lines := strings.Split(out, "\n")
+	s.Equal([]string{"RULE", "PL", "POSITIVE", "NEGATIVE", "OBSERVED", "FILE"}, strings.Fields(lines[0]))
+	s.Equal([]string{"920011", "-", "0", "0", "0"}, strings.Fields(lines[1])[:5])
+	s.Equal([]string{"920200", "2", "0", "1", "0"}, strings.Fields(lines[2])[:5])
+	s.Equal("", lines[3])
+	// the summary always covers all rules
+	s.Equal("all 3 1 (33.3%) 2 (66.7%) 1 (33.3%)", strings.Join(strings.Fields(lines[8]), " "))
+}
+
+func (s *coverageCmdTestSuite) TestJson() {
+	out, err := s.execute("-r", s.rulesDir, "-d", s.testsDir, "--results", s.resultsFile, "-o", "json")
+	s.Require().NoError(err)
+
+	report := &coverage.Report{}
+	s.Require().NoError(json.Unmarshal([]byte(out), report))
+	s.True(report.HasResults)
+	s.Require().Len(report.Rules, 2)
+	s.Equal(1, report.Rules[0].Observed)
+	s.Len(report.Summaries, 2)
+	s.Equal(2, report.Total.Rules)
+}
+
+func (s *coverageCmdTestSuite) TestMarkdown() {
+	out, err := s.execute("-r", s.rulesDir, "-d", s.testsDir, "--results", s.resultsFile, "-o", "markdown")
+	s.Require().NoError(err)
+
+	s.Contains(out, "| Paranoia level | Rules | With positive tests | With negative tests | Observed |\n|---|---|---|---|---|\n")
+	s.Contains(out, "| **all** | 2 | 1 (50.0%) | 2 (100.0%) | 1 (50.0%) |\n")
+	s.Contains(out, "| Rule | Paranoia level | Positive tests | Negative tests | Observed | File |\n|---|---|---|---|---|---|\n")
+	s.Contains(out, "| 920200 | 2 | **0** | 1 | **0** | `"+filepath.Join(s.rulesDir, "REQUEST-920-PROTOCOL-ENFORCEMENT.conf")+"` |\n")
+}
+
+func (s *coverageCmdTestSuite) TestUnknownRules() {
+	s.Require().NoError(os.WriteFile(filepath.Join(s.testsDir, "930110.yaml"), []byte(strings.ReplaceAll(coverageTestContents, "920100", "930110")), 0644))
+	out, err := s.execute("-r", s.rulesDir, "-d", s.testsDir)
+	s.Require().NoError(err)
+	s.Contains(out, "rules referenced by tests but not found in the rules: 930110\n")
+}
+
+func (s *coverageCmdTestSuite) TestErrors() {
+	_, err := s.execute("-d", s.testsDir)
+	s.ErrorContains(err, `required flag(s) "rules-dir" not set`)
+
+	_, err = s.execute("-r", s.rulesDir, "-o", "html")
+	s.ErrorContains(err, `invalid --output "html"`)
+
+	_, err = s.execute("-r", s.testsDir, "-d", s.testsDir)
+	s.ErrorContains(err, "no rules found in "+s.testsDir)
+
+	s.Require().NoError(os.WriteFile(s.resultsFile, []byte("+ run 2 total tests"), 0644))
+	_, err = s.execute("-r", s.rulesDir, "-d", s.testsDir, "--results", s.resultsFile)
+	s.ErrorContains(err, "expected the output of 'run -o json'")
+}
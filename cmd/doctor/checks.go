@@ -0,0 +1,240 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/runner"
+	"github.com/coreruleset/go-ftw/v2/waflog"
+)
+
+// blockedRequestURI is the URI of the known-bad request. It contains a cross-site scripting payload
+// that every WAF should block.
+const blockedRequestURI = "/?q=%3Cscript%3Ealert(1)%3C/script%3E"
+
+// slowMarkerLatency is the marker latency above which the WAF is considered to buffer its log
+const slowMarkerLatency = time.Second
+
+// checkDestination sends a harmless request to the destination
+func checkDestination(doctor *doctorContext) checkResult {
+	result := checkResult{name: "destination"}
+	url := doctor.dest.URL()
+	client, err := ftwhttp.NewClient(doctor.runnerConfig)
+	if err != nil {
+		result.message = err.Error()
+		return result
+	}
+	if err := client.NewConnection(*doctor.dest); err != nil {
+		result.message = fmt.Sprintf("can't connect to %s: %s", url, err)
+		result.hint = fmt.Sprintf("check that the WAF is running and that --%s is correct", targetFlag)
+		if doctor.dest.Protocol == "https" {
+			result.hint += fmt.Sprintf(". If the WAF uses a self-signed certificate, use --%s", skipTlsVerificationFlag)
+		}
+		return result
+	}
+	response, err := client.Do(*doctorRequest("/"))
+	if err != nil {
+		result.message = fmt.Sprintf("no response from %s: %s", url, err)
+		result.hint = fmt.Sprintf("check that %s is the address of the WAF, or increase --%s", url, readTimeoutFlag)
+		return result
+	}
+	doctor.reachable = true
+	result.passed = true
+	result.message = fmt.Sprintf("%s responded with status %d", url, response.Parsed.StatusCode)
+	return result
+}
+
+// checkLogFile checks that the log file can be read
+func checkLogFile(doctor *doctorContext) checkResult {
+	result := checkResult{name: "log file"}
+	logFilePath := doctor.runnerConfig.LogFilePath
+	if logFilePath == "" {
+		result.message = "no log file configured"
+		result.hint = fmt.Sprintf("set the 'logfile' option in the config file, or use --%s", logFileFlag)
+		return result
+	}
+	file, err := os.Open(logFilePath)
+	if err != nil {
+		result.message = err.Error()
+		result.hint = "check the path of the log file, and that it can be read by the user running go-ftw"
+		return result
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		result.message = err.Error()
+		return result
+	}
+	if !fileInfo.Mode().IsRegular() {
+		result.message = fmt.Sprintf("%s is not a regular file", logFilePath)
+		result.hint = "configure the path of the file the WAF writes its log to"
+		return result
+	}
+	doctor.logSize = fileInfo.Size()
+	doctor.logReadable = true
+	result.passed = true
+	result.message = fmt.Sprintf("%s can be read (%d bytes)", logFilePath, fileInfo.Size())
+	return result
+}
+
+// checkLogMarker sends a marker request and checks that the marker appears in the log
+func checkLogMarker(doctor *doctorContext) checkResult {
+	result := checkResult{name: "log marker"}
+	if !doctor.logReadable || !doctor.reachable {
+		result.skipped = true
+		result.message = "skipped, the destination or the log file is not available"
+		return result
+	}
+	if strategy := doctor.runnerConfig.LogCorrelation.Strategy; strategy != config.MarkerCorrelation && strategy != "" {
+		doctor.logCorrelated = true
+		result.skipped = true
+		result.message = fmt.Sprintf("skipped, log correlation strategy %q doesn't use marker requests", strategy)
+		return result
+	}
+	latency, err := runner.CheckMarker(doctor.runnerConfig, doctor.dest)
+	if err != nil {
+		result.message = err.Error()
+		result.hint = fmt.Sprintf("check that the WAF logs the '%s' header of the marker requests (%s) to %s (see 'marker_request' in the config file)",
+			doctor.runnerConfig.LogMarkerHeaderName, runner.DescribeMarkerRequest(doctor.runnerConfig, doctor.dest), doctor.runnerConfig.LogFilePath)
+		return result
+	}
+	doctor.logCorrelated = true
+	result.passed = true
+	result.message = fmt.Sprintf("found in the log after %s", latency.Round(time.Millisecond))
+	if latency > slowMarkerLatency {
+		result.message += ", the WAF may buffer its log"
+	}
+	return result
+}
+
+// checkLogGrowth checks that the log file has grown since checkLogFile, i.e., that the WAF writes to it
+func checkLogGrowth(doctor *doctorContext) checkResult {
+	result := checkResult{name: "log growth"}
+	if !doctor.logReadable || !doctor.reachable {
+		result.skipped = true
+		result.message = "skipped, the destination or the log file is not available"
+		return result
+	}
+	fileInfo, err := os.Stat(doctor.runnerConfig.LogFilePath)
+	if err != nil {
+		result.message = err.Error()
+		return result
+	}
+	if fileInfo.Size() == doctor.logSize {
+		result.message = "nothing was written to the log while sending requests"
+		result.hint = "check that the WAF writes to this file, and that it doesn't buffer its log"
+		return result
+	}
+	result.passed = true
+	result.message = fmt.Sprintf("%d bytes were written to the log", fileInfo.Size()-doctor.logSize)
+	return result
+}
+
+// checkBlockedRequest sends a known-bad request, which must be blocked
+func checkBlockedRequest(doctor *doctorContext) checkResult {
+	result := checkResult{name: "blocked request"}
+	if !doctor.reachable {
+		result.skipped = true
+		result.message = "skipped, the destination is not available"
+		return result
+	}
+	runnerConfig := *doctor.runnerConfig
+	if !doctor.logCorrelated {
+		// the log entries of the request can't be found, but the response can still be checked
+		runnerConfig.RunMode = config.CloudRunMode
+	}
+	method := "GET"
+	uri := blockedRequestURI
+	autocompleteHeaders := true
+	stage := schema.Stage{Input: schema.Input{
+		AutocompleteHeaders: &autocompleteHeaders,
+		DestAddr:            &doctor.dest.DestAddr,
+		Port:                &doctor.dest.Port,
+		Protocol:            &doctor.dest.Protocol,
+		Method:              &method,
+		URI:                 &uri,
+		OrderedHeaders: []schema.HeaderTuple{
+			{Name: "Host", Value: "localhost"},
+			{Name: "User-Agent", Value: "go-ftw doctor"},
+			{Name: "Accept", Value: "*/*"},
+		},
+	}}
+	sendResult, err := runner.Send(&runnerConfig, stage)
+	if err != nil {
+		result.message = err.Error()
+		return result
+	}
+	doctor.blockedResult = sendResult
+	if sendResult.Response == nil {
+		result.message = "no response received"
+		return result
+	}
+	status := sendResult.Response.Parsed.StatusCode
+	if status != doctor.blockedStatus {
+		result.message = fmt.Sprintf("GET %s was not blocked, status %d instead of %d", blockedRequestURI, status, doctor.blockedStatus)
+		result.hint = fmt.Sprintf("check that the WAF is in blocking mode, or use --%s if it blocks with a different status", blockedStatusFlag)
+		return result
+	}
+	result.passed = true
+	result.message = fmt.Sprintf("GET %s was blocked with status %d", blockedRequestURI, status)
+	return result
+}
+
+// checkRuleIds checks that the IDs of the rules that blocked the known-bad request are found in the log
+func checkRuleIds(doctor *doctorContext) checkResult {
+	result := checkResult{name: "rule IDs"}
+	customLogIdRegex := doctor.runnerConfig.CustomLogIdRegex
+	if customLogIdRegex != "" {
+		if err := new(waflog.FTWLogLines).WithCustomLogIdRegex(customLogIdRegex); err != nil {
+			result.message = err.Error()
+			result.hint = "fix 'custom_log_id_regex' in the config file; it needs a capture group for the rule ID"
+			return result
+		}
+	}
+	if doctor.blockedResult == nil || !doctor.logCorrelated {
+		result.skipped = true
+		result.message = "skipped, the log entries of the blocked request are not available"
+		return result
+	}
+	if len(doctor.blockedResult.TriggeredRules) == 0 {
+		result.message = fmt.Sprintf("no rule IDs found in the %d log lines of the blocked request", len(doctor.blockedResult.LogLines))
+		if len(doctor.blockedResult.LogLines) == 0 {
+			result.hint = "check that the WAF logs the rules that match a request"
+		} else if customLogIdRegex != "" {
+			result.hint = "check that 'custom_log_id_regex' matches the rule IDs in the log, e.g.: " + string(doctor.blockedResult.LogLines[0])
+		} else {
+			result.hint = "set 'custom_log_id_regex' in the config file to match the rule IDs in the log, e.g.: " + string(doctor.blockedResult.LogLines[0])
+		}
+		return result
+	}
+	ids := make([]string, 0, len(doctor.blockedResult.TriggeredRules))
+	for _, id := range doctor.blockedResult.TriggeredRules {
+		ids = append(ids, fmt.Sprint(id))
+	}
+	result.passed = true
+	result.message = "found " + strings.Join(ids, ", ")
+	return result
+}
+
+// doctorRequest builds a harmless request to uri
+func doctorRequest(uri string) *ftwhttp.Request {
+	header := ftwhttp.NewHeader()
+	header.Add("Accept", "*/*")
+	header.Add("User-Agent", "go-ftw doctor")
+	header.Add("Host", "localhost")
+	rline := &ftwhttp.RequestLine{
+		Method:  "GET",
+		URI:     uri,
+		Version: "HTTP/1.1",
+	}
+	return ftwhttp.NewRequest(rline, header, nil, true)
+}
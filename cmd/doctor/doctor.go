@@ -0,0 +1,230 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/output"
+	"github.com/coreruleset/go-ftw/v2/runner"
+)
+
+const (
+	blockedStatusFlag       = "blocked-status"
+	connectTimeoutFlag      = "connect-timeout"
+	logFileFlag             = "log-file"
+	outputFlag              = "output"
+	readTimeoutFlag         = "read-timeout"
+	resolveFlag             = "resolve"
+	skipTlsVerificationFlag = "skip-tls-verification"
+	targetFlag              = "target"
+)
+
+// checkResult is the outcome of a single diagnostic check
+type checkResult struct {
+	name    string
+	passed  bool
+	skipped bool
+	message string
+	// hint tells how to fix a failed check
+	hint string
+}
+
+// doctorContext holds what the diagnostic checks need, and what they found out for the checks after them
+type doctorContext struct {
+	runnerConfig  *config.RunnerConfig
+	dest          *ftwhttp.Destination
+	blockedStatus int
+	reachable     bool
+	logReadable   bool
+	// logCorrelated is true if the log entries of a request can be found in the log
+	logCorrelated bool
+	// logSize is the size of the log file before any request was sent
+	logSize int64
+	// blockedResult is the result of sending the known-bad request
+	blockedResult *runner.SendResult
+}
+
+// New represents the doctor command
+func New(cmdContext *internal.CommandContext) *cobra.Command {
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the test environment before a run",
+		Long: `Check that the test environment is set up correctly, using the loaded configuration.
+The destination must be reachable, the WAF must write the log markers to the log file, and it must block a known-bad request
+and log the IDs of the rules that blocked it. In cloud mode, only the destination and the blocked request are checked.
+A checklist is printed; for each failed check, a hint tells how to fix it. The command fails if any check failed.`,
+		Args: cobra.NoArgs,
+		RunE: runE(cmdContext),
+	}
+
+	doctorCmd.Flags().String(targetFlag, "", "URL of the WAF, e.g. \"https://waf.example.com:8443\", or \"unix:///run/waf.sock\" for a Unix domain socket. Defaults to the destination of the input overrides in the config file, or \"http://localhost:80\"")
+	doctorCmd.Flags().StringP(logFileFlag, "l", "", "path to log file to watch for WAF events")
+	doctorCmd.Flags().StringP(outputFlag, "o", "normal", "output type. \"normal\" is the default.")
+	doctorCmd.Flags().Int(blockedStatusFlag, 403, "status of the response of the WAF to a blocked request")
+	doctorCmd.Flags().Duration(connectTimeoutFlag, 3*time.Second, "timeout for connecting to the WAF")
+	doctorCmd.Flags().Duration(readTimeoutFlag, 10*time.Second, "timeout for receiving responses")
+	doctorCmd.Flags().StringArray(resolveFlag, nil, "connect to address instead of host and port, in the form \"host:port:address\" like curl. Can be repeated; adds to the 'resolve' option in the config file")
+	doctorCmd.Flags().Bool(skipTlsVerificationFlag, false, "Skips TLS certificate checks. Useful for testing domains with self-signed TLS ceritificates.")
+
+	return doctorCmd
+}
+
+func runE(cmdContext *internal.CommandContext) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		doctor, err := buildDoctorContext(cmd, cmdContext)
+		if err != nil {
+			return err
+		}
+		outputType, err := cmd.Flags().GetString(outputFlag)
+		if err != nil {
+			return err
+		}
+		out := output.NewOutput(outputType, cmd.OutOrStdout())
+
+		failed := 0
+		for _, check := range checks(doctor) {
+			result := check(doctor)
+			printCheckResult(out, result)
+			if !result.passed && !result.skipped {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	}
+}
+
+// checks returns the checks that apply to the run mode, in the order they must be run
+func checks(doctor *doctorContext) []func(*doctorContext) checkResult {
+	if doctor.runnerConfig.RunMode == config.CloudRunMode {
+		return []func(*doctorContext) checkResult{checkDestination, checkBlockedRequest}
+	}
+	return []func(*doctorContext) checkResult{
+		checkDestination,
+		checkLogFile,
+		checkLogMarker,
+		checkBlockedRequest,
+		checkLogGrowth,
+		checkRuleIds,
+	}
+}
+
+func buildDoctorContext(cmd *cobra.Command, cmdContext *internal.CommandContext) (*doctorContext, error) {
+	runnerConfig := config.NewRunnerConfiguration(cmdContext.Configuration)
+	var err error
+	runnerConfig.ConnectTimeout, err = cmd.Flags().GetDuration(connectTimeoutFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.ReadTimeout, err = cmd.Flags().GetDuration(readTimeoutFlag)
+	if err != nil {
+		return nil, err
+	}
+	skipTlsVerification, err := cmd.Flags().GetBool(skipTlsVerificationFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.SkipTlsVerification = runnerConfig.SkipTlsVerification || skipTlsVerification
+	resolve, err := cmd.Flags().GetStringArray(resolveFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.Resolve = append(slices.Clone(runnerConfig.Resolve), resolve...)
+	logFilePath, err := cmd.Flags().GetString(logFileFlag)
+	if err != nil {
+		return nil, err
+	}
+	if logFilePath != "" {
+		runnerConfig.LogFilePath = filepath.Clean(logFilePath)
+	}
+	if cmdContext.CloudMode {
+		runnerConfig.RunMode = config.CloudRunMode
+	}
+
+	target, err := cmd.Flags().GetString(targetFlag)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := buildDestination(target, runnerConfig.TestOverride.Overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedStatus, err := cmd.Flags().GetInt(blockedStatusFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &doctorContext{runnerConfig: runnerConfig, dest: dest, blockedStatus: blockedStatus}, nil
+}
+
+// buildDestination returns the destination of target, or of the input overrides if target is empty
+func buildDestination(target string, overrides config.Overrides) (*ftwhttp.Destination, error) {
+	if target == "" {
+		dest := &ftwhttp.Destination{DestAddr: "localhost", Port: 80, Protocol: "http"}
+		if overrides.Protocol != nil {
+			dest.Protocol = *overrides.Protocol
+			if dest.Protocol == "https" {
+				dest.Port = 443
+			}
+		}
+		if overrides.DestAddr != nil {
+			dest.DestAddr = *overrides.DestAddr
+		}
+		if overrides.Port != nil {
+			dest.Port = *overrides.Port
+		}
+		return dest, nil
+	}
+
+	targetUrl, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", targetFlag, err)
+	}
+	if targetUrl.Scheme == ftwhttp.UnixProtocol && targetUrl.Host+targetUrl.Path != "" {
+		return &ftwhttp.Destination{DestAddr: targetUrl.Host + targetUrl.Path, Protocol: ftwhttp.UnixProtocol}, nil
+	}
+	if (targetUrl.Scheme != "http" && targetUrl.Scheme != "https") || targetUrl.Hostname() == "" {
+		return nil, fmt.Errorf("invalid --%s %q: expected a URL like \"http://localhost:80\" or \"unix:///run/waf.sock\"", targetFlag, target)
+	}
+	dest := &ftwhttp.Destination{DestAddr: targetUrl.Hostname(), Port: 80, Protocol: targetUrl.Scheme}
+	if dest.Protocol == "https" {
+		dest.Port = 443
+	}
+	if targetUrl.Port() != "" {
+		if dest.Port, err = strconv.Atoi(targetUrl.Port()); err != nil {
+			return nil, fmt.Errorf("invalid --%s %q: %w", targetFlag, target, err)
+		}
+	}
+	return dest, nil
+}
+
+func printCheckResult(out *output.Output, result checkResult) {
+	if result.skipped {
+		_ = out.Println(out.Message("~ %s: %s"), result.name, result.message)
+		return
+	}
+	if result.passed {
+		_ = out.Println(out.Message("+ %s: %s"), result.name, result.message)
+		return
+	}
+	_ = out.Println(out.Message("- %s: %s"), result.name, result.message)
+	if result.hint != "" {
+		_ = out.Println("  hint: %s", result.hint)
+	}
+}
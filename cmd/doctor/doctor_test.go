@@ -0,0 +1,211 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+const doctorRuleLogLine = `[client 127.0.0.1] ModSecurity: Access denied with code 403 (phase 2). [id "941100"] [msg "XSS Attack Detected via libinjection"]`
+
+type doctorCmdTestSuite struct {
+	suite.Suite
+	logFilePath string
+	cmd         *cobra.Command
+	cmdContext  *internal.CommandContext
+	server      *httptest.Server
+	// logMarkers determines whether the server emulates the log marker rule
+	logMarkers bool
+	// block determines whether the server emulates a WAF in blocking mode
+	block bool
+	// ruleLogLine is logged for blocked requests
+	ruleLogLine string
+}
+
+func TestDoctorCmdTestSuite(t *testing.T) {
+	suite.Run(t, new(doctorCmdTestSuite))
+}
+
+func (s *doctorCmdTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *doctorCmdTestSuite) SetupTest() {
+	s.logFilePath = filepath.Join(s.T().TempDir(), "waf.log")
+	s.Require().NoError(os.WriteFile(s.logFilePath, nil, 0644))
+	s.logMarkers = true
+	s.block = true
+	s.ruleLogLine = doctorRuleLogLine
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if marker := r.Header.Get(config.DefaultLogMarkerHeaderName); marker != "" {
+			if s.logMarkers {
+				s.writeLog(fmt.Sprintf("%s: %s", config.DefaultLogMarkerHeaderName, marker))
+			}
+		} else if strings.Contains(r.URL.Query().Get("q"), "<script>") {
+			s.writeLog(s.ruleLogLine)
+			if s.block {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	s.cmdContext = internal.NewCommandContext()
+	s.cmdContext.Configuration.MaxMarkerRetries = 2
+	s.cmd = New(s.cmdContext)
+}
+
+func (s *doctorCmdTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *doctorCmdTestSuite) writeLog(line string) {
+	f, err := os.OpenFile(s.logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	s.Require().NoError(err)
+	defer f.Close()
+	_, err = f.WriteString(line + "\n")
+	s.Require().NoError(err)
+}
+
+func (s *doctorCmdTestSuite) execute(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	s.cmd.SetOut(out)
+	s.cmd.SetArgs(append([]string{"--target", s.server.URL, "--output", "plain"}, args...))
+	err := s.cmd.Execute()
+	return out.String(), err
+}
+
+func (s *doctorCmdTestSuite) TestAllChecksPass() {
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.Require().NoError(err, out)
+	s.Contains(out, "+ destination: "+s.server.URL+" responded with status 200\n")
+	s.Contains(out, "+ log file: "+s.logFilePath+" can be read (0 bytes)\n")
+	s.Contains(out, "+ log marker: found in the log after")
+	s.Contains(out, "+ blocked request: GET /?q=%3Cscript%3Ealert(1)%3C/script%3E was blocked with status 403\n")
+	s.Contains(out, "+ log growth: ")
+	s.Contains(out, "+ rule IDs: found 941100\n")
+	s.NotContains(out, "hint:")
+}
+
+func (s *doctorCmdTestSuite) TestLogMarkerNotFound() {
+	s.logMarkers = false
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.EqualError(err, "1 check(s) failed")
+	s.Contains(out, "- log marker: can't find log marker")
+	s.Contains(out, "hint: check that the WAF logs the 'X-CRS-Test' header of the marker requests (GET /status/200 HTTP/1.1 to "+s.server.URL+")")
+	s.Contains(out, "+ blocked request: ", "the response must still be checked")
+	s.Contains(out, "+ log growth: ")
+	s.Contains(out, "~ rule IDs: skipped")
+}
+
+func (s *doctorCmdTestSuite) TestLogMarkerNotFoundConfiguredRequest() {
+	s.logMarkers = false
+	// the method and version are not configured, the defaults are sent
+	s.cmdContext.Configuration.MarkerRequest = config.MarkerRequest{URI: "/marker", DestAddr: "127.0.0.1"}
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.EqualError(err, "1 check(s) failed")
+	s.Contains(out, "(GET /marker HTTP/1.1 to http://127.0.0.1:")
+}
+
+func (s *doctorCmdTestSuite) TestNotBlocked() {
+	s.block = false
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.EqualError(err, "1 check(s) failed")
+	s.Contains(out, "- blocked request: GET /?q=%3Cscript%3Ealert(1)%3C/script%3E was not blocked, status 200 instead of 403\n")
+	s.Contains(out, "hint: check that the WAF is in blocking mode")
+}
+
+func (s *doctorCmdTestSuite) TestBlockedStatus() {
+	_, err := s.execute("--log-file", s.logFilePath, "--blocked-status", "406")
+	s.EqualError(err, "1 check(s) failed")
+}
+
+func (s *doctorCmdTestSuite) TestRuleIdsNotFound() {
+	s.ruleLogLine = "ModSecurity: Access denied, rule=941100"
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.EqualError(err, "1 check(s) failed")
+	s.Contains(out, "- rule IDs: no rule IDs found in the 1 log lines of the blocked request\n")
+	s.Contains(out, "hint: set 'custom_log_id_regex' in the config file to match the rule IDs in the log, e.g.: "+s.ruleLogLine)
+}
+
+func (s *doctorCmdTestSuite) TestCustomLogIdRegex() {
+	s.ruleLogLine = "ModSecurity: Access denied, rule=941100"
+	s.cmdContext.Configuration.CustomLogIdRegex = `rule=(\d+)`
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.Require().NoError(err, out)
+	s.Contains(out, "+ rule IDs: found 941100\n")
+}
+
+func (s *doctorCmdTestSuite) TestInvalidCustomLogIdRegex() {
+	s.cmdContext.Configuration.CustomLogIdRegex = `rule=\d+`
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.Require().Error(err)
+	s.Contains(out, "- rule IDs: custom log id regex: regex does not contain a capture group")
+}
+
+func (s *doctorCmdTestSuite) TestNoLogFile() {
+	out, err := s.execute()
+	s.EqualError(err, "1 check(s) failed")
+	s.Contains(out, "- log file: no log file configured\n")
+	s.Contains(out, "~ log marker: skipped")
+	s.Contains(out, "+ blocked request: ")
+}
+
+func (s *doctorCmdTestSuite) TestDestinationNotReachable() {
+	s.server.Close()
+	out, err := s.execute("--log-file", s.logFilePath)
+	s.EqualError(err, "1 check(s) failed")
+	s.Contains(out, "- destination: can't connect to "+s.server.URL)
+	s.Contains(out, "~ log marker: skipped")
+	s.Contains(out, "~ blocked request: skipped")
+}
+
+func (s *doctorCmdTestSuite) TestCloudMode() {
+	s.cmdContext.CloudMode = true
+	out, err := s.execute()
+	s.Require().NoError(err, out)
+	s.Contains(out, "+ destination: ")
+	s.Contains(out, "+ blocked request: ")
+	s.NotContains(out, "log file")
+}
+
+func (s *doctorCmdTestSuite) TestBuildDestination() {
+	dest, err := buildDestination("https://waf.example.com", config.Overrides{})
+	s.Require().NoError(err)
+	s.Equal("waf.example.com", dest.DestAddr)
+	s.Equal(443, dest.Port)
+	s.Equal("https", dest.Protocol)
+
+	addr := "override.example.com"
+	port := 8080
+	dest, err = buildDestination("", config.Overrides{DestAddr: &addr, Port: &port})
+	s.Require().NoError(err)
+	s.Equal("override.example.com", dest.DestAddr)
+	s.Equal(8080, dest.Port)
+	s.Equal("http", dest.Protocol)
+
+	dest, err = buildDestination("unix:///run/waf.sock", config.Overrides{})
+	s.Require().NoError(err)
+	s.Equal("/run/waf.sock", dest.DestAddr)
+	s.Equal("unix", dest.Protocol)
+
+	_, err = buildDestination("ftp://waf.example.com", config.Overrides{})
+	s.ErrorContains(err, "invalid --target")
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/filter"
+	"github.com/coreruleset/go-ftw/v2/internal/inventory"
+	"github.com/coreruleset/go-ftw/v2/runner"
+	"github.com/coreruleset/go-ftw/v2/test"
+)
+
+const (
+	dirFlag         = "dir"
+	excludeFlag     = "exclude"
+	filterFlag      = "filter"
+	globFlag        = "glob"
+	includeFlag     = "include"
+	includeTagsFlag = "include-tags"
+	outputFlag      = "output"
+	viewFlag        = "view"
+)
+
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+)
+
+const (
+	testsView      = "tests"
+	rulesView      = "rules"
+	noNegativeView = "no-negative"
+	deprecatedView = "deprecated"
+)
+
+// New represents the list command
+func New(cmdContext *internal.CommandContext) *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tests in a directory",
+		Long: `List the tests found below a directory, without running them. Tests are selected in the same way as by the run command.
+Views:
+  tests        one line per test (default)
+  rules        number of tests per rule, and how many of them are positive and negative tests
+  no-negative  rules without negative tests, i.e. tests expecting the rule not to be triggered
+  deprecated   tests using deprecated fields`,
+		Args: cobra.NoArgs,
+		RunE: runE(cmdContext),
+	}
+
+	listCmd.Flags().StringP(dirFlag, "d", ".", "recursively find yaml tests in this directory")
+	listCmd.Flags().StringP(globFlag, "g", "*.y*ml", "override the filename glob pattern for matching test files")
+	listCmd.Flags().StringP(excludeFlag, "e", "", "exclude tests matching this Go regular expression (e.g. to exclude all tests beginning with \"91\", use \"^91.*\").")
+	listCmd.Flags().StringP(includeFlag, "i", "", "include only tests matching this Go regular expression (e.g. to include only tests beginning with \"91\", use \"^91.*\").")
+	listCmd.Flags().StringP(includeTagsFlag, "T", "", "include tests tagged with labels matching this Go regular expression (e.g. to include all tests being tagged with \"cookie\", use \"^cookie$\").")
+	listCmd.Flags().StringP(filterFlag, "F", "", "include only tests matching this filter expression over tags, IDs, file paths and metadata (e.g. 'pl<=2 && !slow && (sqli || xss)').")
+	listCmd.Flags().StringP(outputFlag, "o", tableOutput, fmt.Sprintf("output format, either %q or %q", tableOutput, jsonOutput))
+	listCmd.Flags().String(viewFlag, testsView, fmt.Sprintf("what to list, one of %q, %q, %q or %q", testsView, rulesView, noNegativeView, deprecatedView))
+
+	return listCmd
+}
+
+func runE(cmdContext *internal.CommandContext) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		outputFormat, err := cmd.Flags().GetString(outputFlag)
+		if err != nil {
+			return err
+		}
+		if outputFormat != tableOutput && outputFormat != jsonOutput {
+			return fmt.Errorf("invalid --%s %q, must be %q or %q", outputFlag, outputFormat, tableOutput, jsonOutput)
+		}
+		view, err := cmd.Flags().GetString(viewFlag)
+		if err != nil {
+			return err
+		}
+		runnerConfig, err := buildRunnerConfig(cmd, cmdContext)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		tests, err := loadTests(cmd)
+		if err != nil {
+			return err
+		}
+		inv := inventory.New(tests, func(ftwTest *test.FTWTest, testCase *schema.Test) bool {
+			skip, _ := runner.NeedToSkipTest(runnerConfig, ftwTest, testCase)
+			return !skip
+		})
+
+		w := cmd.OutOrStdout()
+		switch view {
+		case testsView:
+			return printEntries(w, outputFormat, inv.Tests, printTests)
+		case rulesView:
+			return printEntries(w, outputFormat, inv.Rules(), printRules)
+		case noNegativeView:
+			return printEntries(w, outputFormat, inv.RulesWithoutNegativeTests(), printRules)
+		case deprecatedView:
+			return printEntries(w, outputFormat, inv.Deprecated(), printDeprecated)
+		default:
+			return fmt.Errorf("invalid --%s %q, must be one of %q, %q, %q or %q", viewFlag, view, testsView, rulesView, noNegativeView, deprecatedView)
+		}
+	}
+}
+
+func buildRunnerConfig(cmd *cobra.Command, cmdContext *internal.CommandContext) (*config.RunnerConfig, error) {
+	exclude, err := cmd.Flags().GetString(excludeFlag)
+	if err != nil {
+		return nil, err
+	}
+	include, err := cmd.Flags().GetString(includeFlag)
+	if err != nil {
+		return nil, err
+	}
+	includeTags, err := cmd.Flags().GetString(includeTagsFlag)
+	if err != nil {
+		return nil, err
+	}
+	filterExpression, err := cmd.Flags().GetString(filterFlag)
+	if err != nil {
+		return nil, err
+	}
+	if exclude != "" && include != "" {
+		return nil, fmt.Errorf("inlusion *and* exclusion specified. You need to choose either --%s (%s) or --%s (%s)", includeFlag, include, excludeFlag, exclude)
+	}
+
+	runnerConfig := config.NewRunnerConfiguration(cmdContext.Configuration)
+	if include != "" {
+		if runnerConfig.Include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid --%s regular expression: %w", includeFlag, err)
+		}
+	}
+	if exclude != "" {
+		if runnerConfig.Exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid --%s regular expression: %w", excludeFlag, err)
+		}
+	}
+	if includeTags != "" {
+		if runnerConfig.IncludeTags, err = regexp.Compile(includeTags); err != nil {
+			return nil, fmt.Errorf("invalid --%s regular expression: %w", includeTagsFlag, err)
+		}
+	}
+	if filterExpression != "" {
+		if runnerConfig.Filter, err = filter.Parse(filterExpression); err != nil {
+			return nil, fmt.Errorf("invalid --%s expression: %w", filterFlag, err)
+		}
+	}
+	return runnerConfig, nil
+}
+
+func loadTests(cmd *cobra.Command) ([]*test.FTWTest, error) {
+	dir, err := cmd.Flags().GetString(dirFlag)
+	if err != nil {
+		return nil, err
+	}
+	filenameGlob, err := cmd.Flags().GetString(globFlag)
+	if err != nil {
+		return nil, err
+	}
+	return test.GetTestsFromFiles(fmt.Sprintf("%s/**/%s", dir, filenameGlob))
+}
+
+func printEntries[T any](w io.Writer, outputFormat string, entries []T, printTable func(tw *tabwriter.Writer, entries []T)) error {
+	if outputFormat == jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	printTable(tw, entries)
+	return tw.Flush()
+}
+
+func printTests(tw *tabwriter.Writer, entries []*inventory.TestEntry) {
+	_, _ = fmt.Fprintln(tw, "RULE\tTEST\tSTAGES\tSTATUS\tEXPECT IDS\tNO EXPECT IDS\tTAGS\tFILE")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			entry.RuleId, entry.TestId, entry.Stages, join(entry.ExpectedStatus), join(entry.ExpectIds),
+			join(entry.NoExpectIds), join(entry.Tags), entry.File)
+	}
+	_, _ = fmt.Fprintf(tw, "\n%d tests\n", len(entries))
+}
+
+func printRules(tw *tabwriter.Writer, entries []*inventory.RuleEntry) {
+	_, _ = fmt.Fprintln(tw, "RULE\tTESTS\tPOSITIVE\tNEGATIVE\tFILES")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\n",
+			entry.RuleId, entry.Tests, entry.PositiveTests, entry.NegativeTests, join(entry.Files))
+	}
+	_, _ = fmt.Fprintf(tw, "\n%d rules\n", len(entries))
+}
+
+func printDeprecated(tw *tabwriter.Writer, entries []*inventory.TestEntry) {
+	_, _ = fmt.Fprintln(tw, "RULE\tTEST\tDEPRECATED FIELDS\tFILE")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", entry.RuleId, entry.TestId, join(entry.DeprecatedFields), entry.File)
+	}
+	_, _ = fmt.Fprintf(tw, "\n%d tests\n", len(entries))
+}
+
+// join formats a list of values for a table cell
+func join[T any](values []T) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	formatted := make([]string, 0, len(values))
+	for _, value := range values {
+		formatted = append(formatted, fmt.Sprint(value))
+	}
+	return strings.Join(formatted, ",")
+}
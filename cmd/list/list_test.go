@@ -0,0 +1,172 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/internal/inventory"
+)
+
+var listFileContents = `---
+meta:
+  author: "go-ftw"
+rule_id: 920100
+tests:
+  - test_id: 1
+    tags:
+      - slow
+    stages:
+      - input:
+          headers:
+            Host: "localhost"
+        output:
+          status: 403
+          log:
+            expect_ids: [920100]
+  - test_id: 2
+    stages:
+      - input:
+          ordered_headers:
+            - name: Host
+              value: localhost
+        output:
+          log:
+            no_expect_ids: [920100]
+`
+
+var otherListFileContents = `---
+meta:
+  author: "go-ftw"
+rule_id: 930110
+tests:
+  - test_id: 1
+    stages:
+      - input:
+          ordered_headers:
+            - name: Host
+              value: localhost
+        output:
+          log:
+            expect_ids: [930110]
+`
+
+type listCmdTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+func TestListCmdTestSuite(t *testing.T) {
+	suite.Run(t, new(listCmdTestSuite))
+}
+
+func (s *listCmdTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *listCmdTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, "920100.yaml"), []byte(listFileContents), 0644))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, "930110.yaml"), []byte(otherListFileContents), 0644))
+}
+
+func (s *listCmdTestSuite) execute(args ...string) (string, error) {
+	// flag values persist between executions, so every execution needs a new command
+	cmd := New(internal.NewCommandContext())
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs(append([]string{"-d", s.tempDir}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func (s *listCmdTestSuite) TestListTests() {
+	out, err := s.execute()
+	s.Require().NoError(err)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	s.Require().Len(lines, 6)
+	s.Equal([]string{"RULE", "TEST", "STAGES", "STATUS", "EXPECT", "IDS", "NO", "EXPECT", "IDS", "TAGS", "FILE"}, strings.Fields(lines[0]))
+	s.Equal([]string{"920100", "1", "1", "403", "920100", "-", "slow", filepath.Join(s.tempDir, "920100.yaml")}, strings.Fields(lines[1]))
+	s.Equal([]string{"920100", "2", "1", "0", "-", "920100", "-", filepath.Join(s.tempDir, "920100.yaml")}, strings.Fields(lines[2]))
+	s.Equal("930110", strings.Fields(lines[3])[0])
+	s.Equal("3 tests", lines[5])
+}
+
+func (s *listCmdTestSuite) TestListTestsJson() {
+	out, err := s.execute("-o", "json", "-i", "^920100-")
+	s.Require().NoError(err)
+
+	var entries []*inventory.TestEntry
+	s.Require().NoError(json.Unmarshal([]byte(out), &entries))
+	s.Require().Len(entries, 2)
+	s.Equal(uint(920100), entries[0].RuleId)
+	s.Equal([]string{"input.headers"}, entries[0].DeprecatedFields)
+	s.True(entries[1].Negative)
+}
+
+func (s *listCmdTestSuite) TestListRules() {
+	out, err := s.execute("--view", "rules", "-o", "json")
+	s.Require().NoError(err)
+
+	var entries []*inventory.RuleEntry
+	s.Require().NoError(json.Unmarshal([]byte(out), &entries))
+	s.Require().Len(entries, 2)
+	s.Equal(&inventory.RuleEntry{
+		RuleId:        920100,
+		Tests:         2,
+		PositiveTests: 1,
+		NegativeTests: 1,
+		Files:         []string{filepath.Join(s.tempDir, "920100.yaml")},
+	}, entries[0])
+}
+
+func (s *listCmdTestSuite) TestListRulesWithoutNegativeTests() {
+	out, err := s.execute("--view", "no-negative")
+	s.Require().NoError(err)
+	s.Contains(out, "930110")
+	s.NotContains(out, "920100")
+	s.Contains(out, "1 rules")
+}
+
+func (s *listCmdTestSuite) TestListDeprecated() {
+	out, err := s.execute("--view", "deprecated")
+	s.Require().NoError(err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	s.Require().Len(lines, 4)
+	s.Equal([]string{"920100", "1", "input.headers", filepath.Join(s.tempDir, "920100.yaml")}, strings.Fields(lines[1]))
+}
+
+func (s *listCmdTestSuite) TestListSelection() {
+	out, err := s.execute("-o", "json", "-F", "!slow")
+	s.Require().NoError(err)
+	var entries []*inventory.TestEntry
+	s.Require().NoError(json.Unmarshal([]byte(out), &entries))
+	s.Len(entries, 2)
+
+	out, err = s.execute("-o", "json", "-T", "^slow$")
+	s.Require().NoError(err)
+	s.Require().NoError(json.Unmarshal([]byte(out), &entries))
+	s.Len(entries, 1)
+}
+
+func (s *listCmdTestSuite) TestListInvalidFlags() {
+	_, err := s.execute("-o", "yaml")
+	s.ErrorContains(err, `invalid --output "yaml"`)
+
+	_, err = s.execute("--view", "all")
+	s.ErrorContains(err, `invalid --view "all"`)
+
+	_, err = s.execute("-i", "1", "-e", "2")
+	s.ErrorContains(err, "inlusion *and* exclusion specified")
+}
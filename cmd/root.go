@@ -11,10 +11,14 @@ import (
 	"github.com/spf13/cobra"
 
 	check "github.com/coreruleset/go-ftw/v2/cmd/check"
+	coverage "github.com/coreruleset/go-ftw/v2/cmd/coverage"
+	doctor "github.com/coreruleset/go-ftw/v2/cmd/doctor"
 	internal "github.com/coreruleset/go-ftw/v2/cmd/internal"
+	list "github.com/coreruleset/go-ftw/v2/cmd/list"
 	quantitative "github.com/coreruleset/go-ftw/v2/cmd/quantitative"
 	run "github.com/coreruleset/go-ftw/v2/cmd/run"
 	selfUpdate "github.com/coreruleset/go-ftw/v2/cmd/self_update"
+	send "github.com/coreruleset/go-ftw/v2/cmd/send"
 	"github.com/coreruleset/go-ftw/v2/config"
 )
 
@@ -56,8 +60,12 @@ func Execute(version string) error {
 	rootCmd := NewRootCommand(cmdContext)
 	rootCmd.AddCommand(
 		check.New(cmdContext),
+		coverage.New(cmdContext),
+		doctor.New(cmdContext),
+		list.New(cmdContext),
 		run.New(cmdContext),
 		quantitative.New(cmdContext),
+		send.New(cmdContext),
 		selfUpdate.New(cmdContext))
 	// Setting Version creates a `--version` flag
 	rootCmd.Version = version
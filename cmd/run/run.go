@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"time"
 
 	"github.com/go-logr/zerologr"
@@ -20,6 +21,7 @@ import (
 
 	"github.com/coreruleset/go-ftw/v2/cmd/internal"
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/filter"
 	"github.com/coreruleset/go-ftw/v2/output"
 	"github.com/coreruleset/go-ftw/v2/runner"
 	"github.com/coreruleset/go-ftw/v2/test"
@@ -28,17 +30,23 @@ import (
 const (
 	connectTimeoutFlag           = "connect-timeout"
 	dirFlag                      = "dir"
+	dryRunFlag                   = "dry-run"
+	dryRunDirFlag                = "dry-run-dir"
 	globFlag                     = "glob"
 	excludeFlag                  = "exclude"
 	failFastFlag                 = "fail-fast"
 	fileFlag                     = "file"
+	filterFlag                   = "filter"
 	includeFlag                  = "include"
 	includeTagsFlag              = "include-tags"
 	logFileFlag                  = "log-file"
 	maxMarkerRetriesFlag         = "max-marker-retries"
 	maxMarkerLogLinesFlag        = "max-marker-log-lines"
+	logBacklogLinesFlag          = "log-backlog-lines"
 	outputFlag                   = "output"
+	protocolFlag                 = "protocol"
 	readTimeoutFlag              = "read-timeout"
+	resolveFlag                  = "resolve"
 	rateLimitFlag                = "rate-limit"
 	showFailuresOnlyFlag         = "show-failures-only"
 	storeFailureWafLogsFlag      = "store-failure-waf-logs"
@@ -57,6 +65,12 @@ const (
 	waitForNoRedirectFlag        = "wait-for-no-redirect"
 	waitForTimeoutFlag           = "wait-for-timeout"
 	reportTriggeredRulesFlag     = "report-triggered-rules"
+	shuffleFlag                  = "shuffle"
+	seedFlag                     = "seed"
+	captureDirFlag               = "capture-dir"
+	captureFormatFlag            = "capture-format"
+	captureAllStagesFlag         = "capture-all-stages"
+	artifactsDirFlag             = "artifacts-dir"
 )
 
 const defaultFailureWafLogsName = "go-ftw-failure-waf-logs.log"
@@ -73,6 +87,7 @@ func New(cmdContext *internal.CommandContext) *cobra.Command {
 	runCmd.Flags().StringP(excludeFlag, "e", "", "exclude tests matching this Go regular expression (e.g. to exclude all tests beginning with \"91\", use \"^91.*\"). \nIf you want more permanent exclusion, check the 'exclude' option in the config file.")
 	runCmd.Flags().StringP(includeFlag, "i", "", "include only tests matching this Go regular expression (e.g. to include only tests beginning with \"91\", use \"^91.*\"). \nIf you want more permanent inclusion, check the 'include' option in the config file.")
 	runCmd.Flags().StringP(includeTagsFlag, "T", "", "include tests tagged with labels matching this Go regular expression (e.g. to include all tests being tagged with \"cookie\", use \"^cookie$\").")
+	runCmd.Flags().StringP(filterFlag, "F", "", "include only tests matching this filter expression over tags, IDs, file paths and metadata (e.g. 'pl<=2 && !slow && (sqli || xss)').\nApplies in addition to the other selections. If you want a more permanent filter, check the 'filter' option in the config file.")
 	runCmd.Flags().StringP(dirFlag, "d", ".", "recursively find yaml tests in this directory")
 	runCmd.Flags().StringP(globFlag, "g", "*.y*ml", "override the filename glob pattern for matching test files")
 	runCmd.Flags().StringP(outputFlag, "o", "normal", "output type for ftw tests. \"normal\" is the default.")
@@ -87,6 +102,10 @@ func New(cmdContext *internal.CommandContext) *cobra.Command {
 	runCmd.Flags().Duration(readTimeoutFlag, 10*time.Second, "timeout for receiving responses during test execution")
 	runCmd.Flags().Uint(maxMarkerRetriesFlag, 20, "maximum number of times the search for log markers will be repeated.\nEach time an additional request is sent to the web server, eventually forcing the log to be flushed")
 	runCmd.Flags().Uint(maxMarkerLogLinesFlag, 500, "maximum number of lines to search for a marker before aborting")
+	_ = runCmd.Flags().MarkDeprecated(maxMarkerLogLinesFlag, fmt.Sprintf("it has no effect, the log file is read forwards and markers are found regardless of its size. Use --%s to set the number of lines read when the log file is opened", logBacklogLinesFlag))
+	runCmd.Flags().Uint(logBacklogLinesFlag, 500, "number of lines at the end of the log file to read when it is opened; afterwards, only appended lines are read")
+	runCmd.Flags().StringArray(resolveFlag, nil, "connect to address instead of host and port, in the form \"host:port:address\" like curl, e.g. \"example.com:443:127.0.0.1\".\nCan be repeated; adds to the 'resolve' option in the config file. Applies to test and marker requests")
+	runCmd.Flags().String(protocolFlag, "", "protocol of test requests, \"http1\" or \"http3\". Overrides the version of every test stage.\nBy default, stages with the version \"HTTP/3\" are sent over HTTP/3 and all others over HTTP/1")
 	runCmd.Flags().Bool(skipTlsVerificationFlag, http.DefaultInsecureSkipTLSVerify, "Skips TLS certificate checks. Useful for testing domains with self-signed TLS ceritificates.")
 	runCmd.Flags().String(waitForHostFlag, "", "Wait for host to be available before running tests.")
 	runCmd.Flags().Duration(waitDelayFlag, 1*time.Second, "Time to wait between retries for all wait operations.")
@@ -101,6 +120,14 @@ func New(cmdContext *internal.CommandContext) *cobra.Command {
 	runCmd.Flags().DurationP(rateLimitFlag, "r", 0, "Limit the request rate to the server to 1 request per specified duration. 0 is the default, and disables rate limiting.")
 	runCmd.Flags().Bool(failFastFlag, false, "Fail on first failed test")
 	runCmd.Flags().Bool(reportTriggeredRulesFlag, false, "Report triggered rules for each test")
+	runCmd.Flags().Bool(shuffleFlag, false, fmt.Sprintf("Run test files and test cases in random order. The seed is printed and stored in the results; pass it to --%s to reproduce the order", seedFlag))
+	runCmd.Flags().Bool(dryRunFlag, false, fmt.Sprintf("Build the request of every test stage and print the exact bytes that would be sent, without connecting to the WAF. Use --%s to write the requests to files instead", dryRunDirFlag))
+	runCmd.Flags().String(dryRunDirFlag, "", fmt.Sprintf("directory to write the requests built by --%s to, one file per stage. Implies --%s", dryRunFlag, dryRunFlag))
+	runCmd.Flags().String(captureDirFlag, "", fmt.Sprintf("directory to write the traffic of failed test stages to, one file per stage. See --%s and --%s", captureFormatFlag, captureAllStagesFlag))
+	runCmd.Flags().String(captureFormatFlag, string(config.PcapngCaptureFormat), fmt.Sprintf("format of the files written to --%s, \"pcapng\" or \"transcript\"", captureDirFlag))
+	runCmd.Flags().Bool(captureAllStagesFlag, false, fmt.Sprintf("write the traffic of all test stages to --%s, not only of failed ones", captureDirFlag))
+	runCmd.Flags().String(artifactsDirFlag, "", "directory to write a folder per failed test stage to, with the raw request and response, the WAF log lines, the test and a diagnosis of the failed assertion")
+	runCmd.Flags().Int64(seedFlag, 0, fmt.Sprintf("Seed for shuffling tests, as printed by a previous run with --%s. Implies --%s", shuffleFlag, shuffleFlag))
 
 	return runCmd
 }
@@ -151,6 +178,10 @@ func buildRunnerConfig(cmd *cobra.Command, cmdContext *internal.CommandContext)
 	if err != nil {
 		return nil, err
 	}
+	filterExpression, err := cmd.Flags().GetString(filterFlag)
+	if err != nil {
+		return nil, err
+	}
 	logFilePath, err := cmd.Flags().GetString(logFileFlag)
 	if err != nil {
 		return nil, err
@@ -239,7 +270,7 @@ func buildRunnerConfig(cmd *cobra.Command, cmdContext *internal.CommandContext)
 	if err != nil {
 		return nil, err
 	}
-	runnerConfig.MaxMarkerLogLines, err = cmd.Flags().GetUint(maxMarkerLogLinesFlag)
+	runnerConfig.LogBacklogLines, err = cmd.Flags().GetUint(logBacklogLinesFlag)
 	if err != nil {
 		return nil, err
 	}
@@ -251,7 +282,67 @@ func buildRunnerConfig(cmd *cobra.Command, cmdContext *internal.CommandContext)
 	if err != nil {
 		return nil, err
 	}
+	runnerConfig.Shuffle, err = cmd.Flags().GetBool(shuffleFlag)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Flags().Changed(seedFlag) {
+		seed, err := cmd.Flags().GetInt64(seedFlag)
+		if err != nil {
+			return nil, err
+		}
+		runnerConfig.Seed = &seed
+		runnerConfig.Shuffle = true
+	}
+	runnerConfig.DryRun, err = cmd.Flags().GetBool(dryRunFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.DryRunDir, err = cmd.Flags().GetString(dryRunDirFlag)
+	if err != nil {
+		return nil, err
+	}
+	if runnerConfig.DryRunDir != "" {
+		runnerConfig.DryRun = true
+	}
+	protocol, err := cmd.Flags().GetString(protocolFlag)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Protocol(protocol) {
+	case "", config.HTTP1Protocol, config.HTTP3Protocol:
+		runnerConfig.Protocol = config.Protocol(protocol)
+	default:
+		return nil, fmt.Errorf("invalid --%s %q, expected %q or %q", protocolFlag, protocol, config.HTTP1Protocol, config.HTTP3Protocol)
+	}
+	runnerConfig.CaptureDir, err = cmd.Flags().GetString(captureDirFlag)
+	if err != nil {
+		return nil, err
+	}
+	captureFormat, err := cmd.Flags().GetString(captureFormatFlag)
+	if err != nil {
+		return nil, err
+	}
+	switch config.CaptureFormat(captureFormat) {
+	case config.PcapngCaptureFormat, config.TranscriptCaptureFormat:
+		runnerConfig.CaptureFormat = config.CaptureFormat(captureFormat)
+	default:
+		return nil, fmt.Errorf("invalid --%s %q, expected %q or %q", captureFormatFlag, captureFormat, config.PcapngCaptureFormat, config.TranscriptCaptureFormat)
+	}
+	runnerConfig.CaptureAllStages, err = cmd.Flags().GetBool(captureAllStagesFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.ArtifactsDir, err = cmd.Flags().GetString(artifactsDirFlag)
+	if err != nil {
+		return nil, err
+	}
 	runnerConfig.SkipTlsVerification = skipTlsVerification
+	resolve, err := cmd.Flags().GetStringArray(resolveFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.Resolve = append(slices.Clone(runnerConfig.Resolve), resolve...)
 
 	if cmdContext.CloudMode {
 		runnerConfig.RunMode = config.CloudRunMode
@@ -293,8 +384,13 @@ func buildRunnerConfig(cmd *cobra.Command, cmdContext *internal.CommandContext)
 			return nil, fmt.Errorf("invalid --%s regular expression: %w", includeTagsFlag, err)
 		}
 	}
-	// Add wait4x checkers
-	if waitForHost != "" {
+	if filterExpression != "" {
+		if runnerConfig.Filter, err = filter.Parse(filterExpression); err != nil {
+			return nil, fmt.Errorf("invalid --%s expression: %w", filterFlag, err)
+		}
+	}
+	// Add wait4x checkers. There is nothing to wait for in a dry run, as no requests are sent.
+	if waitForHost != "" && !runnerConfig.DryRun {
 		_, err := url.Parse(waitForHost)
 		if err != nil {
 			return nil, err
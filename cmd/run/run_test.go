@@ -166,7 +166,7 @@ func (s *runCmdTestSuite) TestFlags() {
 		"--" + connectTimeoutFlag, "4s",
 		"--" + readTimeoutFlag, "5s",
 		"--" + maxMarkerRetriesFlag, "6",
-		"--" + maxMarkerLogLinesFlag, "7",
+		"--" + logBacklogLinesFlag, "7",
 		"--" + skipTlsVerificationFlag,
 		"--" + waitForHostFlag, "https://some-host.com",
 		"--" + waitDelayFlag, "9s",
@@ -215,7 +215,7 @@ func (s *runCmdTestSuite) TestFlags() {
 	s.NoError(err)
 	maxMarkerRetries, err := cmd.Flags().GetUint(maxMarkerRetriesFlag)
 	s.NoError(err)
-	maxMarkerLogLines, err := cmd.Flags().GetUint(maxMarkerLogLinesFlag)
+	logBacklogLines, err := cmd.Flags().GetUint(logBacklogLinesFlag)
 	s.NoError(err)
 	waitForInsecureSkipTlsVerify, err := cmd.Flags().GetBool(skipTlsVerificationFlag)
 	s.NoError(err)
@@ -260,7 +260,7 @@ func (s *runCmdTestSuite) TestFlags() {
 	s.Equal(4*time.Second, connectTimeout)
 	s.Equal(5*time.Second, readTimeout)
 	s.Equal(uint(6), maxMarkerRetries)
-	s.Equal(uint(7), maxMarkerLogLines)
+	s.Equal(uint(7), logBacklogLines)
 	s.Equal("https://some-host.com", waitForHost)
 	s.Equal(9*time.Second, waitDelay)
 	s.Equal(10*time.Second, waitForTimeout)
@@ -518,3 +518,157 @@ func (s *runCmdTestSuite) TestFailureWafLogsFileNameFlag() {
 	actualPath := filepath.Base(runnerConfig.FailureWafLogsFilePath)
 	s.Equal("thefile", actualPath)
 }
+
+func (s *runCmdTestSuite) TestGlobalFilterOverriddenByCmdLineFlag() {
+	configYaml := `---
+filter: 'pl <= 2 && !slow'
+`
+	configFile, err := utils.CreateTempFileWithContent(s.tempDir, configYaml, "global-config.yaml")
+	s.Require().NoError(err)
+	cfg, err := config.NewConfigFromFile(configFile)
+	s.Require().NoError(err)
+
+	s.cmdContext.Configuration = cfg
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.Require().NotNil(runnerConfig.Filter)
+	s.Equal("pl <= 2 && !slow", runnerConfig.Filter.String())
+
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + filterFlag, "sqli || xss",
+	})
+	cmd, _ = s.cmd.ExecuteC()
+
+	runnerConfig, err = buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.Require().NotNil(runnerConfig.Filter)
+	s.Equal("sqli || xss", runnerConfig.Filter.String())
+}
+
+func (s *runCmdTestSuite) TestInvalidFilter() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + filterFlag, "sqli &&",
+	})
+	_, err := s.cmd.ExecuteC()
+	s.ErrorContains(err, "invalid --filter expression")
+}
+
+func (s *runCmdTestSuite) TestDryRunDirFlagImpliesDryRun() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + dryRunDirFlag, s.tempDir,
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.True(runnerConfig.DryRun)
+	s.Equal(s.tempDir, runnerConfig.DryRunDir)
+}
+
+func (s *runCmdTestSuite) TestProtocolFlag() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + protocolFlag, "http3",
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.Equal(config.HTTP3Protocol, runnerConfig.Protocol)
+}
+
+func (s *runCmdTestSuite) TestInvalidProtocolFlag() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + protocolFlag, "http2",
+	})
+	_, err := s.cmd.ExecuteC()
+	s.ErrorContains(err, `invalid --protocol "http2", expected "http1" or "http3"`)
+}
+
+func (s *runCmdTestSuite) TestCaptureFlags() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + captureDirFlag, s.tempDir,
+		"--" + captureFormatFlag, "transcript",
+		"--" + captureAllStagesFlag,
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.Equal(s.tempDir, runnerConfig.CaptureDir)
+	s.Equal(config.TranscriptCaptureFormat, runnerConfig.CaptureFormat)
+	s.True(runnerConfig.CaptureAllStages)
+}
+
+func (s *runCmdTestSuite) TestInvalidCaptureFormatFlag() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + captureFormatFlag, "pcap",
+	})
+	_, err := s.cmd.ExecuteC()
+	s.ErrorContains(err, `invalid --capture-format "pcap", expected "pcapng" or "transcript"`)
+}
+
+func (s *runCmdTestSuite) TestArtifactsDirFlag() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + artifactsDirFlag, s.tempDir,
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.Equal(s.tempDir, runnerConfig.ArtifactsDir)
+}
+
+func (s *runCmdTestSuite) TestLogBacklogLinesFlag() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + logBacklogLinesFlag, "42",
+		// deprecated, accepted but ignored
+		"--" + maxMarkerLogLinesFlag, "1000",
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.Equal(uint(42), runnerConfig.LogBacklogLines)
+	s.NotEmpty(cmd.Flags().Lookup(maxMarkerLogLinesFlag).Deprecated)
+}
+
+func (s *runCmdTestSuite) TestSeedFlag() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + seedFlag, "0",
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.True(runnerConfig.Shuffle)
+	s.Require().NotNil(runnerConfig.Seed, "0 is a valid seed")
+	s.Zero(*runnerConfig.Seed)
+}
+
+func (s *runCmdTestSuite) TestShuffleWithoutSeed() {
+	s.cmd.SetArgs([]string{
+		"-d", s.tempDir,
+		"--" + shuffleFlag,
+	})
+	cmd, _ := s.cmd.ExecuteC()
+
+	runnerConfig, err := buildRunnerConfig(cmd, s.cmdContext)
+	s.Require().NoError(err)
+	s.True(runnerConfig.Shuffle)
+	s.Nil(runnerConfig.Seed)
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/runner"
+)
+
+const (
+	autocompleteHeadersFlag = "autocomplete-headers"
+	connectTimeoutFlag      = "connect-timeout"
+	dataFlag                = "data"
+	headerFlag              = "header"
+	httpVersionFlag         = "http-version"
+	logFileFlag             = "log-file"
+	methodFlag              = "method"
+	rawFlag                 = "raw"
+	readTimeoutFlag         = "read-timeout"
+	resolveFlag             = "resolve"
+	skipTlsVerificationFlag = "skip-tls-verification"
+	targetFlag              = "target"
+	uriFlag                 = "uri"
+)
+
+// New represents the send command
+func New(cmdContext *internal.CommandContext) *cobra.Command {
+	sendCmd := &cobra.Command{
+		Use:   "send",
+		Short: "Send a single request and show the rules it triggered",
+		Long: `Send a single request to the WAF, using the same machinery as the test runner, including the log marker requests.
+The raw response is printed, followed by the IDs of the rules that were triggered and the matching log lines.
+The request is either built from the flags, or read as-is from a file (or standard input) using --raw.`,
+		Args: cobra.NoArgs,
+		RunE: runE(cmdContext),
+	}
+
+	sendCmd.Flags().String(targetFlag, "http://localhost:80", "URL of the WAF to send the request to, e.g. \"https://waf.example.com:8443\", or \"unix:///run/waf.sock\" for a Unix domain socket. Only the scheme, host and port are used")
+	sendCmd.Flags().StringP(methodFlag, "X", "GET", "HTTP method of the request")
+	sendCmd.Flags().StringP(uriFlag, "u", "/", "URI of the request, sent as-is in the request line")
+	sendCmd.Flags().String(httpVersionFlag, "HTTP/1.1", "HTTP version of the request line")
+	sendCmd.Flags().StringArrayP(headerFlag, "H", nil, "header of the request in the form \"Name: value\". Can be repeated; headers are sent in the order given.\nIf there is no \"Host\" header, one is added with the host of the target")
+	sendCmd.Flags().StringP(dataFlag, "d", "", "body of the request. Like \"data\" in tests, form data is URL-encoded if necessary, unless autocomplete-headers is disabled")
+	sendCmd.Flags().Bool(autocompleteHeadersFlag, true, "add the headers go-ftw adds to test requests, such as \"Content-Length\" and \"Connection\"")
+	sendCmd.Flags().StringP(rawFlag, "r", "", "file containing the complete raw request to send; use \"-\" to read it from standard input. All other request flags are ignored")
+	sendCmd.Flags().StringP(logFileFlag, "l", "", "path to log file to watch for WAF events")
+	sendCmd.Flags().Duration(connectTimeoutFlag, 3*time.Second, "timeout for connecting to the WAF")
+	sendCmd.Flags().Duration(readTimeoutFlag, 10*time.Second, "timeout for receiving the response")
+	sendCmd.Flags().StringArray(resolveFlag, nil, "connect to address instead of host and port, in the form \"host:port:address\" like curl. Can be repeated; adds to the 'resolve' option in the config file")
+	sendCmd.Flags().Bool(skipTlsVerificationFlag, false, "Skips TLS certificate checks. Useful for testing domains with self-signed TLS ceritificates.")
+
+	return sendCmd
+}
+
+func runE(cmdContext *internal.CommandContext) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		runnerConfig, err := buildRunnerConfig(cmd, cmdContext)
+		if err != nil {
+			return err
+		}
+		stage, err := buildStage(cmd)
+		if err != nil {
+			return err
+		}
+
+		result, err := runner.Send(runnerConfig, *stage)
+		if err != nil {
+			return err
+		}
+
+		printResult(cmd.OutOrStdout(), result, runnerConfig.RunMode == config.CloudRunMode)
+		return nil
+	}
+}
+
+func buildRunnerConfig(cmd *cobra.Command, cmdContext *internal.CommandContext) (*config.RunnerConfig, error) {
+	runnerConfig := config.NewRunnerConfiguration(cmdContext.Configuration)
+	// Test overrides are meant for test files. Applying them here could silently
+	// change the destination or the contents of the request.
+	runnerConfig.TestOverride = config.FTWTestOverride{}
+
+	var err error
+	runnerConfig.ConnectTimeout, err = cmd.Flags().GetDuration(connectTimeoutFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.ReadTimeout, err = cmd.Flags().GetDuration(readTimeoutFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.SkipTlsVerification, err = cmd.Flags().GetBool(skipTlsVerificationFlag)
+	if err != nil {
+		return nil, err
+	}
+	resolve, err := cmd.Flags().GetStringArray(resolveFlag)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.Resolve = append(slices.Clone(runnerConfig.Resolve), resolve...)
+	logFilePath, err := cmd.Flags().GetString(logFileFlag)
+	if err != nil {
+		return nil, err
+	}
+	if logFilePath != "" {
+		runnerConfig.LogFilePath = filepath.Clean(logFilePath)
+	}
+	if cmdContext.CloudMode {
+		runnerConfig.RunMode = config.CloudRunMode
+	}
+	if runnerConfig.RunMode != config.CloudRunMode && runnerConfig.LogFilePath == "" {
+		return nil, fmt.Errorf("a log file is required for finding the triggered rules. Use --%s, the 'logfile' option in the config file, or --cloud", logFileFlag)
+	}
+
+	return runnerConfig, nil
+}
+
+//gocyclo:ignore
+func buildStage(cmd *cobra.Command) (*schema.Stage, error) {
+	target, err := cmd.Flags().GetString(targetFlag)
+	if err != nil {
+		return nil, err
+	}
+	targetUrl, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", targetFlag, err)
+	}
+	host := targetUrl.Hostname()
+	hostHeader := targetUrl.Host
+	protocol := targetUrl.Scheme
+	port := 80
+	switch {
+	case protocol == ftwhttp.UnixProtocol && targetUrl.Host+targetUrl.Path != "":
+		// the host is the path of the socket
+		host = targetUrl.Host + targetUrl.Path
+		hostHeader = "localhost"
+		port = 0
+	case (protocol != "http" && protocol != "https") || host == "":
+		return nil, fmt.Errorf("invalid --%s %q: expected a URL like \"http://localhost:80\" or \"unix:///run/waf.sock\"", targetFlag, target)
+	case protocol == "https":
+		port = 443
+	}
+	if targetUrl.Port() != "" {
+		if port, err = strconv.Atoi(targetUrl.Port()); err != nil {
+			return nil, fmt.Errorf("invalid --%s %q: %w", targetFlag, target, err)
+		}
+	}
+
+	input := schema.Input{
+		DestAddr: &host,
+		Port:     &port,
+		Protocol: &protocol,
+	}
+
+	rawFile, err := cmd.Flags().GetString(rawFlag)
+	if err != nil {
+		return nil, err
+	}
+	if rawFile != "" {
+		raw, err := readRawRequest(cmd, rawFile)
+		if err != nil {
+			return nil, err
+		}
+		input.EncodedRequest = base64.StdEncoding.EncodeToString(raw)
+		autocompleteHeaders := false
+		input.AutocompleteHeaders = &autocompleteHeaders
+		return &schema.Stage{Input: input}, nil
+	}
+
+	method, err := cmd.Flags().GetString(methodFlag)
+	if err != nil {
+		return nil, err
+	}
+	uri, err := cmd.Flags().GetString(uriFlag)
+	if err != nil {
+		return nil, err
+	}
+	version, err := cmd.Flags().GetString(httpVersionFlag)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := cmd.Flags().GetStringArray(headerFlag)
+	if err != nil {
+		return nil, err
+	}
+	data, err := cmd.Flags().GetString(dataFlag)
+	if err != nil {
+		return nil, err
+	}
+	autocompleteHeaders, err := cmd.Flags().GetBool(autocompleteHeadersFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	input.Method = &method
+	input.URI = &uri
+	input.Version = &version
+	input.AutocompleteHeaders = &autocompleteHeaders
+	input.OrderedHeaders = []schema.HeaderTuple{}
+	for _, header := range headers {
+		name, value, found := strings.Cut(header, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid --%s %q: expected \"Name: value\"", headerFlag, header)
+		}
+		input.OrderedHeaders = append(input.OrderedHeaders, schema.HeaderTuple{
+			Name:  name,
+			Value: strings.TrimLeft(value, " \t"),
+		})
+	}
+	if !slices.ContainsFunc(input.OrderedHeaders, func(h schema.HeaderTuple) bool { return strings.EqualFold(h.Name, "Host") }) {
+		input.OrderedHeaders = append([]schema.HeaderTuple{{Name: "Host", Value: hostHeader}}, input.OrderedHeaders...)
+	}
+	if data != "" {
+		// `encoded_data` is used instead of `data`, so that the body is not treated as a template
+		encodedData := base64.StdEncoding.EncodeToString([]byte(data))
+		input.EncodedData = &encodedData
+	}
+
+	return &schema.Stage{Input: input}, nil
+}
+
+func readRawRequest(cmd *cobra.Command, rawFile string) ([]byte, error) {
+	var raw []byte
+	var err error
+	if rawFile == "-" {
+		raw, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		raw, err = os.ReadFile(rawFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw request: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("the raw request is empty")
+	}
+	return raw, nil
+}
+
+func printResult(w io.Writer, result *runner.SendResult, cloudMode bool) {
+	if result.Response != nil {
+		_, _ = fmt.Fprintf(w, "%s", result.Response.RAW)
+		if !strings.HasSuffix(string(result.Response.RAW), "\n") {
+			_, _ = fmt.Fprintln(w)
+		}
+	} else {
+		_, _ = fmt.Fprintln(w, "no response received")
+	}
+	if cloudMode {
+		// without a log, rule IDs can only be found in the response, if configured
+		if len(result.TriggeredRules) > 0 {
+			_, _ = fmt.Fprintln(w)
+			printTriggeredRules(w, result.TriggeredRules)
+		}
+		return
+	}
+
+	_, _ = fmt.Fprintln(w)
+	printTriggeredRules(w, result.TriggeredRules)
+	_, _ = fmt.Fprintf(w, "log lines (%d):\n", len(result.LogLines))
+	for _, line := range result.LogLines {
+		_, _ = fmt.Fprintf(w, "%s\n", line)
+	}
+}
+
+func printTriggeredRules(w io.Writer, triggeredRules []uint) {
+	if len(triggeredRules) == 0 {
+		_, _ = fmt.Fprintln(w, "triggered rules: none")
+		return
+	}
+	ids := make([]string, 0, len(triggeredRules))
+	for _, id := range triggeredRules {
+		ids = append(ids, fmt.Sprint(id))
+	}
+	_, _ = fmt.Fprintf(w, "triggered rules: %s\n", strings.Join(ids, ", "))
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/cmd/internal"
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+var sendLogLine = `[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Matched phrase "sqlmap" at REQUEST_HEADERS:User-Agent. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-913-SCANNER-DETECTION.conf"] [line "33"] [id "913100"] [msg "Found User-Agent associated with security scanner"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]`
+
+type sendCmdTestSuite struct {
+	suite.Suite
+	tempDir     string
+	logFilePath string
+	cmd         *cobra.Command
+	cmdContext  *internal.CommandContext
+	server      *httptest.Server
+	// requests contains the requests received by the server, excluding marker requests
+	requests []*http.Request
+	mutex    sync.Mutex
+}
+
+func TestSendCmdTestSuite(t *testing.T) {
+	suite.Run(t, new(sendCmdTestSuite))
+}
+
+func (s *sendCmdTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *sendCmdTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.logFilePath = filepath.Join(s.tempDir, "waf.log")
+	s.Require().NoError(os.WriteFile(s.logFilePath, nil, 0644))
+	s.requests = nil
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// emulate the log marker rule and a rule that detects scanners
+		logLine := ""
+		if marker := r.Header.Get(config.DefaultLogMarkerHeaderName); marker != "" {
+			logLine = fmt.Sprintf("%s: %s\n", config.DefaultLogMarkerHeaderName, marker)
+		} else {
+			s.mutex.Lock()
+			s.requests = append(s.requests, r)
+			s.mutex.Unlock()
+			if strings.Contains(r.UserAgent(), "sqlmap") {
+				logLine = sendLogLine + "\n"
+			}
+		}
+		f, err := os.OpenFile(s.logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+		s.Require().NoError(err)
+		defer f.Close()
+		_, err = f.WriteString(logLine)
+		s.Require().NoError(err)
+
+		w.Header().Set("X-Test", "send")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Hello, client"))
+	}))
+
+	s.cmdContext = internal.NewCommandContext()
+	s.cmd = New(s.cmdContext)
+}
+
+func (s *sendCmdTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *sendCmdTestSuite) execute(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	s.cmd.SetOut(out)
+	s.cmd.SetArgs(append([]string{"--target", s.server.URL, "--log-file", s.logFilePath}, args...))
+	err := s.cmd.Execute()
+	return out.String(), err
+}
+
+func (s *sendCmdTestSuite) TestSendFromFlags() {
+	out, err := s.execute(
+		"-X", "POST",
+		"-u", "/post?a=b",
+		"-H", "User-Agent: sqlmap/1.0",
+		"-H", "Accept: */*",
+		"-d", "a=b",
+	)
+	s.Require().NoError(err)
+
+	s.Require().Len(s.requests, 1)
+	request := s.requests[0]
+	s.Equal("POST", request.Method)
+	s.Equal("/post?a=b", request.RequestURI)
+	s.Equal("sqlmap/1.0", request.UserAgent())
+	s.Equal(strings.TrimPrefix(s.server.URL, "http://"), request.Host)
+	s.Equal(int64(3), request.ContentLength)
+
+	s.Contains(out, "HTTP/1.1 200 OK")
+	s.Contains(out, "X-Test: send")
+	s.Contains(out, "Hello, client")
+	s.Contains(out, "triggered rules: 913100\n")
+	s.Contains(out, "log lines (1):\n"+sendLogLine+"\n")
+}
+
+func (s *sendCmdTestSuite) TestSendNoRulesTriggered() {
+	out, err := s.execute("-H", "Host: example.com")
+	s.Require().NoError(err)
+
+	s.Require().Len(s.requests, 1)
+	s.Equal("example.com", s.requests[0].Host)
+	s.Contains(out, "triggered rules: none\n")
+	s.Contains(out, "log lines (0):\n")
+}
+
+func (s *sendCmdTestSuite) TestSendRawFromStdin() {
+	s.cmd.SetIn(strings.NewReader("GET /raw HTTP/1.1\r\nHost: localhost\r\nUser-Agent: sqlmap\r\nConnection: close\r\n\r\n"))
+	out, err := s.execute("--raw", "-", "-X", "PUT")
+	s.Require().NoError(err)
+
+	s.Require().Len(s.requests, 1)
+	s.Equal("GET", s.requests[0].Method, "flags for building requests must be ignored for raw requests")
+	s.Equal("/raw", s.requests[0].RequestURI)
+	s.Contains(out, "triggered rules: 913100\n")
+}
+
+func (s *sendCmdTestSuite) TestSendRawFromFile() {
+	rawFile := filepath.Join(s.tempDir, "request.txt")
+	s.Require().NoError(os.WriteFile(rawFile, []byte("GET /file HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"), 0644))
+
+	_, err := s.execute("--raw", rawFile)
+	s.Require().NoError(err)
+	s.Require().Len(s.requests, 1)
+	s.Equal("/file", s.requests[0].RequestURI)
+}
+
+func (s *sendCmdTestSuite) TestSendCloudMode() {
+	s.cmdContext.CloudMode = true
+	s.cmd.SetArgs([]string{"--target", s.server.URL})
+	out := &bytes.Buffer{}
+	s.cmd.SetOut(out)
+	err := s.cmd.Execute()
+	s.Require().NoError(err)
+
+	s.Len(s.requests, 1)
+	s.Contains(out.String(), "Hello, client")
+	s.NotContains(out.String(), "triggered rules")
+}
+
+func (s *sendCmdTestSuite) TestSendResolve() {
+	s.cmdContext.CloudMode = true
+	serverUrl, err := url.Parse(s.server.URL)
+	s.Require().NoError(err)
+	target := "http://waf.example.com:" + serverUrl.Port()
+	s.cmd.SetArgs([]string{"--target", target, "--resolve", "waf.example.com:" + serverUrl.Port() + ":" + serverUrl.Hostname()})
+	s.cmd.SetOut(&bytes.Buffer{})
+	s.Require().NoError(s.cmd.Execute())
+
+	s.Require().Len(s.requests, 1)
+	s.Equal("waf.example.com:"+serverUrl.Port(), s.requests[0].Host)
+}
+
+func (s *sendCmdTestSuite) TestSendRequiresLogFile() {
+	s.cmd.SetArgs([]string{"--target", s.server.URL})
+	err := s.cmd.Execute()
+	s.ErrorContains(err, "a log file is required")
+	s.Empty(s.requests)
+}
+
+func (s *sendCmdTestSuite) TestSendInvalidArguments() {
+	_, err := s.execute("--target", "ftp://localhost")
+	s.ErrorContains(err, `expected a URL like "http://localhost:80"`)
+
+	_, err = s.execute("-H", "no-colon")
+	s.ErrorContains(err, `expected "Name: value"`)
+
+	s.cmd.SetIn(strings.NewReader(""))
+	_, err = s.execute("--raw", "-")
+	s.ErrorContains(err, "the raw request is empty")
+
+	s.Empty(s.requests)
+}
+
+func (s *sendCmdTestSuite) TestFlagUsage() {
+	// pflag uses the first back-quoted word of the usage as the name of the value
+	usages := s.cmd.Flags().FlagUsages()
+	s.Contains(usages, "-H, --header stringArray ")
+	s.Contains(usages, "-d, --data string ")
+	s.Contains(usages, "--autocomplete-headers ")
+	s.NotContains(usages, "--autocomplete-headers Content-Length")
+}
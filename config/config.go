@@ -12,6 +12,7 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/providers/rawbytes"
 	koanfv2 "github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog/log"
 )
 
 // NewDefaultConfig initializes the configuration with default values
@@ -22,7 +23,17 @@ func NewDefaultConfig() *FTWConfiguration {
 		RunMode:             DefaultRunMode,
 		MaxMarkerRetries:    DefaultMaxMarkerRetries,
 		MaxMarkerLogLines:   DefaultMaxMarkerLogLines,
+		LogBacklogLines:     DefaultLogBacklogLines,
 		CustomLogIdRegex:    "",
+		LogCorrelation: LogCorrelation{
+			Strategy: MarkerCorrelation,
+			Delay:    DefaultCorrelationDelay,
+		},
+		MarkerRequest: MarkerRequest{
+			Method:  DefaultMarkerRequestMethod,
+			URI:     DefaultMarkerRequestURI,
+			Version: DefaultMarkerRequestVersion,
+		},
 	}
 }
 
@@ -108,6 +119,9 @@ func unmarshalConfig(k *koanfv2.Koanf) (*FTWConfiguration, error) {
 	if err != nil {
 		return nil, err
 	}
+	if k.Exists("maxmarkerloglines") {
+		log.Warn().Msg("The setting 'maxmarkerloglines' is deprecated and has no effect, the log file is read forwards and markers are found regardless of its size. Use 'logbackloglines' to set the number of lines read when the log file is opened")
+	}
 
 	return config, nil
 }
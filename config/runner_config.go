@@ -7,6 +7,7 @@ import (
 	"time"
 
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types/overrides"
+	"github.com/coreruleset/go-ftw/v2/filter"
 	"github.com/coreruleset/go-ftw/v2/output"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/file"
@@ -22,6 +23,8 @@ type RunnerConfig struct {
 	Exclude *regexp.Regexp
 	// IncludeTags is a regular expression to filter tests to count the ones tagged with the mathing label. If nil, no impact on test runner.
 	IncludeTags *regexp.Regexp
+	// Filter is a boolean expression that tests must match in order to be run. If nil, no impact on test runner.
+	Filter *filter.Expression
 	// ShowTime determines whether to show the time taken to run each test.
 	ShowTime bool
 	// ShowOnlyFailed will only output information related to failed tests
@@ -39,18 +42,58 @@ type RunnerConfig struct {
 	// RateLimit is the rate limit for requests to the server. 0 is unlimited.
 	RateLimit time.Duration
 	// FailFast determines whether to stop running tests when the first failure is encountered.
-	FailFast            bool
+	FailFast bool
+	// Shuffle randomizes the order in which test files and the test cases within them are run.
+	Shuffle bool
+	// Seed is the seed used for shuffling tests (see `Shuffle`). 0 is a valid seed. If nil, a seed is
+	// generated from the current time.
+	Seed *int64
+	// DryRun builds the requests of all test stages without sending them. Nothing connects to the WAF.
+	DryRun bool
+	// DryRunDir is the directory that the requests built during a dry run are written to, one file
+	// per stage. If empty, the requests are printed to the output instead (see `DryRun`).
+	DryRunDir           string
 	RunMode             RunMode
 	LogMarkerHeaderName string
 	LogFilePath         string
 	PlatformOverrides   PlatformOverrides
 	TestOverride        FTWTestOverride
 	MaxMarkerRetries    uint
-	MaxMarkerLogLines   uint
+	// Deprecated: has no effect, see LogBacklogLines
+	MaxMarkerLogLines uint
+	// LogBacklogLines is the number of lines at the end of the log file that are read when it is opened
+	LogBacklogLines uint
 	// SkipTlsVerification skips certificate validation. Useful for connecting
 	// to domains with a self-signed certificate.
 	SkipTlsVerification bool
 	CustomLogIdRegex    string
+	// CloudRuleIdHeader and CloudRuleIdRegex configure where rule IDs are found in responses in
+	// cloud mode. See FTWConfiguration.
+	CloudRuleIdHeader string
+	CloudRuleIdRegex  string
+	// LogCorrelation configures how the log entries of a test stage are found. See FTWConfiguration.
+	LogCorrelation LogCorrelation
+	// MarkerRequest configures the requests sent for writing log markers. See FTWConfiguration.
+	MarkerRequest MarkerRequest
+	// TLS configures the TLS connections to the WAF. See FTWConfiguration.
+	TLS TLSConfig
+	// Proxy is the URL of the proxy that connections to the WAF are tunneled through. See FTWConfiguration.
+	Proxy string
+	// Resolve contains "host:port:address" entries for connecting to address instead of host. See FTWConfiguration.
+	Resolve []string
+	// Protocol overrides the protocol of the test stages. If empty, the `version` of each stage selects
+	// the protocol: "HTTP/3" is sent over HTTP/3, everything else over HTTP/1.x.
+	Protocol Protocol
+	// CaptureDir is the directory that the traffic of failed test stages is written to, one file per
+	// stage. If empty, no traffic is recorded.
+	CaptureDir string
+	// CaptureFormat is the format of the files written to `CaptureDir`
+	CaptureFormat CaptureFormat
+	// CaptureAllStages writes the traffic of all test stages to `CaptureDir`, not only of failed ones
+	CaptureAllStages bool
+	// ArtifactsDir is the directory that a folder with the request, the response, the log lines and
+	// a diagnosis is written to for each failed test stage. If empty, no artifacts are written.
+	ArtifactsDir string
 }
 
 type PlatformOverrides struct {
@@ -63,11 +106,19 @@ func NewRunnerConfiguration(cfg *FTWConfiguration) *RunnerConfig {
 		LogMarkerHeaderName: cfg.LogMarkerHeaderName,
 		LogFilePath:         cfg.LogFile,
 		TestOverride:        cfg.TestOverride,
-		MaxMarkerLogLines:   cfg.MaxMarkerLogLines,
+		LogBacklogLines:     cfg.LogBacklogLines,
 		MaxMarkerRetries:    cfg.MaxMarkerRetries,
 		RunMode:             cfg.RunMode,
 		SkipTlsVerification: cfg.SkipTlsVerification,
 		CustomLogIdRegex:    cfg.CustomLogIdRegex,
+		CloudRuleIdHeader:   cfg.CloudRuleIdHeader,
+		CloudRuleIdRegex:    cfg.CloudRuleIdRegex,
+		LogCorrelation:      cfg.LogCorrelation,
+		MarkerRequest:       cfg.MarkerRequest,
+		TLS:                 cfg.TLS,
+		Proxy:               cfg.Proxy,
+		Resolve:             cfg.Resolve,
+		Filter:              cfg.Filter,
 	}
 
 	if cfg.IncludeTests != nil {
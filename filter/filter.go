@@ -0,0 +1,230 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+// Package filter implements a small boolean expression language for selecting tests.
+//
+// A bare word matches a tag of the test, e.g. `slow` or `paranoia-level/2`. Fields can be
+// compared with `==`, `!=`, `<`, `<=`, `>`, `>=`, or matched against a regular expression with
+// `~` and `!~`. Terms are combined with `&&`, `||`, `!` and parentheses:
+//
+//	pl<=2 && !slow && (sqli || xss)
+//	rule >= 942000 && rule < 943000 && file ~ "sqli"
+//	author == "fzipi" || enabled == false
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// paranoiaLevelTagPrefix is the prefix of the tag that CRS uses to declare a paranoia level
+const paranoiaLevelTagPrefix = "paranoia-level/"
+
+// DefaultParanoiaLevel is the paranoia level of tests that have no `paranoia-level/N` tag
+const DefaultParanoiaLevel uint = 1
+
+// Subject holds the properties of a test that can be used in a filter expression
+type Subject struct {
+	// RuleId is the ID of the rule the test belongs to
+	RuleId uint
+	// TestId is the ID of the test within the rule
+	TestId uint
+	// Tags contains the tags of the test, including those declared in the file's metadata
+	Tags []string
+	// FilePath is the path of the file the test was loaded from
+	FilePath string
+	// Author is the author from the file's metadata
+	Author string
+	// Enabled is false if the file's metadata disables the test
+	Enabled bool
+}
+
+// ParanoiaLevel returns the highest paranoia level declared by a `paranoia-level/N` tag,
+// or DefaultParanoiaLevel if there is no such tag.
+func (s *Subject) ParanoiaLevel() uint {
+	level := uint(0)
+	for _, tag := range s.Tags {
+		value, found := strings.CutPrefix(tag, paranoiaLevelTagPrefix)
+		if !found {
+			continue
+		}
+		if parsed, err := strconv.ParseUint(value, 10, 0); err == nil {
+			level = max(level, uint(parsed))
+		}
+	}
+	if level == 0 {
+		return DefaultParanoiaLevel
+	}
+	return level
+}
+
+// Expression is a parsed filter expression
+type Expression struct {
+	source string
+	root   node
+}
+
+// Parse parses a filter expression
+func Parse(expression string) (*Expression, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, errors.New("filter: empty expression")
+	}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, unexpected(t, "'&&', '||' or end of expression")
+	}
+	return &Expression{source: expression, root: root}, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface, so that expressions
+// can be used in configuration files
+func (e *Expression) UnmarshalText(b []byte) error {
+	parsed, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*e = *parsed
+	return nil
+}
+
+// String returns the expression as it was written
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Matches returns true if the subject satisfies the expression
+func (e *Expression) Matches(subject *Subject) bool {
+	return e.root.eval(subject)
+}
+
+type node interface {
+	eval(subject *Subject) bool
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) eval(subject *Subject) bool {
+	return n.left.eval(subject) && n.right.eval(subject)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) eval(subject *Subject) bool {
+	return n.left.eval(subject) || n.right.eval(subject)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(subject *Subject) bool {
+	return !n.operand.eval(subject)
+}
+
+type tagNode struct {
+	tag string
+}
+
+func (n *tagNode) eval(subject *Subject) bool {
+	return slices.Contains(subject.Tags, n.tag)
+}
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	numericField
+	booleanField
+)
+
+type field struct {
+	name string
+	kind fieldKind
+	// values returns the values of the field for a subject. Fields with multiple values,
+	// such as tags, match if any of the values matches.
+	values func(subject *Subject) []string
+}
+
+var fields = map[string]*field{}
+
+func init() {
+	for _, f := range []*field{
+		{"pl", numericField, func(s *Subject) []string { return []string{strconv.FormatUint(uint64(s.ParanoiaLevel()), 10)} }},
+		{"rule", numericField, func(s *Subject) []string { return []string{strconv.FormatUint(uint64(s.RuleId), 10)} }},
+		{"test", numericField, func(s *Subject) []string { return []string{strconv.FormatUint(uint64(s.TestId), 10)} }},
+		{"id", stringField, func(s *Subject) []string { return []string{fmt.Sprintf("%d-%d", s.RuleId, s.TestId)} }},
+		{"tag", stringField, func(s *Subject) []string { return s.Tags }},
+		{"file", stringField, func(s *Subject) []string { return []string{s.FilePath} }},
+		{"author", stringField, func(s *Subject) []string { return []string{s.Author} }},
+		{"enabled", booleanField, func(s *Subject) []string { return []string{strconv.FormatBool(s.Enabled)} }},
+	} {
+		fields[f.name] = f
+	}
+}
+
+type comparisonNode struct {
+	field    *field
+	operator string
+	value    string
+	number   uint
+	regex    *regexp.Regexp
+}
+
+func (n *comparisonNode) eval(subject *Subject) bool {
+	values := n.field.values(subject)
+	switch n.operator {
+	case "!=":
+		return !slices.ContainsFunc(values, n.equals)
+	case "!~":
+		return !slices.ContainsFunc(values, n.regex.MatchString)
+	case "~":
+		return slices.ContainsFunc(values, n.regex.MatchString)
+	case "==":
+		return slices.ContainsFunc(values, n.equals)
+	default:
+		return slices.ContainsFunc(values, n.compare)
+	}
+}
+
+func (n *comparisonNode) equals(value string) bool {
+	if n.field.kind == numericField {
+		number, err := strconv.ParseUint(value, 10, 0)
+		return err == nil && uint(number) == n.number
+	}
+	return value == n.value
+}
+
+func (n *comparisonNode) compare(value string) bool {
+	parsed, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return false
+	}
+	number := uint(parsed)
+	switch n.operator {
+	case "<":
+		return number < n.number
+	case "<=":
+		return number <= n.number
+	case ">":
+		return number > n.number
+	case ">=":
+		return number >= n.number
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type filterTestSuite struct {
+	suite.Suite
+	subject *Subject
+}
+
+func TestFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(filterTestSuite))
+}
+
+func (s *filterTestSuite) SetupTest() {
+	s.subject = &Subject{
+		RuleId:   942100,
+		TestId:   3,
+		Tags:     []string{"paranoia-level/2", "platform-nginx", "sqli"},
+		FilePath: "tests/REQUEST-942-APPLICATION-ATTACK-SQLI/942100.yaml",
+		Author:   "fzipi",
+		Enabled:  true,
+	}
+}
+
+func (s *filterTestSuite) matches(expression string) bool {
+	e, err := Parse(expression)
+	s.Require().NoError(err)
+	return e.Matches(s.subject)
+}
+
+func (s *filterTestSuite) TestTags() {
+	s.True(s.matches("sqli"))
+	s.True(s.matches("paranoia-level/2"))
+	s.True(s.matches(`"platform-nginx"`))
+	s.False(s.matches("xss"))
+	s.False(s.matches("sql"))
+	s.True(s.matches("!slow"))
+}
+
+func (s *filterTestSuite) TestBooleanOperators() {
+	s.True(s.matches("pl<=2 && !slow && (sqli || xss)"))
+	s.False(s.matches("pl<=2 && !slow && (rce || xss)"))
+	s.True(s.matches("xss || sqli && platform-nginx"))
+	s.False(s.matches("(xss || sqli) && platform-apache"))
+	s.True(s.matches("!!sqli"))
+	s.False(s.matches("!(sqli)"))
+}
+
+func (s *filterTestSuite) TestPrecedence() {
+	// && binds tighter than ||
+	s.True(s.matches("sqli || xss && rce"))
+	s.False(s.matches("(sqli || xss) && rce"))
+}
+
+func (s *filterTestSuite) TestParanoiaLevel() {
+	s.True(s.matches("pl == 2"))
+	s.True(s.matches("pl > 1"))
+	s.False(s.matches("pl < 2"))
+	s.True(s.matches("pl >= 2"))
+	s.True(s.matches("pl != 3"))
+
+	s.subject.Tags = []string{"paranoia-level/1", "paranoia-level/3"}
+	s.True(s.matches("pl == 3"))
+
+	s.subject.Tags = nil
+	s.Equal(DefaultParanoiaLevel, s.subject.ParanoiaLevel())
+	s.True(s.matches("pl == 1"))
+}
+
+func (s *filterTestSuite) TestIds() {
+	s.True(s.matches("rule == 942100"))
+	s.True(s.matches("rule >= 942000 && rule < 943000"))
+	s.True(s.matches(`rule ~ "^942"`))
+	s.True(s.matches("test == 3"))
+	s.True(s.matches(`id == "942100-3"`))
+	s.True(s.matches(`id ~ "-3$"`))
+	s.False(s.matches(`id !~ "^942"`))
+}
+
+func (s *filterTestSuite) TestMetadata() {
+	s.True(s.matches(`author == fzipi`))
+	s.True(s.matches(`author != "someone else"`))
+	s.True(s.matches(`enabled == true`))
+	s.False(s.matches(`enabled == false`))
+	s.True(s.matches(`enabled != 0`))
+	s.True(s.matches(`file ~ "REQUEST-942-[A-Z-]+/\d+\.yaml$"`))
+}
+
+func (s *filterTestSuite) TestTagField() {
+	s.True(s.matches(`tag ~ "^platform-"`))
+	s.False(s.matches(`tag !~ "^platform-"`))
+	s.True(s.matches(`tag == sqli`))
+	s.False(s.matches(`tag != sqli`))
+}
+
+func (s *filterTestSuite) TestString() {
+	e, err := Parse("pl<=2 && !slow")
+	s.Require().NoError(err)
+	s.Equal("pl<=2 && !slow", e.String())
+}
+
+func (s *filterTestSuite) TestUnmarshalText() {
+	e := &Expression{}
+	s.Require().NoError(e.UnmarshalText([]byte("sqli && pl < 3")))
+	s.True(e.Matches(s.subject))
+
+	s.Error(e.UnmarshalText([]byte("sqli &&")))
+}
+
+func (s *filterTestSuite) TestParseErrors() {
+	for _, expression := range []string{
+		"",
+		"   ",
+		"sqli &&",
+		"sqli xss",
+		"(sqli",
+		"sqli)",
+		"&& sqli",
+		"unknown == 1",
+		"pl <= two",
+		"author < 3",
+		`enabled == maybe`,
+		`file ~ "("`,
+		`"unterminated`,
+		`"sqli" == 1`,
+		"pl ==",
+		"= sqli",
+	} {
+		_, err := Parse(expression)
+		s.Errorf(err, "expected error for %q", expression)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLeftParen
+	tokenRightParen
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// pos is the byte offset of the token in the expression
+	pos int
+}
+
+// operators are ordered so that longer operators are matched first
+var operators = []string{"==", "!=", "<=", ">=", "!~", "<", ">", "~"}
+
+// wordDelimiters are the characters that terminate a word
+const wordDelimiters = `&|!()<>=~"`
+
+// tokenize splits a filter expression into tokens
+func tokenize(expression string) ([]token, error) {
+	tokens := []token{}
+	pos := 0
+	for pos < len(expression) {
+		c := rune(expression[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case strings.HasPrefix(expression[pos:], "&&"):
+			tokens = append(tokens, token{tokenAnd, "&&", pos})
+			pos += 2
+		case strings.HasPrefix(expression[pos:], "||"):
+			tokens = append(tokens, token{tokenOr, "||", pos})
+			pos += 2
+		case c == '(':
+			tokens = append(tokens, token{tokenLeftParen, "(", pos})
+			pos++
+		case c == ')':
+			tokens = append(tokens, token{tokenRightParen, ")", pos})
+			pos++
+		case c == '"':
+			value, length, err := readString(expression[pos:])
+			if err != nil {
+				return nil, fmt.Errorf("filter: %w at position %d", err, pos)
+			}
+			tokens = append(tokens, token{tokenString, value, pos})
+			pos += length
+		default:
+			if operator := readOperator(expression[pos:]); operator != "" {
+				tokens = append(tokens, token{tokenOperator, operator, pos})
+				pos += len(operator)
+				continue
+			}
+			if c == '!' {
+				tokens = append(tokens, token{tokenNot, "!", pos})
+				pos++
+				continue
+			}
+			if strings.ContainsRune(wordDelimiters, c) {
+				return nil, fmt.Errorf("filter: unexpected character %q at position %d", c, pos)
+			}
+			end := pos
+			for end < len(expression) {
+				next := rune(expression[end])
+				if unicode.IsSpace(next) || strings.ContainsRune(wordDelimiters, next) {
+					break
+				}
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, expression[pos:end], pos})
+			pos = end
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", pos})
+	return tokens, nil
+}
+
+func readOperator(s string) string {
+	for _, operator := range operators {
+		if strings.HasPrefix(s, operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+// readString reads a double quoted string. A backslash escapes a following double quote
+// or backslash and is retained otherwise, so that regular expressions can be written naturally.
+// Returns the unquoted value and the number of bytes consumed.
+func readString(s string) (string, int, error) {
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, errors.New("unterminated string")
+			}
+			if s[i+1] == '"' || s[i+1] == '\\' {
+				i++
+			}
+			value.WriteByte(s[i])
+		case '"':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// parser is a recursive descent parser for the following grammar:
+//
+//	expression = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | primary
+//	primary    = "(" expression ")" | field operator value | tag
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseExpression() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLeftParen:
+		inner, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, unexpected(closing, "')'")
+		}
+		return inner, nil
+	case tokenWord, tokenString:
+		if p.peek().kind == tokenOperator {
+			if t.kind == tokenString {
+				return nil, fmt.Errorf("filter: expected field name at position %d, found string %q", t.pos, t.value)
+			}
+			return p.parseComparison(t)
+		}
+		return &tagNode{t.value}, nil
+	default:
+		return nil, unexpected(t, "tag, field or '('")
+	}
+}
+
+func (p *parser) parseComparison(fieldToken token) (node, error) {
+	f, ok := fields[fieldToken.value]
+	if !ok {
+		return nil, fmt.Errorf("filter: unknown field %q at position %d", fieldToken.value, fieldToken.pos)
+	}
+	operator := p.next()
+	valueToken := p.next()
+	if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+		return nil, unexpected(valueToken, "value")
+	}
+	c := &comparisonNode{
+		field:    f,
+		operator: operator.value,
+		value:    valueToken.value,
+	}
+
+	switch operator.value {
+	case "~", "!~":
+		re, err := regexp.Compile(valueToken.value)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid regular expression at position %d: %w", valueToken.pos, err)
+		}
+		c.regex = re
+	case "<", "<=", ">", ">=":
+		if f.kind != numericField {
+			return nil, fmt.Errorf("filter: operator %s at position %d requires a numeric field, %q is not numeric", operator.value, operator.pos, f.name)
+		}
+		fallthrough
+	default:
+		switch f.kind {
+		case numericField:
+			number, err := strconv.ParseUint(valueToken.value, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("filter: expected number at position %d, found %q", valueToken.pos, valueToken.value)
+			}
+			c.number = uint(number)
+		case booleanField:
+			boolean, err := strconv.ParseBool(valueToken.value)
+			if err != nil {
+				return nil, fmt.Errorf("filter: expected boolean at position %d, found %q", valueToken.pos, valueToken.value)
+			}
+			c.value = strconv.FormatBool(boolean)
+		}
+	}
+	return c, nil
+}
+
+func unexpected(t token, expected string) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("filter: expected %s, found end of expression", expected)
+	}
+	return fmt.Errorf("filter: expected %s at position %d, found %q", expected, t.pos, t.value)
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// UnixProtocol is the protocol of destinations that are Unix domain sockets. The address of such a
+// destination is the path of the socket, and the port is ignored. Requests are sent as plain HTTP.
+const UnixProtocol = "unix"
+
+// URL returns the destination as a URL, e.g. "https://localhost:443" or "unix:///run/waf.sock"
+func (d Destination) URL() string {
+	if d.Protocol == UnixProtocol {
+		return "unix://" + d.DestAddr
+	}
+	return fmt.Sprintf("%s://%s", d.Protocol, net.JoinHostPort(d.DestAddr, fmt.Sprint(d.Port)))
+}
+
+// ParseResolve parses curl-style "host:port:address" entries into a map from "host:port" to the
+// address and port that are connected to instead. IPv6 addresses may be enclosed in brackets.
+func ParseResolve(entries []string) (map[string]string, error) {
+	resolve := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		host, rest, ok := cutResolveField(entry)
+		if !ok {
+			return nil, fmt.Errorf("resolve: invalid entry %q, expected host:port:address", entry)
+		}
+		port, address, ok := strings.Cut(rest, ":")
+		if !ok || host == "" || address == "" {
+			return nil, fmt.Errorf("resolve: invalid entry %q, expected host:port:address", entry)
+		}
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return nil, fmt.Errorf("resolve: invalid port %q in entry %q", port, entry)
+		}
+		address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+		resolve[strings.ToLower(net.JoinHostPort(host, port))] = net.JoinHostPort(address, port)
+	}
+	return resolve, nil
+}
+
+// cutResolveField cuts the host from the start of a resolve entry. The host may be an IPv6
+// address in brackets.
+func cutResolveField(entry string) (string, string, bool) {
+	if strings.HasPrefix(entry, "[") {
+		host, rest, ok := strings.Cut(entry[1:], "]:")
+		return host, rest, ok
+	}
+	return strings.Cut(entry, ":")
+}
+
+// address returns the network and the address to connect to for d, applying the resolve
+// mapping of the client config
+func (c *Client) address(d Destination) (string, string) {
+	if d.Protocol == UnixProtocol {
+		return "unix", d.DestAddr
+	}
+	hostPort := net.JoinHostPort(d.DestAddr, fmt.Sprint(d.Port))
+	if resolved, ok := c.config.Resolve[strings.ToLower(hostPort)]; ok {
+		return "tcp", resolved
+	}
+	return "tcp", hostPort
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type addressTestSuite struct {
+	suite.Suite
+	client *Client
+}
+
+func TestAddressTestSuite(t *testing.T) {
+	suite.Run(t, new(addressTestSuite))
+}
+
+func (s *addressTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *addressTestSuite) SetupTest() {
+	var err error
+	s.client, err = NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+}
+
+func (s *addressTestSuite) TestParseResolve() {
+	resolve, err := ParseResolve([]string{
+		"Example.com:443:127.0.0.1",
+		"waf.example.com:80:[::1]",
+		"[2001:db8::1]:8080:10.0.0.1",
+	})
+	s.Require().NoError(err)
+	s.Equal(map[string]string{
+		"example.com:443":    "127.0.0.1:443",
+		"waf.example.com:80": "[::1]:80",
+		"[2001:db8::1]:8080": "10.0.0.1:8080",
+	}, resolve)
+
+	resolve, err = ParseResolve(nil)
+	s.Require().NoError(err)
+	s.Empty(resolve)
+}
+
+func (s *addressTestSuite) TestParseResolveErrors() {
+	for _, entry := range []string{"example.com", "example.com:443", ":443:127.0.0.1", "example.com:https:127.0.0.1", "example.com:0:127.0.0.1", "[::1:443:127.0.0.1"} {
+		_, err := ParseResolve([]string{entry})
+		s.ErrorContains(err, "resolve: invalid", entry)
+	}
+}
+
+func (s *addressTestSuite) TestURL() {
+	s.Equal("https://localhost:443", Destination{DestAddr: "localhost", Port: 443, Protocol: "https"}.URL())
+	s.Equal("http://[::1]:80", Destination{DestAddr: "::1", Port: 80, Protocol: "http"}.URL())
+	s.Equal("unix:///run/waf.sock", Destination{DestAddr: "/run/waf.sock", Protocol: UnixProtocol}.URL())
+}
+
+func (s *addressTestSuite) TestDestinationFromUnixURL() {
+	d, err := DestinationFromString("unix:///run/waf.sock")
+	s.Require().NoError(err)
+	s.Equal(&Destination{DestAddr: "/run/waf.sock", Protocol: UnixProtocol}, d)
+
+	d, err = DestinationFromString("unix://waf.sock")
+	s.Require().NoError(err)
+	s.Equal("waf.sock", d.DestAddr, "relative paths are supported")
+}
+
+func (s *addressTestSuite) TestUnixSocket() {
+	dir, err := os.MkdirTemp("", "ftw")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "waf.sock")
+	listener, err := net.Listen("unix", socketPath)
+	s.Require().NoError(err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	// the proxy must not be used for Unix domain sockets
+	s.client.config.Proxy, err = ParseProxyURL("http://127.0.0.1:1")
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.NewConnection(Destination{DestAddr: socketPath, Protocol: UnixProtocol}))
+	response, err := s.client.Do(*generateBaseRequestForTesting())
+	s.Require().NoError(err)
+	s.Equal(http.StatusTeapot, response.Parsed.StatusCode)
+}
+
+func (s *addressTestSuite) TestResolve() {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	d, err := DestinationFromString(ts.URL)
+	s.Require().NoError(err)
+
+	s.client.config.Resolve, err = ParseResolve([]string{fmt.Sprintf("waf.example.com:%d:%s", d.Port, d.DestAddr)})
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.NewConnection(Destination{DestAddr: "WAF.example.com", Port: d.Port, Protocol: "http"}))
+	response, err := s.client.Do(*generateBaseRequestForTesting())
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.Parsed.StatusCode)
+
+	err = s.client.NewConnection(Destination{DestAddr: "waf.example.com", Port: d.Port + 1, Protocol: "http"})
+	s.Error(err, "other ports must not be resolved")
+}
+
+func (s *addressTestSuite) TestResolveKeepsServerName() {
+	var serverName string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	s.client.SetRootCAs(ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs)
+	d, err := DestinationFromString(ts.URL)
+	s.Require().NoError(err)
+
+	// the certificate of the test server is valid for example.com
+	s.client.config.Resolve, err = ParseResolve([]string{fmt.Sprintf("example.com:%d:%s", d.Port, d.DestAddr)})
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.NewConnection(Destination{DestAddr: "example.com", Port: d.Port, Protocol: "https"}))
+	_, err = s.client.Do(*generateBaseRequestForTesting())
+	s.Require().NoError(err)
+	s.Equal("example.com", serverName)
+}
@@ -0,0 +1,311 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	yamlv4 "go.yaml.in/yaml/v4"
+)
+
+// DefaultMultipartBoundary is the boundary of multipart bodies that don't set one
+const DefaultMultipartBoundary = "go-ftw-boundary"
+
+// Body describes a request body that is generated from a structure instead of being written by
+// hand. Exactly one of Multipart, JSON and XML must be set. The generated bytes are deterministic,
+// and well-formed unless a malformed variant is explicitly requested.
+type Body struct {
+	// Multipart generates a multipart/form-data body
+	Multipart *MultipartBody `yaml:"multipart,omitempty"`
+	// JSON generates a JSON document from a YAML value. The order of keys is kept.
+	JSON yamlv4.Node `yaml:"json,omitempty"`
+	// XML generates an XML document from a YAML mapping with a single key, the root element.
+	// Keys starting with "@" are attributes, the key "#text" is the text of the element, and
+	// sequences are repeated elements. The order of keys is kept.
+	XML yamlv4.Node `yaml:"xml,omitempty"`
+	// Truncate cuts the generated body after the given number of bytes, e.g. to send an
+	// unterminated document. 0 disables truncation.
+	Truncate int `yaml:"truncate,omitempty"`
+}
+
+// MultipartBody describes a multipart/form-data body
+type MultipartBody struct {
+	// Boundary separates the parts. DefaultMultipartBoundary is used if empty.
+	Boundary string          `yaml:"boundary,omitempty"`
+	Parts    []MultipartPart `yaml:"parts"`
+	// BareLF separates lines with "\n" instead of "\r\n" (malformed)
+	BareLF bool `yaml:"bare_lf,omitempty"`
+	// OmitClosingBoundary leaves out the closing boundary "--boundary--" (malformed)
+	OmitClosingBoundary bool `yaml:"omit_closing_boundary,omitempty"`
+}
+
+// MultipartPart is a single part of a multipart body. A Content-Disposition header is written if
+// the part has a name or a file name.
+type MultipartPart struct {
+	Name string `yaml:"name,omitempty"`
+	// Filename is written even if it is empty, as in `filename=""`
+	Filename *string `yaml:"filename,omitempty"`
+	// ContentType is written as the Content-Type header of the part, if set
+	ContentType string `yaml:"content_type,omitempty"`
+	// Headers are additional header lines of the part, written as they are, e.g.
+	// "Content-Transfer-Encoding: base64"
+	Headers []string `yaml:"headers,omitempty"`
+	// Content is the content of the part. Use EncodedContent for binary content.
+	Content string `yaml:"content,omitempty"`
+	// EncodedContent is the base64 encoded content of the part. Replaces Content.
+	EncodedContent string `yaml:"encoded_content,omitempty"`
+}
+
+// UnmarshalYAML validates the body, so that mistakes are reported when loading the test
+func (b *Body) UnmarshalYAML(node *yamlv4.Node) error {
+	type plain Body
+	if err := node.Decode((*plain)(b)); err != nil {
+		return err
+	}
+	if err := b.validate(); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	return nil
+}
+
+// validate checks that the body can be generated
+func (b *Body) validate() error {
+	set := 0
+	for _, isSet := range []bool{b.Multipart != nil, !b.JSON.IsZero(), !b.XML.IsZero()} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("body: exactly one of 'multipart', 'json' and 'xml' is required")
+	}
+	if b.Truncate < 0 {
+		return errors.New("body: 'truncate' must not be negative")
+	}
+	_, _, err := b.Encode()
+	return err
+}
+
+// Encode generates the body and returns it together with the matching Content-Type
+func (b *Body) Encode() ([]byte, string, error) {
+	var data []byte
+	var contentType string
+	var err error
+	switch {
+	case b.Multipart != nil:
+		data, err = b.Multipart.encode()
+		contentType = "multipart/form-data; boundary=" + b.Multipart.boundary()
+	case !b.JSON.IsZero():
+		buf := &bytes.Buffer{}
+		err = writeJSON(buf, &b.JSON)
+		data, contentType = buf.Bytes(), "application/json"
+	case !b.XML.IsZero():
+		data, err = encodeXML(&b.XML)
+		contentType = "application/xml"
+	default:
+		return nil, "", errors.New("body: nothing to encode")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("body: %w", err)
+	}
+	if b.Truncate > 0 && b.Truncate < len(data) {
+		data = data[:b.Truncate]
+	}
+	return data, contentType, nil
+}
+
+func (m *MultipartBody) boundary() string {
+	if m.Boundary == "" {
+		return DefaultMultipartBoundary
+	}
+	return m.Boundary
+}
+
+func (m *MultipartBody) encode() ([]byte, error) {
+	eol := HeaderDelimiter
+	if m.BareLF {
+		eol = "\n"
+	}
+	buf := &bytes.Buffer{}
+	for index, part := range m.Parts {
+		content := []byte(part.Content)
+		if part.EncodedContent != "" {
+			var err error
+			if content, err = base64.StdEncoding.DecodeString(part.EncodedContent); err != nil {
+				return nil, fmt.Errorf("invalid encoded_content of part %d: %w", index+1, err)
+			}
+		}
+		buf.WriteString("--" + m.boundary() + eol)
+		if part.Name != "" || part.Filename != nil {
+			buf.WriteString("Content-Disposition: form-data")
+			if part.Name != "" {
+				buf.WriteString(`; name="` + part.Name + `"`)
+			}
+			if part.Filename != nil {
+				buf.WriteString(`; filename="` + *part.Filename + `"`)
+			}
+			buf.WriteString(eol)
+		}
+		if part.ContentType != "" {
+			buf.WriteString("Content-Type: " + part.ContentType + eol)
+		}
+		for _, header := range part.Headers {
+			buf.WriteString(header + eol)
+		}
+		buf.WriteString(eol)
+		buf.Write(content)
+		buf.WriteString(eol)
+	}
+	if !m.OmitClosingBoundary {
+		buf.WriteString("--" + m.boundary() + "--" + eol)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes a YAML node as compact JSON
+func writeJSON(buf *bytes.Buffer, node *yamlv4.Node) error {
+	switch node.Kind {
+	case yamlv4.DocumentNode:
+		return writeJSON(buf, node.Content[0])
+	case yamlv4.AliasNode:
+		return writeJSON(buf, node.Alias)
+	case yamlv4.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONValue(buf, node.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yamlv4.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yamlv4.ScalarNode:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		if err := writeJSONValue(buf, value); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+	}
+	return nil
+}
+
+// writeJSONValue writes a JSON value. Unlike json.Marshal, characters such as "<" are not escaped,
+// so that payloads are sent as they are written.
+func writeJSONValue(buf *bytes.Buffer, value any) error {
+	encoded := &bytes.Buffer{}
+	encoder := json.NewEncoder(encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+	return nil
+}
+
+// encodeXML generates an XML document from a YAML mapping with a single key
+func encodeXML(node *yamlv4.Node) ([]byte, error) {
+	if node.Kind == yamlv4.DocumentNode {
+		node = node.Content[0]
+	}
+	if node.Kind != yamlv4.MappingNode || len(node.Content) != 2 {
+		return nil, fmt.Errorf("line %d: xml must be a mapping with a single key, the root element", node.Line)
+	}
+	buf := &bytes.Buffer{}
+	if err := writeXMLElement(buf, node.Content[0].Value, node.Content[1]); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeXMLElement writes the element name with the content of node. Sequences are written as
+// repeated elements.
+func writeXMLElement(buf *bytes.Buffer, name string, node *yamlv4.Node) error {
+	if node.Kind == yamlv4.AliasNode {
+		node = node.Alias
+	}
+	if strings.HasPrefix(name, "@") || name == "#text" || name == "" {
+		return fmt.Errorf("line %d: invalid element name %q", node.Line, name)
+	}
+	switch node.Kind {
+	case yamlv4.SequenceNode:
+		for _, item := range node.Content {
+			if err := writeXMLElement(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case yamlv4.ScalarNode:
+		buf.WriteString("<" + name)
+		if node.Tag == "!!null" {
+			buf.WriteString("/>")
+			return nil
+		}
+		buf.WriteByte('>')
+		if err := xml.EscapeText(buf, []byte(node.Value)); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+		return nil
+	case yamlv4.MappingNode:
+		buf.WriteString("<" + name)
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if attribute, ok := strings.CutPrefix(key, "@"); ok {
+				if value.Kind != yamlv4.ScalarNode {
+					return fmt.Errorf("line %d: the value of attribute %q must be a scalar", value.Line, attribute)
+				}
+				buf.WriteString(" " + attribute + `="`)
+				if err := xml.EscapeText(buf, []byte(value.Value)); err != nil {
+					return err
+				}
+				buf.WriteByte('"')
+			}
+		}
+		buf.WriteByte('>')
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			switch {
+			case strings.HasPrefix(key, "@"):
+			case key == "#text":
+				if value.Kind != yamlv4.ScalarNode {
+					return fmt.Errorf("line %d: the value of #text must be a scalar", value.Line)
+				}
+				if err := xml.EscapeText(buf, []byte(value.Value)); err != nil {
+					return err
+				}
+			default:
+				if err := writeXMLElement(buf, key, value); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteString("</" + name + ">")
+		return nil
+	}
+	return fmt.Errorf("line %d: unsupported value of element %q", node.Line, name)
+}
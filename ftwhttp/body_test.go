@@ -0,0 +1,143 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	yamlv4 "go.yaml.in/yaml/v4"
+)
+
+type bodyTestSuite struct {
+	suite.Suite
+}
+
+func TestBodyTestSuite(t *testing.T) {
+	suite.Run(t, new(bodyTestSuite))
+}
+
+func (s *bodyTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+// encode reads a body from YAML and encodes it
+func (s *bodyTestSuite) encode(yaml string) (string, string) {
+	body := &Body{}
+	s.Require().NoError(yamlv4.Unmarshal([]byte(yaml), body))
+	data, contentType, err := body.Encode()
+	s.Require().NoError(err)
+	return string(data), contentType
+}
+
+func (s *bodyTestSuite) TestMultipart() {
+	data, contentType := s.encode(`
+multipart:
+  parts:
+    - name: comment
+      content: "<script>alert(1)</script>"
+    - name: upload
+      filename: "shell.php"
+      content_type: application/octet-stream
+      headers: ["Content-Transfer-Encoding: binary"]
+      encoded_content: "PD9waHA/Pg=="
+    - filename: ""
+`)
+	s.Equal("multipart/form-data; boundary=go-ftw-boundary", contentType)
+	s.Equal("--go-ftw-boundary\r\n"+
+		"Content-Disposition: form-data; name=\"comment\"\r\n"+
+		"\r\n"+
+		"<script>alert(1)</script>\r\n"+
+		"--go-ftw-boundary\r\n"+
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"shell.php\"\r\n"+
+		"Content-Type: application/octet-stream\r\n"+
+		"Content-Transfer-Encoding: binary\r\n"+
+		"\r\n"+
+		"<?php?>\r\n"+
+		"--go-ftw-boundary\r\n"+
+		"Content-Disposition: form-data; filename=\"\"\r\n"+
+		"\r\n"+
+		"\r\n"+
+		"--go-ftw-boundary--\r\n", data)
+}
+
+func (s *bodyTestSuite) TestMalformedMultipart() {
+	data, contentType := s.encode(`
+multipart:
+  boundary: "x"
+  bare_lf: true
+  omit_closing_boundary: true
+  parts:
+    - name: a
+      content: "1"
+`)
+	s.Equal("multipart/form-data; boundary=x", contentType)
+	s.Equal("--x\nContent-Disposition: form-data; name=\"a\"\n\n1\n", data)
+}
+
+func (s *bodyTestSuite) TestJSON() {
+	data, contentType := s.encode(`
+json:
+  user: "admin' OR 1=1--"
+  id: 1
+  ratio: 0.5
+  admin: false
+  tags: ["<b>", null]
+  nested: {a: {}}
+`)
+	s.Equal("application/json", contentType)
+	s.Equal(`{"user":"admin' OR 1=1--","id":1,"ratio":0.5,"admin":false,"tags":["<b>",null],"nested":{"a":{}}}`, data)
+
+	data, _ = s.encode(`json: "scalar"`)
+	s.Equal(`"scalar"`, data)
+}
+
+func (s *bodyTestSuite) TestXML() {
+	data, contentType := s.encode(`
+xml:
+  order:
+    "@id": "1&2"
+    "#text": "note: "
+    item:
+      - {"@sku": "a", "#text": "<one>"}
+      - two
+    empty: null
+`)
+	s.Equal("application/xml", contentType)
+	s.Equal(`<order id="1&amp;2">note: <item sku="a">&lt;one&gt;</item><item>two</item><empty/></order>`, data)
+}
+
+func (s *bodyTestSuite) TestTruncate() {
+	data, _ := s.encode(`
+json: {a: 1}
+truncate: 5
+`)
+	s.Equal(`{"a":`, data)
+
+	data, _ = s.encode(`
+json: {a: 1}
+truncate: 100
+`)
+	s.Equal(`{"a":1}`, data)
+}
+
+func (s *bodyTestSuite) TestInvalidBodies() {
+	tests := map[string]string{
+		"{}":                      "exactly one of 'multipart', 'json' and 'xml' is required",
+		"{json: 1, xml: {a: 1}}":  "exactly one of 'multipart', 'json' and 'xml' is required",
+		"{json: 1, truncate: -1}": "'truncate' must not be negative",
+		"{xml: [a, b]}":           "xml must be a mapping with a single key, the root element",
+		"{xml: {a: 1, b: 2}}":     "xml must be a mapping with a single key, the root element",
+		"{xml: {a: {'@b': [1]}}}": `the value of attribute "b" must be a scalar`,
+		"{xml: {'@a': 1}}":        `invalid element name "@a"`,
+		"{multipart: {parts: [{encoded_content: '!'}]}}": "invalid encoded_content of part 1",
+	}
+	for yaml, expected := range tests {
+		s.Run(yaml, func() {
+			err := yamlv4.Unmarshal([]byte(yaml), &Body{})
+			s.ErrorContains(err, expected)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CaptureDirection is the direction of captured data
+type CaptureDirection int
+
+const (
+	// CaptureSent is data sent by the client
+	CaptureSent CaptureDirection = iota
+	// CaptureReceived is data received from the server
+	CaptureReceived
+)
+
+// CapturedSegment is data that was sent or received with a single write or read, or the end of
+// one direction of the connection
+type CapturedSegment struct {
+	Time      time.Time
+	Direction CaptureDirection
+	Data      []byte
+	// End is set if the sender closed the connection, i.e. the client closed it or the server
+	// sent a FIN
+	End bool
+	// Reset is set if the server reset the connection
+	Reset bool
+}
+
+// CapturedConnection contains the segments of a connection in the order they were sent or received
+type CapturedConnection struct {
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// Start is the time the connection was established
+	Start    time.Time
+	Segments []CapturedSegment
+}
+
+// Capture records the traffic of the connections of a client, see Client.StartCapture.
+// Connections that use TLS are recorded decrypted, so that the requests and responses can be
+// read. HTTP/3 connections are not recorded.
+type Capture struct {
+	mutex       sync.Mutex
+	connections []*CapturedConnection
+}
+
+// capturingConn records the data that is written to and read from a connection
+type capturingConn struct {
+	net.Conn
+	capture    *Capture
+	connection *CapturedConnection
+}
+
+// StartCapture starts recording the traffic of the connections that are created from now on,
+// replacing a previous capture. Recorded connections are recorded until they are closed, even
+// if the capture is stopped before.
+func (c *Client) StartCapture() {
+	c.capture = &Capture{}
+}
+
+// StopCapture stops recording and returns the capture. Nil is returned if no capture was started.
+func (c *Client) StopCapture() *Capture {
+	capture := c.capture
+	c.capture = nil
+	return capture
+}
+
+// Connections returns a copy of the recorded connections
+func (c *Capture) Connections() []CapturedConnection {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	connections := make([]CapturedConnection, 0, len(c.connections))
+	for _, connection := range c.connections {
+		copied := *connection
+		copied.Segments = slices.Clone(connection.Segments)
+		connections = append(connections, copied)
+	}
+	return connections
+}
+
+// record returns conn, recording its traffic
+func (c *Capture) record(conn net.Conn) net.Conn {
+	connection := &CapturedConnection{
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+		Start:      time.Now(),
+	}
+	c.mutex.Lock()
+	c.connections = append(c.connections, connection)
+	c.mutex.Unlock()
+	return &capturingConn{Conn: conn, capture: c, connection: connection}
+}
+
+func (c *Capture) add(connection *CapturedConnection, segment CapturedSegment) {
+	segment.Time = time.Now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	connection.Segments = append(connection.Segments, segment)
+}
+
+func (c *capturingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.capture.add(c.connection, CapturedSegment{Direction: CaptureReceived, Data: slices.Clone(b[:n])})
+	}
+	switch {
+	case errors.Is(err, io.EOF):
+		c.capture.add(c.connection, CapturedSegment{Direction: CaptureReceived, End: true})
+	case errors.Is(err, syscall.ECONNRESET):
+		c.capture.add(c.connection, CapturedSegment{Direction: CaptureReceived, Reset: true})
+	}
+	return n, err
+}
+
+func (c *capturingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.capture.add(c.connection, CapturedSegment{Direction: CaptureSent, Data: slices.Clone(b[:n])})
+	}
+	return n, err
+}
+
+func (c *capturingConn) Close() error {
+	c.capture.add(c.connection, CapturedSegment{Direction: CaptureSent, End: true})
+	return c.Conn.Close()
+}
+
+// unwrapConn returns the connection that is recorded by conn, if any
+func unwrapConn(conn net.Conn) net.Conn {
+	if capturing, ok := conn.(*capturingConn); ok {
+		return capturing.Conn
+	}
+	return conn
+}
+
+// WriteTranscript writes the recorded data as text. Each read and write is preceded by a line
+// starting with "#" that holds the time, the direction (">" for sent and "<" for received data)
+// and the number of bytes, followed by the data exactly as it was sent or received and a newline.
+func (c *Capture) WriteTranscript(w io.Writer) error {
+	for index, connection := range c.Connections() {
+		if _, err := fmt.Fprintf(w, "# connection %d from %s to %s at %s\n", index+1, connection.LocalAddr, connection.RemoteAddr, formatCaptureTime(connection.Start)); err != nil {
+			return err
+		}
+		for _, segment := range connection.Segments {
+			direction := ">"
+			if segment.Direction == CaptureReceived {
+				direction = "<"
+			}
+			var err error
+			switch {
+			case segment.Reset:
+				_, err = fmt.Fprintf(w, "# %s %s connection reset\n", formatCaptureTime(segment.Time), direction)
+			case segment.End:
+				_, err = fmt.Fprintf(w, "# %s %s connection closed\n", formatCaptureTime(segment.Time), direction)
+			default:
+				_, err = fmt.Fprintf(w, "# %s %s %d bytes\n%s\n", formatCaptureTime(segment.Time), direction, len(segment.Data), segment.Data)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatCaptureTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z")
+}
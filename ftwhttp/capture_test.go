@@ -0,0 +1,295 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type captureTestSuite struct {
+	suite.Suite
+	client *Client
+}
+
+func TestCaptureTestSuite(t *testing.T) {
+	suite.Run(t, new(captureTestSuite))
+}
+
+func (s *captureTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *captureTestSuite) SetupTest() {
+	var err error
+	s.client, err = NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+}
+
+func (s *captureTestSuite) newServer(secure bool) (*httptest.Server, Destination) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello, client"))
+	})
+	var ts *httptest.Server
+	if secure {
+		ts = httptest.NewTLSServer(handler)
+		s.client.SetRootCAs(ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs)
+	} else {
+		ts = httptest.NewServer(handler)
+	}
+	s.T().Cleanup(ts.Close)
+	d, err := DestinationFromString(ts.URL)
+	s.Require().NoError(err)
+	return ts, *d
+}
+
+func (s *captureTestSuite) TestCaptureRecordsTraffic() {
+	_, d := s.newServer(insecureServer)
+	s.Nil(s.client.StopCapture(), "nothing is recorded without a capture")
+
+	s.client.StartCapture()
+	s.Require().NoError(s.client.NewConnection(d))
+	request := generateBaseRequestForTesting()
+	response, err := s.client.Do(*request)
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.NewConnection(d))
+	capture := s.client.StopCapture()
+	s.Require().NotNil(capture)
+
+	// connections created after the capture was stopped are not recorded
+	s.Require().NoError(s.client.NewConnection(d))
+	_, err = s.client.Do(*request)
+	s.Require().NoError(err)
+
+	connections := capture.Connections()
+	s.Require().Len(connections, 2)
+	first := connections[0]
+	s.Equal(s.client.Transport.connection.RemoteAddr().String(), first.RemoteAddr.String())
+	s.Require().Len(first.Segments, 3)
+	wireBytes, err := request.WireBytes()
+	s.Require().NoError(err)
+	s.Equal(CapturedSegment{Time: first.Segments[0].Time, Direction: CaptureSent, Data: wireBytes}, first.Segments[0])
+	s.Equal(CaptureReceived, first.Segments[1].Direction)
+	s.Equal(response.RAW, first.Segments[1].Data)
+	s.Equal(CapturedSegment{Time: first.Segments[2].Time, Direction: CaptureSent, End: true}, first.Segments[2],
+		"closing the connection must be recorded")
+	s.False(first.Segments[1].Time.Before(first.Segments[0].Time))
+	// the connection belongs to the capture, so that closing it is recorded
+	s.Require().Len(connections[1].Segments, 1)
+	s.True(connections[1].Segments[0].End)
+}
+
+func (s *captureTestSuite) TestCaptureTLS() {
+	_, d := s.newServer(secureServer)
+	s.client.StartCapture()
+	s.Require().NoError(s.client.NewConnection(d))
+	response, err := s.client.Do(*generateBaseRequestForTesting())
+	s.Require().NoError(err)
+	s.NotNil(response.Parsed.TLS, "the TLS state must be available when recording")
+
+	connections := s.client.StopCapture().Connections()
+	s.Require().Len(connections, 1)
+	s.Require().NotEmpty(connections[0].Segments)
+	s.True(bytes.HasPrefix(connections[0].Segments[0].Data, []byte("UNEXISTENT /this/path HTTP/1.4\r\n")), "TLS connections are recorded decrypted")
+}
+
+func (s *captureTestSuite) TestCaptureServerClose() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buffer := make([]byte, 1024)
+			_, _ = conn.Read(buffer)
+			if bytes.Contains(buffer, []byte("/reset")) {
+				// closing with a linger time of 0 sends an RST instead of a FIN
+				_ = conn.(*net.TCPConn).SetLinger(0)
+			}
+			_ = conn.Close()
+		}
+	}()
+	tcpAddr := listener.Addr().(*net.TCPAddr)
+	d := Destination{DestAddr: tcpAddr.IP.String(), Port: tcpAddr.Port, Protocol: "http"}
+
+	for uri, expected := range map[string]CapturedSegment{
+		"/close": {Direction: CaptureReceived, End: true},
+		"/reset": {Direction: CaptureReceived, Reset: true},
+	} {
+		s.Run(uri, func() {
+			s.client.StartCapture()
+			s.Require().NoError(s.client.NewConnection(d))
+			request := generateBaseRequestForTesting()
+			request.requestLine.URI = uri
+			_, err := s.client.Do(*request)
+			s.Require().Error(err)
+			connections := s.client.StopCapture().Connections()
+			s.Require().Len(connections, 1)
+			segments := connections[0].Segments
+			s.Require().Len(segments, 2)
+			expected.Time = segments[1].Time
+			s.Equal(expected, segments[1])
+		})
+	}
+}
+
+func (s *captureTestSuite) testCapture() *Capture {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &Capture{connections: []*CapturedConnection{{
+		LocalAddr:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000},
+		RemoteAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 8080},
+		Start:      start,
+		Segments: []CapturedSegment{
+			{Time: start.Add(time.Millisecond), Direction: CaptureSent, Data: []byte("GET / HTTP/1.1\r\n\r\n")},
+			{Time: start.Add(2 * time.Millisecond), Direction: CaptureReceived, Data: []byte("HTTP/1.1 403 Forbidden\r\n\r\n")},
+			{Time: start.Add(3 * time.Millisecond), Direction: CaptureReceived, End: true},
+			{Time: start.Add(4 * time.Millisecond), Direction: CaptureSent, End: true},
+		},
+	}}}
+}
+
+func (s *captureTestSuite) TestWriteTranscript() {
+	var buffer bytes.Buffer
+	s.Require().NoError(s.testCapture().WriteTranscript(&buffer))
+	s.Equal(`# connection 1 from 127.0.0.1:50000 to 127.0.0.2:8080 at 2024-05-01T12:00:00.000000Z
+# 2024-05-01T12:00:00.001000Z > 18 bytes
+GET / HTTP/1.1`+"\r\n\r\n"+`
+# 2024-05-01T12:00:00.002000Z < 26 bytes
+HTTP/1.1 403 Forbidden`+"\r\n\r\n"+`
+# 2024-05-01T12:00:00.003000Z < connection closed
+# 2024-05-01T12:00:00.004000Z > connection closed
+`, buffer.String())
+}
+
+// pcapngPacket is a packet read from a pcapng file
+type pcapngPacket struct {
+	timestamp uint64
+	data      []byte
+}
+
+// readPcapng checks the blocks of a pcapng file and returns the packets
+func (s *captureTestSuite) readPcapng(data []byte) []pcapngPacket {
+	packets := []pcapngPacket{}
+	blockTypes := []uint32{}
+	for len(data) > 0 {
+		s.Require().GreaterOrEqual(len(data), 12)
+		blockType := binary.LittleEndian.Uint32(data)
+		length := binary.LittleEndian.Uint32(data[4:])
+		s.Require().Zero(length%4, "blocks must be padded to 32 bits")
+		s.Require().LessOrEqual(int(length), len(data))
+		s.Equal(length, binary.LittleEndian.Uint32(data[length-4:]), "the block length must be repeated at the end")
+		body := data[8 : length-4]
+		switch blockType {
+		case pcapngSectionHeaderBlock:
+			s.Equal(pcapngByteOrderMagic, binary.LittleEndian.Uint32(body))
+		case pcapngInterfaceBlock:
+			s.Equal(pcapngLinkTypeRaw, binary.LittleEndian.Uint16(body))
+		case pcapngEnhancedPacketBlock:
+			capturedLength := binary.LittleEndian.Uint32(body[12:])
+			s.Equal(capturedLength, binary.LittleEndian.Uint32(body[16:]))
+			packets = append(packets, pcapngPacket{
+				timestamp: uint64(binary.LittleEndian.Uint32(body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:])),
+				data:      body[20 : 20+capturedLength],
+			})
+		}
+		blockTypes = append(blockTypes, blockType)
+		data = data[length:]
+	}
+	s.Require().GreaterOrEqual(len(blockTypes), 2)
+	s.Equal([]uint32{pcapngSectionHeaderBlock, pcapngInterfaceBlock}, blockTypes[:2])
+	return packets
+}
+
+func (s *captureTestSuite) TestWritePcapng() {
+	var buffer bytes.Buffer
+	capture := s.testCapture()
+	s.Require().NoError(capture.WritePcapng(&buffer))
+	packets := s.readPcapng(buffer.Bytes())
+
+	type tcpSegment struct {
+		srcPort, dstPort uint16
+		seq, ack         uint32
+		flags            byte
+		payload          string
+	}
+	segments := []tcpSegment{}
+	for _, packet := range packets {
+		ipPacket := packet.data
+		s.Require().Equal(byte(0x45), ipPacket[0])
+		s.Equal(uint16(0), internetChecksum(ipPacket[:20]), "the IPv4 header checksum must be valid")
+		s.Contains([]string{"127.0.0.1", "127.0.0.2"}, net.IP(ipPacket[12:16]).String())
+		tcp := ipPacket[20:]
+		pseudoHeader := append(append([]byte{}, ipPacket[12:20]...), 0, 6, byte(len(tcp)>>8), byte(len(tcp)))
+		s.Equal(uint16(0), internetChecksum(pseudoHeader, tcp), "the TCP checksum must be valid")
+		segments = append(segments, tcpSegment{
+			srcPort: binary.BigEndian.Uint16(tcp),
+			dstPort: binary.BigEndian.Uint16(tcp[2:]),
+			seq:     binary.BigEndian.Uint32(tcp[4:]),
+			ack:     binary.BigEndian.Uint32(tcp[8:]),
+			flags:   tcp[13],
+			payload: string(tcp[20:]),
+		})
+	}
+	s.Equal([]tcpSegment{
+		{50000, 8080, 0, 0, tcpSYN, ""},
+		{8080, 50000, 0, 1, tcpSYN | tcpACK, ""},
+		{50000, 8080, 1, 1, tcpACK, ""},
+		{50000, 8080, 1, 1, tcpPSH | tcpACK, "GET / HTTP/1.1\r\n\r\n"},
+		{8080, 50000, 1, 19, tcpPSH | tcpACK, "HTTP/1.1 403 Forbidden\r\n\r\n"},
+		{8080, 50000, 27, 19, tcpFIN | tcpACK, ""},
+		{50000, 8080, 19, 28, tcpFIN | tcpACK, ""},
+	}, segments)
+	s.Equal(uint64(capture.connections[0].Start.UnixMicro())+1000, packets[3].timestamp)
+}
+
+func (s *captureTestSuite) TestWritePcapngAddresses() {
+	capture := &Capture{connections: []*CapturedConnection{
+		{
+			LocalAddr:  &net.TCPAddr{IP: net.ParseIP("::1"), Port: 50000},
+			RemoteAddr: &net.TCPAddr{IP: net.ParseIP("::1"), Port: 443},
+			Start:      time.Now(),
+			Segments:   []CapturedSegment{{Time: time.Now(), Direction: CaptureSent, Data: make([]byte, maxCaptureSegment+1)}},
+		},
+		{
+			LocalAddr:  &net.UnixAddr{Net: "unix"},
+			RemoteAddr: &net.UnixAddr{Name: "/run/waf.sock", Net: "unix"},
+			Start:      time.Now(),
+		},
+	}}
+	var buffer bytes.Buffer
+	s.Require().NoError(capture.WritePcapng(&buffer))
+	packets := s.readPcapng(buffer.Bytes())
+	// handshake and two segments of the IPv6 connection, handshake of the Unix domain socket
+	s.Require().Len(packets, 8)
+
+	ipv6 := packets[3].data
+	s.Equal(byte(0x60), ipv6[0])
+	s.Equal(net.ParseIP("::1"), net.IP(ipv6[8:24]))
+	s.Equal(20+maxCaptureSegment, int(binary.BigEndian.Uint16(ipv6[4:])))
+	pseudoHeader := append(append([]byte{}, ipv6[8:40]...), 0, 0, byte((len(ipv6)-40)>>8), byte(len(ipv6)-40), 0, 0, 0, 6)
+	s.Equal(uint16(0), internetChecksum(pseudoHeader, ipv6[40:]), "the TCP checksum must be valid")
+	s.Len(packets[4].data, 40+20+1, "large writes must be split")
+
+	var unixPackets [][]byte
+	for _, packet := range packets {
+		if packet.data[0] == 0x45 {
+			unixPackets = append(unixPackets, packet.data)
+		}
+	}
+	s.Require().Len(unixPackets, 3)
+	s.Equal(net.IPv4(127, 0, 0, 1).To4(), net.IP(unixPackets[0][12:16]))
+	s.Equal(uint16(49153), binary.BigEndian.Uint16(unixPackets[0][20:]))
+	s.Equal(uint16(80), binary.BigEndian.Uint16(unixPackets[0][22:]))
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bytes"
+	"fmt"
+
+	yamlv4 "go.yaml.in/yaml/v4"
+)
+
+// ChunkedOptions describes how the body of a request is sent with the chunked transfer encoding.
+// Without options, the body is sent as a single chunk followed by the last chunk. The remaining
+// options produce unusual or malformed encodings, e.g. to test request body inspection evasions.
+type ChunkedOptions struct {
+	// ChunkSizes are the sizes of the chunks the body is split into. The last size is repeated
+	// until the body is consumed. If empty, the body is sent as a single chunk.
+	ChunkSizes []int `yaml:"chunk_sizes,omitempty"`
+	// Extension is appended to the size line of every chunk, including the last chunk,
+	// e.g. ";name=value"
+	Extension string `yaml:"extension,omitempty"`
+	// SizeLines replace the size lines of the chunks, by position, including the last chunk. The
+	// lines are written as they are, e.g. "0x5" or "-1". Empty lines keep the computed size line.
+	SizeLines []string `yaml:"size_lines,omitempty"`
+	// Trailers are header lines sent after the last chunk, written as they are
+	Trailers []string `yaml:"trailers,omitempty"`
+	// OmitLastChunk leaves out the last chunk and the trailers
+	OmitLastChunk bool `yaml:"omit_last_chunk,omitempty"`
+	// ContentLength also adds a Content-Length header with the length of the encoded body when
+	// headers are autocompleted, so that the request has conflicting Content-Length and
+	// Transfer-Encoding headers
+	ContentLength bool `yaml:"content_length,omitempty"`
+}
+
+// UnmarshalYAML validates the options, so that mistakes are reported when loading the test
+func (o *ChunkedOptions) UnmarshalYAML(node *yamlv4.Node) error {
+	type plain ChunkedOptions
+	if err := node.Decode((*plain)(o)); err != nil {
+		return err
+	}
+	for _, size := range o.ChunkSizes {
+		if size < 1 {
+			return fmt.Errorf("line %d: chunked: chunk sizes must be positive, got %d", node.Line, size)
+		}
+	}
+	return nil
+}
+
+// Encode returns data encoded with the chunked transfer encoding
+func (o *ChunkedOptions) Encode(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	chunk := 0
+	for len(data) > 0 {
+		size := len(data)
+		if len(o.ChunkSizes) > 0 {
+			size = min(o.ChunkSizes[min(chunk, len(o.ChunkSizes)-1)], len(data))
+		}
+		buf.WriteString(o.sizeLine(chunk, size) + HeaderDelimiter)
+		buf.Write(data[:size])
+		buf.WriteString(HeaderDelimiter)
+		data = data[size:]
+		chunk++
+	}
+	if o.OmitLastChunk {
+		return buf.Bytes()
+	}
+	buf.WriteString(o.sizeLine(chunk, 0) + HeaderDelimiter)
+	for _, trailer := range o.Trailers {
+		buf.WriteString(trailer + HeaderDelimiter)
+	}
+	buf.WriteString(HeaderDelimiter)
+	return buf.Bytes()
+}
+
+// sizeLine returns the size line of the chunk at the given position
+func (o *ChunkedOptions) sizeLine(chunk int, size int) string {
+	if chunk < len(o.SizeLines) && o.SizeLines[chunk] != "" {
+		return o.SizeLines[chunk]
+	}
+	return fmt.Sprintf("%x", size) + o.Extension
+}
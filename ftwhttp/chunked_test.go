@@ -0,0 +1,112 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	yamlv4 "go.yaml.in/yaml/v4"
+
+	header_names "github.com/coreruleset/go-ftw/v2/ftwhttp/header_names"
+)
+
+type chunkedTestSuite struct {
+	suite.Suite
+}
+
+func TestChunkedTestSuite(t *testing.T) {
+	suite.Run(t, new(chunkedTestSuite))
+}
+
+func (s *chunkedTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *chunkedTestSuite) TestEncode() {
+	tests := []struct {
+		name     string
+		options  ChunkedOptions
+		data     string
+		expected string
+	}{
+		{"single chunk", ChunkedOptions{}, "a=<script>", "a\r\na=<script>\r\n0\r\n\r\n"},
+		{"empty body", ChunkedOptions{}, "", "0\r\n\r\n"},
+		{"chunk sizes", ChunkedOptions{ChunkSizes: []int{1, 4}}, "a=<script>", "1\r\na\r\n4\r\n=<sc\r\n4\r\nript\r\n1\r\n>\r\n0\r\n\r\n"},
+		{"extension", ChunkedOptions{ChunkSizes: []int{2}, Extension: ";x=y"}, "abc", "2;x=y\r\nab\r\n1;x=y\r\nc\r\n0;x=y\r\n\r\n"},
+		{"size lines", ChunkedOptions{ChunkSizes: []int{2}, SizeLines: []string{"0x2", "", "-0"}}, "abc", "0x2\r\nab\r\n1\r\nc\r\n-0\r\n\r\n"},
+		{"trailers", ChunkedOptions{Trailers: []string{"X-Trailer: 1", "Content-Type: text/xml"}}, "abc", "3\r\nabc\r\n0\r\nX-Trailer: 1\r\nContent-Type: text/xml\r\n\r\n"},
+		{"omit last chunk", ChunkedOptions{OmitLastChunk: true, Trailers: []string{"X-Trailer: 1"}}, "abc", "3\r\nabc\r\n"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.Equal(tt.expected, string(tt.options.Encode([]byte(tt.data))))
+		})
+	}
+}
+
+func (s *chunkedTestSuite) TestUnmarshalYAML() {
+	options := &ChunkedOptions{}
+	s.Require().NoError(yamlv4.Unmarshal([]byte("{chunk_sizes: [3, 1], extension: ';a', content_length: true}"), options))
+	s.Equal(&ChunkedOptions{ChunkSizes: []int{3, 1}, Extension: ";a", ContentLength: true}, options)
+
+	err := yamlv4.Unmarshal([]byte("{chunk_sizes: [3, 0]}"), &ChunkedOptions{})
+	s.ErrorContains(err, "chunk sizes must be positive, got 0")
+}
+
+func (s *chunkedTestSuite) newRequest(headers *Header, options *ChunkedOptions) *Request {
+	req := NewRequest(&RequestLine{Method: "POST", URI: "/", Version: "HTTP/1.1"}, headers, []byte("a=b"), true)
+	req.SetChunked(options)
+	return req
+}
+
+func (s *chunkedTestSuite) TestStandardHeaders() {
+	h := NewHeader()
+	h.Add("Host", "localhost")
+	data, err := s.newRequest(h, &ChunkedOptions{}).WireBytes()
+	s.Require().NoError(err)
+	s.Equal("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/x-www-form-urlencoded\r\n"+
+		"Connection: close\r\nTransfer-Encoding: chunked\r\n\r\n3\r\na=b\r\n0\r\n\r\n", string(data))
+
+	req := s.newRequest(h, &ChunkedOptions{ContentLength: true})
+	_, err = req.WireBytes()
+	s.Require().NoError(err)
+	s.Equal("13", req.Headers().GetAll(header_names.ContentLength)[0].Value, "the length of the encoded body")
+
+	h.Add(header_names.TransferEncoding, "gzip, chunked")
+	h.Add(header_names.ContentLength, "3")
+	req = s.newRequest(h, &ChunkedOptions{})
+	_, err = req.WireBytes()
+	s.Require().NoError(err)
+	s.Len(req.Headers().GetAll(header_names.TransferEncoding), 1)
+	s.Equal("gzip, chunked", req.Headers().GetAll(header_names.TransferEncoding)[0].Value)
+	s.Equal("3", req.Headers().GetAll(header_names.ContentLength)[0].Value)
+}
+
+func (s *chunkedTestSuite) TestSendChunkedRequest() {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- strings.Join(r.TransferEncoding, ",") + " " + string(body) + " " + r.Trailer.Get("X-Trailer")
+	}))
+	defer ts.Close()
+	client, err := NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+	d, err := DestinationFromString(ts.URL)
+	s.Require().NoError(err)
+	s.Require().NoError(client.NewConnection(*d))
+
+	h := NewHeader()
+	h.Add("Host", "localhost")
+	h.Add("Trailer", "X-Trailer")
+	response, err := client.Do(*s.newRequest(h, &ChunkedOptions{ChunkSizes: []int{1}, Extension: ";ext", Trailers: []string{"X-Trailer: yes"}}))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.Parsed.StatusCode)
+	s.Equal("chunked a=b yes", <-received)
+}
@@ -7,13 +7,12 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"net"
 	"net/http/cookiejar"
 	"strings"
 	"time"
 
-	"fmt"
-
 	"github.com/coreruleset/go-ftw/v2/config"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/publicsuffix"
@@ -29,7 +28,9 @@ func NewClientConfig() *ClientConfig {
 	}
 }
 
-// NewClientConfig returns a new ClientConfig with reasonable defaults.
+// NewClientConfigFromConfig returns a new ClientConfig with reasonable defaults.
+// The TLS options, the proxy and the resolve mapping are not set, see NewTLSOptions, ParseProxyURL
+// and ParseResolve.
 func NewClientConfigFromConfig(runnerConfig *config.RunnerConfig) *ClientConfig {
 	config := NewClientConfig()
 	if runnerConfig.ConnectTimeout != 0 {
@@ -62,7 +63,21 @@ func NewClientWithConfig(config *ClientConfig) (*Client, error) {
 
 // NewClient initializes the http client, creating the cookiejar
 func NewClient(runnerConfig *config.RunnerConfig) (*Client, error) {
-	return NewClientWithConfig(NewClientConfigFromConfig(runnerConfig))
+	clientConfig := NewClientConfigFromConfig(runnerConfig)
+	tlsOptions, err := NewTLSOptions(runnerConfig.TLS)
+	if err != nil {
+		return nil, err
+	}
+	clientConfig.TLS = *tlsOptions
+	if runnerConfig.Proxy != "" {
+		if clientConfig.Proxy, err = ParseProxyURL(runnerConfig.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	if clientConfig.Resolve, err = ParseResolve(runnerConfig.Resolve); err != nil {
+		return nil, err
+	}
+	return NewClientWithConfig(clientConfig)
 }
 
 // SetRootCAs sets the root CAs for the client.
@@ -78,10 +93,14 @@ func (c *Client) SetRateLimiter(limiter *rate.Limiter) {
 
 // NewConnection creates a new Connection based on a Destination
 func (c *Client) NewConnection(d Destination) error {
-	if c.Transport != nil && c.Transport.connection != nil {
-		if err := c.Transport.connection.Close(); err != nil {
-			return err
-		}
+	return c.NewConnectionWithTLSOptions(d, nil)
+}
+
+// NewConnectionWithTLSOptions creates a new Connection based on a Destination. The non-zero fields
+// of tlsOptions replace the TLS options of the client config for this connection.
+func (c *Client) NewConnectionWithTLSOptions(d Destination, tlsOptions *TLSOptions) error {
+	if err := c.closeConnections(); err != nil {
+		return err
 	}
 
 	c.Transport = &Connection{
@@ -90,7 +109,7 @@ func (c *Client) NewConnection(d Destination) error {
 		duration:    NewRoundTripTime(),
 	}
 
-	netConn, err := c.dial(d)
+	netConn, err := c.dial(d, tlsOptions)
 	if err == nil {
 		c.Transport.connection = netConn
 	}
@@ -99,16 +118,19 @@ func (c *Client) NewConnection(d Destination) error {
 }
 
 // NewOrReusedConnection reuses an existing connection, or creates a new one
-// if no connection has been set up yet
+// if no connection has been set up yet. The HTTP/3 connection is kept, see NewHTTP3Connection.
 func (c *Client) NewOrReusedConnection(d Destination) error {
 	if c.Transport == nil {
-		return c.NewConnection(d)
-	}
-	if err := c.Transport.connection.Close(); err != nil {
+		c.Transport = &Connection{
+			protocol:    d.Protocol,
+			readTimeout: c.config.ReadTimeout,
+			duration:    NewRoundTripTime(),
+		}
+	} else if err := c.Transport.connection.Close(); err != nil {
 		return err
 	}
 
-	netConn, err := c.dial(d)
+	netConn, err := c.dial(d, nil)
 	if err == nil {
 		c.Transport.connection = netConn
 	}
@@ -116,24 +138,53 @@ func (c *Client) NewOrReusedConnection(d Destination) error {
 	return err
 }
 
-// dial tries to establish a connection
-func (c *Client) dial(d Destination) (net.Conn, error) {
-	hostPort := net.JoinHostPort(d.DestAddr, fmt.Sprint(d.Port))
+// dial tries to establish a connection, through the proxy of the client config if one is set.
+// Unix domain sockets are always connected to directly.
+// Errors are classified, see TransportError.
+func (c *Client) dial(d Destination, tlsOptions *TLSOptions) (net.Conn, error) {
+	network, address := c.address(d)
+
+	ctx := context.Background()
+	if c.config.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.ConnectTimeout)
+		defer cancel()
+	}
 
-	if strings.ToLower(d.Protocol) == "https" {
-		return tls.DialWithDialer(
-			&net.Dialer{
-				Timeout: c.config.ConnectTimeout,
-			},
-			"tcp", hostPort,
-			&tls.Config{
-				MinVersion:         tls.VersionTLS12,
-				RootCAs:            c.config.RootCAs,
-				InsecureSkipVerify: c.config.SkipTlsVerification,
-			})
+	var dialer contextDialer = &net.Dialer{}
+	if c.config.Proxy != nil && network != "unix" {
+		var err error
+		if dialer, err = newProxyDialer(c.config.Proxy, &net.Dialer{}); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, connectError(err)
+	}
+
+	if strings.ToLower(d.Protocol) != "https" {
+		return c.recordConn(conn), nil
+	}
+	tlsConfig := c.tlsConfig(tlsOptions)
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = d.DestAddr
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, handshakeError(err)
 	}
+	return c.recordConn(tlsConn), nil
+}
 
-	return net.DialTimeout("tcp", hostPort, c.config.ConnectTimeout)
+// recordConn returns conn, recording its traffic if a capture was started. TLS connections are
+// recorded after the handshake, so that the decrypted data is recorded.
+func (c *Client) recordConn(conn net.Conn) net.Conn {
+	if c.capture == nil {
+		return conn
+	}
+	return c.capture.record(conn)
 }
 
 // Do perform the http request round trip.
@@ -145,6 +196,12 @@ func (c *Client) Do(req Request) (*Response, error) {
 		log.Error().Msgf("http/client: error waiting on rate limiter: %s\n", err.Error())
 		return response, err
 	}
+	if req.UsesHTTP3() {
+		if c.HTTP3Transport == nil || c.HTTP3Transport.conn == nil {
+			return nil, errors.New("ftw/http3: not connected to server")
+		}
+		return c.HTTP3Transport.RoundTrip(&req)
+	}
 	err = c.Transport.Request(&req)
 
 	if err != nil {
@@ -162,15 +219,26 @@ func (c *Client) Do(req Request) (*Response, error) {
 
 // GetRoundTripTime returns the time taken from the initial send till receiving the full response
 func (c *Client) GetRoundTripTime() *RoundTripTime {
+	if c.HTTP3Transport != nil {
+		return c.HTTP3Transport.GetTrackedTime()
+	}
 	return c.Transport.GetTrackedTime()
 }
 
 // StartTrackingTime sets the timer to start transactions. This will be the starting time in logs.
 func (c *Client) StartTrackingTime() {
+	if c.HTTP3Transport != nil {
+		c.HTTP3Transport.StartTrackingTime()
+		return
+	}
 	c.Transport.StartTrackingTime()
 }
 
 // StopTrackingTime stops the timer. When looking at logs, we will read up to this one.
 func (c *Client) StopTrackingTime() {
+	if c.HTTP3Transport != nil {
+		c.HTTP3Transport.StopTrackingTime()
+		return
+	}
 	c.Transport.StopTrackingTime()
 }
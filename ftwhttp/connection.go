@@ -7,6 +7,7 @@ package ftwhttp
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -25,6 +26,9 @@ func DestinationFromString(urlString string) (*Destination, error) {
 	if err != nil {
 		return nil, err
 	}
+	if u.Scheme == UnixProtocol {
+		return &Destination{DestAddr: u.Host + u.Path, Protocol: UnixProtocol}, nil
+	}
 	host, port, _ := net.SplitHostPort(u.Host)
 	p, _ := strconv.Atoi(port)
 
@@ -61,6 +65,7 @@ func (c *Connection) send(data []byte) (int, error) {
 
 	if c.connection != nil {
 		sent, err = c.connection.Write(data)
+		err = writeError(err)
 	} else {
 		err = errors.New("ftw/http/send: not connected to server")
 	}
@@ -84,15 +89,9 @@ func (c *Connection) receive() (io.Reader, error) {
 // Request will use all the inputs and send a raw http request to the destination
 func (c *Connection) Request(request *Request) error {
 	// Build request first, then connect and send, so timers are accurate
-	var data []byte
-	var err error
-	if request.isRaw {
-		data = request.rawRequest
-	} else {
-		data, err = BuildRequest(request)
-		if err != nil {
-			return fmt.Errorf("ftw/http: fatal error building request: %w", err)
-		}
+	data, err := request.WireBytes()
+	if err != nil {
+		return fmt.Errorf("ftw/http: fatal error building request: %w", err)
 	}
 
 	log.Debug().Msgf("ftw/http: sending data:\n%s\n", data)
@@ -109,27 +108,39 @@ func (c *Connection) Request(request *Request) error {
 // Response reads the response sent by the WAF and return the corresponding struct
 // It leverages the go stdlib for reading and parsing the response
 func (c *Connection) Response() (*Response, error) {
+	response, _, err := c.readResponse()
+	return response, err
+}
+
+// readResponse reads the response and returns it together with the reader, which holds the data
+// that was received after the response, e.g. the first WebSocket frames
+func (c *Connection) readResponse() (*Response, *bufio.Reader, error) {
 	r, err := c.receive()
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	buf := &bytes.Buffer{}
 
-	reader := *bufio.NewReader(io.TeeReader(r, buf))
+	reader := bufio.NewReader(io.TeeReader(r, buf))
 
-	httpResponse, err := http.ReadResponse(&reader, nil)
+	httpResponse, err := http.ReadResponse(reader, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, readError(err, MalformedResponseCategory)
 	}
 
 	data := buf.Bytes()
 	log.Debug().Msgf("ftw/http: received data - %q", data)
 
+	if tlsConn, ok := unwrapConn(c.connection).(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		httpResponse.TLS = &state
+	}
+
 	response := Response{
 		RAW:    data,
 		Parsed: *httpResponse,
 	}
-	return &response, err
+	return &response, reader, err
 }
@@ -0,0 +1,108 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httputil"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// headerTerminator separates the headers of a response from its body
+var headerTerminator = []byte("\r\n\r\n")
+
+// GetDecodedResponse gives the full response as string, with the body decoded: the chunked
+// transfer encoding is removed, and the content encodings gzip, deflate, br and identity are
+// decoded. The status line and headers are returned as they were received. RAW is not modified.
+// An error is returned if the body can't be decoded, e.g. for unsupported content encodings such
+// as "zstd", or if the body was not completely received.
+func (r *Response) GetDecodedResponse() (string, error) {
+	index := bytes.Index(r.RAW, headerTerminator)
+	if index < 0 {
+		return "", errors.New("ftw/http: decode: the response has no complete headers")
+	}
+	head := r.RAW[:index+len(headerTerminator)]
+	body, err := r.DecodeBody(r.RAW[len(head):])
+	if err != nil {
+		return "", err
+	}
+	return string(head) + string(body), nil
+}
+
+// DecodeBody decodes the raw body of the response according to its Transfer-Encoding and
+// Content-Encoding headers
+func (r *Response) DecodeBody(raw []byte) ([]byte, error) {
+	body := raw
+	if slices.Contains(r.Parsed.TransferEncoding, "chunked") {
+		decoded, err := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(body)))
+		if err != nil {
+			return nil, fmt.Errorf("ftw/http: decode: invalid chunked body: %w", err)
+		}
+		body = decoded
+	}
+
+	encodings := contentEncodings(r.Parsed.Header.Values("Content-Encoding"))
+	// encodings are listed in the order in which they were applied
+	for _, encoding := range slices.Backward(encodings) {
+		decoded, err := decodeContent(encoding, body)
+		if err != nil {
+			return nil, fmt.Errorf("ftw/http: decode: %w", err)
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+// contentEncodings splits the values of Content-Encoding headers into a list of encodings
+func contentEncodings(values []string) []string {
+	encodings := []string{}
+	for _, value := range values {
+		for encoding := range strings.SplitSeq(value, ",") {
+			if encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding != "" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+	return encodings
+}
+
+// decodeContent removes a single content encoding from data
+func decodeContent(encoding string, data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "identity":
+		return data, nil
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		// deflate is supposed to be zlib wrapped, but some servers send raw deflate data
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(data)), nil
+		}
+	case "br":
+		reader = io.NopCloser(brotli.NewReader(bytes.NewReader(data)))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s content: %w", encoding, err)
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s content: %w", encoding, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const decodeTestBody = "<html><body>Access denied</body></html>"
+
+type decodeTestSuite struct {
+	suite.Suite
+}
+
+func TestDecodeTestSuite(t *testing.T) {
+	suite.Run(t, new(decodeTestSuite))
+}
+
+func (s *decodeTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *decodeTestSuite) compress(encoding string, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(buf)
+	case "deflate":
+		writer = zlib.NewWriter(buf)
+	case "br":
+		writer = brotli.NewWriter(buf)
+	case "raw deflate":
+		var err error
+		writer, err = flate.NewWriter(buf, flate.DefaultCompression)
+		s.Require().NoError(err)
+	}
+	_, err := writer.Write(data)
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+	return buf.Bytes()
+}
+
+// newResponse builds a response from the raw headers and body, as the connection does
+func (s *decodeTestSuite) newResponse(head string, body []byte) *Response {
+	raw := append([]byte(head), body...)
+	parsed, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	s.Require().NoError(err)
+	return &Response{RAW: raw, Parsed: *parsed}
+}
+
+func (s *decodeTestSuite) TestDecodedResponse() {
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"identity", "identity", []byte(decodeTestBody)},
+		{"gzip", "gzip", s.compress("gzip", []byte(decodeTestBody))},
+		{"x-gzip", "x-gzip", s.compress("gzip", []byte(decodeTestBody))},
+		{"deflate", "deflate", s.compress("deflate", []byte(decodeTestBody))},
+		{"raw deflate", "deflate", s.compress("raw deflate", []byte(decodeTestBody))},
+		{"br", "br", s.compress("br", []byte(decodeTestBody))},
+		{"multiple encodings", "deflate, GZIP", s.compress("gzip", s.compress("deflate", []byte(decodeTestBody)))},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			head := "HTTP/1.1 200 OK\r\nContent-Encoding: " + tt.encoding + "\r\nConnection: close\r\n\r\n"
+			response := s.newResponse(head, tt.body)
+			decoded, err := response.GetDecodedResponse()
+			s.Require().NoError(err)
+			s.Equal(head+decodeTestBody, decoded)
+			s.Equal(append([]byte(head), tt.body...), response.RAW, "the raw response must not be modified")
+		})
+	}
+}
+
+func (s *decodeTestSuite) TestDecodedChunkedResponse() {
+	compressed := s.compress("gzip", []byte(decodeTestBody))
+	head := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Encoding: gzip\r\n\r\n"
+	body := []byte("10\r\n")
+	body = append(body, compressed[:16]...)
+	body = append(body, fmt.Appendf(nil, "\r\n%X\r\n", len(compressed)-16)...)
+	body = append(body, compressed[16:]...)
+	body = append(body, []byte("\r\n0\r\n\r\n")...)
+
+	decoded, err := s.newResponse(head, body).GetDecodedResponse()
+	s.Require().NoError(err)
+	s.Equal(head+decodeTestBody, decoded)
+}
+
+func (s *decodeTestSuite) TestDecodedResponseErrors() {
+	tests := []struct {
+		name     string
+		head     string
+		body     string
+		expected string
+	}{
+		{"unsupported encoding", "HTTP/1.1 200 OK\r\nContent-Encoding: zstd\r\n\r\n", decodeTestBody, `unsupported content encoding "zstd"`},
+		{"invalid br", "HTTP/1.1 200 OK\r\nContent-Encoding: br\r\n\r\n", decodeTestBody, "invalid br content"},
+		{"invalid gzip", "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\n\r\n", decodeTestBody, "invalid gzip content"},
+		{"truncated chunked body", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", "20\r\n<html>", "invalid chunked body"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			_, err := s.newResponse(tt.head, []byte(tt.body)).GetDecodedResponse()
+			s.ErrorContains(err, tt.expected)
+		})
+	}
+
+	_, err := (&Response{RAW: []byte("HTTP/1.1 200 OK\r\n")}).GetDecodedResponse()
+	s.ErrorContains(err, "the response has no complete headers")
+}
+
+func (s *decodeTestSuite) TestDecodeReceivedResponse() {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		_, _ = writer.Write([]byte(strings.Repeat(decodeTestBody, 10)))
+		_ = writer.Close()
+		// flushing before the end of the handler makes the server use the chunked transfer encoding
+		w.(http.Flusher).Flush()
+	}))
+	defer ts.Close()
+	client, err := NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+	d, err := DestinationFromString(ts.URL)
+	s.Require().NoError(err)
+	s.Require().NoError(client.NewConnection(*d))
+
+	response, err := client.Do(*generateBaseRequestForTesting())
+	s.Require().NoError(err)
+	s.Contains(response.GetFullResponse(), "Transfer-Encoding: chunked")
+	s.NotContains(response.GetFullResponse(), decodeTestBody)
+	decoded, err := response.GetDecodedResponse()
+	s.Require().NoError(err)
+	s.True(strings.HasSuffix(decoded, "\r\n\r\n"+strings.Repeat(decodeTestBody, 10)))
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	yamlv4 "go.yaml.in/yaml/v4"
+	"golang.org/x/net/quic"
+)
+
+// ErrorCategory classifies the errors of connecting to a server, sending a request and receiving
+// the response. WAFs block requests in different ways, e.g. by resetting the connection or by
+// closing it silently, which the categories tell apart.
+type ErrorCategory string
+
+const (
+	// ConnectionRefusedCategory is used if the server refused the connection
+	ConnectionRefusedCategory ErrorCategory = "connection_refused"
+	// ConnectTimeoutCategory is used if the connection, including the TLS handshake, wasn't
+	// established within the connect timeout
+	ConnectTimeoutCategory ErrorCategory = "connect_timeout"
+	// ReadTimeoutCategory is used if the response wasn't received within the read timeout
+	ReadTimeoutCategory ErrorCategory = "read_timeout"
+	// ConnectionResetCategory is used if the server reset the connection (or the HTTP/3 stream)
+	ConnectionResetCategory ErrorCategory = "connection_reset"
+	// EOFBeforeHeadersCategory is used if the server closed the connection before the headers of
+	// the response were complete
+	EOFBeforeHeadersCategory ErrorCategory = "eof_before_headers"
+	// TLSHandshakeCategory is used if the TLS handshake failed, e.g. with an alert of the server
+	TLSHandshakeCategory ErrorCategory = "tls_handshake_failure"
+	// MalformedResponseCategory is used if the response couldn't be parsed
+	MalformedResponseCategory ErrorCategory = "malformed_response"
+	// OtherErrorCategory is used for all other errors
+	OtherErrorCategory ErrorCategory = "other"
+)
+
+var errorCategories = []ErrorCategory{
+	ConnectionRefusedCategory,
+	ConnectTimeoutCategory,
+	ReadTimeoutCategory,
+	ConnectionResetCategory,
+	EOFBeforeHeadersCategory,
+	TLSHandshakeCategory,
+	MalformedResponseCategory,
+	OtherErrorCategory,
+}
+
+// TransportError is an error of connecting to a server, sending a request or receiving a
+// response, together with its category
+type TransportError struct {
+	Category ErrorCategory
+	Err      error
+}
+
+func (e *TransportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCategoryOf returns the category of err. Errors that are not transport errors belong to
+// OtherErrorCategory. The empty category is returned if err is nil.
+func ErrorCategoryOf(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return transportErr.Category
+	}
+	return OtherErrorCategory
+}
+
+// UnmarshalYAML accepts the known categories only
+func (c *ErrorCategory) UnmarshalYAML(node *yamlv4.Node) error {
+	var category string
+	if err := node.Decode(&category); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(errorCategories))
+	for _, known := range errorCategories {
+		if ErrorCategory(category) == known {
+			*c = known
+			return nil
+		}
+		names = append(names, "'"+string(known)+"'")
+	}
+	return fmt.Errorf("line %d: invalid error category %q, expected one of %s", node.Line, category, strings.Join(names, ", "))
+}
+
+// newTransportError returns err with the given category. Errors that already have a category
+// keep it.
+func newTransportError(category ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return err
+	}
+	return &TransportError{Category: category, Err: err}
+}
+
+// connectError classifies an error of establishing a connection
+func connectError(err error) error {
+	category := OtherErrorCategory
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		category = ConnectionRefusedCategory
+	case isTimeout(err):
+		category = ConnectTimeoutCategory
+	case isReset(err):
+		category = ConnectionResetCategory
+	}
+	return newTransportError(category, err)
+}
+
+// handshakeError classifies an error of the TLS handshake
+func handshakeError(err error) error {
+	category := TLSHandshakeCategory
+	switch {
+	case isTimeout(err):
+		category = ConnectTimeoutCategory
+	case isReset(err):
+		category = ConnectionResetCategory
+	}
+	return newTransportError(category, err)
+}
+
+// writeError classifies an error of sending a request
+func writeError(err error) error {
+	category := OtherErrorCategory
+	switch {
+	case isTimeout(err):
+		category = ReadTimeoutCategory
+	case isReset(err):
+		category = ConnectionResetCategory
+	}
+	return newTransportError(category, err)
+}
+
+// readError classifies an error of receiving the headers of a response. Errors of the connection
+// that aren't timeouts, resets or EOF belong to OtherErrorCategory, all remaining errors to
+// fallback.
+func readError(err error, fallback ErrorCategory) error {
+	category := fallback
+	var opErr *net.OpError
+	switch {
+	case isTimeout(err):
+		category = ReadTimeoutCategory
+	case isReset(err):
+		category = ConnectionResetCategory
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		category = EOFBeforeHeadersCategory
+	case errors.As(err, &opErr):
+		category = OtherErrorCategory
+	}
+	return newTransportError(category, err)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func isReset(err error) bool {
+	var streamErr quic.StreamErrorCode
+	var applicationErr *quic.ApplicationError
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &streamErr) || errors.As(err, &applicationErr)
+}
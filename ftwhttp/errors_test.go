@@ -0,0 +1,189 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	yamlv4 "go.yaml.in/yaml/v4"
+)
+
+type errorsTestSuite struct {
+	suite.Suite
+	client   *Client
+	listener net.Listener
+}
+
+func TestErrorsTestSuite(t *testing.T) {
+	suite.Run(t, new(errorsTestSuite))
+}
+
+func (s *errorsTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *errorsTestSuite) SetupTest() {
+	config := NewClientConfig()
+	config.ReadTimeout = 200 * time.Millisecond
+	var err error
+	s.client, err = NewClientWithConfig(config)
+	s.Require().NoError(err)
+	s.listener = nil
+}
+
+func (s *errorsTestSuite) TearDownTest() {
+	if s.listener != nil {
+		s.Require().NoError(s.listener.Close())
+	}
+}
+
+// serve accepts a single connection, reads the request headers and passes the connection to respond
+func (s *errorsTestSuite) serve(respond func(conn *net.TCPConn)) Destination {
+	var err error
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	go func() {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		if _, err := http.ReadRequest(reader); err != nil {
+			return
+		}
+		respond(conn.(*net.TCPConn))
+	}()
+	return s.destination(s.listener.Addr())
+}
+
+func (s *errorsTestSuite) destination(addr net.Addr) Destination {
+	tcpAddr := addr.(*net.TCPAddr)
+	return Destination{DestAddr: tcpAddr.IP.String(), Port: tcpAddr.Port, Protocol: "http"}
+}
+
+func (s *errorsTestSuite) do(d Destination) error {
+	s.Require().NoError(s.client.NewConnection(d))
+	_, err := s.client.Do(*generateBaseRequestForTesting())
+	return err
+}
+
+func (s *errorsTestSuite) TestConnectionRefused() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	d := s.destination(listener.Addr())
+	s.Require().NoError(listener.Close())
+
+	err = s.client.NewConnection(d)
+	s.Equal(ConnectionRefusedCategory, ErrorCategoryOf(err))
+	s.ErrorIs(err, syscall.ECONNREFUSED)
+}
+
+func (s *errorsTestSuite) TestConnectionReset() {
+	d := s.serve(func(conn *net.TCPConn) {
+		// closing with a linger time of 0 sends an RST instead of a FIN
+		_ = conn.SetLinger(0)
+	})
+	s.Equal(ConnectionResetCategory, ErrorCategoryOf(s.do(d)))
+}
+
+func (s *errorsTestSuite) TestEOFBeforeHeaders() {
+	tests := map[string]string{
+		"no response":        "",
+		"incomplete headers": "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n",
+	}
+	for name, response := range tests {
+		s.Run(name, func() {
+			d := s.serve(func(conn *net.TCPConn) {
+				_, _ = conn.Write([]byte(response))
+			})
+			s.Equal(EOFBeforeHeadersCategory, ErrorCategoryOf(s.do(d)))
+			s.Require().NoError(s.listener.Close())
+			s.listener = nil
+		})
+	}
+}
+
+func (s *errorsTestSuite) TestMalformedResponse() {
+	d := s.serve(func(conn *net.TCPConn) {
+		_, _ = conn.Write([]byte("this is not HTTP\r\n\r\n"))
+	})
+	s.Equal(MalformedResponseCategory, ErrorCategoryOf(s.do(d)))
+}
+
+func (s *errorsTestSuite) TestReadTimeout() {
+	done := make(chan struct{})
+	defer close(done)
+	d := s.serve(func(conn *net.TCPConn) {
+		<-done
+	})
+	s.Equal(ReadTimeoutCategory, ErrorCategoryOf(s.do(d)))
+}
+
+func (s *errorsTestSuite) TestTLSHandshakeFailure() {
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+	d, err := DestinationFromString(ts.URL)
+	s.Require().NoError(err)
+
+	// the certificate of the test server is not trusted
+	err = s.client.NewConnection(*d)
+	s.Equal(TLSHandshakeCategory, ErrorCategoryOf(err))
+}
+
+func (s *errorsTestSuite) TestClassification() {
+	timeout := &net.OpError{Op: "read", Err: context.DeadlineExceeded}
+	reset := &net.OpError{Op: "read", Err: syscall.ECONNRESET}
+	tests := []struct {
+		name     string
+		err      error
+		expected ErrorCategory
+	}{
+		{"connect refused", connectError(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), ConnectionRefusedCategory},
+		{"connect timeout", connectError(timeout), ConnectTimeoutCategory},
+		{"connect reset", connectError(reset), ConnectionResetCategory},
+		{"connect other", connectError(errors.New("proxy refused")), OtherErrorCategory},
+		{"handshake timeout", handshakeError(timeout), ConnectTimeoutCategory},
+		{"handshake alert", handshakeError(errors.New("remote error: tls: handshake failure")), TLSHandshakeCategory},
+		{"write broken pipe", writeError(&net.OpError{Op: "write", Err: syscall.EPIPE}), ConnectionResetCategory},
+		{"read timeout", readError(timeout, MalformedResponseCategory), ReadTimeoutCategory},
+		{"read unexpected EOF", readError(io.ErrUnexpectedEOF, MalformedResponseCategory), EOFBeforeHeadersCategory},
+		{"read network error", readError(&net.OpError{Op: "read", Err: errors.New("no route")}, MalformedResponseCategory), OtherErrorCategory},
+		{"read parse error", readError(errors.New("malformed HTTP status code"), MalformedResponseCategory), MalformedResponseCategory},
+		{"wrapped", fmt.Errorf("failed: %w", readError(reset, OtherErrorCategory)), ConnectionResetCategory},
+		{"classified once", readError(connectError(timeout), MalformedResponseCategory), ConnectTimeoutCategory},
+		{"unclassified", errors.New("not connected"), OtherErrorCategory},
+		{"no error", nil, ""},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.Equal(tt.expected, ErrorCategoryOf(tt.err))
+		})
+	}
+	s.Nil(readError(nil, MalformedResponseCategory))
+}
+
+func (s *errorsTestSuite) TestUnmarshalYAML() {
+	var category ErrorCategory
+	s.Require().NoError(yamlv4.Unmarshal([]byte("connection_reset"), &category))
+	s.Equal(ConnectionResetCategory, category)
+
+	err := yamlv4.Unmarshal([]byte("reset"), &category)
+	s.ErrorContains(err, `invalid error category "reset", expected one of 'connection_refused', 'connect_timeout'`)
+}
@@ -1,7 +1,9 @@
 package header_names
 
 const (
-	Connection    = "Connection"
-	ContentType   = "Content-Type"
-	ContentLength = "Content-Length"
+	Connection       = "Connection"
+	ContentType      = "Content-Type"
+	ContentLength    = "Content-Length"
+	Host             = "Host"
+	TransferEncoding = "Transfer-Encoding"
 )
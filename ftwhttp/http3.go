@@ -0,0 +1,518 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/quic"
+
+	header_names "github.com/coreruleset/go-ftw/v2/ftwhttp/header_names"
+)
+
+// HTTP3Version is the version of requests that are sent over HTTP/3, see Client.NewHTTP3Connection
+const HTTP3Version = "HTTP/3"
+
+// http3ALPN is the ALPN protocol of HTTP/3
+const http3ALPN = "h3"
+
+// HTTP/3 frame and stream types, see RFC 9114, sections 6.2 and 7.2
+const (
+	http3FrameData     = 0x0
+	http3FrameHeaders  = 0x1
+	http3FrameSettings = 0x4
+	http3StreamControl = 0x0
+)
+
+// http3MissingSettings is the error code of a control stream that doesn't start with a SETTINGS
+// frame, see RFC 9114, section 8.1
+const http3MissingSettings = 0x10a
+
+// maxHTTP3FrameSize limits the size of received frames
+const maxHTTP3FrameSize = 16 << 20
+
+// http3ConnectionHeaders are connection-specific headers, which HTTP/3 doesn't allow, see RFC 9114,
+// section 4.2
+var http3ConnectionHeaders = []string{
+	header_names.Connection,
+	"Keep-Alive",
+	"Proxy-Connection",
+	header_names.TransferEncoding,
+	"Upgrade",
+}
+
+// UsesHTTP3 returns true if the request is sent over HTTP/3, i.e. if its version is HTTP3Version.
+// Raw requests are always sent as they are.
+func (r Request) UsesHTTP3() bool {
+	return !r.isRaw && r.requestLine.Version == HTTP3Version
+}
+
+// NewHTTP3Connection replaces the connections of the client with an HTTP/3 connection to d.
+// Requests with the version HTTP3Version are sent over the HTTP/3 connection, other requests need
+// a connection created with NewOrReusedConnection. HTTP/3 always uses TLS; the TLS options are
+// applied as for NewConnectionWithTLSOptions, with the ALPN protocol "h3" unless the options set
+// one. Proxies and Unix domain sockets are not supported.
+//
+// All HTTP/3 connections of the client share a single UDP socket, which is closed by Close.
+func (c *Client) NewHTTP3Connection(d Destination, tlsOptions *TLSOptions) error {
+	if err := c.closeConnections(); err != nil {
+		return err
+	}
+	// the connection is set up before dialing, so that the time can be tracked if dialing fails
+	c.HTTP3Transport = &HTTP3Connection{
+		readTimeout: c.config.ReadTimeout,
+		duration:    NewRoundTripTime(),
+	}
+	if d.Protocol == UnixProtocol {
+		return errors.New("ftw/http3: Unix domain sockets are not supported")
+	}
+	if c.config.Proxy != nil {
+		return errors.New("ftw/http3: proxies are not supported")
+	}
+
+	ctx := context.Background()
+	if c.config.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.ConnectTimeout)
+		defer cancel()
+	}
+
+	tlsConfig := c.tlsConfig(tlsOptions)
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = d.DestAddr
+	}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{http3ALPN}
+	}
+	// QUIC requires TLS 1.3
+	tlsConfig.MinVersion = max(tlsConfig.MinVersion, tls.VersionTLS13)
+
+	if c.http3Endpoint == nil {
+		endpoint, err := quic.Listen("udp", ":0", nil)
+		if err != nil {
+			return err
+		}
+		c.http3Endpoint = endpoint
+	}
+	_, address := c.address(d)
+	// QUIC establishes the connection with the TLS handshake. Servers must not open
+	// bidirectional streams.
+	conn, err := c.http3Endpoint.Dial(ctx, "udp", address, &quic.Config{TLSConfig: tlsConfig, MaxBidiRemoteStreams: -1})
+	if err != nil {
+		return handshakeError(err)
+	}
+	c.HTTP3Transport.conn = conn
+	go c.HTTP3Transport.acceptStreams()
+	return writeError(c.HTTP3Transport.openControlStream(ctx))
+}
+
+// Close closes the connections of the client, including the UDP socket of HTTP/3 connections
+func (c *Client) Close() error {
+	if err := c.closeConnections(); err != nil {
+		return err
+	}
+	if c.http3Endpoint == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := c.http3Endpoint.Close(ctx)
+	c.http3Endpoint = nil
+	return err
+}
+
+// closeConnections closes the connection and the HTTP/3 connection of the client
+func (c *Client) closeConnections() error {
+	if c.Transport != nil && c.Transport.connection != nil {
+		if err := c.Transport.connection.Close(); err != nil {
+			return err
+		}
+	}
+	c.Transport = nil
+	if c.HTTP3Transport != nil {
+		if err := c.HTTP3Transport.Close(); err != nil {
+			return err
+		}
+	}
+	c.HTTP3Transport = nil
+	return nil
+}
+
+// openControlStream opens the control stream of the client and sends its (empty) settings, see
+// RFC 9114, section 6.2.1
+func (c *HTTP3Connection) openControlStream(ctx context.Context) error {
+	stream, err := c.conn.NewSendOnlyStream(ctx)
+	if err != nil {
+		return err
+	}
+	stream.SetWriteContext(ctx)
+	data := appendHTTP3Frame(appendVarint(nil, http3StreamControl), http3FrameSettings, nil)
+	if _, err := stream.Write(data); err != nil {
+		return err
+	}
+	return stream.Flush()
+}
+
+// acceptStreams reads the unidirectional streams that the server opens until the connection is
+// closed, see RFC 9114, section 6.2. The server's control stream must start with its SETTINGS;
+// the settings, the QPACK encoder and decoder streams (the dynamic table is not used) and streams
+// of other types are discarded, so that the server is never blocked by flow control.
+func (c *HTTP3Connection) acceptStreams() {
+	for {
+		stream, err := c.conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go c.discardStream(stream)
+	}
+}
+
+func (c *HTTP3Connection) discardStream(stream *quic.Stream) {
+	defer stream.CloseRead()
+	streamType, err := readVarint(stream)
+	if err != nil {
+		return
+	}
+	if streamType == http3StreamControl {
+		frameType, _, err := readHTTP3Frame(stream)
+		if err != nil {
+			return
+		}
+		if frameType != http3FrameSettings {
+			log.Debug().Msgf("ftw/http3: the control stream of the server starts with frame type %d instead of SETTINGS", frameType)
+			c.conn.Abort(&quic.ApplicationError{Code: http3MissingSettings, Reason: "missing SETTINGS"})
+			return
+		}
+	}
+	_, _ = io.Copy(io.Discard, stream)
+}
+
+// StartTrackingTime initializes timer
+func (c *HTTP3Connection) StartTrackingTime() {
+	c.duration.StartTracking()
+}
+
+// StopTrackingTime stops timer
+func (c *HTTP3Connection) StopTrackingTime() {
+	c.duration.StopTracking()
+}
+
+// GetTrackedTime will return the time since the request started and the response was parsed
+func (c *HTTP3Connection) GetTrackedTime() *RoundTripTime {
+	return c.duration
+}
+
+// Close closes the QUIC connection without waiting for the server to acknowledge it
+func (c *HTTP3Connection) Close() error {
+	if c.conn != nil {
+		c.conn.Abort(nil)
+	}
+	return nil
+}
+
+// RoundTrip sends the request on a new stream and reads the response. The response is rendered
+// like an HTTP/1.1 response, with the status line "HTTP/3 <status>" and the header names as
+// they were received, so that it can be checked like other responses.
+//
+// If headers are autocompleted, header names are lower-cased, the Host header is sent as the
+// ":authority" pseudo-header, and connection-specific headers such as Connection are left out.
+// Otherwise the headers are sent as they are. Raw requests and the chunked transfer encoding
+// are not supported.
+func (c *HTTP3Connection) RoundTrip(request *Request) (*Response, error) {
+	data, fields, err := request.http3Request()
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Msgf("ftw/http3: sending request:\n%s%s\n", renderFields(fields), request.Data())
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.readTimeout)
+	defer cancel()
+	stream, err := c.conn.NewStream(ctx)
+	if err != nil {
+		return nil, writeError(err)
+	}
+	defer stream.Close()
+	stream.SetWriteContext(ctx)
+	stream.SetReadContext(ctx)
+	if _, err := stream.Write(data); err != nil {
+		return nil, writeError(err)
+	}
+	stream.CloseWrite()
+
+	response, err := c.readResponse(stream)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Msgf("ftw/http3: received data - %q", response.RAW)
+	return response, nil
+}
+
+// http3Request builds the request and returns the frames of its request stream: a HEADERS frame
+// with the QPACK encoded fields, followed by a DATA frame if the request has a body. The fields are
+// returned as well.
+func (r *Request) http3Request() ([]byte, []HeaderTuple, error) {
+	if r.IsRaw() {
+		return nil, nil, errors.New("ftw/http3: raw requests can't be sent over HTTP/3")
+	}
+	if r.Chunked() != nil {
+		return nil, nil, errors.New("ftw/http3: the chunked transfer encoding can't be used with HTTP/3")
+	}
+	// BuildRequest encodes the data and autocompletes the headers, as for HTTP/1.x
+	if _, err := BuildRequest(r); err != nil {
+		return nil, nil, fmt.Errorf("ftw/http3: fatal error building request: %w", err)
+	}
+	fields := r.http3Fields()
+	data := appendHTTP3Frame(nil, http3FrameHeaders, encodeQPACK(fields))
+	if body := r.Data(); len(body) > 0 {
+		data = appendHTTP3Frame(data, http3FrameData, body)
+	}
+	return data, fields, nil
+}
+
+// HTTP3Frames returns the frames that are sent on the request stream of an HTTP/3 request, exactly
+// as RoundTrip sends them: a HEADERS frame with the QPACK encoded fields, followed by a DATA frame
+// if the request has a body.
+func (r *Request) HTTP3Frames() ([]byte, error) {
+	data, _, err := r.http3Request()
+	return data, err
+}
+
+// DescribeHTTP3Frames returns a readable description of the frames of an HTTP/3 request: the
+// fields of the HEADERS frame, one per line, and the payload of the DATA frame. Names, values and
+// the payload are escaped with EscapeWireBytes.
+func (r *Request) DescribeHTTP3Frames() (string, error) {
+	_, fields, err := r.http3Request()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("HEADERS frame\n")
+	for _, field := range fields {
+		b.WriteString(EscapeWireBytes([]byte(field.Name)) + ": " + EscapeWireBytes([]byte(field.Value)) + "\n")
+	}
+	if body := r.Data(); len(body) > 0 {
+		fmt.Fprintf(&b, "DATA frame, %d bytes\n%s", len(body), EscapeWireBytes(body))
+		if !bytes.HasSuffix(body, []byte("\n")) {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// http3Fields returns the pseudo-headers and headers of the request
+func (r *Request) http3Fields() []HeaderTuple {
+	authority := ""
+	headers := []HeaderTuple{}
+	for _, header := range r.headers.entries {
+		if r.autoCompleteHeaders {
+			if slices.ContainsFunc(http3ConnectionHeaders, func(name string) bool { return strings.EqualFold(name, header.Name) }) {
+				continue
+			}
+			if strings.EqualFold(header.Name, header_names.Host) {
+				authority = header.Value
+				continue
+			}
+			header.Name = strings.ToLower(header.Name)
+		}
+		headers = append(headers, header)
+	}
+
+	fields := []HeaderTuple{
+		{Name: ":method", Value: r.requestLine.Method},
+		{Name: ":scheme", Value: "https"},
+	}
+	if authority != "" {
+		fields = append(fields, HeaderTuple{Name: ":authority", Value: authority})
+	}
+	fields = append(fields, HeaderTuple{Name: ":path", Value: r.requestLine.URI})
+	return append(fields, headers...)
+}
+
+// readResponse reads the frames of the response until the server closes the stream.
+// Informational responses and trailers are skipped.
+func (c *HTTP3Connection) readResponse(stream *quic.Stream) (*Response, error) {
+	var fields []HeaderTuple
+	status := 0
+	body := &bytes.Buffer{}
+	for {
+		frameType, payload, err := readHTTP3Frame(stream)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, readError(fmt.Errorf("ftw/http3: error reading response: %w", err), OtherErrorCategory)
+		}
+		switch frameType {
+		case http3FrameHeaders:
+			if status != 0 {
+				// trailers
+				continue
+			}
+			decoded, err := decodeQPACK(payload)
+			if err != nil {
+				return nil, newTransportError(MalformedResponseCategory, err)
+			}
+			if status, err = http3Status(decoded); err != nil {
+				return nil, newTransportError(MalformedResponseCategory, err)
+			}
+			if status < http.StatusOK {
+				status = 0
+				continue
+			}
+			fields = decoded
+		case http3FrameData:
+			if status == 0 {
+				return nil, newTransportError(MalformedResponseCategory, errors.New("ftw/http3: received data before the response headers"))
+			}
+			body.Write(payload)
+		default:
+			// unknown and reserved frame types are ignored, see RFC 9114, section 9
+		}
+	}
+	if status == 0 {
+		return nil, newTransportError(EOFBeforeHeadersCategory, errors.New("ftw/http3: the stream ended without a response"))
+	}
+
+	raw := &bytes.Buffer{}
+	fmt.Fprintf(raw, "%s %d %s\r\n", HTTP3Version, status, http.StatusText(status))
+	header := http.Header{}
+	for _, field := range fields {
+		if strings.HasPrefix(field.Name, ":") {
+			continue
+		}
+		header.Add(field.Name, field.Value)
+		raw.WriteString(field.Name + ": " + field.Value + HeaderDelimiter)
+	}
+	raw.WriteString(HeaderDelimiter)
+	raw.Write(body.Bytes())
+
+	contentLength := int64(-1)
+	if value := header.Get(header_names.ContentLength); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			contentLength = parsed
+		}
+	}
+	state := c.conn.ConnectionState()
+	return &Response{
+		RAW: raw.Bytes(),
+		Parsed: http.Response{
+			Status:        strings.TrimSpace(fmt.Sprintf("%d %s", status, http.StatusText(status))),
+			StatusCode:    status,
+			Proto:         "HTTP/3.0",
+			ProtoMajor:    3,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body.Bytes())),
+			ContentLength: contentLength,
+			TLS:           &state,
+		},
+	}, nil
+}
+
+// http3Status returns the value of the ":status" pseudo-header
+func http3Status(fields []HeaderTuple) (int, error) {
+	for _, field := range fields {
+		if field.Name == ":status" {
+			status, err := strconv.Atoi(field.Value)
+			if err != nil || status < 100 || status > 999 {
+				return 0, fmt.Errorf("ftw/http3: invalid status %q", field.Value)
+			}
+			return status, nil
+		}
+	}
+	return 0, errors.New("ftw/http3: the response has no status")
+}
+
+// renderFields renders fields like HTTP/1.x headers, for logging
+func renderFields(fields []HeaderTuple) string {
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(field.Name + ": " + field.Value + HeaderDelimiter)
+	}
+	b.WriteString(HeaderDelimiter)
+	return b.String()
+}
+
+// appendHTTP3Frame appends a frame with the given type and payload
+func appendHTTP3Frame(data []byte, frameType uint64, payload []byte) []byte {
+	data = appendVarint(data, frameType)
+	data = appendVarint(data, uint64(len(payload)))
+	return append(data, payload...)
+}
+
+// http3Reader is implemented by QUIC streams
+type http3Reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readHTTP3Frame reads a frame. io.EOF is returned if the stream ends before a frame.
+func readHTTP3Frame(reader http3Reader) (uint64, []byte, error) {
+	frameType, err := readVarint(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := readVarint(reader)
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	if length > maxHTTP3FrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	return frameType, payload, nil
+}
+
+// appendVarint appends a QUIC variable-length integer, see RFC 9000, section 16
+func appendVarint(data []byte, value uint64) []byte {
+	switch {
+	case value < 1<<6:
+		return append(data, byte(value))
+	case value < 1<<14:
+		return binary.BigEndian.AppendUint16(data, uint16(value)|0x4000)
+	case value < 1<<30:
+		return binary.BigEndian.AppendUint32(data, uint32(value)|0x80000000)
+	default:
+		return binary.BigEndian.AppendUint64(data, value|0xc000000000000000)
+	}
+}
+
+// readVarint reads a QUIC variable-length integer
+func readVarint(reader io.ByteReader) (uint64, error) {
+	first, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	value := uint64(first & 0x3f)
+	for range 1<<(first>>6) - 1 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF, for data that ends prematurely
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
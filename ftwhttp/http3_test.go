@@ -0,0 +1,462 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/http2/hpack"
+	"golang.org/x/net/quic"
+)
+
+// http3TestRequest is a request received by the test server
+type http3TestRequest struct {
+	fields []HeaderTuple
+	body   []byte
+}
+
+// http3TestServer is a minimal HTTP/3 server: it answers every request stream with respond
+type http3TestServer struct {
+	endpoint *quic.Endpoint
+	requests chan http3TestRequest
+	mutex    sync.Mutex
+	// respond writes the frames of the response to a request
+	respond func(request http3TestRequest) []byte
+	// onConnect is called with every accepted connection, if set
+	onConnect func(conn *quic.Conn)
+}
+
+type http3TestSuite struct {
+	suite.Suite
+	server *http3TestServer
+	client *Client
+	dest   Destination
+}
+
+func TestHTTP3TestSuite(t *testing.T) {
+	suite.Run(t, new(http3TestSuite))
+}
+
+func (s *http3TestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *http3TestSuite) SetupTest() {
+	certificate, roots := s.serverCertificate()
+	endpoint, err := quic.Listen("udp", "127.0.0.1:0", &quic.Config{
+		TLSConfig: &tls.Config{
+			MinVersion:   tls.VersionTLS13,
+			Certificates: []tls.Certificate{certificate},
+			NextProtos:   []string{http3ALPN},
+		},
+	})
+	s.Require().NoError(err)
+	s.server = &http3TestServer{
+		endpoint: endpoint,
+		requests: make(chan http3TestRequest, 10),
+		respond:  defaultHTTP3Response,
+	}
+	go s.server.serve()
+
+	s.client, err = NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+	s.client.SetRootCAs(roots)
+	s.dest = Destination{DestAddr: "127.0.0.1", Port: int(endpoint.LocalAddr().Port()), Protocol: "https"}
+}
+
+func (s *http3TestSuite) TearDownTest() {
+	s.Require().NoError(s.client.Close())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = s.server.endpoint.Close(ctx)
+}
+
+// serverCertificate creates a self-signed certificate for 127.0.0.1
+func (s *http3TestSuite) serverCertificate() (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-ftw test server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	s.Require().NoError(err)
+	parsed, err := x509.ParseCertificate(der)
+	s.Require().NoError(err)
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+func (s *http3TestServer) setResponse(respond func(request http3TestRequest) []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.respond = respond
+}
+
+func (s *http3TestServer) serve() {
+	for {
+		conn, err := s.endpoint.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		onConnect := s.onConnect
+		s.mutex.Unlock()
+		if onConnect != nil {
+			go onConnect(conn)
+		}
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				if stream.IsReadOnly() {
+					// the control stream of the client
+					go func() { _, _ = io.Copy(io.Discard, stream) }()
+					continue
+				}
+				go s.handle(stream)
+			}
+		}()
+	}
+}
+
+func (s *http3TestServer) handle(stream *quic.Stream) {
+	defer stream.Close()
+	request := http3TestRequest{}
+	for {
+		frameType, payload, err := readHTTP3Frame(stream)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return
+		}
+		switch frameType {
+		case http3FrameHeaders:
+			if request.fields, err = decodeQPACK(payload); err != nil {
+				return
+			}
+		case http3FrameData:
+			request.body = append(request.body, payload...)
+		}
+	}
+	s.requests <- request
+	s.mutex.Lock()
+	respond := s.respond
+	s.mutex.Unlock()
+	_, _ = stream.Write(respond(request))
+}
+
+// defaultHTTP3Response answers with status 200 from the static table, a Huffman encoded content type,
+// a literal header and the request body
+func defaultHTTP3Response(request http3TestRequest) []byte {
+	fields := []byte{0x00, 0x00, 0xc0 | 25}
+	// content-type with the static name of index 53, and a Huffman encoded value
+	fields = appendQPACKInt(fields, 0x50, 4, 53)
+	fields = appendQPACKInt(fields, 0x80, 7, hpack.HuffmanEncodeLength("text/plain"))
+	fields = hpack.AppendHuffmanString(fields, "text/plain")
+	fields = append(fields, encodeQPACK([]HeaderTuple{{Name: "x-test", Value: "http3"}})[2:]...)
+
+	data := appendHTTP3Frame(nil, http3FrameHeaders, fields)
+	// an unknown frame type, which must be ignored
+	data = appendHTTP3Frame(data, 0x21, []byte("reserved"))
+	return appendHTTP3Frame(data, http3FrameData, append([]byte("echo: "), request.body...))
+}
+
+func (s *http3TestSuite) newRequest(autocomplete bool) *Request {
+	headers := NewHeader()
+	headers.Add("Host", "localhost")
+	headers.Add("User-Agent", "go-ftw test agent")
+	return NewRequest(&RequestLine{Method: "POST", URI: "/path?q=<script>", Version: HTTP3Version}, headers, []byte("a=1"), autocomplete)
+}
+
+func (s *http3TestSuite) TestRoundTrip() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	s.client.StartTrackingTime()
+	response, err := s.client.Do(*s.newRequest(true))
+	s.client.StopTrackingTime()
+	s.Require().NoError(err)
+
+	request := <-s.server.requests
+	s.Equal([]HeaderTuple{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "localhost"},
+		{Name: ":path", Value: "/path?q=<script>"},
+		{Name: "user-agent", Value: "go-ftw test agent"},
+		{Name: "content-type", Value: "application/x-www-form-urlencoded"},
+		{Name: "content-length", Value: "3"},
+	}, request.fields, "connection-specific headers must be removed")
+	s.Equal("a=1", string(request.body))
+
+	s.Equal(200, response.Parsed.StatusCode)
+	s.Equal(3, response.Parsed.ProtoMajor)
+	s.Equal("text/plain", response.Parsed.Header.Get("Content-Type"))
+	s.Equal("HTTP/3 200 OK\r\ncontent-type: text/plain\r\nx-test: http3\r\n\r\necho: a=1", response.GetFullResponse())
+	s.Require().NotNil(response.Parsed.TLS)
+	s.Equal(http3ALPN, response.Parsed.TLS.NegotiatedProtocol)
+	s.Positive(s.client.GetRoundTripTime().RoundTripDuration())
+}
+
+func (s *http3TestSuite) TestRoundTripWithoutAutocomplete() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	request := s.newRequest(false)
+	request.AddHeader("Connection", "close")
+	_, err := s.client.Do(*request)
+	s.Require().NoError(err)
+
+	s.Equal([]HeaderTuple{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":path", Value: "/path?q=<script>"},
+		{Name: "Host", Value: "localhost"},
+		{Name: "User-Agent", Value: "go-ftw test agent"},
+		{Name: "Connection", Value: "close"},
+	}, (<-s.server.requests).fields, "headers must be sent as they are")
+}
+
+func (s *http3TestSuite) TestMultipleRequests() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	for range 3 {
+		response, err := s.client.Do(*s.newRequest(true))
+		s.Require().NoError(err)
+		s.Equal(200, response.Parsed.StatusCode)
+	}
+}
+
+func (s *http3TestSuite) TestInformationalResponseAndTrailers() {
+	s.server.setResponse(func(request http3TestRequest) []byte {
+		data := appendHTTP3Frame(nil, http3FrameHeaders, encodeQPACK([]HeaderTuple{{Name: ":status", Value: "103"}, {Name: "link", Value: "</style.css>"}}))
+		data = appendHTTP3Frame(data, http3FrameHeaders, encodeQPACK([]HeaderTuple{{Name: ":status", Value: "403"}}))
+		data = appendHTTP3Frame(data, http3FrameData, []byte("denied"))
+		return appendHTTP3Frame(data, http3FrameHeaders, encodeQPACK([]HeaderTuple{{Name: "x-trailer", Value: "1"}}))
+	})
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	response, err := s.client.Do(*s.newRequest(true))
+	s.Require().NoError(err)
+	s.Equal(403, response.Parsed.StatusCode)
+	s.Equal("HTTP/3 403 Forbidden\r\n\r\ndenied", response.GetFullResponse())
+}
+
+func (s *http3TestSuite) TestInvalidResponses() {
+	tests := map[string]struct {
+		response []byte
+		expected string
+		category ErrorCategory
+	}{
+		"no response": {nil, "the stream ended without a response", EOFBeforeHeadersCategory},
+		"data first":  {appendHTTP3Frame(nil, http3FrameData, []byte("x")), "received data before the response headers", MalformedResponseCategory},
+		"no status":   {appendHTTP3Frame(nil, http3FrameHeaders, encodeQPACK([]HeaderTuple{{Name: "x-test", Value: "1"}})), "the response has no status", MalformedResponseCategory},
+		"truncated":   {appendHTTP3Frame(nil, http3FrameHeaders, encodeQPACK(nil))[:2], "unexpected EOF", EOFBeforeHeadersCategory},
+	}
+	for name, tt := range tests {
+		s.Run(name, func() {
+			s.server.setResponse(func(http3TestRequest) []byte { return tt.response })
+			s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+			_, err := s.client.Do(*s.newRequest(true))
+			s.ErrorContains(err, tt.expected)
+			s.Equal(tt.category, ErrorCategoryOf(err))
+		})
+	}
+}
+
+func (s *http3TestSuite) TestUnsupportedRequests() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	request := s.newRequest(true)
+	request.SetChunked(&ChunkedOptions{})
+	_, err := s.client.HTTP3Transport.RoundTrip(request)
+	s.ErrorContains(err, "the chunked transfer encoding can't be used with HTTP/3")
+
+	_, err = s.client.HTTP3Transport.RoundTrip(NewRawRequest([]byte("GET / HTTP/3\r\n\r\n")))
+	s.ErrorContains(err, "raw requests can't be sent over HTTP/3")
+
+	s.False(NewRawRequest([]byte("GET / HTTP/3\r\n\r\n")).UsesHTTP3())
+	s.False(generateBaseRequestForTesting().UsesHTTP3())
+	s.True(s.newRequest(true).UsesHTTP3())
+}
+
+func (s *http3TestSuite) TestHTTP3Frames() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	_, err := s.client.Do(*s.newRequest(true))
+	s.Require().NoError(err)
+	sent := <-s.server.requests
+
+	frames, err := s.newRequest(true).HTTP3Frames()
+	s.Require().NoError(err)
+	expected := appendHTTP3Frame(nil, http3FrameHeaders, encodeQPACK(sent.fields))
+	expected = appendHTTP3Frame(expected, http3FrameData, sent.body)
+	s.Equal(expected, frames, "the frames must be the ones sent by RoundTrip")
+
+	description, err := s.newRequest(true).DescribeHTTP3Frames()
+	s.Require().NoError(err)
+	s.Equal("HEADERS frame\n"+
+		":method: POST\n"+
+		":scheme: https\n"+
+		":authority: localhost\n"+
+		":path: /path?q=<script>\n"+
+		"user-agent: go-ftw test agent\n"+
+		"content-type: application/x-www-form-urlencoded\n"+
+		"content-length: 3\n"+
+		"DATA frame, 3 bytes\n"+
+		"a=1\n", description)
+
+	_, err = s.newRequest(true).WireBytes()
+	s.ErrorContains(err, "HTTP/3 requests are sent as frames")
+}
+
+func (s *http3TestSuite) TestNotConnected() {
+	_, err := s.client.Do(*s.newRequest(true))
+	s.ErrorContains(err, "ftw/http3: not connected to server")
+}
+
+func (s *http3TestSuite) TestUnsupportedDestinations() {
+	err := s.client.NewHTTP3Connection(Destination{DestAddr: "/run/waf.sock", Protocol: UnixProtocol}, nil)
+	s.ErrorContains(err, "Unix domain sockets are not supported")
+
+	proxy, err := ParseProxyURL("socks5://127.0.0.1:1080")
+	s.Require().NoError(err)
+	config := NewClientConfig()
+	config.Proxy = proxy
+	client, err := NewClientWithConfig(config)
+	s.Require().NoError(err)
+	s.ErrorContains(client.NewHTTP3Connection(s.dest, nil), "proxies are not supported")
+}
+
+func (s *http3TestSuite) TestConnectionReplacement() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	http3Transport := s.client.HTTP3Transport
+
+	// a marker request opens a connection, keeping the HTTP/3 connection and its round trip time
+	tcpServer, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	defer tcpServer.Close()
+	tcpDest := Destination{DestAddr: "127.0.0.1", Port: tcpServer.Addr().(*net.TCPAddr).Port, Protocol: "http"}
+	s.Require().NoError(s.client.NewOrReusedConnection(tcpDest))
+	s.NotNil(s.client.Transport)
+	s.Same(http3Transport, s.client.HTTP3Transport)
+	s.Same(http3Transport.GetTrackedTime(), s.client.GetRoundTripTime())
+
+	// a new stage closes the HTTP/3 connection
+	s.Require().NoError(s.client.NewConnection(tcpDest))
+	s.Nil(s.client.HTTP3Transport)
+	_, err = http3Transport.RoundTrip(s.newRequest(true))
+	s.Error(err)
+}
+
+func (s *http3TestSuite) TestServerStreams() {
+	// more data than fits into the flow control window of a stream, which is only sent completely
+	// if the client reads it
+	large := bytes.Repeat([]byte("x"), 2<<20)
+	written := make(chan error, 1)
+	s.server.mutex.Lock()
+	s.server.onConnect = func(conn *quic.Conn) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		streams := [][]byte{
+			// control stream with the settings of the server
+			appendHTTP3Frame(appendVarint(nil, http3StreamControl), http3FrameSettings, appendVarint(appendVarint(nil, 0x6), 4096)),
+			// QPACK encoder and decoder streams
+			{0x02},
+			{0x03},
+			// a reserved stream type
+			append(appendVarint(nil, 0x21), large...),
+		}
+		for _, data := range streams {
+			stream, err := conn.NewSendOnlyStream(ctx)
+			if err == nil {
+				stream.SetWriteContext(ctx)
+				_, err = stream.Write(data)
+			}
+			if err == nil {
+				err = stream.Close()
+			}
+			if err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}
+	s.server.mutex.Unlock()
+
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	select {
+	case err := <-written:
+		s.Require().NoError(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("the streams of the server were not read")
+	}
+	response, err := s.client.Do(*s.newRequest(true))
+	s.Require().NoError(err)
+	s.Equal(200, response.Parsed.StatusCode)
+}
+
+func (s *http3TestSuite) TestMissingSettings() {
+	s.server.mutex.Lock()
+	s.server.onConnect = func(conn *quic.Conn) {
+		stream, err := conn.NewSendOnlyStream(context.Background())
+		if err != nil {
+			return
+		}
+		_, _ = stream.Write(appendHTTP3Frame(appendVarint(nil, http3StreamControl), http3FrameData, nil))
+		_ = stream.Flush()
+	}
+	s.server.mutex.Unlock()
+
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	s.Eventually(func() bool {
+		_, err := s.client.Do(*s.newRequest(true))
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond, "the connection must be closed")
+}
+
+func (s *http3TestSuite) TestEndpointReuse() {
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	endpoint := s.client.http3Endpoint
+	s.Require().NotNil(endpoint)
+	s.Require().NoError(s.client.NewHTTP3Connection(s.dest, nil))
+	s.Same(endpoint, s.client.http3Endpoint)
+	_, err := s.client.Do(*s.newRequest(true))
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.client.Close())
+	s.Nil(s.client.http3Endpoint)
+}
+
+func (s *http3TestSuite) TestVarint() {
+	for _, value := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+		encoded := appendVarint(nil, value)
+		decoded, err := readVarint(bytes.NewReader(encoded))
+		s.Require().NoError(err)
+		s.Equal(value, decoded)
+	}
+	_, err := readVarint(bytes.NewReader([]byte{0x40}))
+	s.ErrorIs(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"time"
+)
+
+// pcapng block types and values, see https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-03.html
+const (
+	pcapngSectionHeaderBlock  uint32 = 0x0a0d0d0a
+	pcapngInterfaceBlock      uint32 = 0x00000001
+	pcapngEnhancedPacketBlock uint32 = 0x00000006
+	pcapngByteOrderMagic      uint32 = 0x1a2b3c4d
+	// the link type of raw IPv4 and IPv6 packets
+	pcapngLinkTypeRaw uint16 = 101
+)
+
+// TCP flags
+const (
+	tcpFIN byte = 0x01
+	tcpSYN byte = 0x02
+	tcpRST byte = 0x04
+	tcpPSH byte = 0x08
+	tcpACK byte = 0x10
+)
+
+// maxCaptureSegment limits the payload of synthesized TCP segments, so that they fit into an IP
+// packet. Larger reads and writes are split.
+const maxCaptureSegment = 65000
+
+// capturePacket is a synthesized IP packet
+type capturePacket struct {
+	time time.Time
+	data []byte
+}
+
+// tcpEndpoint is one side of a synthesized TCP connection
+type tcpEndpoint struct {
+	ip   net.IP
+	port uint16
+	// seq is the next sequence number of the endpoint
+	seq uint32
+}
+
+// WritePcapng writes the recorded connections as a pcapng file. The TCP/IP framing is
+// synthesized: every read and write becomes a TCP segment (split if it is too large for a
+// single packet), the handshake is added at the start of each connection, and FIN and RST
+// segments are added where a side closed or reset the connection. Connections that don't have
+// TCP addresses, e.g. Unix domain sockets, are given loopback addresses.
+func (c *Capture) WritePcapng(w io.Writer) error {
+	packets := []capturePacket{}
+	for index, connection := range c.Connections() {
+		packets = append(packets, synthesizeTCP(index, &connection)...)
+	}
+	slices.SortStableFunc(packets, func(a, b capturePacket) int { return a.time.Compare(b.time) })
+
+	data := appendPcapngBlock(nil, pcapngSectionHeaderBlock, func(body []byte) []byte {
+		body = binary.LittleEndian.AppendUint32(body, pcapngByteOrderMagic)
+		// version 1.0
+		body = binary.LittleEndian.AppendUint16(body, 1)
+		body = binary.LittleEndian.AppendUint16(body, 0)
+		// the section length is not specified
+		return binary.LittleEndian.AppendUint64(body, ^uint64(0))
+	})
+	data = appendPcapngBlock(data, pcapngInterfaceBlock, func(body []byte) []byte {
+		body = binary.LittleEndian.AppendUint16(body, pcapngLinkTypeRaw)
+		body = binary.LittleEndian.AppendUint16(body, 0)
+		// no snapshot length limit
+		return binary.LittleEndian.AppendUint32(body, 0)
+	})
+	for _, packet := range packets {
+		data = appendPcapngBlock(data, pcapngEnhancedPacketBlock, func(body []byte) []byte {
+			// the default timestamp resolution is microseconds
+			timestamp := uint64(packet.time.UnixMicro())
+			body = binary.LittleEndian.AppendUint32(body, 0)
+			body = binary.LittleEndian.AppendUint32(body, uint32(timestamp>>32))
+			body = binary.LittleEndian.AppendUint32(body, uint32(timestamp))
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(packet.data)))
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(packet.data)))
+			body = append(body, packet.data...)
+			return append(body, make([]byte, pcapngPadding(len(packet.data)))...)
+		})
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// appendPcapngBlock appends a block with the body added by appendBody
+func appendPcapngBlock(data []byte, blockType uint32, appendBody func([]byte) []byte) []byte {
+	body := appendBody(nil)
+	length := uint32(len(body) + 12)
+	data = binary.LittleEndian.AppendUint32(data, blockType)
+	data = binary.LittleEndian.AppendUint32(data, length)
+	data = append(data, body...)
+	return binary.LittleEndian.AppendUint32(data, length)
+}
+
+func pcapngPadding(length int) int {
+	return (4 - length%4) % 4
+}
+
+// synthesizeTCP returns the packets of a connection
+func synthesizeTCP(index int, connection *CapturedConnection) []capturePacket {
+	client := tcpEndpointOf(connection.LocalAddr, net.IPv4(127, 0, 0, 1), uint16(49152+index))
+	server := tcpEndpointOf(connection.RemoteAddr, net.IPv4(127, 0, 0, 1), 80)
+	if client.ip.To4() == nil || server.ip.To4() == nil {
+		client.ip, server.ip = client.ip.To16(), server.ip.To16()
+	} else {
+		client.ip, server.ip = client.ip.To4(), server.ip.To4()
+	}
+
+	packets := []capturePacket{}
+	add := func(t time.Time, from, to *tcpEndpoint, flags byte, payload []byte) {
+		packets = append(packets, capturePacket{time: t, data: tcpPacket(from, to, flags, payload)})
+		from.seq += uint32(len(payload))
+		if flags&(tcpSYN|tcpFIN) != 0 {
+			from.seq++
+		}
+	}
+	add(connection.Start, &client, &server, tcpSYN, nil)
+	add(connection.Start, &server, &client, tcpSYN|tcpACK, nil)
+	add(connection.Start, &client, &server, tcpACK, nil)
+	for _, segment := range connection.Segments {
+		from, to := &client, &server
+		if segment.Direction == CaptureReceived {
+			from, to = &server, &client
+		}
+		switch {
+		case segment.Reset:
+			add(segment.Time, from, to, tcpRST|tcpACK, nil)
+		case segment.End:
+			add(segment.Time, from, to, tcpFIN|tcpACK, nil)
+		default:
+			for payload := range slices.Chunk(segment.Data, maxCaptureSegment) {
+				add(segment.Time, from, to, tcpPSH|tcpACK, payload)
+			}
+		}
+	}
+	return packets
+}
+
+// tcpEndpointOf returns the endpoint of a TCP address, or the fallback for other addresses
+func tcpEndpointOf(addr net.Addr, fallbackIP net.IP, fallbackPort uint16) tcpEndpoint {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok && tcpAddr.IP != nil {
+		return tcpEndpoint{ip: tcpAddr.IP, port: uint16(tcpAddr.Port)}
+	}
+	return tcpEndpoint{ip: fallbackIP, port: fallbackPort}
+}
+
+// tcpPacket returns an IPv4 or IPv6 packet holding a TCP segment
+func tcpPacket(from, to *tcpEndpoint, flags byte, payload []byte) []byte {
+	segment := binary.BigEndian.AppendUint16(nil, from.port)
+	segment = binary.BigEndian.AppendUint16(segment, to.port)
+	segment = binary.BigEndian.AppendUint32(segment, from.seq)
+	ack := uint32(0)
+	if flags&tcpACK != 0 {
+		ack = to.seq
+	}
+	segment = binary.BigEndian.AppendUint32(segment, ack)
+	// data offset of 5 words, without options
+	segment = append(segment, 5<<4, flags)
+	segment = binary.BigEndian.AppendUint16(segment, 0xffff)
+	// checksum and urgent pointer
+	segment = append(segment, 0, 0, 0, 0)
+	segment = append(segment, payload...)
+
+	var pseudoHeader []byte
+	var packet []byte
+	if len(from.ip) == net.IPv4len {
+		packet = []byte{0x45, 0}
+		packet = binary.BigEndian.AppendUint16(packet, uint16(20+len(segment)))
+		// identification, don't fragment, TTL 64, protocol TCP and checksum
+		packet = append(packet, 0, 0, 0x40, 0, 64, 6, 0, 0)
+		packet = append(packet, from.ip...)
+		packet = append(packet, to.ip...)
+		binary.BigEndian.PutUint16(packet[10:], internetChecksum(packet))
+		pseudoHeader = append(slices.Clone(packet[12:20]), 0, 6)
+		pseudoHeader = binary.BigEndian.AppendUint16(pseudoHeader, uint16(len(segment)))
+	} else {
+		packet = []byte{0x60, 0, 0, 0}
+		packet = binary.BigEndian.AppendUint16(packet, uint16(len(segment)))
+		// next header TCP, hop limit 64
+		packet = append(packet, 6, 64)
+		packet = append(packet, from.ip...)
+		packet = append(packet, to.ip...)
+		pseudoHeader = slices.Clone(packet[8:40])
+		pseudoHeader = binary.BigEndian.AppendUint32(pseudoHeader, uint32(len(segment)))
+		pseudoHeader = append(pseudoHeader, 0, 0, 0, 6)
+	}
+	binary.BigEndian.PutUint16(segment[16:], internetChecksum(pseudoHeader, segment))
+	return append(packet, segment...)
+}
+
+// internetChecksum computes the checksum of RFC 1071 over the concatenated data
+func internetChecksum(data ...[]byte) uint16 {
+	sum := uint32(0)
+	odd := false
+	var last byte
+	for _, part := range data {
+		for _, b := range part {
+			if odd {
+				sum += uint32(last)<<8 | uint32(b)
+			} else {
+				last = b
+			}
+			odd = !odd
+		}
+	}
+	if odd {
+		sum += uint32(last) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
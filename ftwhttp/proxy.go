@@ -0,0 +1,128 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// contextDialer opens network connections, directly or through a proxy
+type contextDialer interface {
+	DialContext(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+// ParseProxyURL parses the URL of an outbound proxy. Supported schemes are "http" for HTTP proxies,
+// which are asked to open a tunnel with the CONNECT method, and "socks5" or "socks5h" for SOCKS5
+// proxies. Credentials for the proxy are taken from the user info of the URL.
+func ParseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: invalid URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy: unsupported scheme %q in %s, expected http, socks5 or socks5h", proxyURL.Scheme, proxyURL.Redacted())
+	}
+	if proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("proxy: no host in %s", proxyURL.Redacted())
+	}
+	return proxyURL, nil
+}
+
+// newProxyDialer returns a dialer that tunnels connections through the proxy at proxyURL. The
+// tunnel passes the bytes of requests and responses unmodified.
+func newProxyDialer(proxyURL *url.URL, forward *net.Dialer) (contextDialer, error) {
+	if proxyURL.Scheme == "http" {
+		return &httpConnectDialer{proxyURL: proxyURL, forward: forward}, nil
+	}
+	dialer, err := proxy.FromURL(proxyURL, forward)
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("proxy: scheme %q doesn't support timeouts", proxyURL.Scheme)
+	}
+	return contextDialer, nil
+}
+
+// httpConnectDialer opens tunnels through an HTTP proxy with the CONNECT method
+type httpConnectDialer struct {
+	proxyURL *url.URL
+	forward  *net.Dialer
+}
+
+// DialContext connects to the proxy and asks it to open a tunnel to address
+func (d *httpConnectDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	proxyAddress := d.proxyURL.Host
+	if d.proxyURL.Port() == "" {
+		proxyAddress = net.JoinHostPort(d.proxyURL.Hostname(), "80")
+	}
+	conn, err := d.forward.DialContext(ctx, network, proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	reader, err := d.connect(conn, address)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if reader.Buffered() > 0 {
+		// the target has already sent data through the tunnel
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// connect sends the CONNECT request and reads the response of the proxy
+func (d *httpConnectDialer) connect(conn net.Conn, address string) (*bufio.Reader, error) {
+	request := &bytes.Buffer{}
+	fmt.Fprintf(request, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", address, address)
+	if user := d.proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		fmt.Fprintf(request, "Proxy-Authorization: Basic %s\r\n", credentials)
+	}
+	request.WriteString("\r\n")
+	if _, err := conn.Write(request.Bytes()); err != nil {
+		return nil, fmt.Errorf("proxy: can't send CONNECT request to %s: %w", d.proxyURL.Host, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, fmt.Errorf("proxy: can't read CONNECT response from %s: %w", d.proxyURL.Host, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy: %s refused to connect to %s: %s", d.proxyURL.Host, address, response.Status)
+	}
+	return reader, nil
+}
+
+// bufferedConn is a connection with data that has already been read into a buffer
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// QPACK (RFC 9204) encoding of HTTP/3 field sections. The dynamic table is never used: the
+// client announces a table capacity of 0, so servers may only reference the static table.
+
+var errQPACKTruncated = errors.New("ftw/http3: qpack: truncated field section")
+
+// encodeQPACK encodes fields as literals with literal names, without Huffman encoding, so that
+// names and values are sent exactly as they are written
+func encodeQPACK(fields []HeaderTuple) []byte {
+	// Required Insert Count and Delta Base are 0, as the dynamic table is not used
+	data := []byte{0x00, 0x00}
+	for _, field := range fields {
+		data = appendQPACKInt(data, 0x20, 3, uint64(len(field.Name)))
+		data = append(data, field.Name...)
+		data = appendQPACKInt(data, 0x00, 7, uint64(len(field.Value)))
+		data = append(data, field.Value...)
+	}
+	return data
+}
+
+// decodeQPACK decodes a field section that only references the static table
+func decodeQPACK(data []byte) ([]HeaderTuple, error) {
+	requiredInsertCount, data, err := readQPACKInt(data, 8)
+	if err != nil {
+		return nil, err
+	}
+	if requiredInsertCount != 0 {
+		return nil, errors.New("ftw/http3: qpack: the dynamic table is not supported")
+	}
+	if _, data, err = readQPACKInt(data, 7); err != nil {
+		return nil, err
+	}
+
+	fields := []HeaderTuple{}
+	for len(data) > 0 {
+		var field HeaderTuple
+		first := data[0]
+		switch {
+		case first&0x80 != 0:
+			// indexed field line
+			var index uint64
+			if index, data, err = readQPACKStaticIndex(data, first&0x40 != 0, 6); err != nil {
+				return nil, err
+			}
+			field = qpackStaticTable[index]
+		case first&0xc0 == 0x40:
+			// literal field line with name reference
+			var index uint64
+			if index, data, err = readQPACKStaticIndex(data, first&0x10 != 0, 4); err != nil {
+				return nil, err
+			}
+			field.Name = qpackStaticTable[index].Name
+			if field.Value, data, err = readQPACKString(data, 7); err != nil {
+				return nil, err
+			}
+		case first&0xe0 == 0x20:
+			// literal field line with literal name
+			if field.Name, data, err = readQPACKString(data, 3); err != nil {
+				return nil, err
+			}
+			if field.Value, data, err = readQPACKString(data, 7); err != nil {
+				return nil, err
+			}
+		default:
+			// field lines with post-base indexes reference the dynamic table
+			return nil, errors.New("ftw/http3: qpack: the dynamic table is not supported")
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// readQPACKStaticIndex reads the index of a static table entry
+func readQPACKStaticIndex(data []byte, static bool, prefix uint) (uint64, []byte, error) {
+	if !static {
+		return 0, nil, errors.New("ftw/http3: qpack: the dynamic table is not supported")
+	}
+	index, data, err := readQPACKInt(data, prefix)
+	if err != nil {
+		return 0, nil, err
+	}
+	if index >= uint64(len(qpackStaticTable)) {
+		return 0, nil, fmt.Errorf("ftw/http3: qpack: invalid static table index %d", index)
+	}
+	return index, data, nil
+}
+
+// appendQPACKInt appends an integer with the given prefix size, see RFC 7541, section 5.1. flags
+// holds the bits of the first byte before the prefix.
+func appendQPACKInt(data []byte, flags byte, prefix uint, value uint64) []byte {
+	limit := uint64(1)<<prefix - 1
+	if value < limit {
+		return append(data, flags|byte(value))
+	}
+	data = append(data, flags|byte(limit))
+	value -= limit
+	for value >= 0x80 {
+		data = append(data, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
+
+// readQPACKInt reads an integer with the given prefix size and returns the remaining data
+func readQPACKInt(data []byte, prefix uint) (uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, errQPACKTruncated
+	}
+	limit := uint64(1)<<prefix - 1
+	value := uint64(data[0]) & limit
+	data = data[1:]
+	if value < limit {
+		return value, data, nil
+	}
+	for shift := uint(0); ; shift += 7 {
+		if len(data) == 0 {
+			return 0, nil, errQPACKTruncated
+		}
+		if shift > 56 {
+			return 0, nil, errors.New("ftw/http3: qpack: integer overflow")
+		}
+		b := data[0]
+		data = data[1:]
+		value += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, data, nil
+		}
+	}
+}
+
+// readQPACKString reads a string literal whose length has the given prefix size. The bit before
+// the prefix marks Huffman encoded strings.
+func readQPACKString(data []byte, prefix uint) (string, []byte, error) {
+	if len(data) == 0 {
+		return "", nil, errQPACKTruncated
+	}
+	huffman := data[0]&(1<<prefix) != 0
+	length, data, err := readQPACKInt(data, prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(data)) {
+		return "", nil, errQPACKTruncated
+	}
+	value, data := data[:length], data[length:]
+	if !huffman {
+		return string(value), data, nil
+	}
+	decoded, err := hpack.HuffmanDecodeToString(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("ftw/http3: qpack: %w", err)
+	}
+	return decoded, data, nil
+}
+
+// qpackStaticTable is the static table of RFC 9204, appendix A
+var qpackStaticTable = [...]HeaderTuple{
+	{":authority", ""},
+	{":path", "/"},
+	{"age", "0"},
+	{"content-disposition", ""},
+	{"content-length", "0"},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"referer", ""},
+	{"set-cookie", ""},
+	{":method", "CONNECT"},
+	{":method", "DELETE"},
+	{":method", "GET"},
+	{":method", "HEAD"},
+	{":method", "OPTIONS"},
+	{":method", "POST"},
+	{":method", "PUT"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "103"},
+	{":status", "200"},
+	{":status", "304"},
+	{":status", "404"},
+	{":status", "503"},
+	{"accept", "*/*"},
+	{"accept", "application/dns-message"},
+	{"accept-encoding", "gzip, deflate, br"},
+	{"accept-ranges", "bytes"},
+	{"access-control-allow-headers", "cache-control"},
+	{"access-control-allow-headers", "content-type"},
+	{"access-control-allow-origin", "*"},
+	{"cache-control", "max-age=0"},
+	{"cache-control", "max-age=2592000"},
+	{"cache-control", "max-age=604800"},
+	{"cache-control", "no-cache"},
+	{"cache-control", "no-store"},
+	{"cache-control", "public, max-age=31536000"},
+	{"content-encoding", "br"},
+	{"content-encoding", "gzip"},
+	{"content-type", "application/dns-message"},
+	{"content-type", "application/javascript"},
+	{"content-type", "application/json"},
+	{"content-type", "application/x-www-form-urlencoded"},
+	{"content-type", "image/gif"},
+	{"content-type", "image/jpeg"},
+	{"content-type", "image/png"},
+	{"content-type", "text/css"},
+	{"content-type", "text/html; charset=utf-8"},
+	{"content-type", "text/plain"},
+	{"content-type", "text/plain;charset=utf-8"},
+	{"range", "bytes=0-"},
+	{"strict-transport-security", "max-age=31536000"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains; preload"},
+	{"vary", "accept-encoding"},
+	{"vary", "origin"},
+	{"x-content-type-options", "nosniff"},
+	{"x-xss-protection", "1; mode=block"},
+	{":status", "100"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "302"},
+	{":status", "400"},
+	{":status", "403"},
+	{":status", "421"},
+	{":status", "425"},
+	{":status", "500"},
+	{"accept-language", ""},
+	{"access-control-allow-credentials", "FALSE"},
+	{"access-control-allow-credentials", "TRUE"},
+	{"access-control-allow-headers", "*"},
+	{"access-control-allow-methods", "get"},
+	{"access-control-allow-methods", "get, post, options"},
+	{"access-control-allow-methods", "options"},
+	{"access-control-expose-headers", "content-length"},
+	{"access-control-request-headers", "content-type"},
+	{"access-control-request-method", "get"},
+	{"access-control-request-method", "post"},
+	{"alt-svc", "clear"},
+	{"authorization", ""},
+	{"content-security-policy", "script-src 'none'; object-src 'none'; base-uri 'none'"},
+	{"early-data", "1"},
+	{"expect-ct", ""},
+	{"forwarded", ""},
+	{"if-range", ""},
+	{"origin", ""},
+	{"purpose", "prefetch"},
+	{"server", ""},
+	{"timing-allow-origin", "*"},
+	{"upgrade-insecure-requests", "1"},
+	{"user-agent", ""},
+	{"x-forwarded-for", ""},
+	{"x-frame-options", "deny"},
+	{"x-frame-options", "sameorigin"},
+}
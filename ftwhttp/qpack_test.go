@@ -0,0 +1,97 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/http2/hpack"
+)
+
+type qpackTestSuite struct {
+	suite.Suite
+}
+
+func TestQPACKTestSuite(t *testing.T) {
+	suite.Run(t, new(qpackTestSuite))
+}
+
+func (s *qpackTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *qpackTestSuite) TestEncodeDecode() {
+	fields := []HeaderTuple{
+		{Name: ":method", Value: "GET"},
+		{Name: ":path", Value: "/?q=" + string(make([]byte, 200))},
+		{Name: "X-Mixed-Case", Value: ""},
+		{Name: "a-header-name-longer-than-the-3-bit-prefix", Value: "value"},
+	}
+	encoded := encodeQPACK(fields)
+	// the length 7 doesn't fit into the 3-bit prefix, so that a second byte follows
+	s.Equal([]byte{0x00, 0x00, 0x27, 0x00, ':', 'm', 'e', 't', 'h', 'o', 'd', 0x03, 'G', 'E', 'T'}, encoded[:15],
+		"fields must be encoded as literals with literal names, without Huffman encoding")
+	decoded, err := decodeQPACK(encoded)
+	s.Require().NoError(err)
+	s.Equal(fields, decoded)
+}
+
+func (s *qpackTestSuite) TestDecodeStaticTable() {
+	data := []byte{0x00, 0x00}
+	// indexed field line, :status 404
+	data = append(data, 0xc0|27)
+	// literal field line with the name reference of index 92 (server) and a Huffman encoded value
+	data = appendQPACKInt(data, 0x50, 4, 92)
+	data = appendQPACKInt(data, 0x80, 7, hpack.HuffmanEncodeLength("go-ftw"))
+	data = hpack.AppendHuffmanString(data, "go-ftw")
+	// literal field line with a Huffman encoded literal name
+	data = appendQPACKInt(data, 0x28, 3, hpack.HuffmanEncodeLength("x-waf"))
+	data = hpack.AppendHuffmanString(data, "x-waf")
+	data = appendQPACKInt(data, 0x00, 7, 7)
+	data = append(data, "blocked"...)
+
+	decoded, err := decodeQPACK(data)
+	s.Require().NoError(err)
+	s.Equal([]HeaderTuple{
+		{Name: ":status", Value: "404"},
+		{Name: "server", Value: "go-ftw"},
+		{Name: "x-waf", Value: "blocked"},
+	}, decoded)
+}
+
+func (s *qpackTestSuite) TestDecodeErrors() {
+	tests := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"empty":                      {nil, "truncated field section"},
+		"required insert count":      {[]byte{0x01, 0x00}, "the dynamic table is not supported"},
+		"dynamic indexed field line": {[]byte{0x00, 0x00, 0x80}, "the dynamic table is not supported"},
+		"dynamic name reference":     {[]byte{0x00, 0x00, 0x40, 0x00}, "the dynamic table is not supported"},
+		"post-base index":            {[]byte{0x00, 0x00, 0x10}, "the dynamic table is not supported"},
+		"invalid static index":       {[]byte{0x00, 0x00, 0xff, 0x24}, "invalid static table index 99"},
+		"truncated string":           {[]byte{0x00, 0x00, 0x23, 'a'}, "truncated field section"},
+		"truncated integer":          {[]byte{0x00, 0x00, 0xff, 0x80}, "truncated field section"},
+		"invalid huffman":            {[]byte{0x00, 0x00, 0x29, 0x00}, "qpack: hpack: invalid Huffman-encoded data"},
+	}
+	for name, tt := range tests {
+		s.Run(name, func() {
+			_, err := decodeQPACK(tt.data)
+			s.ErrorContains(err, tt.expected)
+		})
+	}
+}
+
+func (s *qpackTestSuite) TestPrefixedIntegers() {
+	for _, value := range []uint64{0, 6, 7, 8, 126, 127, 128, 1337, 1 << 40} {
+		encoded := appendQPACKInt(nil, 0x20, 3, value)
+		s.Equal(byte(0x20), encoded[0]&0xf8, "the flags must be kept")
+		decoded, rest, err := readQPACKInt(encoded, 3)
+		s.Require().NoError(err)
+		s.Equal(value, decoded)
+		s.Empty(rest)
+	}
+}
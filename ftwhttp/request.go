@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 
@@ -45,6 +46,11 @@ func NewRawRequest(data []byte) *Request {
 	}
 }
 
+// IsRaw returns true if the request was created from raw data, see NewRawRequest
+func (r Request) IsRaw() bool {
+	return r.isRaw
+}
+
 // SetAutoCompleteHeaders sets the value to the corresponding bool
 func (r *Request) SetAutoCompleteHeaders(value bool) {
 	r.autoCompleteHeaders = value
@@ -61,11 +67,33 @@ func (r *Request) SetData(data []byte) {
 	r.data = data
 }
 
+// SetPreserveData sets whether the data is sent exactly as it is: it is not URL encoded, and line
+// feeds in multipart bodies are not replaced with CRLF. Used for generated bodies, see Body.
+func (r *Request) SetPreserveData(value bool) {
+	r.preserveData = value
+}
+
+// SetChunked sends the data with the chunked transfer encoding, using the given options. Nil
+// sends the data as it is.
+func (r *Request) SetChunked(options *ChunkedOptions) {
+	r.chunked = options
+}
+
+// Chunked returns the options of the chunked transfer encoding, or nil if the data is sent as it is
+func (r Request) Chunked() *ChunkedOptions {
+	return r.chunked
+}
+
 // Data returns the data
 func (r Request) Data() []byte {
 	return r.data
 }
 
+// RequestLine returns the request line. Nil for raw requests.
+func (r Request) RequestLine() *RequestLine {
+	return r.requestLine
+}
+
 // Headers return request headers
 func (r Request) Headers() *Header {
 	return r.headers
@@ -88,11 +116,23 @@ func (r *Request) AddHeader(name string, value string) {
 //   - adds `Content-Length` header if payload size > 0 or the request method
 //     permits a body (the spec says that the client SHOULD send `Content-Length`
 //     in that case)
+//   - adds `Transfer-Encoding: chunked` instead of `Content-Length` for chunked
+//     requests, see SetChunked
 func (r *Request) AddStandardHeaders() {
 	if !r.headers.HasAny(header_names.Connection) {
 		r.headers.Add(header_names.Connection, "close")
 	}
 
+	if r.chunked != nil {
+		if !r.headers.HasAny(header_names.TransferEncoding) {
+			r.headers.Add(header_names.TransferEncoding, "chunked")
+		}
+		if r.chunked.ContentLength && !r.headers.HasAny(header_names.ContentLength) {
+			r.headers.Add(header_names.ContentLength, strconv.Itoa(len(r.wireData())))
+		}
+		return
+	}
+
 	if r.headers.HasAny(header_names.ContentLength) {
 		return
 	}
@@ -102,6 +142,44 @@ func (r *Request) AddStandardHeaders() {
 	}
 }
 
+// WireBytes returns the bytes of the request exactly as they are sent to the server.
+// Raw requests are returned unmodified, all other requests are built using BuildRequest.
+// HTTP/3 requests are sent as frames instead, see HTTP3Frames.
+func (r *Request) WireBytes() ([]byte, error) {
+	if r.isRaw {
+		return r.rawRequest, nil
+	}
+	if r.UsesHTTP3() {
+		return nil, errors.New("ftw/http: HTTP/3 requests are sent as frames, see HTTP3Frames")
+	}
+	return BuildRequest(r)
+}
+
+// EscapeWireBytes makes request or response bytes readable, while preserving every byte.
+// Printable ASCII characters are kept as is, carriage returns, line feeds, tabs and backslashes
+// are escaped as in Go strings, and all other bytes are hex-escaped (e.g. `\x00`). Every line feed
+// is followed by an actual line break, so that the output keeps the shape of the message.
+func EscapeWireBytes(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		switch {
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\n':
+			b.WriteString("\\n\n")
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
 // The request should be created with anything we want. We want to actually break HTTP.
 func BuildRequest(r *Request) ([]byte, error) {
 	var err error
@@ -115,7 +193,7 @@ func BuildRequest(r *Request) ([]byte, error) {
 	}
 
 	// We need to add the remaining headers, unless "NoDefaults"
-	if utils.IsNotEmpty(r.Data()) && r.WithAutoCompleteHeaders() {
+	if utils.IsNotEmpty(r.Data()) && r.WithAutoCompleteHeaders() && !r.preserveData {
 		if !r.Headers().HasAny(header_names.ContentType) {
 			// If there is no Content-Type, then we add one
 			r.AddHeader(header_names.ContentType, header_values.ApplicationXWwwFormUrlencoded)
@@ -129,7 +207,7 @@ func BuildRequest(r *Request) ([]byte, error) {
 	}
 
 	// Multipart form data needs to end in \r\n, per RFC (and modsecurity make a scene if not)
-	if r.headers.HasAnyValueContaining(header_names.ContentType, "multipart/form-data;") {
+	if r.headers.HasAnyValueContaining(header_names.ContentType, "multipart/form-data;") && !r.preserveData {
 		log.Debug().Msgf("ftw/http: with LF only - %d bytes:\n%x\n", len(r.Data()), r.Data())
 		data = bytes.ReplaceAll(r.data, []byte("\n"), []byte(HeaderDelimiter))
 		log.Debug().Msgf("ftw/http: with CRLF - %d bytes:\n%x\n", len(data), data)
@@ -153,8 +231,8 @@ func BuildRequest(r *Request) ([]byte, error) {
 		return nil, err
 	}
 	// Now the body, if anything
-	if utils.IsNotEmpty(r.Data()) {
-		_, err = b.Write(r.Data())
+	if body := r.wireData(); utils.IsNotEmpty(body) {
+		_, err = b.Write(body)
 		if err != nil {
 			log.Debug().Msgf("ftw/http: error writing to buffer: %s", err.Error())
 			return nil, err
@@ -164,6 +242,14 @@ func BuildRequest(r *Request) ([]byte, error) {
 	return b.Bytes(), err
 }
 
+// wireData returns the data as it is sent, applying the chunked transfer encoding if set
+func (r *Request) wireData() []byte {
+	if r.chunked != nil {
+		return r.chunked.Encode(r.Data())
+	}
+	return r.Data()
+}
+
 // encodeDataParameters url encode parameters in data
 func encodeDataParameters(h *Header, data []byte) ([]byte, error) {
 	if len(data) == 0 {
@@ -4,6 +4,7 @@
 package ftwhttp
 
 import (
+	"bytes"
 	"testing"
 
 	header_names "github.com/coreruleset/go-ftw/v2/ftwhttp/header_names"
@@ -156,6 +157,24 @@ Some-file-test-here
 
 }
 
+func (s *requestTestSuite) TestPreserveData() {
+	rl := &RequestLine{Method: "POST", URI: "/", Version: "HTTP/1.1"}
+	h := NewHeader()
+	h.Add(header_names.ContentType, "multipart/form-data; boundary=b")
+	data := []byte("--b\nContent-Disposition: form-data; name=\"a\"\n\nx y\n--b--\n")
+
+	req := NewRequest(rl, h, data, true)
+	wire, err := req.WireBytes()
+	s.Require().NoError(err)
+	s.NotContains(string(wire), "--b\n", "line feeds of multipart bodies are replaced")
+
+	req = NewRequest(rl, h, data, true)
+	req.SetPreserveData(true)
+	wire, err = req.WireBytes()
+	s.Require().NoError(err)
+	s.True(bytes.HasSuffix(wire, data), "the data must be sent as it is")
+}
+
 func (s *requestTestSuite) TestRequestLine() {
 	rl := &RequestLine{
 		Method:  "UNEXISTENT",
@@ -328,3 +347,22 @@ func (s *requestTestSuite) TestNewRequest_EmptyHeaders() {
 	s.Empty(headers.canonicalNames)
 	s.Empty(headers.entries)
 }
+
+func (s *requestTestSuite) TestWireBytes() {
+	req := generateBaseRequestForTesting()
+	data, err := req.WireBytes()
+	s.Require().NoError(err)
+	s.Equal("UNEXISTENT /this/path HTTP/1.4\r\nHost: localhost\r\nThis: Header\r\nConnection: Not-Closed\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 4\r\n\r\nData", string(data))
+
+	raw := []byte("GET / HTTP/1.1\r\n\r\n\x00")
+	data, err = NewRawRequest(raw).WireBytes()
+	s.Require().NoError(err)
+	s.Equal(raw, data)
+}
+
+func (s *requestTestSuite) TestEscapeWireBytes() {
+	s.Equal("GET / HTTP/1.1\\r\\n\n\\r\\n\n", EscapeWireBytes([]byte("GET / HTTP/1.1\r\n\r\n")))
+	s.Equal(`a\tb\\c\x00\xff`, EscapeWireBytes([]byte("a\tb\\c\x00\xff")))
+	s.Equal(`caf\xc3\xa9`, EscapeWireBytes([]byte("café")))
+	s.Empty(EscapeWireBytes(nil))
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+// tlsVersions maps the version names accepted in the configuration to TLS versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOptions configures TLS connections. Zero values keep the defaults.
+type TLSOptions struct {
+	// Certificates are presented to servers that request client authentication (mutual TLS)
+	Certificates []tls.Certificate
+	// RootCAs is the set of root CA certificates that is used to verify the server
+	RootCAs *x509.CertPool
+	// ServerName is sent in the SNI extension and used to verify the server certificate.
+	// Defaults to the address of the destination.
+	ServerName string
+	// MinVersion is the minimum TLS version, tls.VersionTLS12 by default
+	MinVersion uint16
+	// MaxVersion is the maximum TLS version
+	MaxVersion uint16
+	// CipherSuites are the enabled TLS 1.0-1.2 cipher suites
+	CipherSuites []uint16
+	// NextProtos are the protocols offered in the ALPN extension
+	NextProtos []string
+}
+
+// NewTLSOptions loads the certificates and parses the versions and cipher suites of cfg
+func NewTLSOptions(cfg config.TLSConfig) (*TLSOptions, error) {
+	options := &TLSOptions{
+		ServerName: cfg.ServerName,
+		NextProtos: cfg.ALPN,
+	}
+
+	if cfg.ClientCertificate != "" || cfg.ClientKey != "" {
+		if cfg.ClientCertificate == "" || cfg.ClientKey == "" {
+			return nil, errors.New("tls: both a client certificate and a client key are required")
+		}
+		certificate, err := tls.LoadX509KeyPair(cfg.ClientCertificate, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls: can't load client certificate: %w", err)
+		}
+		options.Certificates = []tls.Certificate{certificate}
+	}
+
+	if cfg.CACertificate != "" {
+		pem, err := os.ReadFile(cfg.CACertificate)
+		if err != nil {
+			return nil, fmt.Errorf("tls: can't read CA certificate: %w", err)
+		}
+		options.RootCAs = x509.NewCertPool()
+		if !options.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", cfg.CACertificate)
+		}
+	}
+
+	var err error
+	if options.MinVersion, err = parseTLSVersion(cfg.MinVersion); err != nil {
+		return nil, err
+	}
+	if options.MaxVersion, err = parseTLSVersion(cfg.MaxVersion); err != nil {
+		return nil, err
+	}
+	if options.MinVersion != 0 && options.MaxVersion != 0 && options.MinVersion > options.MaxVersion {
+		return nil, fmt.Errorf("tls: minimum version %s is greater than maximum version %s", cfg.MinVersion, cfg.MaxVersion)
+	}
+
+	for _, name := range cfg.CipherSuites {
+		id, err := parseCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		options.CipherSuites = append(options.CipherSuites, id)
+	}
+
+	return options, nil
+}
+
+// parseTLSVersion returns the TLS version of a name like "1.2" or "TLS 1.2", or 0 if name is empty
+func parseTLSVersion(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	normalized := strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "TLS"))
+	version, ok := tlsVersions[normalized]
+	if !ok {
+		return 0, fmt.Errorf("tls: unknown version %q, expected one of 1.0, 1.1, 1.2 or 1.3", name)
+	}
+	return version, nil
+}
+
+// parseCipherSuite returns the ID of the cipher suite with the given name, including insecure
+// cipher suites, which may be needed for testing
+func parseCipherSuite(name string) (uint16, error) {
+	for _, suite := range slices.Concat(tls.CipherSuites(), tls.InsecureCipherSuites()) {
+		if suite.Name == name {
+			return suite.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("tls: unknown cipher suite %q", name)
+}
+
+// merge returns a copy of o with the non-zero fields of overrides replacing those of o
+func (o TLSOptions) merge(overrides *TLSOptions) TLSOptions {
+	if overrides == nil {
+		return o
+	}
+	if overrides.Certificates != nil {
+		o.Certificates = overrides.Certificates
+	}
+	if overrides.RootCAs != nil {
+		o.RootCAs = overrides.RootCAs
+	}
+	if overrides.ServerName != "" {
+		o.ServerName = overrides.ServerName
+	}
+	if overrides.MinVersion != 0 {
+		o.MinVersion = overrides.MinVersion
+	}
+	if overrides.MaxVersion != 0 {
+		o.MaxVersion = overrides.MaxVersion
+	}
+	if overrides.CipherSuites != nil {
+		o.CipherSuites = overrides.CipherSuites
+	}
+	if overrides.NextProtos != nil {
+		o.NextProtos = overrides.NextProtos
+	}
+	return o
+}
+
+// tlsConfig builds the TLS configuration from the client config and the overrides of a connection
+func (c *Client) tlsConfig(overrides *TLSOptions) *tls.Config {
+	options := c.config.TLS.merge(overrides)
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		MaxVersion:         options.MaxVersion,
+		RootCAs:            c.config.RootCAs,
+		InsecureSkipVerify: c.config.SkipTlsVerification,
+		ServerName:         options.ServerName,
+		Certificates:       options.Certificates,
+		CipherSuites:       options.CipherSuites,
+		NextProtos:         options.NextProtos,
+	}
+	if options.MinVersion != 0 {
+		tlsConfig.MinVersion = options.MinVersion
+	} else if options.MaxVersion != 0 && options.MaxVersion < tlsConfig.MinVersion {
+		// a maximum version below the default minimum allows the older versions only
+		tlsConfig.MinVersion = options.MaxVersion
+	}
+	if options.RootCAs != nil {
+		tlsConfig.RootCAs = options.RootCAs
+	}
+	return tlsConfig
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+type tlsTestSuite struct {
+	suite.Suite
+	ts     *httptest.Server
+	client *Client
+	// serverName is the SNI received by the server
+	serverName string
+	// certFile and keyFile are the paths of the client certificate and key
+	certFile string
+	keyFile  string
+	// clientCAs contains the client certificate
+	clientCAs *x509.CertPool
+}
+
+func TestTLSTestSuite(t *testing.T) {
+	suite.Run(t, new(tlsTestSuite))
+}
+
+func (s *tlsTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *tlsTestSuite) SetupTest() {
+	s.serverName = ""
+	s.writeClientCertificate()
+
+	var err error
+	s.client, err = NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+}
+
+func (s *tlsTestSuite) TearDownTest() {
+	if s.ts != nil {
+		s.ts.Close()
+	}
+}
+
+// writeClientCertificate creates a self-signed client certificate
+func (s *tlsTestSuite) writeClientCertificate() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-ftw client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	s.Require().NoError(err)
+	certificate, err := x509.ParseCertificate(der)
+	s.Require().NoError(err)
+	s.clientCAs = x509.NewCertPool()
+	s.clientCAs.AddCert(certificate)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	s.Require().NoError(err)
+	dir := s.T().TempDir()
+	s.certFile = filepath.Join(dir, "client.crt")
+	s.keyFile = filepath.Join(dir, "client.key")
+	s.Require().NoError(os.WriteFile(s.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	s.Require().NoError(os.WriteFile(s.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+// startServer starts a TLS server; if requireClientCert is true, the client certificate is required
+func (s *tlsTestSuite) startServer(requireClientCert bool) *Destination {
+	s.ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	s.ts.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			s.serverName = hello.ServerName
+			return nil, nil
+		},
+	}
+	if requireClientCert {
+		s.ts.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		s.ts.TLS.ClientCAs = s.clientCAs
+	}
+	s.ts.StartTLS()
+	s.client.SetRootCAs(s.ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs)
+
+	d, err := DestinationFromString(s.ts.URL)
+	s.Require().NoError(err)
+	return d
+}
+
+func (s *tlsTestSuite) do(d *Destination, tlsOptions *TLSOptions) (*Response, error) {
+	if err := s.client.NewConnectionWithTLSOptions(*d, tlsOptions); err != nil {
+		return nil, err
+	}
+	return s.client.Do(*generateBaseRequestForTesting())
+}
+
+func (s *tlsTestSuite) TestNewTLSOptions() {
+	options, err := NewTLSOptions(config.TLSConfig{
+		ClientCertificate: s.certFile,
+		ClientKey:         s.keyFile,
+		ServerName:        "waf.example.com",
+		MinVersion:        "1.1",
+		MaxVersion:        "TLS 1.2",
+		CipherSuites:      []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_RC4_128_SHA"},
+		ALPN:              []string{"http/1.1"},
+	})
+	s.Require().NoError(err)
+	s.Len(options.Certificates, 1)
+	s.Nil(options.RootCAs)
+	s.Equal("waf.example.com", options.ServerName)
+	s.Equal(uint16(tls.VersionTLS11), options.MinVersion)
+	s.Equal(uint16(tls.VersionTLS12), options.MaxVersion)
+	s.Equal([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_RC4_128_SHA}, options.CipherSuites)
+	s.Equal([]string{"http/1.1"}, options.NextProtos)
+}
+
+func (s *tlsTestSuite) TestNewTLSOptionsCACertificate() {
+	options, err := NewTLSOptions(config.TLSConfig{CACertificate: s.certFile})
+	s.Require().NoError(err)
+	s.NotNil(options.RootCAs)
+
+	_, err = NewTLSOptions(config.TLSConfig{CACertificate: s.keyFile})
+	s.ErrorContains(err, "no certificates found")
+}
+
+func (s *tlsTestSuite) TestNewTLSOptionsErrors() {
+	tests := []struct {
+		name     string
+		cfg      config.TLSConfig
+		expected string
+	}{
+		{"missing key", config.TLSConfig{ClientCertificate: s.certFile}, "both a client certificate and a client key are required"},
+		{"missing certificate file", config.TLSConfig{ClientCertificate: "missing.crt", ClientKey: s.keyFile}, "can't load client certificate"},
+		{"unknown version", config.TLSConfig{MinVersion: "1.4"}, `unknown version "1.4"`},
+		{"min greater than max", config.TLSConfig{MinVersion: "1.3", MaxVersion: "1.2"}, "minimum version 1.3 is greater than maximum version 1.2"},
+		{"unknown cipher suite", config.TLSConfig{CipherSuites: []string{"TLS_NULL"}}, `unknown cipher suite "TLS_NULL"`},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			_, err := NewTLSOptions(tt.cfg)
+			s.ErrorContains(err, tt.expected)
+		})
+	}
+}
+
+func (s *tlsTestSuite) TestMutualTLS() {
+	d := s.startServer(true)
+
+	_, err := s.do(d, nil)
+	s.Error(err, "the server requires a client certificate")
+
+	options, err := NewTLSOptions(config.TLSConfig{ClientCertificate: s.certFile, ClientKey: s.keyFile})
+	s.Require().NoError(err)
+	response, err := s.do(d, options)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.Parsed.StatusCode)
+	s.Len(response.Parsed.TLS.PeerCertificates, 1)
+}
+
+func (s *tlsTestSuite) TestClientConfigCertificate() {
+	d := s.startServer(true)
+	options, err := NewTLSOptions(config.TLSConfig{ClientCertificate: s.certFile, ClientKey: s.keyFile})
+	s.Require().NoError(err)
+	s.client.config.TLS = *options
+
+	response, err := s.do(d, nil)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.Parsed.StatusCode)
+}
+
+func (s *tlsTestSuite) TestServerName() {
+	d := s.startServer(false)
+
+	_, err := s.do(d, nil)
+	s.Require().NoError(err)
+	s.Empty(s.serverName, "no SNI is sent for IP addresses")
+
+	// the certificate of the test server is valid for example.com
+	_, err = s.do(d, &TLSOptions{ServerName: "example.com"})
+	s.Require().NoError(err)
+	s.Equal("example.com", s.serverName)
+}
+
+func (s *tlsTestSuite) TestServerNameOverridesClientConfig() {
+	d := s.startServer(false)
+	s.client.config.TLS.ServerName = "www.example.com"
+	s.client.config.SkipTlsVerification = true
+
+	_, err := s.do(d, nil)
+	s.Require().NoError(err)
+	s.Equal("www.example.com", s.serverName)
+
+	_, err = s.do(d, &TLSOptions{ServerName: "bypass.example.com"})
+	s.Require().NoError(err)
+	s.Equal("bypass.example.com", s.serverName)
+}
+
+func (s *tlsTestSuite) TestNegotiatedParameters() {
+	d := s.startServer(false)
+
+	response, err := s.do(d, &TLSOptions{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		NextProtos:   []string{"http/1.1"},
+	})
+	s.Require().NoError(err)
+	s.Require().NotNil(response.Parsed.TLS)
+	s.Equal(uint16(tls.VersionTLS12), response.Parsed.TLS.Version)
+	s.Equal(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, response.Parsed.TLS.CipherSuite)
+	s.Equal("http/1.1", response.Parsed.TLS.NegotiatedProtocol)
+}
+
+func (s *tlsTestSuite) TestPlainResponseHasNoTLSState() {
+	s.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	d, err := DestinationFromString(s.ts.URL)
+	s.Require().NoError(err)
+
+	response, err := s.do(d, nil)
+	s.Require().NoError(err)
+	s.Nil(response.Parsed.TLS)
+}
+
+func (s *tlsTestSuite) TestTLSConfigDefaults() {
+	tlsConfig := s.client.tlsConfig(nil)
+	s.Equal(uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	s.Zero(tlsConfig.MaxVersion)
+
+	tlsConfig = s.client.tlsConfig(&TLSOptions{MaxVersion: tls.VersionTLS11})
+	s.Equal(uint16(tls.VersionTLS11), tlsConfig.MinVersion, "a maximum version below 1.2 lowers the minimum version")
+}
@@ -7,8 +7,10 @@ import (
 	"crypto/x509"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
+	"golang.org/x/net/quic"
 	"golang.org/x/time/rate"
 )
 
@@ -25,13 +27,29 @@ type ClientConfig struct {
 	// SkipTlsVerification skips certificate validation. Useful for connecting
 	// to domains with a self-signed certificate.
 	SkipTlsVerification bool
+	// TLS configures client certificates, SNI, versions, cipher suites and ALPN of TLS connections.
+	// RootCAs is used if TLS.RootCAs is not set.
+	TLS TLSOptions
+	// Proxy is the URL of the proxy that connections are tunneled through. If nil, connections
+	// are direct. See ParseProxyURL.
+	Proxy *url.URL
+	// Resolve maps "host:port" of destinations to the address and port that are connected to
+	// instead, like the --resolve option of curl. Keys are lower case. See ParseResolve.
+	Resolve map[string]string
 }
 
 // Client is the top level abstraction in http
 type Client struct {
 	Transport *Connection
-	Jar       http.CookieJar
-	config    ClientConfig
+	// HTTP3Transport is the HTTP/3 connection, see NewHTTP3Connection
+	HTTP3Transport *HTTP3Connection
+	Jar            http.CookieJar
+	config         ClientConfig
+	// capture records the traffic of new connections. Nil if nothing is recorded, see StartCapture.
+	capture *Capture
+	// http3Endpoint is the UDP socket of all HTTP/3 connections. It is created by the first call
+	// to NewHTTP3Connection.
+	http3Endpoint *quic.Endpoint
 }
 
 // Connection is the type used for sending/receiving data
@@ -42,6 +60,14 @@ type Connection struct {
 	duration    *RoundTripTime
 }
 
+// HTTP3Connection is the type used for sending requests over HTTP/3. Each request is sent on a
+// new stream of the same QUIC connection.
+type HTTP3Connection struct {
+	conn        *quic.Conn
+	readTimeout time.Duration
+	duration    *RoundTripTime
+}
+
 // RoundTripTime abstracts the time a transaction takes
 type RoundTripTime struct {
 	begin time.Time
@@ -57,7 +83,8 @@ type FTWConnection interface {
 	receive() ([]byte, error)
 }
 
-// Destination is the host, port and protocol to be used when connecting to a remote host
+// Destination is the host, port and protocol to be used when connecting to a remote host.
+// For the UnixProtocol, DestAddr is the path of the socket.
 type Destination struct {
 	DestAddr string `default:"localhost"`
 	Port     int    `default:"80"`
@@ -81,9 +108,12 @@ type Request struct {
 	autoCompleteHeaders bool
 	isRaw               bool
 	rawRequest          []byte
+	preserveData        bool
+	chunked             *ChunkedOptions
 }
 
-// Response represents the http response received from the server/waf
+// Response represents the http response received from the server/waf.
+// For TLS connections, Parsed.TLS holds the negotiated TLS parameters.
 type Response struct {
 	RAW    []byte
 	Parsed http.Response
@@ -0,0 +1,344 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	yamlv4 "go.yaml.in/yaml/v4"
+
+	header_names "github.com/coreruleset/go-ftw/v2/ftwhttp/header_names"
+)
+
+// WebSocket opcodes, see RFC 6455, section 5.2
+const (
+	WebSocketContinuation byte = 0x0
+	WebSocketText         byte = 0x1
+	WebSocketBinary       byte = 0x2
+	WebSocketClose        byte = 0x8
+	WebSocketPing         byte = 0x9
+	WebSocketPong         byte = 0xa
+)
+
+// maxWebSocketPayload limits the size of received frames
+const maxWebSocketPayload = 16 << 20
+
+// Masking of WebSocket frames sent by the client
+const (
+	// MaskingMasked masks the payload with a random key, as required for clients
+	MaskingMasked = "masked"
+	// MaskingUnmasked sends the payload without a mask (malformed)
+	MaskingUnmasked = "unmasked"
+	// MaskingInvalid announces a mask key, but sends the payload without masking it (malformed)
+	MaskingInvalid = "invalid"
+)
+
+var webSocketMessageTypes = map[string]byte{
+	"text":   WebSocketText,
+	"binary": WebSocketBinary,
+	"ping":   WebSocketPing,
+	"pong":   WebSocketPong,
+	"close":  WebSocketClose,
+}
+
+// WebSocketMessage is a message sent by the client after the WebSocket handshake
+type WebSocketMessage struct {
+	// Type is one of "text" (default), "binary", "ping", "pong" and "close"
+	Type string `yaml:"type,omitempty"`
+	// Content is the payload of the message. Use EncodedContent for binary payloads.
+	Content string `yaml:"content,omitempty"`
+	// EncodedContent is the base64 encoded payload of the message. Replaces Content.
+	EncodedContent string `yaml:"encoded_content,omitempty"`
+	// Fragments splits the message into the given number of frames. 0 and 1 send a single frame.
+	Fragments int `yaml:"fragments,omitempty"`
+	// Masking is one of "masked" (default), "unmasked" and "invalid"
+	Masking string `yaml:"masking,omitempty"`
+}
+
+// WebSocketFrame is a frame received from the server
+type WebSocketFrame struct {
+	Fin     bool
+	Opcode  byte
+	Payload []byte
+}
+
+// WebSocket is an open WebSocket connection, see Client.WebSocket
+type WebSocket struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	readTimeout time.Duration
+}
+
+// UnmarshalYAML validates the message, so that mistakes are reported when loading the test
+func (m *WebSocketMessage) UnmarshalYAML(node *yamlv4.Node) error {
+	type plain WebSocketMessage
+	if err := node.Decode((*plain)(m)); err != nil {
+		return err
+	}
+	if _, err := m.opcode(); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	if _, err := m.payload(); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	switch m.Masking {
+	case "", MaskingMasked, MaskingUnmasked, MaskingInvalid:
+	default:
+		return fmt.Errorf("line %d: websocket: invalid masking %q, expected 'masked', 'unmasked' or 'invalid'", node.Line, m.Masking)
+	}
+	if m.Fragments < 0 {
+		return fmt.Errorf("line %d: websocket: 'fragments' must not be negative", node.Line)
+	}
+	return nil
+}
+
+func (m *WebSocketMessage) opcode() (byte, error) {
+	if m.Type == "" {
+		return WebSocketText, nil
+	}
+	opcode, ok := webSocketMessageTypes[m.Type]
+	if !ok {
+		return 0, fmt.Errorf("websocket: invalid message type %q, expected 'text', 'binary', 'ping', 'pong' or 'close'", m.Type)
+	}
+	return opcode, nil
+}
+
+func (m *WebSocketMessage) payload() ([]byte, error) {
+	if m.EncodedContent == "" {
+		return []byte(m.Content), nil
+	}
+	payload, err := base64.StdEncoding.DecodeString(m.EncodedContent)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: invalid encoded_content: %w", err)
+	}
+	return payload, nil
+}
+
+// AddWebSocketHeaders adds the headers of a WebSocket handshake to the request, if they don't exist
+func (r *Request) AddWebSocketHeaders() error {
+	if !r.headers.HasAny("Upgrade") {
+		r.headers.Add("Upgrade", "websocket")
+	}
+	if !r.headers.HasAny(header_names.Connection) {
+		r.headers.Add(header_names.Connection, "Upgrade")
+	}
+	if !r.headers.HasAny("Sec-WebSocket-Key") {
+		key := make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		r.headers.Add("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	}
+	if !r.headers.HasAny("Sec-WebSocket-Version") {
+		r.headers.Add("Sec-WebSocket-Version", "13")
+	}
+	return nil
+}
+
+// WebSocket performs the WebSocket handshake with the request. The handshake headers are added if
+// the request autocompletes headers. The handshake response is returned; if the server switched
+// protocols, the open WebSocket is returned as well, otherwise it is nil.
+func (c *Client) WebSocket(req *Request) (*Response, *WebSocket, error) {
+	if c.Transport == nil || c.Transport.connection == nil {
+		return nil, nil, errors.New("ftw/http/websocket: not connected to server")
+	}
+	if req.WithAutoCompleteHeaders() {
+		if err := req.AddWebSocketHeaders(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.config.RateLimiter.Wait(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	if err := c.Transport.Request(req); err != nil {
+		return nil, nil, err
+	}
+	response, reader, err := c.Transport.readResponse()
+	if err != nil {
+		return nil, nil, err
+	}
+	if response.Parsed.StatusCode != http.StatusSwitchingProtocols {
+		return response, nil, nil
+	}
+	return response, &WebSocket{
+		conn:        c.Transport.connection,
+		reader:      reader,
+		readTimeout: c.Transport.readTimeout,
+	}, nil
+}
+
+// Send sends a message as one or more frames
+func (ws *WebSocket) Send(message WebSocketMessage) error {
+	opcode, err := message.opcode()
+	if err != nil {
+		return err
+	}
+	payload, err := message.payload()
+	if err != nil {
+		return err
+	}
+	fragments := max(message.Fragments, 1)
+	size := (len(payload) + fragments - 1) / fragments
+	for i := range fragments {
+		start := min(i*size, len(payload))
+		end := min(start+size, len(payload))
+		frameOpcode := WebSocketContinuation
+		if i == 0 {
+			frameOpcode = opcode
+		}
+		frame, err := encodeWebSocketFrame(i == fragments-1, frameOpcode, payload[start:end], message.Masking)
+		if err != nil {
+			return err
+		}
+		if _, err := ws.conn.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeWebSocketFrame encodes a single frame as a client
+func encodeWebSocketFrame(fin bool, opcode byte, payload []byte, masking string) ([]byte, error) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	var maskBit byte
+	if masking != MaskingUnmasked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	if masking == MaskingUnmasked {
+		return append(frame, payload...), nil
+	}
+	key := make([]byte, 4)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	frame = append(frame, key...)
+	if masking == MaskingInvalid {
+		return append(frame, payload...), nil
+	}
+	for i, b := range payload {
+		frame = append(frame, b^key[i%4])
+	}
+	return frame, nil
+}
+
+// ReceiveFrame reads a single frame from the server
+func (ws *WebSocket) ReceiveFrame() (*WebSocketFrame, error) {
+	if err := ws.conn.SetReadDeadline(time.Now().Add(ws.readTimeout)); err != nil {
+		return nil, err
+	}
+	return ws.readFrame()
+}
+
+// readFrame reads and unmasks a single frame
+func (ws *WebSocket) readFrame() (*WebSocketFrame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, header); err != nil {
+		return nil, err
+	}
+	frame := &WebSocketFrame{Fin: header[0]&0x80 != 0, Opcode: header[0] & 0x0f}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, extended); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > maxWebSocketPayload {
+		return nil, fmt.Errorf("ftw/http/websocket: frame of %d bytes is too large", length)
+	}
+	var key []byte
+	if header[1]&0x80 != 0 {
+		key = make([]byte, 4)
+		if _, err := io.ReadFull(ws.reader, key); err != nil {
+			return nil, err
+		}
+	}
+	frame.Payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, frame.Payload); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		for i := range frame.Payload {
+			frame.Payload[i] ^= key[i%4]
+		}
+	}
+	return frame, nil
+}
+
+// Receive reads the next message from the server, joining fragmented frames. Control frames
+// received between the fragments of a message are skipped. io.EOF is returned once the server
+// has sent a close frame.
+func (ws *WebSocket) Receive() (*WebSocketFrame, error) {
+	var message *WebSocketFrame
+	for {
+		frame, err := ws.ReceiveFrame()
+		if err != nil {
+			return nil, err
+		}
+		log.Trace().Msgf("ftw/http/websocket: received frame with opcode %d: %q", frame.Opcode, frame.Payload)
+		if frame.Opcode == WebSocketClose {
+			return nil, io.EOF
+		}
+		if frame.Opcode >= WebSocketClose {
+			// control frames are never fragmented
+			if message == nil {
+				return frame, nil
+			}
+			continue
+		}
+		if message == nil {
+			message = frame
+		} else {
+			message.Payload = append(message.Payload, frame.Payload...)
+		}
+		if frame.Fin {
+			message.Fin = true
+			return message, nil
+		}
+	}
+}
+
+// Close sends a close frame with the status "normal closure". The connection itself belongs to
+// the client and is closed with the next connection of the client.
+func (ws *WebSocket) Close() error {
+	frame, err := encodeWebSocketFrame(true, WebSocketClose, []byte{0x03, 0xe8}, MaskingMasked)
+	if err != nil {
+		return err
+	}
+	_, err = ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package ftwhttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	yamlv4 "go.yaml.in/yaml/v4"
+	"golang.org/x/net/websocket"
+)
+
+type webSocketTestSuite struct {
+	suite.Suite
+	ts     *httptest.Server
+	client *Client
+}
+
+func TestWebSocketTestSuite(t *testing.T) {
+	suite.Run(t, new(webSocketTestSuite))
+}
+
+func (s *webSocketTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *webSocketTestSuite) SetupTest() {
+	mux := http.NewServeMux()
+	// echo every message received; fragments are received as separate messages
+	mux.Handle("/echo", websocket.Server{Handler: func(ws *websocket.Conn) {
+		for {
+			var message string
+			if err := websocket.Message.Receive(ws, &message); err != nil {
+				return
+			}
+			if err := websocket.Message.Send(ws, "echo: "+message); err != nil {
+				return
+			}
+		}
+	}})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	s.ts = httptest.NewServer(mux)
+
+	var err error
+	s.client, err = NewClientWithConfig(NewClientConfig())
+	s.Require().NoError(err)
+	s.client.config.ReadTimeout = time.Second
+	d, err := DestinationFromString(s.ts.URL)
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.NewConnection(*d))
+}
+
+func (s *webSocketTestSuite) TearDownTest() {
+	s.ts.Close()
+}
+
+func (s *webSocketTestSuite) handshake(uri string) (*Response, *WebSocket) {
+	h := NewHeader()
+	h.Add("Host", "localhost")
+	req := NewRequest(&RequestLine{Method: "GET", URI: uri, Version: "HTTP/1.1"}, h, nil, true)
+	response, ws, err := s.client.WebSocket(req)
+	s.Require().NoError(err)
+	return response, ws
+}
+
+func (s *webSocketTestSuite) TestHandshake() {
+	response, ws := s.handshake("/echo")
+	s.Require().NotNil(ws)
+	s.Equal(http.StatusSwitchingProtocols, response.Parsed.StatusCode)
+	s.Equal("websocket", response.Parsed.Header.Get("Upgrade"))
+	s.NoError(ws.Close())
+}
+
+func (s *webSocketTestSuite) TestHandshakeRefused() {
+	response, ws := s.handshake("/")
+	s.Nil(ws)
+	s.Equal(http.StatusForbidden, response.Parsed.StatusCode)
+}
+
+func (s *webSocketTestSuite) TestMessages() {
+	_, ws := s.handshake("/echo")
+	s.Require().NotNil(ws)
+
+	s.Require().NoError(ws.Send(WebSocketMessage{Content: "<script>alert(1)</script>"}))
+	s.Require().NoError(ws.Send(WebSocketMessage{Type: "binary", EncodedContent: "AAEC"}))
+	s.Require().NoError(ws.Send(WebSocketMessage{Content: strings.Repeat("a", 70000)}))
+
+	for _, expected := range []string{"echo: <script>alert(1)</script>", "echo: \x00\x01\x02", "echo: " + strings.Repeat("a", 70000)} {
+		message, err := ws.Receive()
+		s.Require().NoError(err)
+		s.Equal(WebSocketText, message.Opcode)
+		s.Equal(expected, string(message.Payload))
+	}
+}
+
+func (s *webSocketTestSuite) TestFragments() {
+	_, ws := s.handshake("/echo")
+	s.Require().NotNil(ws)
+
+	s.Require().NoError(ws.Send(WebSocketMessage{Content: "union select", Fragments: 3}))
+	for _, expected := range []string{"echo: unio", "echo: n se", "echo: lect"} {
+		message, err := ws.Receive()
+		s.Require().NoError(err)
+		s.Equal(expected, string(message.Payload))
+	}
+}
+
+func (s *webSocketTestSuite) TestMasking() {
+	_, ws := s.handshake("/echo")
+	s.Require().NotNil(ws)
+	s.Require().NoError(ws.Send(WebSocketMessage{Content: "hello", Masking: MaskingInvalid}))
+	message, err := ws.Receive()
+	s.Require().NoError(err)
+	s.NotEqual("echo: hello", string(message.Payload), "the server unmasks the payload with the announced key")
+
+	s.Require().NoError(ws.Send(WebSocketMessage{Content: "hello", Masking: MaskingUnmasked}))
+	_, err = ws.Receive()
+	s.ErrorIs(err, io.EOF, "the server closes the connection on unmasked frames")
+}
+
+func (s *webSocketTestSuite) TestEncodeFrame() {
+	frame, err := encodeWebSocketFrame(false, WebSocketText, []byte("abc"), MaskingUnmasked)
+	s.Require().NoError(err)
+	s.Equal([]byte{0x01, 0x03, 'a', 'b', 'c'}, frame)
+
+	frame, err = encodeWebSocketFrame(true, WebSocketBinary, make([]byte, 300), MaskingInvalid)
+	s.Require().NoError(err)
+	s.Equal([]byte{0x82, 0xfe, 0x01, 0x2c}, frame[:4])
+	s.Equal(make([]byte, 300), frame[8:], "the payload is not masked")
+
+	frame, err = encodeWebSocketFrame(true, WebSocketText, []byte("abc"), MaskingMasked)
+	s.Require().NoError(err)
+	ws := &WebSocket{reader: bufio.NewReader(bytes.NewReader(frame))}
+	s.Equal([]byte{0x81, 0x83}, frame[:2])
+	// the frame is read without setting a deadline on the reader
+	received, err := ws.readFrame()
+	s.Require().NoError(err)
+	s.Equal(&WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("abc")}, received)
+}
+
+func (s *webSocketTestSuite) TestUnmarshalYAML() {
+	tests := map[string]string{
+		"{type: stream}":           `invalid message type "stream"`,
+		"{masking: xor}":           `invalid masking "xor"`,
+		"{fragments: -1}":          "'fragments' must not be negative",
+		"{encoded_content: '%%%'}": "invalid encoded_content",
+	}
+	for yaml, expected := range tests {
+		s.Run(yaml, func() {
+			s.ErrorContains(yamlv4.Unmarshal([]byte(yaml), &WebSocketMessage{}), expected)
+		})
+	}
+	message := &WebSocketMessage{}
+	s.Require().NoError(yamlv4.Unmarshal([]byte("{type: ping, content: x, fragments: 2, masking: unmasked}"), message))
+	s.Equal(&WebSocketMessage{Type: "ping", Content: "x", Fragments: 2, Masking: MaskingUnmasked}, message)
+}
@@ -6,6 +6,7 @@ toolchain go1.26.5
 
 require (
 	github.com/Masterminds/sprig/v3 v3.3.0
+	github.com/andybalholm/brotli v1.2.0
 	github.com/corazawaf/coraza/v3 v3.7.0
 	github.com/coreruleset/ftw-tests-schema/v2 v2.3.0
 	github.com/creativeprojects/go-selfupdate v1.5.2
@@ -0,0 +1,163 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+// Package coverage correlates the rules of a rule set with the tests for them and, optionally,
+// with the rules observed during a test run.
+package coverage
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/coreruleset/go-ftw/v2/internal/inventory"
+	"github.com/coreruleset/go-ftw/v2/runner"
+)
+
+// RuleCoverage describes how well a single rule is covered
+type RuleCoverage struct {
+	RuleId        uint   `json:"rule_id"`
+	ParanoiaLevel int    `json:"paranoia_level"`
+	File          string `json:"file"`
+	// PositiveTests is the number of tests expecting the rule to be triggered
+	PositiveTests int `json:"positive_tests"`
+	// NegativeTests is the number of tests expecting the rule not to be triggered
+	NegativeTests int `json:"negative_tests"`
+	// Observed is the number of stages that triggered the rule in the results. Always 0 if there
+	// are no results.
+	Observed int `json:"observed"`
+}
+
+// Summary counts the covered rules of a paranoia level, or of all paranoia levels
+type Summary struct {
+	// ParanoiaLevel is 0 for rules without paranoia level tag, and for the total over all levels
+	ParanoiaLevel        int `json:"paranoia_level"`
+	Rules                int `json:"rules"`
+	WithPositiveTests    int `json:"with_positive_tests"`
+	WithoutPositiveTests int `json:"without_positive_tests"`
+	WithNegativeTests    int `json:"with_negative_tests"`
+	WithoutNegativeTests int `json:"without_negative_tests"`
+	Observed             int `json:"observed"`
+	NeverObserved        int `json:"never_observed"`
+}
+
+// Report is the coverage of all rules of a rule set
+type Report struct {
+	// HasResults is true if the report includes the rules observed during a test run
+	HasResults bool            `json:"has_results"`
+	Rules      []*RuleCoverage `json:"rules"`
+	// Summaries contains one summary per paranoia level, ordered by level
+	Summaries []*Summary `json:"summaries"`
+	Total     *Summary   `json:"total"`
+	// UnknownRules contains the IDs of rules that are referenced by tests but are not part of the rule set
+	UnknownRules []uint `json:"unknown_rules"`
+}
+
+// New creates the coverage report of rules. Tests count for every rule in their `expect_ids`
+// or `no_expect_ids`. results may be nil if no results of a test run are available.
+func New(rules []*Rule, tests *inventory.Inventory, results *runner.RunStats) *Report {
+	report := &Report{
+		HasResults:   results != nil,
+		Rules:        make([]*RuleCoverage, 0, len(rules)),
+		Summaries:    []*Summary{},
+		Total:        &Summary{},
+		UnknownRules: []uint{},
+	}
+	byId := make(map[uint]*RuleCoverage, len(rules))
+	for _, rule := range rules {
+		ruleCoverage := &RuleCoverage{
+			RuleId:        rule.Id,
+			ParanoiaLevel: rule.ParanoiaLevel,
+			File:          rule.File,
+		}
+		report.Rules = append(report.Rules, ruleCoverage)
+		byId[rule.Id] = ruleCoverage
+	}
+	slices.SortStableFunc(report.Rules, func(a *RuleCoverage, b *RuleCoverage) int {
+		return cmp.Compare(a.RuleId, b.RuleId)
+	})
+
+	addUnknown := func(id uint) {
+		if !slices.Contains(report.UnknownRules, id) {
+			report.UnknownRules = append(report.UnknownRules, id)
+		}
+	}
+	for _, entry := range tests.Tests {
+		if _, found := byId[entry.RuleId]; !found {
+			addUnknown(entry.RuleId)
+		}
+		for _, id := range entry.ExpectIds {
+			if ruleCoverage, found := byId[id]; found {
+				ruleCoverage.PositiveTests++
+			} else {
+				addUnknown(id)
+			}
+		}
+		for _, id := range entry.NoExpectIds {
+			if ruleCoverage, found := byId[id]; found {
+				ruleCoverage.NegativeTests++
+			} else {
+				addUnknown(id)
+			}
+		}
+	}
+	slices.Sort(report.UnknownRules)
+
+	if results != nil {
+		for _, stages := range results.TriggeredRules {
+			for _, ids := range stages {
+				for _, id := range ids {
+					if ruleCoverage, found := byId[id]; found {
+						ruleCoverage.Observed++
+					}
+				}
+			}
+		}
+	}
+
+	report.summarize()
+	return report
+}
+
+func (r *Report) summarize() {
+	byLevel := map[int]*Summary{}
+	for _, rule := range r.Rules {
+		summary, found := byLevel[rule.ParanoiaLevel]
+		if !found {
+			summary = &Summary{ParanoiaLevel: rule.ParanoiaLevel}
+			byLevel[rule.ParanoiaLevel] = summary
+			r.Summaries = append(r.Summaries, summary)
+		}
+		summary.add(rule)
+		r.Total.add(rule)
+	}
+	slices.SortFunc(r.Summaries, func(a *Summary, b *Summary) int {
+		return cmp.Compare(a.ParanoiaLevel, b.ParanoiaLevel)
+	})
+}
+
+func (s *Summary) add(rule *RuleCoverage) {
+	s.Rules++
+	if rule.PositiveTests > 0 {
+		s.WithPositiveTests++
+	} else {
+		s.WithoutPositiveTests++
+	}
+	if rule.NegativeTests > 0 {
+		s.WithNegativeTests++
+	} else {
+		s.WithoutNegativeTests++
+	}
+	if rule.Observed > 0 {
+		s.Observed++
+	} else {
+		s.NeverObserved++
+	}
+}
+
+// Uncovered returns the rules without positive tests, without negative tests or, if the report
+// has results, that were never observed
+func (r *Report) Uncovered() []*RuleCoverage {
+	return slices.DeleteFunc(slices.Clone(r.Rules), func(rule *RuleCoverage) bool {
+		return rule.PositiveTests > 0 && rule.NegativeTests > 0 && (!r.HasResults || rule.Observed > 0)
+	})
+}
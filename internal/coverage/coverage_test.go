@@ -0,0 +1,92 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package coverage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/internal/inventory"
+	"github.com/coreruleset/go-ftw/v2/runner"
+)
+
+type coverageTestSuite struct {
+	suite.Suite
+	rules []*Rule
+	tests *inventory.Inventory
+}
+
+func TestCoverageTestSuite(t *testing.T) {
+	suite.Run(t, new(coverageTestSuite))
+}
+
+func (s *coverageTestSuite) SetupTest() {
+	s.rules = []*Rule{
+		{Id: 920200, ParanoiaLevel: 2, File: "920.conf"},
+		{Id: 920100, ParanoiaLevel: 1, File: "920.conf"},
+		{Id: 920160, ParanoiaLevel: 1, File: "920.conf"},
+		{Id: 949110, File: "949.conf"},
+	}
+	s.tests = &inventory.Inventory{Tests: []*inventory.TestEntry{
+		{RuleId: 920100, TestId: 1, ExpectIds: []uint{920100, 949110}},
+		{RuleId: 920100, TestId: 2, ExpectIds: []uint{920100}},
+		{RuleId: 920100, TestId: 3, NoExpectIds: []uint{920100}},
+		{RuleId: 920160, TestId: 1, NoExpectIds: []uint{920160, 920999}},
+		{RuleId: 930110, TestId: 1, ExpectIds: []uint{930110}},
+	}}
+}
+
+func (s *coverageTestSuite) TestNew() {
+	report := New(s.rules, s.tests, nil)
+
+	s.False(report.HasResults)
+	s.Equal([]*RuleCoverage{
+		{RuleId: 920100, ParanoiaLevel: 1, File: "920.conf", PositiveTests: 2, NegativeTests: 1},
+		{RuleId: 920160, ParanoiaLevel: 1, File: "920.conf", NegativeTests: 1},
+		{RuleId: 920200, ParanoiaLevel: 2, File: "920.conf"},
+		{RuleId: 949110, File: "949.conf", PositiveTests: 1},
+	}, report.Rules)
+	s.Equal([]uint{920999, 930110}, report.UnknownRules)
+
+	s.Equal([]*Summary{
+		{ParanoiaLevel: 0, Rules: 1, WithPositiveTests: 1, WithoutNegativeTests: 1, NeverObserved: 1},
+		{ParanoiaLevel: 1, Rules: 2, WithPositiveTests: 1, WithoutPositiveTests: 1, WithNegativeTests: 2, NeverObserved: 2},
+		{ParanoiaLevel: 2, Rules: 1, WithoutPositiveTests: 1, WithoutNegativeTests: 1, NeverObserved: 1},
+	}, report.Summaries)
+	s.Equal(&Summary{Rules: 4, WithPositiveTests: 2, WithoutPositiveTests: 2, WithNegativeTests: 2, WithoutNegativeTests: 2, NeverObserved: 4}, report.Total)
+}
+
+func (s *coverageTestSuite) TestNewWithResults() {
+	results := runner.NewRunStats()
+	results.TriggeredRules = map[string][][]uint{
+		"920100-1": {{920100, 949110}},
+		"920100-2": {{920100}, {920100, 930110}},
+	}
+	report := New(s.rules, s.tests, results)
+
+	s.True(report.HasResults)
+	s.Equal(3, report.Rules[0].Observed)
+	s.Equal(0, report.Rules[1].Observed)
+	s.Equal(1, report.Rules[3].Observed)
+	s.Equal(2, report.Total.Observed)
+	s.Equal(2, report.Total.NeverObserved)
+}
+
+func (s *coverageTestSuite) TestUncovered() {
+	report := New(s.rules, s.tests, nil)
+	uncovered := report.Uncovered()
+	s.Require().Len(uncovered, 3)
+	s.Equal(uint(920160), uncovered[0].RuleId)
+	s.Len(report.Rules, 4, "finding uncovered rules must not modify the report")
+
+	s.tests.Tests = append(s.tests.Tests, &inventory.TestEntry{RuleId: 949110, TestId: 1, NoExpectIds: []uint{949110, 920160, 920200}},
+		&inventory.TestEntry{RuleId: 920200, TestId: 1, ExpectIds: []uint{920200, 920160}})
+	s.Empty(New(s.rules, s.tests, nil).Uncovered())
+
+	results := runner.NewRunStats()
+	results.TriggeredRules = map[string][][]uint{"920100-1": {{920100}}}
+	uncovered = New(s.rules, s.tests, results).Uncovered()
+	s.Len(uncovered, 3, "rules that were never observed must be reported as uncovered")
+}
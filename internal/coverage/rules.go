@@ -0,0 +1,216 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package coverage
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const paranoiaLevelTagPrefix = "paranoia-level/"
+
+// Rule describes a rule found in a rules directory
+type Rule struct {
+	Id uint `json:"id"`
+	// ParanoiaLevel is taken from the `paranoia-level/N` tag of the rule, 0 if the rule has no such tag
+	ParanoiaLevel int `json:"paranoia_level"`
+	// NoLog is true for rules that never write to the log, such as the rules skipping paranoia levels
+	NoLog bool   `json:"nolog"`
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+}
+
+// ParseRulesDir parses all `*.conf` files below dir and returns the rules with an ID, ordered by ID
+func ParseRulesDir(dir string) ([]*Rule, error) {
+	rules := []*Rule{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".conf" {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		fileRules, err := ParseRules(file, path)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules in %s: %w", dir, err)
+	}
+	slices.SortStableFunc(rules, func(a *Rule, b *Rule) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return rules, nil
+}
+
+// ParseRules parses the `SecRule` and `SecAction` directives of a ModSecurity configuration file.
+// Directives without an `id` action, such as chained rules, are ignored.
+func ParseRules(reader io.Reader, fileName string) ([]*Rule, error) {
+	rules := []*Rule{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	directive := strings.Builder{}
+	directiveLine := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if directive.Len() == 0 {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			directiveLine = lineNumber
+		}
+		// directives can span multiple lines, using a backslash at the end of each line but the last
+		if continued, found := strings.CutSuffix(strings.TrimRight(line, " \t"), "\\"); found {
+			directive.WriteString(continued)
+			continue
+		}
+		directive.WriteString(line)
+
+		rule, err := parseDirective(directive.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fileName, directiveLine, err)
+		}
+		if rule != nil {
+			rule.File = fileName
+			rule.Line = directiveLine
+			rules = append(rules, rule)
+		}
+		directive.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseDirective returns the rule defined by a directive, or nil if the directive does not define
+// a rule with an ID
+func parseDirective(directive string) (*Rule, error) {
+	arguments, err := splitArguments(directive)
+	if err != nil {
+		return nil, err
+	}
+	if len(arguments) == 0 {
+		return nil, nil
+	}
+	var actions string
+	switch {
+	case strings.EqualFold(arguments[0], "SecRule") && len(arguments) > 3:
+		actions = arguments[3]
+	case strings.EqualFold(arguments[0], "SecAction") && len(arguments) > 1:
+		actions = arguments[1]
+	default:
+		return nil, nil
+	}
+
+	rule := &Rule{}
+	hasId := false
+	for _, action := range splitActions(actions) {
+		name, value, _ := strings.Cut(action, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), "'")
+		switch name {
+		case "id":
+			id, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule ID %q", value)
+			}
+			rule.Id = uint(id)
+			hasId = true
+		case "tag":
+			if level, found := strings.CutPrefix(value, paranoiaLevelTagPrefix); found {
+				if rule.ParanoiaLevel, err = strconv.Atoi(level); err != nil {
+					return nil, fmt.Errorf("invalid paranoia level tag %q", value)
+				}
+			}
+		case "nolog":
+			rule.NoLog = true
+		}
+	}
+	if !hasId {
+		return nil, nil
+	}
+	return rule, nil
+}
+
+// splitArguments splits a directive into its whitespace separated arguments. Double quotes
+// group arguments, and a backslash escapes the next character within quotes.
+func splitArguments(directive string) ([]string, error) {
+	arguments := []string{}
+	current := strings.Builder{}
+	inArgument := false
+	quoted := false
+	for i := 0; i < len(directive); i++ {
+		c := directive[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(directive):
+			i++
+			if directive[i] != '"' {
+				current.WriteByte(c)
+			}
+			current.WriteByte(directive[i])
+		case quoted && c == '"':
+			quoted = false
+		case !quoted && c == '"':
+			quoted = true
+			inArgument = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inArgument {
+				arguments = append(arguments, current.String())
+				current.Reset()
+				inArgument = false
+			}
+		default:
+			current.WriteByte(c)
+			inArgument = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in directive")
+	}
+	if inArgument {
+		arguments = append(arguments, current.String())
+	}
+	return arguments, nil
+}
+
+// splitActions splits an action list at commas outside of single quotes
+func splitActions(actions string) []string {
+	result := []string{}
+	start := 0
+	quoted := false
+	for i := 0; i < len(actions); i++ {
+		switch actions[i] {
+		case '\\':
+			i++
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				result = append(result, actions[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, actions[start:])
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package coverage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type rulesTestSuite struct {
+	suite.Suite
+}
+
+func TestRulesTestSuite(t *testing.T) {
+	suite.Run(t, new(rulesTestSuite))
+}
+
+func (s *rulesTestSuite) TestParseRulesDir() {
+	rules, err := ParseRulesDir("testdata/rules")
+	s.Require().NoError(err)
+
+	protocolEnforcement := "testdata/rules/REQUEST-920-PROTOCOL-ENFORCEMENT.conf"
+	blockingEvaluation := "testdata/rules/REQUEST-949-BLOCKING-EVALUATION.conf"
+	s.Equal([]*Rule{
+		{Id: 920011, NoLog: true, File: protocolEnforcement, Line: 5},
+		{Id: 920013, NoLog: true, File: protocolEnforcement, Line: 31},
+		{Id: 920100, ParanoiaLevel: 1, File: protocolEnforcement, Line: 7},
+		{Id: 920160, ParanoiaLevel: 1, File: protocolEnforcement, Line: 20},
+		{Id: 920200, ParanoiaLevel: 2, File: protocolEnforcement, Line: 33},
+		{Id: 949052, NoLog: true, File: blockingEvaluation, Line: 1},
+		{Id: 949110, File: blockingEvaluation, Line: 7},
+	}, rules)
+}
+
+func (s *rulesTestSuite) TestParseRulesDirNotFound() {
+	_, err := ParseRulesDir("testdata/does-not-exist")
+	s.ErrorContains(err, "failed to parse rules in testdata/does-not-exist")
+}
+
+func (s *rulesTestSuite) TestParseRulesIgnoresOtherDirectives() {
+	rules, err := ParseRules(strings.NewReader(`
+SecRuleEngine On
+SecDefaultAction "phase:1,log,auditlog,pass"
+SecRuleUpdateTargetById 920100 "!ARGS:foo"
+SecMarker "END-REQUEST-920-PROTOCOL-ENFORCEMENT"
+secrule ARGS "@rx a" "id:1,deny"
+`), "test.conf")
+	s.Require().NoError(err)
+	s.Equal([]*Rule{{Id: 1, File: "test.conf", Line: 6}}, rules)
+}
+
+func (s *rulesTestSuite) TestParseRulesErrors() {
+	_, err := ParseRules(strings.NewReader(`SecRule ARGS "@rx a" "id:abc,deny"`), "test.conf")
+	s.EqualError(err, `test.conf:1: invalid rule ID "abc"`)
+
+	_, err = ParseRules(strings.NewReader(`SecRule ARGS "@rx a" "id:1,tag:'paranoia-level/x'"`), "test.conf")
+	s.EqualError(err, `test.conf:1: invalid paranoia level tag "paranoia-level/x"`)
+
+	_, err = ParseRules(strings.NewReader("\n"+`SecRule ARGS "@rx a "id:1"`), "test.conf")
+	s.EqualError(err, "test.conf:2: unterminated quote in directive")
+}
+
+func (s *rulesTestSuite) TestSplitArguments() {
+	arguments, err := splitArguments(`SecRule  ARGS	"@rx \"a\\b c" "id:1"`)
+	s.Require().NoError(err)
+	s.Equal([]string{"SecRule", "ARGS", `@rx "a\\b c`, "id:1"}, arguments)
+}
+
+func (s *rulesTestSuite) TestSplitActions() {
+	s.Equal([]string{"id:1", "msg:'a, b'", "tag:'it\\'s'", "pass"}, splitActions(`id:1,msg:'a, b',tag:'it\'s',pass`))
+}
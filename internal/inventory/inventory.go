@@ -0,0 +1,135 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+// Package inventory summarizes test files, so that the test corpus can be queried without running it.
+package inventory
+
+import (
+	"cmp"
+	"slices"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+
+	"github.com/coreruleset/go-ftw/v2/test"
+)
+
+// TestEntry describes a single test case
+type TestEntry struct {
+	RuleId uint     `json:"rule_id"`
+	TestId uint     `json:"test_id"`
+	Tags   []string `json:"tags,omitempty"`
+	Stages int      `json:"stages"`
+	// ExpectedStatus contains the expected status of each stage, 0 if a stage does not check the status
+	ExpectedStatus []int `json:"expected_status"`
+	// ExpectIds contains the rule IDs that any of the stages expects to be triggered
+	ExpectIds []uint `json:"expect_ids,omitempty"`
+	// NoExpectIds contains the rule IDs that any of the stages expects not to be triggered
+	NoExpectIds []uint `json:"no_expect_ids,omitempty"`
+	// Negative is true if the test checks that its rule is not triggered
+	Negative bool `json:"negative"`
+	// DeprecatedFields contains the deprecated fields used by the test (see `test.FTWTest.DeprecatedFields`)
+	DeprecatedFields []string `json:"deprecated_fields,omitempty"`
+	File             string   `json:"file"`
+}
+
+// RuleEntry summarizes the tests of a single rule
+type RuleEntry struct {
+	RuleId        uint     `json:"rule_id"`
+	Tests         int      `json:"tests"`
+	PositiveTests int      `json:"positive_tests"`
+	NegativeTests int      `json:"negative_tests"`
+	Files         []string `json:"files"`
+}
+
+// Inventory holds the entries of all selected tests, ordered by rule ID and test ID
+type Inventory struct {
+	Tests []*TestEntry
+}
+
+// New creates an inventory of the tests for which selected returns true. If selected is nil,
+// all tests are included.
+func New(tests []*test.FTWTest, selected func(ftwTest *test.FTWTest, testCase *schema.Test) bool) *Inventory {
+	inventory := &Inventory{Tests: []*TestEntry{}}
+	for _, ftwTest := range tests {
+		for index := range ftwTest.Tests {
+			testCase := &ftwTest.Tests[index]
+			if selected != nil && !selected(ftwTest, testCase) {
+				continue
+			}
+			inventory.Tests = append(inventory.Tests, newTestEntry(ftwTest, testCase))
+		}
+	}
+	slices.SortStableFunc(inventory.Tests, func(a *TestEntry, b *TestEntry) int {
+		return cmp.Or(cmp.Compare(a.RuleId, b.RuleId), cmp.Compare(a.TestId, b.TestId))
+	})
+	return inventory
+}
+
+func newTestEntry(ftwTest *test.FTWTest, testCase *schema.Test) *TestEntry {
+	file := ftwTest.FilePath
+	if file == "" {
+		file = ftwTest.FileName
+	}
+	entry := &TestEntry{
+		RuleId:           testCase.RuleId,
+		TestId:           testCase.TestId,
+		Tags:             testCase.Tags,
+		Stages:           len(testCase.Stages),
+		ExpectedStatus:   make([]int, 0, len(testCase.Stages)),
+		DeprecatedFields: ftwTest.DeprecatedFields(testCase),
+		File:             file,
+	}
+	for _, stage := range testCase.Stages {
+		entry.ExpectedStatus = append(entry.ExpectedStatus, stage.Output.Status)
+		entry.ExpectIds = appendUnique(entry.ExpectIds, stage.Output.Log.ExpectIds...)
+		entry.NoExpectIds = appendUnique(entry.NoExpectIds, stage.Output.Log.NoExpectIds...)
+	}
+	entry.Negative = slices.Contains(entry.NoExpectIds, testCase.RuleId)
+	return entry
+}
+
+// Rules returns a summary of the tests per rule, ordered by rule ID
+func (i *Inventory) Rules() []*RuleEntry {
+	rules := []*RuleEntry{}
+	for _, entry := range i.Tests {
+		if len(rules) == 0 || rules[len(rules)-1].RuleId != entry.RuleId {
+			rules = append(rules, &RuleEntry{RuleId: entry.RuleId, Files: []string{}})
+		}
+		rule := rules[len(rules)-1]
+		rule.Tests++
+		if entry.Negative {
+			rule.NegativeTests++
+		}
+		if slices.Contains(entry.ExpectIds, entry.RuleId) {
+			rule.PositiveTests++
+		}
+		if !slices.Contains(rule.Files, entry.File) {
+			rule.Files = append(rule.Files, entry.File)
+		}
+	}
+	return rules
+}
+
+// RulesWithoutNegativeTests returns the summaries of the rules that have no test checking that
+// the rule is not triggered
+func (i *Inventory) RulesWithoutNegativeTests() []*RuleEntry {
+	return slices.DeleteFunc(i.Rules(), func(rule *RuleEntry) bool {
+		return rule.NegativeTests > 0
+	})
+}
+
+// Deprecated returns the entries of the tests that use deprecated fields
+func (i *Inventory) Deprecated() []*TestEntry {
+	return slices.DeleteFunc(slices.Clone(i.Tests), func(entry *TestEntry) bool {
+		return len(entry.DeprecatedFields) == 0
+	})
+}
+
+func appendUnique(ids []uint, values ...uint) []uint {
+	for _, value := range values {
+		if !slices.Contains(ids, value) {
+			ids = append(ids, value)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"testing"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/test"
+)
+
+type inventoryTestSuite struct {
+	suite.Suite
+	tests []*test.FTWTest
+}
+
+func TestInventoryTestSuite(t *testing.T) {
+	suite.Run(t, new(inventoryTestSuite))
+}
+
+func (s *inventoryTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *inventoryTestSuite) SetupTest() {
+	var err error
+	// load in reverse order to verify that entries are sorted
+	s.tests, err = test.GetTestsFromFiles("testdata/930110.yaml")
+	s.Require().NoError(err)
+	tests, err := test.GetTestsFromFiles("testdata/920100.yaml")
+	s.Require().NoError(err)
+	s.tests = append(s.tests, tests...)
+}
+
+func (s *inventoryTestSuite) TestTests() {
+	inventory := New(s.tests, nil)
+	s.Require().Len(inventory.Tests, 4)
+
+	s.Equal(&TestEntry{
+		RuleId:           920100,
+		TestId:           1,
+		Tags:             []string{"paranoia-level/1"},
+		Stages:           1,
+		ExpectedStatus:   []int{403},
+		ExpectIds:        []uint{920100},
+		DeprecatedFields: []string{},
+		File:             "testdata/920100.yaml",
+	}, inventory.Tests[0])
+	s.Equal(&TestEntry{
+		RuleId:           920100,
+		TestId:           2,
+		Stages:           1,
+		ExpectedStatus:   []int{0},
+		NoExpectIds:      []uint{920100},
+		Negative:         true,
+		DeprecatedFields: []string{},
+		File:             "testdata/920100.yaml",
+	}, inventory.Tests[1])
+	s.Equal(uint(930110), inventory.Tests[2].RuleId)
+	s.Equal(uint(1), inventory.Tests[2].TestId)
+	s.Equal([]uint{930110, 949110}, inventory.Tests[2].ExpectIds)
+	s.Equal(uint(2), inventory.Tests[3].TestId)
+	s.Equal(2, inventory.Tests[3].Stages)
+	s.Equal([]int{0, 200}, inventory.Tests[3].ExpectedStatus)
+	s.Equal([]uint{930110}, inventory.Tests[3].ExpectIds)
+}
+
+func (s *inventoryTestSuite) TestSelection() {
+	inventory := New(s.tests, func(_ *test.FTWTest, testCase *schema.Test) bool {
+		return testCase.RuleId == 930110
+	})
+	s.Len(inventory.Tests, 2)
+}
+
+func (s *inventoryTestSuite) TestRules() {
+	rules := New(s.tests, nil).Rules()
+	s.Equal([]*RuleEntry{
+		{RuleId: 920100, Tests: 2, PositiveTests: 1, NegativeTests: 1, Files: []string{"testdata/920100.yaml"}},
+		{RuleId: 930110, Tests: 2, PositiveTests: 2, NegativeTests: 0, Files: []string{"testdata/930110.yaml"}},
+	}, rules)
+}
+
+func (s *inventoryTestSuite) TestRulesWithoutNegativeTests() {
+	rules := New(s.tests, nil).RulesWithoutNegativeTests()
+	s.Require().Len(rules, 1)
+	s.Equal(uint(930110), rules[0].RuleId)
+}
+
+func (s *inventoryTestSuite) TestDeprecated() {
+	inventory := New(s.tests, nil)
+	deprecated := inventory.Deprecated()
+	s.Require().Len(deprecated, 1)
+	s.Equal(uint(930110), deprecated[0].RuleId)
+	s.Equal(uint(2), deprecated[0].TestId)
+	s.Equal([]string{"input.headers", "input.stop_magic", "output.log_contains"}, deprecated[0].DeprecatedFields)
+	s.Len(inventory.Tests, 4, "listing deprecated tests must not modify the inventory")
+}
+
+func (s *inventoryTestSuite) TestEmpty() {
+	inventory := New(nil, nil)
+	s.Empty(inventory.Tests)
+	s.Empty(inventory.Rules())
+}
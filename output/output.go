@@ -31,22 +31,31 @@ type catalog map[string]string
 // this catalog is used to translate text from basic terminals to enhanced ones that support emoji, just
 // because we are fancy. If we are not using a normal output, then just use the key from this map.
 var normalCatalog = catalog{
-	"** Starting tests!":                    ":hammer_and_wrench:Starting tests!",
-	"** Running go-ftw!":                    ":rocket:Running go-ftw!",
-	"=> executing tests in file %s":         ":point_right:executing tests in file %s",
-	"+ passed in %s (RTT %s)":               ":check_mark:passed in %s (RTT %s)",
-	"- %s failed in %s (RTT %s)":            ":collision:%s failed in %s (RTT %s)",
-	"= test ignored":                        ":information:test ignored",
-	"= test forced to fail":                 ":information:test forced to fail",
-	"= test forced to pass":                 ":information:test forced to pass",
-	"¯\\_(ツ)_/¯ No tests were run":          ":person_shrugging:No tests were run",
-	"+ run %d total tests in %s":            ":plus:run %d total tests in %s",
-	">> skipped %d tests":                   ":next_track_button:skipped %d tests",
-	"^ ignored %d tests":                    ":index_pointing_up:ignored %d tests",
-	"^ forced to pass %d tests":             ":index_pointing_up:forced to pass %d tests",
-	"\\o/ All tests successful!":            ":tada:All tests successful!",
-	"- %d test(s) failed to run: %+q":       ":thumbs_down:%d test(s) failed to run: %+q",
-	"- %d test(s) were forced to fail: %+q": ":index_pointing_up:%d test(s) were forced to fail: %+q",
+	"** Starting tests!":                         ":hammer_and_wrench:Starting tests!",
+	"** Running go-ftw!":                         ":rocket:Running go-ftw!",
+	"=> executing tests in file %s":              ":point_right:executing tests in file %s",
+	"+ passed in %s (RTT %s)":                    ":check_mark:passed in %s (RTT %s)",
+	"- %s failed in %s (RTT %s)":                 ":collision:%s failed in %s (RTT %s)",
+	"= test ignored":                             ":information:test ignored",
+	"= test forced to fail":                      ":information:test forced to fail",
+	"= test forced to pass":                      ":information:test forced to pass",
+	"¯\\_(ツ)_/¯ No tests were run":               ":person_shrugging:No tests were run",
+	"+ run %d total tests in %s":                 ":plus:run %d total tests in %s",
+	">> skipped %d tests":                        ":next_track_button:skipped %d tests",
+	"^ ignored %d tests":                         ":index_pointing_up:ignored %d tests",
+	"^ forced to pass %d tests":                  ":index_pointing_up:forced to pass %d tests",
+	"\\o/ All tests successful!":                 ":tada:All tests successful!",
+	"- %d test(s) failed to run: %+q":            ":thumbs_down:%d test(s) failed to run: %+q",
+	"- %d test(s) were forced to fail: %+q":      ":index_pointing_up:%d test(s) were forced to fail: %+q",
+	"~ shuffling tests using seed %d":            ":game_die:shuffling tests using seed %d",
+	"~ tests were shuffled using seed %d":        ":game_die:tests were shuffled using seed %d",
+	"~ dry run, requests are built but not sent": ":memo:dry run, requests are built but not sent",
+	"=> stage %d of %s to %s":                    ":outbox_tray:stage %d of %s to %s",
+	"=> stage %d of %s to %s written to %s":      ":floppy_disk:stage %d of %s to %s written to %s",
+	"~ rendered %d requests":                     ":memo:rendered %d requests",
+	"+ %s: %s":                                   ":check_mark:%s: %s",
+	"- %s: %s":                                   ":cross_mark:%s: %s",
+	"~ %s: %s":                                   ":next_track_button:%s: %s",
 }
 
 type Output struct {
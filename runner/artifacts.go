@@ -0,0 +1,191 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	yamlv4 "go.yaml.in/yaml/v4"
+
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/test"
+)
+
+// Names of the files written to the artifacts folder of a failed stage
+const (
+	requestArtifact        = "request.http"
+	http3RequestArtifact   = "request.h3"
+	responseArtifact       = "response.http"
+	wafLogArtifact         = "waf.log"
+	testArtifact           = "test.yaml"
+	expectedOutputArtifact = "expected-output.yaml"
+	diagnosisArtifact      = "diagnosis.json"
+)
+
+// stageArtifacts contains what is written to the artifacts folder of a failed stage
+type stageArtifacts struct {
+	testCase       *schema.Test
+	request        *ftwhttp.Request
+	response       *ftwhttp.Response
+	responseErr    error
+	expectedOutput *schema.Output
+	triggeredRules []uint
+}
+
+// diagnosis describes why a stage failed
+type diagnosis struct {
+	Test  string `json:"test"`
+	Stage int    `json:"stage"`
+	// FailedAssertion names the assertion that failed, e.g. "status" or "log"
+	FailedAssertion string `json:"failed-assertion"`
+	Reason          string `json:"reason"`
+	// StatusCode is the status code of the response. 0 if no response was received.
+	StatusCode    int                   `json:"status-code,omitempty"`
+	Error         string                `json:"error,omitempty"`
+	ErrorCategory ftwhttp.ErrorCategory `json:"error-category,omitempty"`
+	// TriggeredRules contains the IDs of the rules found in the log, or in the response in cloud mode
+	TriggeredRules []uint `json:"triggered-rules,omitempty"`
+}
+
+// writeArtifacts writes a folder for the current stage to `ArtifactsDir`, named after the test and
+// the stage like the files of a dry run. A folder of a previous run is replaced. The folder
+// contains the raw request and response, the log lines between the markers, the YAML of the test,
+// the expected output after overrides and a diagnosis. Files that don't apply, e.g. the response if
+// none was received, or the log lines if the stage failed before they were found, are left out.
+func writeArtifacts(runContext *TestRunContext, ftwCheck *FTWCheck, artifacts *stageArtifacts) error {
+	testCase := artifacts.testCase
+	dir := filepath.Join(runContext.RunnerConfig.ArtifactsDir, fmt.Sprintf("%s-%d", testCase.IdString(), runContext.stageNumber))
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove artifacts folder %q: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create artifacts folder %q: %w", dir, err)
+	}
+	write := func(name string, data []byte) error {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to write artifact %q: %w", filepath.Join(dir, name), err)
+		}
+		return nil
+	}
+
+	// HTTP/3 requests are sent as frames, not as a text message
+	requestName := requestArtifact
+	request, err := artifacts.request.WireBytes()
+	if artifacts.request.UsesHTTP3() {
+		requestName = http3RequestArtifact
+		request, err = artifacts.request.HTTP3Frames()
+	}
+	if err != nil {
+		return err
+	}
+	if err := write(requestName, request); err != nil {
+		return err
+	}
+	if artifacts.response != nil {
+		if err := write(responseArtifact, artifacts.response.RAW); err != nil {
+			return err
+		}
+	}
+	// The log lines of a stage are unknown if it failed before they could be correlated, e.g., if
+	// it expected an error and no markers were found
+	if notRunningInCloudMode(ftwCheck) && runContext.LogLines.Correlated() {
+		lines, err := runContext.LogLines.GetMarkedLines()
+		if err != nil {
+			return err
+		}
+		var wafLog bytes.Buffer
+		for _, line := range lines {
+			wafLog.Write(line)
+			wafLog.WriteByte('\n')
+		}
+		if err := write(wafLogArtifact, wafLog.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	var outputExtensions test.OutputExtensions
+	if ftwTest := runContext.ftwTest; ftwTest != nil {
+		testYaml, err := ftwTest.TestYaml(testCase)
+		if err != nil {
+			return err
+		}
+		if testYaml != nil {
+			if err := write(testArtifact, testYaml); err != nil {
+				return err
+			}
+		}
+		outputExtensions = ftwTest.StageExtensions(testCase, runContext.stageNumber-1).Output
+	}
+	expectedOutput, err := expectedOutputYaml(artifacts.expectedOutput, &outputExtensions)
+	if err != nil {
+		return err
+	}
+	if err := write(expectedOutputArtifact, expectedOutput); err != nil {
+		return err
+	}
+
+	stageDiagnosis := diagnosis{
+		Test:            testCase.IdString(),
+		Stage:           runContext.stageNumber,
+		FailedAssertion: ftwCheck.failedAssertion,
+		Reason:          ftwCheck.failureReason,
+		TriggeredRules:  artifacts.triggeredRules,
+	}
+	if artifacts.response != nil {
+		stageDiagnosis.StatusCode = artifacts.response.Parsed.StatusCode
+	}
+	if artifacts.responseErr != nil {
+		stageDiagnosis.Error = artifacts.responseErr.Error()
+		stageDiagnosis.ErrorCategory = ftwhttp.ErrorCategoryOf(artifacts.responseErr)
+	}
+	diagnosisJson, err := json.MarshalIndent(stageDiagnosis, "", "  ")
+	if err != nil {
+		return err
+	}
+	return write(diagnosisArtifact, append(diagnosisJson, '\n'))
+}
+
+// expectedOutputYaml returns the expected output of a stage, with the fields of the test schema
+// followed by the fields that go-ftw supports in addition
+func expectedOutputYaml(output *schema.Output, extensions *test.OutputExtensions) ([]byte, error) {
+	var merged, additional yamlv4.Node
+	if err := merged.Encode(output); err != nil {
+		return nil, err
+	}
+	if err := additional.Encode(extensions); err != nil {
+		return nil, err
+	}
+	mergeYamlMappings(&merged, &additional)
+	return yamlv4.Marshal(&merged)
+}
+
+// mergeYamlMappings adds the keys of src to dst, merging mappings that are found in both. Empty
+// mappings of src are left out.
+func mergeYamlMappings(dst *yamlv4.Node, src *yamlv4.Node) {
+	for index := 0; index+1 < len(src.Content); index += 2 {
+		key, value := src.Content[index], src.Content[index+1]
+		if value.Kind == yamlv4.MappingNode && len(value.Content) == 0 {
+			continue
+		}
+		if existing := yamlMappingValue(dst, key.Value); existing != nil && existing.Kind == yamlv4.MappingNode && value.Kind == yamlv4.MappingNode {
+			mergeYamlMappings(existing, value)
+			continue
+		}
+		dst.Content = append(dst.Content, key, value)
+	}
+}
+
+func yamlMappingValue(mapping *yamlv4.Node, key string) *yamlv4.Node {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value == key {
+			return mapping.Content[index+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/test"
+	"github.com/coreruleset/go-ftw/v2/waflog"
+)
+
+type artifactsTestSuite struct {
+	suite.Suite
+}
+
+func TestArtifactsTestSuite(t *testing.T) {
+	suite.Run(t, new(artifactsTestSuite))
+}
+
+func (s *artifactsTestSuite) TestExpectedOutputYaml() {
+	inbound := 5
+	output := &schema.Output{Status: 403, Log: schema.Log{ExpectIds: []uint{920100}}}
+	extensions := &test.OutputExtensions{
+		Log: test.LogExtensions{AnomalyScore: &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Equals: &inbound}}},
+	}
+
+	expectedOutput, err := expectedOutputYaml(output, extensions)
+	s.Require().NoError(err)
+	s.Equal(`status: 403
+log:
+    expect_ids:
+        - 920100
+    anomaly_score:
+        inbound:
+            equals: 5
+`, string(expectedOutput))
+}
+
+func (s *artifactsTestSuite) TestExpectedOutputYamlWithoutExtensions() {
+	expectedOutput, err := expectedOutputYaml(&schema.Output{Status: 200}, &test.OutputExtensions{})
+	s.Require().NoError(err)
+	s.Equal("status: 200\n", string(expectedOutput))
+}
+
+func (s *artifactsTestSuite) TestStageWithoutMarkers() {
+	logFilePath := filepath.Join(s.T().TempDir(), "error.log")
+	s.Require().NoError(os.WriteFile(logFilePath, nil, 0644))
+	runnerConfig := &config.RunnerConfig{RunMode: config.DefaultRunMode, LogFilePath: logFilePath, ArtifactsDir: s.T().TempDir()}
+	logLines, err := waflog.NewFTWLogLines(runnerConfig)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = logLines.Cleanup() })
+	runContext := &TestRunContext{RunnerConfig: runnerConfig, LogLines: logLines, stageNumber: 1}
+	ftwCheck, err := NewCheck(runContext)
+	s.Require().NoError(err)
+	// the stage expected an error, but the request was sent and no markers were found
+	ftwCheck.fail("expect_error", "expected an error, but the request was sent")
+
+	headers := ftwhttp.NewHeader()
+	headers.Add("Host", "localhost")
+	err = writeArtifacts(runContext, ftwCheck, &stageArtifacts{
+		testCase:       &schema.Test{RuleId: 123456, TestId: 1},
+		request:        ftwhttp.NewRequest(&ftwhttp.RequestLine{Method: "GET", URI: "/", Version: "HTTP/1.1"}, headers, nil, true),
+		expectedOutput: &schema.Output{ExpectError: func() *bool { b := true; return &b }()},
+	})
+	s.Require().NoError(err)
+
+	dir := filepath.Join(runnerConfig.ArtifactsDir, "123456-1-1")
+	s.FileExists(filepath.Join(dir, requestArtifact))
+	s.FileExists(filepath.Join(dir, expectedOutputArtifact))
+	s.FileExists(filepath.Join(dir, diagnosisArtifact))
+	s.NoFileExists(filepath.Join(dir, wafLogArtifact), "the log lines of the stage are unknown")
+}
+
+func (s *artifactsTestSuite) TestHTTP3Request() {
+	runnerConfig := &config.RunnerConfig{RunMode: config.CloudRunMode, ArtifactsDir: s.T().TempDir()}
+	runContext := &TestRunContext{RunnerConfig: runnerConfig, stageNumber: 1}
+	ftwCheck, err := NewCheck(runContext)
+	s.Require().NoError(err)
+
+	headers := ftwhttp.NewHeader()
+	headers.Add("Host", "localhost")
+	request := ftwhttp.NewRequest(&ftwhttp.RequestLine{Method: "GET", URI: "/", Version: ftwhttp.HTTP3Version}, headers, nil, true)
+	err = writeArtifacts(runContext, ftwCheck, &stageArtifacts{
+		testCase:       &schema.Test{RuleId: 123456, TestId: 1},
+		request:        request,
+		expectedOutput: &schema.Output{Status: 200},
+	})
+	s.Require().NoError(err)
+
+	dir := filepath.Join(runnerConfig.ArtifactsDir, "123456-1-1")
+	frames, err := os.ReadFile(filepath.Join(dir, http3RequestArtifact))
+	s.Require().NoError(err)
+	expected, err := request.HTTP3Frames()
+	s.Require().NoError(err)
+	s.Equal(expected, frames)
+	s.NoFileExists(filepath.Join(dir, requestArtifact), "HTTP/3 requests must not be written as HTTP/1 messages")
+}
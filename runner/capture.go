@@ -0,0 +1,42 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+)
+
+// writeCapture writes the recorded traffic of the current stage to a file in `CaptureDir`, named
+// after the test and the stage like the files of a dry run.
+func writeCapture(runContext *TestRunContext, testCase *schema.Test, capture *ftwhttp.Capture) error {
+	write := capture.WritePcapng
+	extension := "pcapng"
+	if runContext.RunnerConfig.CaptureFormat == config.TranscriptCaptureFormat {
+		write = capture.WriteTranscript
+		extension = "txt"
+	}
+	fileName := filepath.Join(runContext.RunnerConfig.CaptureDir, fmt.Sprintf("%s-%d.%s", testCase.IdString(), runContext.stageNumber, extension))
+	f, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create capture file %q: %w", fileName, err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			log.Error().Err(closeErr).Msg("Failed to close capture file")
+		}
+	}()
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to write capture file %q: %w", fileName, err)
+	}
+	log.Debug().Msgf("Traffic of stage %d of %s written to %s", runContext.stageNumber, testCase.IdString(), fileName)
+	return nil
+}
@@ -4,9 +4,14 @@
 package runner
 
 import (
+	"fmt"
+	"time"
+
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/rs/zerolog/log"
 
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 	"github.com/coreruleset/go-ftw/v2/test"
 	"github.com/coreruleset/go-ftw/v2/waflog"
 )
@@ -16,6 +21,27 @@ type FTWCheck struct {
 	log      *waflog.FTWLogLines
 	expected *test.Output
 	cfg      *config.RunnerConfig
+	// expectedAnomalyScore and expectedLogEntries are not part of the test schema, so they are set
+	// separately from expected
+	expectedAnomalyScore *test.AnomalyScoreExpectation
+	expectedLogEntries   []test.LogEntryExpectation
+	// expectedWebSocket contains the expectations on the messages received in a WebSocket stage.
+	// Nil if there are none.
+	expectedWebSocket *test.WebSocketExpectation
+	// webSocketMessages contains the payloads of the messages received in a WebSocket stage
+	webSocketMessages [][]byte
+	// expectedErrorCategory is the category of the expected error. Empty if any error is accepted.
+	expectedErrorCategory ftwhttp.ErrorCategory
+	// responseView is the view of the response that response expectations are matched against
+	responseView test.ResponseView
+	// ruleIdExtractor finds rule IDs in responses in cloud mode. Nil if not configured.
+	ruleIdExtractor *responseRuleIdExtractor
+	// responseRuleIds contains the rule IDs found in the response of the stage
+	responseRuleIds []uint
+	// failedAssertion names the assertion that failed the stage and failureReason describes why.
+	// Both are empty if the stage didn't fail.
+	failedAssertion string
+	failureReason   string
 }
 
 // NewCheck creates a new FTWCheck, allowing to inject the configuration
@@ -26,14 +52,84 @@ func NewCheck(context *TestRunContext) (*FTWCheck, error) {
 		expected: &test.Output{},
 	}
 
+	if check.CloudMode() {
+		ruleIdExtractor, err := newResponseRuleIdExtractor(context.RunnerConfig.CloudRuleIdHeader, context.RunnerConfig.CloudRuleIdRegex)
+		if err != nil {
+			return nil, err
+		}
+		check.ruleIdExtractor = ruleIdExtractor
+	}
+
 	return check, nil
 }
 
+// fail records the assertion that failed the stage
+func (c *FTWCheck) fail(assertion string, format string, args ...any) {
+	c.failedAssertion = assertion
+	c.failureReason = fmt.Sprintf(format, args...)
+}
+
+// SetResponse sets the response of the stage. In cloud mode, the IDs of the triggered rules are read
+// from the response, if configured.
+func (c *FTWCheck) SetResponse(response *ftwhttp.Response) {
+	c.responseRuleIds = nil
+	if c.ruleIdExtractor != nil && response != nil {
+		c.responseRuleIds = c.ruleIdExtractor.ruleIds(response, c.responseText(response))
+	}
+}
+
+// responseText returns the selected view of the response. The raw response is returned unless the
+// decoded view is selected and the response can be decoded.
+func (c *FTWCheck) responseText(response *ftwhttp.Response) string {
+	if c.responseView != test.DecodedResponseView {
+		return response.GetFullResponse()
+	}
+	decoded, err := response.GetDecodedResponse()
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to decode response, using the raw response")
+		return response.GetFullResponse()
+	}
+	return decoded
+}
+
 // SetExpectTestOutput sets the combined expected output from this test
 func (c *FTWCheck) SetExpectTestOutput(t *test.Output) {
 	c.expected = t
 }
 
+// SetExpectAnomalyScore sets the anomaly scores expected to be found in the logs. Nil disables the check.
+func (c *FTWCheck) SetExpectAnomalyScore(expectation *test.AnomalyScoreExpectation) {
+	c.expectedAnomalyScore = expectation
+}
+
+// SetExpectLogEntries sets the details of the log entries expected to be found in the logs
+func (c *FTWCheck) SetExpectLogEntries(expectations []test.LogEntryExpectation) {
+	c.expectedLogEntries = expectations
+}
+
+// SetResponseView sets the view of the response that response expectations are matched against.
+// The empty view is the raw view.
+func (c *FTWCheck) SetResponseView(view test.ResponseView) {
+	c.responseView = view
+}
+
+// SetExpectWebSocket sets the expectations on the messages received in a WebSocket stage. Nil
+// disables the check.
+func (c *FTWCheck) SetExpectWebSocket(expectation *test.WebSocketExpectation) {
+	c.expectedWebSocket = expectation
+}
+
+// SetExpectErrorCategory sets the category of the expected error. The empty category only checks
+// expect_error.
+func (c *FTWCheck) SetExpectErrorCategory(category ftwhttp.ErrorCategory) {
+	c.expectedErrorCategory = category
+}
+
+// SetWebSocketMessages sets the payloads of the messages received in a WebSocket stage
+func (c *FTWCheck) SetWebSocketMessages(messages [][]byte) {
+	c.webSocketMessages = messages
+}
+
 // SetExpectStatus sets to expect the HTTP status from the test to be in the integer range passed
 func (c *FTWCheck) SetExpectStatus(status int) {
 	c.expected.Status = status
@@ -108,13 +204,53 @@ func (c *FTWCheck) SetEndMarker(marker []byte) {
 	c.log.WithEndMarker(marker)
 }
 
+// OpenLogWindow starts collecting the log lines of the stage without markers
+func (c *FTWCheck) OpenLogWindow() error {
+	return c.log.OpenWindow()
+}
+
+// CloseLogWindow stops collecting the log lines of the stage. If correlationId is not empty, only the
+// lines containing it are analyzed.
+func (c *FTWCheck) CloseLogWindow(correlationId string) error {
+	if err := c.log.CloseWindow(); err != nil {
+		return err
+	}
+	c.log.WithCorrelationId([]byte(correlationId))
+	return nil
+}
+
+// CloseLogTimeWindow stops collecting the log lines of the stage. Only the lines with a timestamp between
+// from and to are analyzed.
+func (c *FTWCheck) CloseLogTimeWindow(from time.Time, to time.Time) error {
+	if err := c.log.CloseWindow(); err != nil {
+		return err
+	}
+	c.log.WithTimeWindow(from, to)
+	return nil
+}
+
 func (c *FTWCheck) GetTriggeredRules() ([]uint, error) {
 	if c.CloudMode() {
-		return nil, nil
+		return c.responseRuleIds, nil
 	}
-	// When a test is expecting to trigger an error and it effectively does, markers are not set.
-	if len(c.log.StartMarker()) == 0 || len(c.log.EndMarker()) == 0 {
+	// When a test is expecting to trigger an error and it effectively does, the log lines of the
+	// stage are not known.
+	if !c.log.Correlated() {
 		return nil, nil
 	}
 	return c.log.TriggeredRules()
 }
+
+// GetAnomalyScores returns the anomaly scores found in the log for the current stage. Nil if the
+// log can't be inspected.
+func (c *FTWCheck) GetAnomalyScores() (*waflog.AnomalyScores, error) {
+	if c.CloudMode() {
+		return nil, nil
+	}
+	// When a test is expecting to trigger an error and it effectively does, the log lines of the
+	// stage are not known.
+	if !c.log.Correlated() {
+		return nil, nil
+	}
+	return c.log.AnomalyScores()
+}
@@ -3,11 +3,16 @@
 
 package runner
 
-import "github.com/rs/zerolog/log"
+import (
+	"github.com/rs/zerolog/log"
 
-// AssertExpectError helper to check if this error was expected or not
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+)
+
+// AssertExpectError helper to check if this error was expected or not. An expected error category
+// implies that an error is expected, and the category of the error must match.
 func (c *FTWCheck) AssertExpectError(err error) (bool, bool) {
-	errorExpected := c.expected.ExpectError != nil && *c.expected.ExpectError
+	errorExpected := c.ErrorExpected()
 	var errorString string
 	if err == nil {
 		errorString = "-"
@@ -16,5 +21,18 @@ func (c *FTWCheck) AssertExpectError(err error) (bool, bool) {
 	}
 	log.Debug().Caller().Msgf("Error expected: %t. Found: %s", errorExpected, errorString)
 
+	if errorExpected && err != nil && c.expectedErrorCategory != "" {
+		category := ftwhttp.ErrorCategoryOf(err)
+		if category != c.expectedErrorCategory {
+			log.Debug().Msgf("Failed to match error category. Expected: %s, found: %s", c.expectedErrorCategory, category)
+			return errorExpected, false
+		}
+	}
+
 	return errorExpected, (errorExpected && err != nil) || (!errorExpected && err == nil)
 }
+
+// ErrorExpected returns whether the stage expects an error instead of a response
+func (c *FTWCheck) ErrorExpected() bool {
+	return (c.expected.ExpectError != nil && *c.expected.ExpectError) || c.expectedErrorCategory != ""
+}
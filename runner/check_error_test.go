@@ -5,12 +5,14 @@ package runner
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 	"github.com/coreruleset/go-ftw/v2/utils"
 )
 
@@ -86,3 +88,26 @@ func (s *checkErrorTestSuite) TestAssertResponseFail() {
 		s.False(succeeded)
 	}
 }
+
+func (s *checkErrorTestSuite) TestAssertExpectErrorCategory() {
+	c, err := NewCheck(s.context)
+	s.Require().NoError(err)
+	c.SetExpectErrorCategory(ftwhttp.ConnectionResetCategory)
+
+	resetErr := fmt.Errorf("failed sending request: %w", &ftwhttp.TransportError{
+		Category: ftwhttp.ConnectionResetCategory,
+		Err:      errors.New("connection reset by peer"),
+	})
+	expected, succeeded := c.AssertExpectError(resetErr)
+	s.True(expected, "an expected category implies that an error is expected")
+	s.True(succeeded)
+
+	_, succeeded = c.AssertExpectError(&ftwhttp.TransportError{Category: ftwhttp.ReadTimeoutCategory, Err: errors.New("i/o timeout")})
+	s.False(succeeded)
+
+	_, succeeded = c.AssertExpectError(errors.New("a"))
+	s.False(succeeded, "errors without a category must not match")
+
+	_, succeeded = c.AssertExpectError(nil)
+	s.False(succeeded)
+}
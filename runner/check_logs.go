@@ -4,12 +4,22 @@
 package runner
 
 import (
+	"regexp"
+	"slices"
+	"strings"
+
 	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/v2/test"
+	"github.com/coreruleset/go-ftw/v2/waflog"
 )
 
 func (c *FTWCheck) AssertLogs() (bool, error) {
 	if c.CloudMode() {
-		// No logs to check in cloud mode
+		// No logs to check in cloud mode, but the rule IDs may be found in the response
+		if c.ruleIdExtractor != nil {
+			return c.assertResponseRuleIds(), nil
+		}
 		return true, nil
 	}
 
@@ -21,8 +31,12 @@ func (c *FTWCheck) AssertLogs() (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	anomalyScore, err := c.assertAnomalyScore()
+	if err != nil {
+		return false, err
+	}
 
-	return contains && notContains, nil
+	return contains && notContains && anomalyScore, nil
 }
 
 // AssertNoLogContains returns true is the string is not found in the logs
@@ -75,6 +89,13 @@ func (c *FTWCheck) assertLogContains() (bool, error) {
 		}
 	}
 
+	if len(c.expectedLogEntries) > 0 {
+		found, err := c.assertLogEntries()
+		if err != nil || !found {
+			return false, err
+		}
+	}
+
 	if c.expected.Isolated {
 		ruleIds, err := c.log.TriggeredRules()
 		if err != nil {
@@ -88,3 +109,79 @@ func (c *FTWCheck) assertLogContains() (bool, error) {
 
 	return true, nil
 }
+
+// assertAnomalyScore returns true if the anomaly scores in the log meet the expectations
+func (c *FTWCheck) assertAnomalyScore() (bool, error) {
+	expectation := c.expectedAnomalyScore
+	if expectation == nil || (expectation.Inbound == nil && expectation.Outbound == nil) {
+		return true, nil
+	}
+	scores, err := c.log.AnomalyScores()
+	if err != nil {
+		return false, err
+	}
+	if expectation.Inbound != nil && !expectation.Inbound.Matches(scores.Inbound) {
+		log.Debug().Msgf("Inbound anomaly score %d does not match the expected score %s", scores.Inbound, expectation.Inbound)
+		return false, nil
+	}
+	if expectation.Outbound != nil && !expectation.Outbound.Matches(scores.Outbound) {
+		log.Debug().Msgf("Outbound anomaly score %d does not match the expected score %s", scores.Outbound, expectation.Outbound)
+		return false, nil
+	}
+	return true, nil
+}
+
+// assertLogEntries returns true if every expected log entry matches at least one entry in the log
+func (c *FTWCheck) assertLogEntries() (bool, error) {
+	entries, err := c.log.Entries()
+	if err != nil {
+		return false, err
+	}
+	for _, expectation := range c.expectedLogEntries {
+		found := false
+		for _, entry := range entries {
+			if found, err = logEntryMatches(&expectation, entry); err != nil {
+				return false, err
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			log.Debug().Msgf("Failed to find a log entry with %s", &expectation)
+			for _, entry := range entries {
+				if entry.RuleId == expectation.Id {
+					log.Debug().Msgf("Found log entry for rule %d: msg %q, severity %q, tags %q, data %q",
+						entry.RuleId, entry.Msg, entry.Severity, entry.Tags, entry.Data)
+				}
+			}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func logEntryMatches(expectation *test.LogEntryExpectation, entry *waflog.LogEntry) (bool, error) {
+	if entry.RuleId != expectation.Id {
+		return false, nil
+	}
+	if expectation.Severity != "" && !strings.EqualFold(entry.Severity, expectation.Severity) {
+		return false, nil
+	}
+	for _, tag := range expectation.Tags {
+		if !slices.Contains(entry.Tags, tag) {
+			return false, nil
+		}
+	}
+	if expectation.Msg != "" {
+		if found, err := regexp.MatchString(expectation.Msg, entry.Msg); err != nil || !found {
+			return false, err
+		}
+	}
+	if expectation.Data != "" {
+		if found, err := regexp.MatchString(expectation.Data, entry.Data); err != nil || !found {
+			return false, err
+		}
+	}
+	return true, nil
+}
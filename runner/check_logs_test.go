@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/test"
 	"github.com/coreruleset/go-ftw/v2/utils"
 	"github.com/coreruleset/go-ftw/v2/waflog"
 )
@@ -235,3 +236,86 @@ func (s *checkLogsTestSuite) TestAssertLogIsolated() {
 	s.Require().NoError(err)
 	s.False(logsCheck, "Expected to find multiple IDs")
 }
+
+func (s *checkLogsTestSuite) TestAssertAnomalyScore() {
+	score := func(value int) *int { return &value }
+	tests := []struct {
+		name        string
+		expectation *test.AnomalyScoreExpectation
+		expected    bool
+	}{
+		{"no expectation", nil, true},
+		{"empty expectation", &test.AnomalyScoreExpectation{}, true},
+		{"exact inbound", &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Equals: score(5)}}, true},
+		{"wrong inbound", &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Equals: score(3)}}, false},
+		{"inbound minimum", &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Min: score(5)}}, true},
+		{"inbound minimum too high", &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Min: score(6)}}, false},
+		{"inbound range", &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Min: score(1), Max: score(10)}}, true},
+		{"inbound maximum too low", &test.AnomalyScoreExpectation{Inbound: &test.ScoreExpectation{Max: score(4)}}, false},
+		{"outbound not logged", &test.AnomalyScoreExpectation{Outbound: &test.ScoreExpectation{Equals: score(0)}}, true},
+		{"outbound not reached", &test.AnomalyScoreExpectation{
+			Inbound:  &test.ScoreExpectation{Equals: score(5)},
+			Outbound: &test.ScoreExpectation{Min: score(1)},
+		}, false},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.check.SetExpectAnomalyScore(tt.expectation)
+			logsCheck, err := s.check.AssertLogs()
+			s.Require().NoError(err)
+			s.Equal(tt.expected, logsCheck)
+		})
+	}
+}
+
+func (s *checkLogsTestSuite) TestGetAnomalyScores() {
+	scores, err := s.check.GetAnomalyScores()
+	s.Require().NoError(err)
+	s.Equal(&waflog.AnomalyScores{Inbound: 5}, scores)
+
+	s.runnerConfig.RunMode = config.CloudRunMode
+	scores, err = s.check.GetAnomalyScores()
+	s.Require().NoError(err)
+	s.Nil(scores)
+}
+
+func (s *checkLogsTestSuite) TestAssertLogEntries() {
+	tests := []struct {
+		name         string
+		expectations []test.LogEntryExpectation
+		expected     bool
+	}{
+		{"rule ID only", []test.LogEntryExpectation{{Id: 920300}}, true},
+		{"missing rule", []test.LogEntryExpectation{{Id: 942100}}, false},
+		{"all details", []test.LogEntryExpectation{{
+			Id:       920210,
+			Msg:      "^Multiple/Conflicting Connection",
+			Severity: "warning",
+			Tags:     []string{"attack-protocol", "paranoia-level/1"},
+			Data:     "close,close",
+		}}, true},
+		{"wrong msg", []test.LogEntryExpectation{{Id: 920210, Msg: "Accept Header"}}, false},
+		{"wrong severity", []test.LogEntryExpectation{{Id: 920210, Severity: "CRITICAL"}}, false},
+		{"missing tag", []test.LogEntryExpectation{{Id: 920210, Tags: []string{"attack-protocol", "attack-sqli"}}}, false},
+		{"wrong data", []test.LogEntryExpectation{{Id: 920210, Data: "keep-alive"}}, false},
+		{"details of another rule", []test.LogEntryExpectation{{Id: 920300, Msg: "Conflicting Connection"}}, false},
+		{"several entries", []test.LogEntryExpectation{
+			{Id: 949110, Severity: "CRITICAL", Msg: `Total Score: 5\)`},
+			{Id: 980130, Tags: []string{"event-correlation"}},
+		}, true},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.check.SetExpectLogEntries(tt.expectations)
+			logsCheck, err := s.check.AssertLogs()
+			s.Require().NoError(err)
+			s.Equal(tt.expected, logsCheck)
+		})
+	}
+}
+
+func (s *checkLogsTestSuite) TestAssertLogEntriesInvalidRegex() {
+	s.check.SetExpectLogEntries([]test.LogEntryExpectation{{Id: 920210, Msg: "("}})
+	_, err := s.check.AssertLogs()
+	s.ErrorContains(err, "missing closing )")
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+)
+
+// defaultResponseRuleIdRegex finds the rule IDs in the configured response header when no regular
+// expression is configured, e.g., "942100" or "942100, 949110"
+var defaultResponseRuleIdRegex = regexp.MustCompile(`\b(\d+)\b`)
+
+// responseRuleIdExtractor finds the IDs of the rules that matched a request in the response. Many
+// managed WAFs report them in a response header or on the block page, which makes it possible
+// to check `expect_ids` and `no_expect_ids` in cloud mode.
+type responseRuleIdExtractor struct {
+	// header is the name of the response header that contains the rule IDs. If empty, regex is
+	// matched against the full response.
+	header string
+	regex  *regexp.Regexp
+}
+
+// newResponseRuleIdExtractor returns nil if neither a header nor a regular expression is configured
+func newResponseRuleIdExtractor(header string, regex string) (*responseRuleIdExtractor, error) {
+	if header == "" && regex == "" {
+		return nil, nil
+	}
+	extractor := &responseRuleIdExtractor{
+		header: header,
+		regex:  defaultResponseRuleIdRegex,
+	}
+	if regex != "" {
+		compiled, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, fmt.Errorf("cloud rule id regex: %w", err)
+		}
+		if compiled.NumSubexp() == 0 {
+			return nil, errors.New("cloud rule id regex does not contain a capture group and cannot be used to find IDs")
+		}
+		extractor.regex = compiled
+	}
+	return extractor, nil
+}
+
+// ruleIds returns the sorted IDs of the rules found in the response, using the headers of response
+// or text, the selected view of the response
+func (e *responseRuleIdExtractor) ruleIds(response *ftwhttp.Response, text string) []uint {
+	if e.header != "" {
+		text = strings.Join(response.Parsed.Header.Values(e.header), "\n")
+	}
+	ruleIds := []uint{}
+	for _, match := range e.regex.FindAllStringSubmatch(text, -1) {
+		if match[1] == "" {
+			continue
+		}
+		ruleId, err := strconv.ParseUint(match[1], 10, 0)
+		if err != nil {
+			log.Debug().Msgf("Failed to parse rule ID from response: %s", match[1])
+			continue
+		}
+		if !slices.Contains(ruleIds, uint(ruleId)) {
+			ruleIds = append(ruleIds, uint(ruleId))
+		}
+	}
+	slices.Sort(ruleIds)
+	log.Trace().Msgf("Found rule IDs in response: %v", ruleIds)
+	return ruleIds
+}
+
+// assertResponseRuleIds returns true if the rule IDs found in the response meet the expectations
+// of `expect_ids` and `no_expect_ids`
+func (c *FTWCheck) assertResponseRuleIds() bool {
+	logExpectations := c.expected.Log
+	missedRules := []uint{}
+	for _, id := range logExpectations.ExpectIds {
+		if !slices.Contains(c.responseRuleIds, id) {
+			missedRules = append(missedRules, id)
+		}
+	}
+	if len(missedRules) > 0 {
+		log.Debug().Msgf("Failed to find the following IDs in the response: %v", missedRules)
+		return false
+	}
+	foundRules := []uint{}
+	for _, id := range logExpectations.NoExpectIds {
+		if slices.Contains(c.responseRuleIds, id) {
+			foundRules = append(foundRules, id)
+		}
+	}
+	if len(foundRules) > 0 {
+		log.Debug().Msgf("Unexpectedly found the following IDs in the response: %v", foundRules)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+)
+
+const blockPage = "HTTP/1.1 403 Forbidden\r\nX-Rule-Id: 942100, 949110\r\n\r\n<html>Request blocked. Incident: rule=942100 ref=1234</html>"
+
+type checkResponseRulesTestSuite struct {
+	suite.Suite
+	runnerConfig *config.RunnerConfig
+	context      *TestRunContext
+}
+
+func TestCheckResponseRulesTestSuite(t *testing.T) {
+	suite.Run(t, new(checkResponseRulesTestSuite))
+}
+
+func (s *checkResponseRulesTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *checkResponseRulesTestSuite) SetupTest() {
+	cfg := config.NewDefaultConfig()
+	cfg.RunMode = config.CloudRunMode
+	s.runnerConfig = config.NewRunnerConfiguration(cfg)
+	s.context = &TestRunContext{
+		RunnerConfig: s.runnerConfig,
+	}
+}
+
+func newBlockedResponse() *ftwhttp.Response {
+	return &ftwhttp.Response{
+		RAW: []byte(blockPage),
+		Parsed: http.Response{
+			StatusCode: http.StatusForbidden,
+			Header:     http.Header{"X-Rule-Id": []string{"942100, 949110"}},
+		},
+	}
+}
+
+func (s *checkResponseRulesTestSuite) TestNewResponseRuleIdExtractor() {
+	extractor, err := newResponseRuleIdExtractor("", "")
+	s.Require().NoError(err)
+	s.Nil(extractor)
+
+	_, err = newResponseRuleIdExtractor("", "rule=(")
+	s.ErrorContains(err, "cloud rule id regex")
+
+	_, err = newResponseRuleIdExtractor("", `rule=\d+`)
+	s.ErrorContains(err, "capture group")
+}
+
+func (s *checkResponseRulesTestSuite) TestRuleIds() {
+	tests := []struct {
+		name     string
+		header   string
+		regex    string
+		expected []uint
+	}{
+		{"header", "X-Rule-Id", "", []uint{942100, 949110}},
+		{"header name is case-insensitive", "x-rule-id", "", []uint{942100, 949110}},
+		{"header and regex", "X-Rule-Id", `(94\d+)$`, []uint{949110}},
+		{"missing header", "X-Incident", "", []uint{}},
+		{"body regex", "", `rule=(\d+)`, []uint{942100}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			extractor, err := newResponseRuleIdExtractor(tt.header, tt.regex)
+			s.Require().NoError(err)
+			response := newBlockedResponse()
+			s.Equal(tt.expected, extractor.ruleIds(response, response.GetFullResponse()))
+		})
+	}
+}
+
+func (s *checkResponseRulesTestSuite) TestAssertLogsInCloudMode() {
+	s.runnerConfig.CloudRuleIdHeader = "X-Rule-Id"
+	tests := []struct {
+		name        string
+		expectIds   []uint
+		noExpectIds []uint
+		expected    bool
+	}{
+		{"expected IDs found", []uint{942100, 949110}, nil, true},
+		{"expected ID missing", []uint{942100, 920300}, nil, false},
+		{"unexpected ID absent", nil, []uint{920300}, true},
+		{"unexpected ID found", nil, []uint{949110}, false},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			check, err := NewCheck(s.context)
+			s.Require().NoError(err)
+			check.expected.Log.ExpectIds = tt.expectIds
+			check.expected.Log.NoExpectIds = tt.noExpectIds
+			check.SetResponse(newBlockedResponse())
+
+			logsCheck, err := check.AssertLogs()
+			s.Require().NoError(err)
+			s.Equal(tt.expected, logsCheck)
+		})
+	}
+}
+
+func (s *checkResponseRulesTestSuite) TestAssertLogsInCloudModeWithoutExtractor() {
+	check, err := NewCheck(s.context)
+	s.Require().NoError(err)
+	check.expected.Log.ExpectIds = []uint{920300}
+	check.SetResponse(newBlockedResponse())
+
+	logsCheck, err := check.AssertLogs()
+	s.Require().NoError(err)
+	s.True(logsCheck, "without extractor, rule IDs can't be checked in cloud mode")
+}
+
+func (s *checkResponseRulesTestSuite) TestGetTriggeredRules() {
+	s.runnerConfig.CloudRuleIdHeader = "X-Rule-Id"
+	check, err := NewCheck(s.context)
+	s.Require().NoError(err)
+
+	check.SetResponse(newBlockedResponse())
+	ruleIds, err := check.GetTriggeredRules()
+	s.Require().NoError(err)
+	s.Equal([]uint{942100, 949110}, ruleIds)
+
+	check.SetResponse(nil)
+	ruleIds, err = check.GetTriggeredRules()
+	s.Require().NoError(err)
+	s.Nil(ruleIds)
+}
+
+func (s *checkResponseRulesTestSuite) TestNewCheckInvalidRegex() {
+	s.runnerConfig.CloudRuleIdRegex = "("
+	_, err := NewCheck(s.context)
+	s.Error(err)
+
+	// the regular expression is only used in cloud mode
+	s.runnerConfig.RunMode = config.DefaultRunMode
+	_, err = NewCheck(s.context)
+	s.NoError(err)
+}
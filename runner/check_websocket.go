@@ -0,0 +1,35 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AssertWebSocketMessages checks the messages received in a WebSocket stage
+func (c *FTWCheck) AssertWebSocketMessages() bool {
+	expectation := c.expectedWebSocket
+	if expectation == nil {
+		return true
+	}
+	if expectation.Receive > 0 && len(c.webSocketMessages) < expectation.Receive {
+		log.Debug().Msgf("Failed to receive WebSocket messages. Expected %d, received %d", expectation.Receive, len(c.webSocketMessages))
+		return false
+	}
+	for _, regex := range expectation.ReceivedContains {
+		if !anyMessageMatches(regexp.MustCompile(regex), c.webSocketMessages) {
+			log.Debug().Msgf("Failed to match received WebSocket messages. Expected to find '%s'", regex)
+			return false
+		}
+	}
+	for _, regex := range expectation.NoReceivedContains {
+		if anyMessageMatches(regexp.MustCompile(regex), c.webSocketMessages) {
+			log.Debug().Msgf("Unexpected WebSocket message matching '%s' received", regex)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/test"
+	"github.com/coreruleset/go-ftw/v2/utils"
+)
+
+// logCorrelator determines which log lines belong to a stage. BeforeRequest is called before the
+// request of the stage is sent, and may modify the request. AfterResponse is called once the response
+// has been received, or has failed. Afterwards, the log lines of the stage can be inspected.
+type logCorrelator interface {
+	BeforeRequest(runContext *TestRunContext, ftwCheck *FTWCheck, testInput *test.Input, req *ftwhttp.Request, stageId string) error
+	AfterResponse(runContext *TestRunContext, ftwCheck *FTWCheck, testInput *test.Input, response *ftwhttp.Response, stageId string) error
+}
+
+// newLogCorrelator creates the log correlator for the configured strategy
+func newLogCorrelator(cfg config.LogCorrelation) (logCorrelator, error) {
+	switch cfg.Strategy {
+	case config.MarkerCorrelation, "":
+		return &markerCorrelator{}, nil
+	case config.RequestIdCorrelation:
+		return &requestIdCorrelator{delay: cfg.Delay}, nil
+	case config.TransactionIdCorrelation:
+		if cfg.TransactionIdHeader == "" {
+			return nil, errors.New("log correlation strategy 'transaction_id' requires 'transaction_id_header'")
+		}
+		return &transactionIdCorrelator{header: cfg.TransactionIdHeader, delay: cfg.Delay}, nil
+	case config.WindowCorrelation:
+		return &windowCorrelator{delay: cfg.Delay, window: cfg.Window}, nil
+	default:
+		return nil, fmt.Errorf("unknown log correlation strategy %q", cfg.Strategy)
+	}
+}
+
+// markerCorrelator sends marker requests before and after the request of the stage, and waits until
+// the WAF has logged them
+type markerCorrelator struct{}
+
+func (m *markerCorrelator) BeforeRequest(runContext *TestRunContext, ftwCheck *FTWCheck, testInput *test.Input, _ *ftwhttp.Request, stageId string) error {
+	startMarker, err := markAndFlush(runContext, testInput, utils.CreateStartMarker(stageId))
+	ftwCheck.SetStartMarker(startMarker)
+	if err != nil {
+		return fmt.Errorf("failed to find start marker: %w", err)
+	}
+	return nil
+}
+
+func (m *markerCorrelator) AfterResponse(runContext *TestRunContext, ftwCheck *FTWCheck, testInput *test.Input, _ *ftwhttp.Response, stageId string) error {
+	endMarker, err := markAndFlush(runContext, testInput, utils.CreateEndMarker(stageId))
+	ftwCheck.SetEndMarker(endMarker)
+	if err != nil {
+		return fmt.Errorf("failed to find end marker: %w", err)
+	}
+	return nil
+}
+
+// requestIdCorrelator adds the log marker header with the stage ID to the request, and collects the
+// log lines containing the stage ID. This requires a log that contains the request headers, e.g.,
+// an audit log.
+type requestIdCorrelator struct {
+	delay time.Duration
+	// tagged is true if the stage ID could be added to the request of the current stage
+	tagged bool
+}
+
+func (r *requestIdCorrelator) BeforeRequest(runContext *TestRunContext, ftwCheck *FTWCheck, _ *test.Input, req *ftwhttp.Request, stageId string) error {
+	r.tagged = addRequestId(runContext.RunnerConfig, req, stageId)
+	if !r.tagged {
+		log.Debug().Msgf("can't add the request ID to the encoded request of stage %s, using all log lines written during the request", stageId)
+	}
+	return ftwCheck.OpenLogWindow()
+}
+
+// addRequestId adds the log marker header with the stage ID to the request of the stage. The request
+// is modified, so that dry runs, captures and artifacts show the header too. Returns false if the
+// request is an encoded request, which can't be modified.
+func addRequestId(runnerConfig *config.RunnerConfig, req *ftwhttp.Request, stageId string) bool {
+	if req.IsRaw() {
+		return false
+	}
+	req.AddHeader(runnerConfig.LogMarkerHeaderName, stageId)
+	return true
+}
+
+func (r *requestIdCorrelator) AfterResponse(_ *TestRunContext, ftwCheck *FTWCheck, _ *test.Input, _ *ftwhttp.Response, stageId string) error {
+	time.Sleep(r.delay)
+	if !r.tagged {
+		stageId = ""
+	}
+	return ftwCheck.CloseLogWindow(stageId)
+}
+
+// transactionIdCorrelator reads the unique transaction ID of the WAF from a response header, and
+// collects the log lines containing the transaction ID
+type transactionIdCorrelator struct {
+	header string
+	delay  time.Duration
+}
+
+func (t *transactionIdCorrelator) BeforeRequest(_ *TestRunContext, ftwCheck *FTWCheck, _ *test.Input, _ *ftwhttp.Request, _ string) error {
+	return ftwCheck.OpenLogWindow()
+}
+
+func (t *transactionIdCorrelator) AfterResponse(_ *TestRunContext, ftwCheck *FTWCheck, _ *test.Input, response *ftwhttp.Response, _ string) error {
+	if response == nil {
+		return errors.New("failed to find transaction ID: no response")
+	}
+	transactionId := response.Parsed.Header.Get(t.header)
+	if transactionId == "" {
+		return fmt.Errorf("failed to find transaction ID: response has no %s header", t.header)
+	}
+	time.Sleep(t.delay)
+	return ftwCheck.CloseLogWindow(transactionId)
+}
+
+// windowCorrelator collects the log lines with a timestamp between sending the request of the stage
+// and receiving its response, widened by window. This requires that nothing else is logged meanwhile.
+type windowCorrelator struct {
+	delay  time.Duration
+	window time.Duration
+	sent   time.Time
+}
+
+func (w *windowCorrelator) BeforeRequest(_ *TestRunContext, ftwCheck *FTWCheck, _ *test.Input, _ *ftwhttp.Request, _ string) error {
+	if err := ftwCheck.OpenLogWindow(); err != nil {
+		return err
+	}
+	w.sent = time.Now()
+	return nil
+}
+
+func (w *windowCorrelator) AfterResponse(_ *TestRunContext, ftwCheck *FTWCheck, _ *test.Input, _ *ftwhttp.Response, _ string) error {
+	received := time.Now()
+	time.Sleep(w.delay)
+	return ftwCheck.CloseLogTimeWindow(w.sent.Add(-w.window), received.Add(w.window))
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/output"
+	"github.com/coreruleset/go-ftw/v2/test"
+	"github.com/coreruleset/go-ftw/v2/waflog"
+)
+
+type correlationTestSuite struct {
+	suite.Suite
+}
+
+func TestCorrelationTestSuite(t *testing.T) {
+	suite.Run(t, new(correlationTestSuite))
+}
+
+func (s *correlationTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *correlationTestSuite) TestNewLogCorrelator() {
+	tests := []struct {
+		strategy config.CorrelationStrategy
+		expected logCorrelator
+	}{
+		{"", &markerCorrelator{}},
+		{config.MarkerCorrelation, &markerCorrelator{}},
+		{config.RequestIdCorrelation, &requestIdCorrelator{delay: time.Second}},
+		{config.TransactionIdCorrelation, &transactionIdCorrelator{header: "X-Unique-Id", delay: time.Second}},
+		{config.WindowCorrelation, &windowCorrelator{delay: time.Second, window: time.Minute}},
+	}
+	for _, tt := range tests {
+		s.Run(string(tt.strategy), func() {
+			correlator, err := newLogCorrelator(config.LogCorrelation{
+				Strategy:            tt.strategy,
+				TransactionIdHeader: "X-Unique-Id",
+				Delay:               time.Second,
+				Window:              time.Minute,
+			})
+			s.Require().NoError(err)
+			s.Equal(tt.expected, correlator)
+		})
+	}
+}
+
+func (s *correlationTestSuite) TestNewLogCorrelatorUnknownStrategy() {
+	_, err := newLogCorrelator(config.LogCorrelation{Strategy: "telepathy"})
+	s.ErrorContains(err, `unknown log correlation strategy "telepathy"`)
+}
+
+func (s *correlationTestSuite) TestNewLogCorrelatorMissingTransactionIdHeader() {
+	_, err := newLogCorrelator(config.LogCorrelation{Strategy: config.TransactionIdCorrelation})
+	s.ErrorContains(err, "requires 'transaction_id_header'")
+}
+
+func (s *correlationTestSuite) TestRunFailsWithInvalidStrategy() {
+	cfg := config.NewDefaultConfig()
+	cfg.LogCorrelation.Strategy = "telepathy"
+	_, err := Run(config.NewRunnerConfiguration(cfg), []*test.FTWTest{}, output.NewOutput("quiet", nil))
+	s.ErrorContains(err, "unknown log correlation strategy")
+}
+
+func (s *correlationTestSuite) newRunContext() *TestRunContext {
+	logFilePath := filepath.Join(s.T().TempDir(), "error.log")
+	s.Require().NoError(os.WriteFile(logFilePath, nil, 0644))
+	cfg := config.NewDefaultConfig()
+	cfg.LogFile = logFilePath
+	runnerConfig := config.NewRunnerConfiguration(cfg)
+	logLines, err := waflog.NewFTWLogLines(runnerConfig)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = logLines.Cleanup() })
+	return &TestRunContext{RunnerConfig: runnerConfig, LogLines: logLines}
+}
+
+func (s *correlationTestSuite) TestRequestIdAddedToRequest() {
+	runContext := s.newRunContext()
+	ftwCheck, err := NewCheck(runContext)
+	s.Require().NoError(err)
+	req := ftwhttp.NewRequest(&ftwhttp.RequestLine{Method: "GET", URI: "/", Version: "HTTP/1.1"}, ftwhttp.NewHeader(), nil, true)
+
+	correlator := &requestIdCorrelator{}
+	s.Require().NoError(correlator.BeforeRequest(runContext, ftwCheck, nil, req, "123456-1-abc"))
+	s.True(req.Headers().HasAnyValue(config.DefaultLogMarkerHeaderName, "123456-1-abc"))
+	s.Require().NoError(correlator.AfterResponse(runContext, ftwCheck, nil, nil, "123456-1-abc"))
+	s.True(runContext.LogLines.Correlated())
+}
+
+func (s *correlationTestSuite) TestRequestIdNotAddedToRawRequest() {
+	runContext := s.newRunContext()
+	ftwCheck, err := NewCheck(runContext)
+	s.Require().NoError(err)
+	req := ftwhttp.NewRawRequest([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	correlator := &requestIdCorrelator{}
+	s.Require().NoError(correlator.BeforeRequest(runContext, ftwCheck, nil, req, "123456-1-abc"))
+	s.False(correlator.tagged)
+}
+
+func (s *correlationTestSuite) TestTransactionIdMissing() {
+	runContext := s.newRunContext()
+	ftwCheck, err := NewCheck(runContext)
+	s.Require().NoError(err)
+
+	correlator := &transactionIdCorrelator{header: "X-Unique-Id"}
+	s.Require().NoError(correlator.BeforeRequest(runContext, ftwCheck, nil, nil, ""))
+	err = correlator.AfterResponse(runContext, ftwCheck, nil, &ftwhttp.Response{}, "")
+	s.ErrorContains(err, "response has no X-Unique-Id header")
+	s.False(runContext.LogLines.Correlated())
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/test"
+	"github.com/coreruleset/go-ftw/v2/utils"
+)
+
+// dryRun builds the request of every stage exactly as `Run` would send it, applying the same
+// test selection, overrides and order, but never connects to the WAF. The requests are printed
+// to the output, or written to one file per stage if `DryRunDir` is set.
+// Log marker requests are not rendered.
+func dryRun(runContext *TestRunContext, tests []*test.FTWTest) error {
+	out := runContext.Output
+	out.Println("%s", out.Message("~ dry run, requests are built but not sent"))
+
+	if dir := runContext.RunnerConfig.DryRunDir; dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create dry run directory %q: %w", dir, err)
+		}
+	}
+
+	ftwCheck, err := NewCheck(runContext)
+	if err != nil {
+		return err
+	}
+
+	rendered := 0
+	for _, ftwTest := range tests {
+		for _, testCase := range shuffled(runContext.shuffler, ftwTest.Tests) {
+			if skip, reason := needToSkipTest(runContext, ftwTest, &testCase); skip {
+				log.Debug().Msgf("Skipping test %s: %s", testCase.IdString(), reason)
+				runContext.Stats.addSkippedResultToStats(&testCase, reason)
+				continue
+			}
+			test.ApplyPlatformOverrides(runContext.RunnerConfig, &testCase)
+
+			// stages of tests with an overridden result are never sent
+			if overridden := overriddenTestResult(ftwCheck, &testCase); overridden != Failed {
+				log.Debug().Msgf("Not rendering test %s: result is overridden", testCase.IdString())
+				continue
+			}
+
+			for index, stage := range testCase.Stages {
+				runContext.stageInput = ftwTest.StageExtensions(&testCase, index).Input
+				if err := renderStage(runContext, &testCase, index+1, &stage); err != nil {
+					return err
+				}
+				rendered++
+			}
+		}
+	}
+
+	out.Println(out.Message("~ rendered %d requests"), rendered)
+	return nil
+}
+
+// renderStage builds the request of a single stage and prints it, or writes it to a file.
+// stageNumber is the 1-based position of the stage in the test.
+func renderStage(runContext *TestRunContext, testCase *schema.Test, stageNumber int, stage *schema.Stage) error {
+	if err := checkTestSanity(stage); err != nil {
+		return err
+	}
+
+	testInput := test.NewInput(&stage.Input)
+	test.ApplyInputOverrides(runContext.RunnerConfig, testInput)
+	if stage.Input.FollowRedirect != nil && *stage.Input.FollowRedirect {
+		log.Warn().Msgf("Stage %d of %s uses follow_redirect, which depends on the response to the previous stage. Rendering the request without following the redirect", stageNumber, testCase.IdString())
+	}
+
+	req, err := getRequestFromTest(testInput, runContext.stageInput)
+	if err != nil {
+		return fmt.Errorf("failed to read request from test specification: %w", err)
+	}
+	// the request_id strategy adds the stage ID to the request when it is sent. The ID is
+	// different on every run.
+	if runContext.RunnerConfig.RunMode != config.CloudRunMode && runContext.RunnerConfig.LogCorrelation.Strategy == config.RequestIdCorrelation {
+		addRequestId(runContext.RunnerConfig, req, utils.GenerateStageId(testCase.RuleId, testCase.TestId))
+	}
+	// HTTP/3 requests are sent as frames, the file contains the frames and the output describes them
+	extension := "http"
+	data, err := req.WireBytes()
+	if req.UsesHTTP3() {
+		extension = "h3"
+		data, err = req.HTTP3Frames()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to build request for stage %d of %s: %w", stageNumber, testCase.IdString(), err)
+	}
+	destination := ftwhttp.Destination{
+		DestAddr: testInput.GetDestAddr(),
+		Port:     testInput.GetPort(),
+		Protocol: testInput.GetProtocol(),
+	}.URL()
+	if req.UsesHTTP3() {
+		destination += " over HTTP/3"
+	}
+
+	out := runContext.Output
+	if dir := runContext.RunnerConfig.DryRunDir; dir != "" {
+		fileName := filepath.Join(dir, fmt.Sprintf("%s-%d.%s", testCase.IdString(), stageNumber, extension))
+		if err := os.WriteFile(fileName, data, 0644); err != nil {
+			return fmt.Errorf("failed to write request to %q: %w", fileName, err)
+		}
+		out.Println(out.Message("=> stage %d of %s to %s written to %s"), stageNumber, testCase.IdString(), destination, fileName)
+		return nil
+	}
+
+	out.Println(out.Message("=> stage %d of %s to %s"), stageNumber, testCase.IdString(), destination)
+	if req.UsesHTTP3() {
+		description, err := req.DescribeHTTP3Frames()
+		if err != nil {
+			return fmt.Errorf("failed to build request for stage %d of %s: %w", stageNumber, testCase.IdString(), err)
+		}
+		out.Printf("%s", description)
+		return nil
+	}
+	escaped := ftwhttp.EscapeWireBytes(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		escaped += "\n"
+	}
+	out.Printf("%s", escaped)
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/test"
+	"github.com/coreruleset/go-ftw/v2/utils"
+	"github.com/coreruleset/go-ftw/v2/waflog"
+)
+
+// CheckMarker sends the configured marker request to dest, exactly like before a test stage, and
+// waits until the marker appears in the log. It returns the time from sending the first marker
+// request until the marker was found.
+func CheckMarker(runnerConfig *config.RunnerConfig, dest *ftwhttp.Destination) (time.Duration, error) {
+	if runnerConfig.RunMode == config.CloudRunMode {
+		return 0, errors.New("log markers are not used in cloud mode")
+	}
+	logLines, err := waflog.NewFTWLogLines(runnerConfig)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanLogs(logLines)
+
+	client, err := ftwhttp.NewClient(runnerConfig)
+	if err != nil {
+		return 0, err
+	}
+	runContext := &TestRunContext{
+		RunnerConfig: runnerConfig,
+		Client:       client,
+		LogLines:     logLines,
+	}
+
+	start := time.Now()
+	if _, err := markAndFlush(runContext, markerCheckInput(dest), utils.CreateStartMarker(utils.GenerateStageId(0, 0))); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// DescribeMarkerRequest returns the request line and the destination of the marker requests that
+// CheckMarker sends to dest, with the defaults of the marker request configuration applied,
+// e.g. "GET /status/200 HTTP/1.1 to http://localhost:80"
+func DescribeMarkerRequest(runnerConfig *config.RunnerConfig, dest *ftwhttp.Destination) string {
+	testInput := markerCheckInput(dest)
+	req := buildMarkerRequest(&TestRunContext{RunnerConfig: runnerConfig}, testInput, "")
+	requestLine := req.RequestLine()
+	return fmt.Sprintf("%s %s %s to %s", requestLine.Method, requestLine.URI, requestLine.Version, markerDestination(runnerConfig, testInput).URL())
+}
+
+// markerCheckInput returns the input of a test stage sent to dest, which the marker requests of the
+// check are based on
+func markerCheckInput(dest *ftwhttp.Destination) *test.Input {
+	return test.NewInput(&schema.Input{
+		DestAddr: &dest.DestAddr,
+		Port:     &dest.Port,
+		Protocol: &dest.Protocol,
+	})
+}
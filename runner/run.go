@@ -4,10 +4,13 @@
 package runner
 
 import (
+	"cmp"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"time"
 
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
@@ -15,39 +18,83 @@ import (
 
 	"github.com/coreruleset/go-ftw/v2/config"
 	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	header_names "github.com/coreruleset/go-ftw/v2/ftwhttp/header_names"
 	"github.com/coreruleset/go-ftw/v2/output"
 	"github.com/coreruleset/go-ftw/v2/test"
 	"github.com/coreruleset/go-ftw/v2/utils"
 	"github.com/coreruleset/go-ftw/v2/waflog"
 )
 
+// Checking the log for a marker only reads the lines appended since the last check, which is much
+// cheaper than sending another marker request. The log is checked a few times before the marker
+// request is sent again, giving the WAF a chance to flush its log.
+const (
+	markerPollAttempts = 3
+	markerPollInterval = 10 * time.Millisecond
+)
+
 // Run runs your tests with the specified Config.
 func Run(runnerConfig *config.RunnerConfig, tests []*test.FTWTest, out *output.Output) (*TestRunContext, error) {
 	out.Println("%s", out.Message("** Running go-ftw!"))
 
-	logLines, err := waflog.NewFTWLogLines(runnerConfig)
-	if err != nil {
-		return &TestRunContext{}, err
-	}
-
-	client, err := ftwhttp.NewClient(runnerConfig)
-	if err != nil {
-		return &TestRunContext{}, err
-	}
-
 	runContext := &TestRunContext{
 		RunnerConfig:           runnerConfig,
 		Include:                runnerConfig.Include,
 		Exclude:                runnerConfig.Exclude,
 		IncludeTags:            runnerConfig.IncludeTags,
+		Filter:                 runnerConfig.Filter,
 		ShowTime:               runnerConfig.ShowTime,
 		Output:                 out,
 		ShowOnlyFailed:         runnerConfig.ShowOnlyFailed,
 		StoreFailureWafLogs:    runnerConfig.StoreFailureLogs,
 		FailureWafLogsFilePath: runnerConfig.FailureWafLogsFilePath,
 		Stats:                  NewRunStats(),
-		Client:                 client,
-		LogLines:               logLines,
+	}
+
+	if runnerConfig.Shuffle {
+		runContext.shuffler = newShuffler(runnerConfig.Seed)
+		seed := runContext.shuffler.Seed()
+		runContext.Stats.Seed = &seed
+		out.Println(out.Message("~ shuffling tests using seed %d"), runContext.shuffler.Seed())
+		tests = shuffled(runContext.shuffler, tests)
+	}
+
+	if runnerConfig.DryRun {
+		if err := dryRun(runContext, tests); err != nil {
+			return &TestRunContext{}, err
+		}
+		return runContext, nil
+	}
+
+	// fail early on an invalid correlation configuration
+	if runnerConfig.RunMode != config.CloudRunMode {
+		if _, err := runContext.logCorrelator(); err != nil {
+			return &TestRunContext{}, err
+		}
+	}
+
+	logLines, err := waflog.NewFTWLogLines(runnerConfig)
+	if err != nil {
+		return &TestRunContext{}, err
+	}
+	runContext.LogLines = logLines
+
+	client, err := ftwhttp.NewClient(runnerConfig)
+	if err != nil {
+		return &TestRunContext{}, err
+	}
+	runContext.Client = client
+	defer closeClient(client)
+
+	if dir := runnerConfig.ArtifactsDir; dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return &TestRunContext{}, fmt.Errorf("failed to create artifacts directory %q: %w", dir, err)
+		}
+	}
+	if dir := runnerConfig.CaptureDir; dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return &TestRunContext{}, fmt.Errorf("failed to create capture directory %q: %w", dir, err)
+		}
 	}
 
 	for _, tc := range tests {
@@ -71,11 +118,13 @@ func Run(runnerConfig *config.RunnerConfig, tests []*test.FTWTest, out *output.O
 // ftwTest is the test you want to run
 func RunTest(runContext *TestRunContext, ftwTest *test.FTWTest) error {
 	changed := true
+	runContext.ftwTest = ftwTest
 
-	for _, testCase := range ftwTest.Tests {
+	for _, testCase := range shuffled(runContext.shuffler, ftwTest.Tests) {
 		// if we received a particular test ID, skip until we find it
-		if needToSkipTest(runContext, &testCase) {
-			runContext.Stats.addResultToStats(Skipped, &testCase)
+		if skip, reason := needToSkipTest(runContext, ftwTest, &testCase); skip {
+			log.Debug().Msgf("Skipping test %s: %s", testCase.IdString(), reason)
+			runContext.Stats.addSkippedResultToStats(&testCase, reason)
 			continue
 		}
 		runContext.StartTest()
@@ -95,11 +144,20 @@ func RunTest(runContext *TestRunContext, ftwTest *test.FTWTest) error {
 			runContext.Output.Printf("\trunning %s: ", testCase.IdString())
 		}
 		// Iterate over stages
-		for _, stage := range testCase.Stages {
+		for index, stage := range testCase.Stages {
 			ftwCheck, err := NewCheck(runContext)
 			if err != nil {
 				return err
 			}
+			stageExtensions := ftwTest.StageExtensions(&testCase, index)
+			runContext.stageInput = stageExtensions.Input
+			runContext.stageNumber = index + 1
+			logExtensions := stageExtensions.Output.Log
+			ftwCheck.SetExpectAnomalyScore(logExtensions.AnomalyScore)
+			ftwCheck.SetExpectLogEntries(logExtensions.ExpectEntries)
+			ftwCheck.SetResponseView(stageExtensions.Output.ResponseView)
+			ftwCheck.SetExpectWebSocket(stageExtensions.Output.WebSocket)
+			ftwCheck.SetExpectErrorCategory(stageExtensions.Output.ExpectErrorCategory)
 			if err := RunStage(runContext, ftwCheck, testCase, stage); err != nil {
 				if err.Error() == "retry-once" {
 					log.Info().Msgf("Retrying test once: %s", testCase.IdString())
@@ -134,9 +192,9 @@ func RunStage(runContext *TestRunContext, ftwCheck *FTWCheck, testCase schema.Te
 	testInput := test.NewInput(&stage.Input)
 	test.ApplyInputOverrides(runContext.RunnerConfig, testInput)
 	expectedOutput := stage.Output
-	expectErr := false
+	expectErr := ftwCheck.expectedErrorCategory != ""
 	if expectedOutput.ExpectError != nil {
-		expectErr = *expectedOutput.ExpectError
+		expectErr = expectErr || *expectedOutput.ExpectError
 	}
 
 	// Check sanity first
@@ -167,42 +225,71 @@ func RunStage(runContext *TestRunContext, ftwCheck *FTWCheck, testCase schema.Te
 		Protocol: testInput.GetProtocol(),
 	}
 
+	req, err := getRequestFromTest(testInput, runContext.stageInput)
+	if err != nil {
+		return fmt.Errorf("failed to read request from test specification: %w", err)
+	}
+
+	var tlsOptions *ftwhttp.TLSOptions
+	if runContext.stageInput.TLS != nil {
+		if tlsOptions, err = ftwhttp.NewTLSOptions(*runContext.stageInput.TLS); err != nil {
+			return fmt.Errorf("invalid TLS input of test %s: %w", testCase.IdString(), err)
+		}
+	}
+
+	var correlator logCorrelator
 	if notRunningInCloudMode(ftwCheck) {
-		startId := utils.CreateStartMarker(stageId)
-		startMarker, err := markAndFlush(runContext, testInput, startId)
-		if err != nil && !expectErr {
-			return fmt.Errorf("failed to find start marker: %w", err)
+		if correlator, err = runContext.logCorrelator(); err != nil {
+			return err
+		}
+		if err := correlator.BeforeRequest(runContext, ftwCheck, testInput, req, stageId); err != nil && !expectErr {
+			return err
 		}
-		ftwCheck.SetStartMarker(startMarker)
 	}
 
-	req, err := getRequestFromTest(testInput)
-	if err != nil {
-		return fmt.Errorf("failed to read request from test specification: %w", err)
+	// marker requests are sent before and after recording, so that only the stage is recorded.
+	// QUIC traffic is encrypted and isn't recorded.
+	if runContext.RunnerConfig.CaptureDir != "" && !req.UsesHTTP3() {
+		runContext.Client.StartCapture()
+		defer runContext.Client.StopCapture()
 	}
 
-	err = runContext.Client.NewConnection(*dest)
+	if req.UsesHTTP3() {
+		if runContext.stageInput.WebSocket != nil {
+			return fmt.Errorf("WebSocket stages can't be sent over HTTP/3, test %s", testCase.IdString())
+		}
+		err = runContext.Client.NewHTTP3Connection(*dest, tlsOptions)
+	} else {
+		err = runContext.Client.NewConnectionWithTLSOptions(*dest, tlsOptions)
+	}
 
 	if err != nil && !expectErr {
 		return fmt.Errorf("can't connect to destination %+v: %w", dest, err)
 	}
 	runContext.Client.StartTrackingTime()
 
-	response, responseErr := runContext.Client.Do(*req)
+	var response *ftwhttp.Response
+	var responseErr error
+	switch {
+	case err != nil:
+		// the error of connecting is the expected error
+		responseErr = err
+	case runContext.stageInput.WebSocket != nil:
+		response, responseErr = doWebSocket(runContext.Client, ftwCheck, req, runContext.stageInput.WebSocket)
+	default:
+		response, responseErr = runContext.Client.Do(*req)
+	}
 
 	runContext.Client.StopTrackingTime()
+	capture := runContext.Client.StopCapture()
 	if responseErr != nil && !expectErr {
 		return fmt.Errorf("failed sending request to destination %+v: %w", dest, responseErr)
 	}
 
-	if notRunningInCloudMode(ftwCheck) {
-		endId := utils.CreateEndMarker(stageId)
-		endMarker, err := markAndFlush(runContext, testInput, endId)
-		if err != nil && !expectErr {
-			return fmt.Errorf("failed to find end marker: %w", err)
-
+	if correlator != nil {
+		if err := correlator.AfterResponse(runContext, ftwCheck, testInput, response, stageId); err != nil && !expectErr {
+			return err
 		}
-		ftwCheck.SetEndMarker(endMarker)
 	}
 
 	// Set expected test output in check
@@ -220,7 +307,11 @@ func RunStage(runContext *TestRunContext, ftwCheck *FTWCheck, testCase schema.Te
 	if err != nil {
 		return err
 	}
-	runContext.EndStage(&testCase, testResult, triggeredRules)
+	anomalyScores, err := ftwCheck.GetAnomalyScores()
+	if err != nil {
+		return err
+	}
+	runContext.EndStage(&testCase, testResult, triggeredRules, anomalyScores, ftwhttp.ErrorCategoryOf(responseErr))
 
 	// Store the response and input for potential use by follow_redirect in next stage
 	runContext.LastStageResponse = response
@@ -229,6 +320,28 @@ func RunStage(runContext *TestRunContext, ftwCheck *FTWCheck, testCase schema.Te
 	// show the result unless quiet was passed in the command line
 	displayResult(&testCase, runContext, testResult, roundTripTime)
 
+	if runContext.RunnerConfig.CaptureDir != "" && (testResult == Failed || runContext.RunnerConfig.CaptureAllStages) {
+		if capture == nil {
+			log.Warn().Msgf("The traffic of stage %d of %s isn't captured, HTTP/3 stages are not recorded", runContext.stageNumber, testCase.IdString())
+		} else if err := writeCapture(runContext, &testCase, capture); err != nil {
+			log.Error().Err(err).Msg("Failed to write the traffic of the stage")
+		}
+	}
+
+	if testResult == Failed && runContext.RunnerConfig.ArtifactsDir != "" {
+		artifacts := &stageArtifacts{
+			testCase:       &testCase,
+			request:        req,
+			response:       response,
+			responseErr:    responseErr,
+			expectedOutput: &expectedOutput,
+			triggeredRules: triggeredRules,
+		}
+		if err := writeArtifacts(runContext, ftwCheck, artifacts); err != nil {
+			log.Error().Err(err).Msg("Failed to write the artifacts of the stage")
+		}
+	}
+
 	if notRunningInCloudMode(ftwCheck) && runContext.StoreFailureWafLogs {
 		if testResult == Failed {
 			if err := appendFailureWafLogs(runContext); err != nil {
@@ -242,11 +355,7 @@ func RunStage(runContext *TestRunContext, ftwCheck *FTWCheck, testCase schema.Te
 
 func markAndFlush(runContext *TestRunContext, testInput *test.Input, stageId string) ([]byte, error) {
 	req := buildMarkerRequest(runContext, testInput, stageId)
-	dest := &ftwhttp.Destination{
-		DestAddr: testInput.GetDestAddr(),
-		Port:     testInput.GetPort(),
-		Protocol: testInput.GetProtocol(),
-	}
+	dest := markerDestination(runContext.RunnerConfig, testInput)
 	for i := runContext.RunnerConfig.MaxMarkerRetries; i > 0; i-- {
 		err := runContext.Client.NewOrReusedConnection(*dest)
 		if err != nil {
@@ -258,15 +367,21 @@ func markAndFlush(runContext *TestRunContext, testInput *test.Input, stageId str
 			return nil, fmt.Errorf("ftw/run: failed sending request to %+v: %w", dest, err)
 		}
 
-		marker := runContext.LogLines.CheckLogForMarker(stageId, runContext.RunnerConfig.MaxMarkerLogLines)
-		if marker != nil {
-			return marker, nil
+		for attempt := 0; attempt < markerPollAttempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(markerPollInterval)
+			}
+			marker := runContext.LogLines.FindMarker(stageId)
+			if marker != nil {
+				return marker, nil
+			}
 		}
 	}
 	return nil, fmt.Errorf("can't find log marker. Am I reading the correct log? Log file: %s", runContext.RunnerConfig.LogFilePath)
 }
 
 func buildMarkerRequest(runContext *TestRunContext, testInput *test.Input, stageId string) *ftwhttp.Request {
+	markerRequest := runContext.RunnerConfig.MarkerRequest
 	host := "localhost"
 	if testInput.VirtualHostMode {
 		// Use the value of the `Host` header of the test for
@@ -289,30 +404,68 @@ func buildMarkerRequest(runContext *TestRunContext, testInput *test.Input, stage
 	header.Add("Accept", "*/*")
 	header.Add("User-Agent", "go-ftw test agent")
 	header.Add("Host", host)
+	// sorted, so that marker requests are always the same
+	for _, name := range slices.Sorted(maps.Keys(markerRequest.Headers)) {
+		header.Set(name, markerRequest.Headers[name])
+	}
 	header.Add(runContext.RunnerConfig.LogMarkerHeaderName, stageId)
 
 	rline := &ftwhttp.RequestLine{
-		Method: "GET",
-		// Use the `/status` endpoint of `httpbin` (http://httpbingo.org), if possible,
-		// to minimize the amount of data transferred and in the log.
-		// `httpbin` is used by the CRS test setup.
-		URI:     "/status/200",
-		Version: "HTTP/1.1",
+		Method:  cmp.Or(markerRequest.Method, config.DefaultMarkerRequestMethod),
+		URI:     cmp.Or(markerRequest.URI, config.DefaultMarkerRequestURI),
+		Version: cmp.Or(markerRequest.Version, config.DefaultMarkerRequestVersion),
+	}
+
+	var data []byte
+	if markerRequest.Data != "" {
+		data = []byte(markerRequest.Data)
+	}
+	return ftwhttp.NewRequest(rline, header, data, true)
+}
+
+// markerDestination returns the destination of the marker requests for a test stage, which is the
+// destination of the stage unless configured otherwise
+func markerDestination(runnerConfig *config.RunnerConfig, testInput *test.Input) *ftwhttp.Destination {
+	markerRequest := runnerConfig.MarkerRequest
+	return &ftwhttp.Destination{
+		DestAddr: cmp.Or(markerRequest.DestAddr, testInput.GetDestAddr()),
+		Port:     cmp.Or(markerRequest.Port, testInput.GetPort()),
+		Protocol: cmp.Or(markerRequest.Protocol, testInput.GetProtocol()),
 	}
+}
 
-	return ftwhttp.NewRequest(rline, header, nil, true)
+// NeedToSkipTest returns true if the test case is not selected by the include, exclude, include tags
+// and filter options of the runner configuration, following the same rules as `Run`. The second
+// return value describes why the test case is skipped.
+func NeedToSkipTest(runnerConfig *config.RunnerConfig, ftwTest *test.FTWTest, testCase *schema.Test) (bool, string) {
+	return needToSkipTest(&TestRunContext{
+		Include:     runnerConfig.Include,
+		Exclude:     runnerConfig.Exclude,
+		IncludeTags: runnerConfig.IncludeTags,
+		Filter:      runnerConfig.Filter,
+	}, ftwTest, testCase)
 }
 
-func needToSkipTest(runContext *TestRunContext, testCase *schema.Test) bool {
+// needToSkipTest returns true if the test case must not be run. The second
+// return value describes why the test case is skipped.
+func needToSkipTest(runContext *TestRunContext, ftwTest *test.FTWTest, testCase *schema.Test) (bool, string) {
 	include := runContext.Include
 	exclude := runContext.Exclude
 	includeTags := runContext.IncludeTags
+	testFilter := runContext.Filter
+
+	// the filter expression applies in addition to all other selections
+	if testFilter != nil {
+		if !testFilter.Matches(ftwTest.FilterSubject(testCase)) {
+			return true, fmt.Sprintf("does not match filter %q", testFilter)
+		}
+	}
 
 	// never skip enabled explicit inclusions
 	if include != nil {
 		if include.MatchString(testCase.IdString()) {
 			// inclusion always wins over exclusion
-			return false
+			return false, ""
 		}
 	}
 
@@ -320,7 +473,7 @@ func needToSkipTest(runContext *TestRunContext, testCase *schema.Test) bool {
 	// it needs to be skipped
 	if includeTags != nil {
 		if !utils.MatchSlice(includeTags, testCase.Tags) {
-			return true
+			return true, fmt.Sprintf("no tag matches include tags %q", includeTags)
 		}
 	}
 
@@ -328,7 +481,7 @@ func needToSkipTest(runContext *TestRunContext, testCase *schema.Test) bool {
 	// it needs to be skipped
 	if exclude != nil {
 		if exclude.MatchString(testCase.IdString()) {
-			return true
+			return true, fmt.Sprintf("ID matches exclude %q", exclude)
 		}
 	}
 
@@ -336,11 +489,11 @@ func needToSkipTest(runContext *TestRunContext, testCase *schema.Test) bool {
 	// it needs to be skipped
 	if include != nil {
 		if !include.MatchString(testCase.IdString()) {
-			return true
+			return true, fmt.Sprintf("ID does not match include %q", include)
 		}
 	}
 
-	return false
+	return false, ""
 }
 
 func checkTestSanity(stage *schema.Stage) error {
@@ -393,48 +546,71 @@ func overriddenTestResult(c *FTWCheck, testCase *schema.Test) TestResult {
 	return Failed
 }
 
-// checkResult has the logic for verifying the result for the test sent
+// checkResult has the logic for verifying the result for the test sent. The assertion that failed
+// is recorded in the check.
 func checkResult(c *FTWCheck, response *ftwhttp.Response, responseError error) TestResult {
+	c.SetResponse(response)
+
 	// Request might return an error, but it could be expected, we check that first
 	if expected, succeeded := c.AssertExpectError(responseError); expected {
 		if succeeded {
 			return Success
 		}
+		if responseError == nil {
+			c.fail("expect_error", "an error was expected, but a response was received")
+		} else {
+			c.fail("expect_error_category", "expected an error of category %q, found %q", c.expectedErrorCategory, ftwhttp.ErrorCategoryOf(responseError))
+		}
 		return Failed
 	}
 
 	// In case of an unexpected error skip other checks
 	if responseError != nil {
 		log.Debug().Msgf("Encountered unexpected error: %v", responseError)
+		c.fail("unexpected_error", "unexpected error: %v", responseError)
 		return Failed
 	}
 
 	// We should have a response here
 	if response == nil {
 		log.Error().Msg("No response to check")
+		c.fail("no_response", "no response to check")
 		return Failed
 	}
 
 	if !c.AssertStatus(response.Parsed.StatusCode) {
+		c.fail("status", "unexpected status code %d", response.Parsed.StatusCode)
 		return Failed
 	}
-	if !c.AssertResponseContains(response.GetFullResponse()) {
+	if !c.AssertResponseContains(c.responseText(response)) {
+		c.fail("response_contains", "the response doesn't match %q", c.expected.ResponseContains)
+		return Failed
+	}
+	if !c.AssertWebSocketMessages() {
+		c.fail("websocket", "the received WebSocket messages don't match the expectations")
 		return Failed
 	}
 	// Lastly, check logs
 	logsCheck, err := c.AssertLogs()
 	if err != nil {
 		log.Error().Err(err).Msg("failed to assert logs")
+		c.fail("log", "failed to assert logs: %v", err)
 		return Failed
 	}
 	if !logsCheck {
+		if c.CloudMode() {
+			c.fail("log", "the rule IDs in the response don't match the expectations")
+		} else {
+			c.fail("log", "the log doesn't match the expectations")
+		}
 		return Failed
 	}
 
 	return Success
 }
 
-func getRequestFromTest(testInput *test.Input) (*ftwhttp.Request, error) {
+// getRequestFromTest builds the request of a stage, applying the input extensions of the stage
+func getRequestFromTest(testInput *test.Input, extensions test.InputExtensions) (*ftwhttp.Request, error) {
 	if utils.IsNotEmpty(testInput.EncodedRequest) {
 		data, err := base64.StdEncoding.DecodeString(testInput.EncodedRequest)
 		if err != nil {
@@ -449,16 +625,59 @@ func getRequestFromTest(testInput *test.Input) (*ftwhttp.Request, error) {
 		Version: testInput.GetVersion(),
 	}
 
-	data := testInput.GetData()
+	var req *ftwhttp.Request
+	if extensions.Body != nil {
+		var err error
+		if req, err = getRequestWithBody(testInput, rline, extensions.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		data := testInput.GetData()
+		//nolint:staticcheck
+		req = ftwhttp.NewRequest(rline, testInput.GetHeaders(),
+			data, *testInput.AutocompleteHeaders)
+	}
+	req.SetChunked(extensions.Chunked)
+	if extensions.WebSocket != nil && req.WithAutoCompleteHeaders() {
+		// added here so that the handshake is rendered in dry runs as well
+		if err := req.AddWebSocketHeaders(); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// getRequestWithBody builds a request with a generated body. The Content-Type of the body is added
+// if headers are autocompleted and the test doesn't set one.
+func getRequestWithBody(testInput *test.Input, rline *ftwhttp.RequestLine, body *ftwhttp.Body) (*ftwhttp.Request, error) {
+	if testInput.Data != nil || testInput.EncodedData != nil {
+		return nil, errors.New("'body' can't be combined with 'data' or 'encoded_data'")
+	}
+	data, contentType, err := body.Encode()
+	if err != nil {
+		return nil, err
+	}
+	headers := testInput.GetHeaders().Clone()
 	//nolint:staticcheck
-	return ftwhttp.NewRequest(rline, testInput.GetHeaders(),
-		data, *testInput.AutocompleteHeaders), nil
+	autocompleteHeaders := *testInput.AutocompleteHeaders
+	if autocompleteHeaders && !headers.HasAny(header_names.ContentType) {
+		headers.Add(header_names.ContentType, contentType)
+	}
+	req := ftwhttp.NewRequest(rline, headers, data, autocompleteHeaders)
+	req.SetPreserveData(true)
+	return req, nil
 }
 
 func notRunningInCloudMode(c *FTWCheck) bool {
 	return !c.CloudMode()
 }
 
+func closeClient(client *ftwhttp.Client) {
+	if err := client.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close connections")
+	}
+}
+
 func cleanLogs(logLines *waflog.FTWLogLines) {
 	if err := logLines.Cleanup(); err != nil {
 		log.Error().Err(err).Msg("Failed to cleanup log file")
@@ -18,6 +18,7 @@ import (
 
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 	"github.com/coreruleset/go-ftw/v2/test"
 )
 
@@ -264,6 +265,28 @@ func (s *inputOverrideTestSuite) TestApplyInputOverrideVersion() {
 	s.Equal(overrideVersion, *testInput.Version, "`Version` should have been overridden")
 }
 
+func (s *inputOverrideTestSuite) TestApplyInputOverrideProtocol() {
+	http1 := "HTTP/1.0"
+	http3 := ftwhttp.HTTP3Version
+	tests := []struct {
+		protocol config.Protocol
+		version  *string
+		expected string
+	}{
+		{"", &http3, ftwhttp.HTTP3Version},
+		{"", &http1, "HTTP/1.0"},
+		{config.HTTP3Protocol, nil, ftwhttp.HTTP3Version},
+		{config.HTTP3Protocol, &http1, ftwhttp.HTTP3Version},
+		{config.HTTP1Protocol, &http3, "HTTP/1.1"},
+		{config.HTTP1Protocol, &http1, "HTTP/1.0"},
+	}
+	for _, tt := range tests {
+		testInput := test.NewInput(&schema.Input{Version: tt.version})
+		test.ApplyInputOverrides(&config.RunnerConfig{Protocol: tt.protocol}, testInput)
+		s.Equal(tt.expected, testInput.GetVersion(), "protocol %q", tt.protocol)
+	}
+}
+
 func (s *inputOverrideTestSuite) TestApplyInputOverrideMethod() {
 	originalMethod := "POST"
 	overrideMethod, err := getOverrideConfigValue("Method")
@@ -5,8 +5,12 @@ package runner
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,16 +18,20 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"text/template"
+	"time"
 
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/websocket"
 
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/filter"
 	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 	"github.com/coreruleset/go-ftw/v2/ftwhttp/header_names"
 	"github.com/coreruleset/go-ftw/v2/ftwhttp/header_values"
@@ -72,6 +80,64 @@ testoverride:
     dest_addr: "{{ .TestAddr }}"
     port: {{ .TestPort }}
     protocol: "http"
+`,
+	"TestDryRun": `---
+testoverride:
+  ignore:
+    "123456-3": "This test is never sent"
+`,
+	"TestCloudRuleIds": `---
+mode: cloud
+cloud_rule_id_header: X-Rule-Id
+`,
+	"TestChunkedBody": `---
+mode: cloud
+`,
+	"TestResponseView": `---
+mode: cloud
+`,
+	"TestWebSocketStage": `---
+mode: cloud
+`,
+	"TestExpectErrorCategory": `---
+mode: cloud
+`,
+	"TestCapture": `---
+mode: cloud
+`,
+	"TestArtifacts": `---
+mode: cloud
+`,
+	"TestRequestIdCorrelation": `---
+log_correlation:
+  strategy: request_id
+  delay: 0s
+`,
+	"TestTransactionIdCorrelation": `---
+log_correlation:
+  strategy: transaction_id
+  transaction_id_header: X-Unique-Id
+  delay: 0s
+`,
+	"TestWindowCorrelation": `---
+log_correlation:
+  strategy: window
+  delay: 0s
+`,
+	"TestBuildMarkerRequestConfigured": `---
+marker_request:
+  method: POST
+  uri: /marker
+  version: HTTP/1.0
+  headers:
+    User-Agent: marker agent
+    X-Extra: extra
+  data: ping
+`,
+	"TestCheckMarker": `---
+marker_request:
+  method: HEAD
+  uri: /marker
 `,
 	"TestApplyInputOverrideMethod": `---
 testoverride:
@@ -320,6 +386,34 @@ func (s *runTestSuite) TestRunTests_Run() {
 		s.Equal(res.Stats.TotalFailed(), 0, "failed to incorporate tagged test")
 	})
 
+	s.Run("filter tests using an expression", func() {
+		var err error
+		s.runnerConfig.IncludeTags = nil
+		s.runnerConfig.Include = nil
+		s.runnerConfig.Exclude = nil
+		s.runnerConfig.Filter, err = filter.Parse("tag-8 || (other && !local)")
+		s.Require().NoError(err)
+		res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+		s.Len(res.Stats.Success, 2, "failed to filter tests")
+		s.Len(res.Stats.Skipped, 3, "failed to filter tests")
+		s.Equal(`does not match filter "tag-8 || (other && !local)"`, res.Stats.SkipReasons[res.Stats.Skipped[0]])
+		s.Equal(res.Stats.TotalFailed(), 0, "failed to filter tests")
+	})
+
+	s.Run("filter expression applies in addition to inclusion", func() {
+		var err error
+		s.runnerConfig.Include = regexp.MustCompile("-8$")
+		s.runnerConfig.Filter, err = filter.Parse("!tag-8")
+		s.Require().NoError(err)
+		res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+		s.Len(res.Stats.Success, 0, "failed to filter tests")
+		s.Len(res.Stats.Skipped, 5, "failed to filter tests")
+		s.Equal(`ID does not match include "-8$"`, res.Stats.SkipReasons[res.Stats.Skipped[0]])
+		s.runnerConfig.Filter = nil
+	})
+
 	s.Run("test exceptions 1", func() {
 		s.runnerConfig.Include = regexp.MustCompile("-1.*")
 		s.runnerConfig.Exclude = regexp.MustCompile("-0.*")
@@ -494,7 +588,7 @@ func (s *runTestSuite) TestGetRequestFromTestWithAutocompleteHeaders_WithoutData
 		Port:                &s.dest.Port,
 		Protocol:            &s.dest.Protocol,
 	})
-	request, err := getRequestFromTest(input)
+	request, err := getRequestFromTest(input, test.InputExtensions{})
 	s.Require().NoError(err)
 
 	client, err := ftwhttp.NewClientWithConfig(ftwhttp.NewClientConfig())
@@ -535,7 +629,7 @@ func (s *runTestSuite) TestGetRequestFromTestWithAutocompleteHeaders_WithData()
 		Protocol:            &s.dest.Protocol,
 		Data:                &data,
 	})
-	request, err := getRequestFromTest(input)
+	request, err := getRequestFromTest(input, test.InputExtensions{})
 	s.Require().NoError(err)
 
 	client, err := ftwhttp.NewClientWithConfig(ftwhttp.NewClientConfig())
@@ -575,7 +669,7 @@ func (s *runTestSuite) TestGetRequestFromTestWithoutAutocompleteHeaders() {
 		Port:                &s.dest.Port,
 		Protocol:            &s.dest.Protocol,
 	})
-	request, err := getRequestFromTest(input)
+	request, err := getRequestFromTest(input, test.InputExtensions{})
 	s.Require().NoError(err)
 
 	client, err := ftwhttp.NewClientWithConfig(ftwhttp.NewClientConfig())
@@ -746,6 +840,72 @@ func (s *runTestSuite) TestVirtualHostMode_True() {
 	s.Equal("not-localhost_virtual-host", hostHeaders[0].Value)
 }
 
+func (s *runTestSuite) TestBuildMarkerRequestDefaults() {
+	context := &TestRunContext{
+		RunnerConfig: config.NewRunnerConfiguration(config.NewDefaultConfig()),
+	}
+	request := buildMarkerRequest(context, test.NewInput(&schema.Input{}), "123456-1-abc")
+	wire, err := request.WireBytes()
+	s.Require().NoError(err)
+
+	s.True(strings.HasPrefix(string(wire), "GET /status/200 HTTP/1.1\r\n"))
+	s.True(request.Headers().HasAnyValue("User-Agent", "go-ftw test agent"))
+	s.True(request.Headers().HasAnyValue(config.DefaultLogMarkerHeaderName, "123456-1-abc"))
+	s.Empty(request.Data())
+}
+
+func (s *runTestSuite) TestBuildMarkerRequestConfigured() {
+	context := &TestRunContext{RunnerConfig: s.runnerConfig}
+	request := buildMarkerRequest(context, test.NewInput(&schema.Input{}), "123456-1-abc")
+	wire, err := request.WireBytes()
+	s.Require().NoError(err)
+
+	s.True(strings.HasPrefix(string(wire), "POST /marker HTTP/1.0\r\n"))
+	userAgents := request.Headers().GetAll("User-Agent")
+	s.Require().Len(userAgents, 1, "configured headers must replace the default headers")
+	s.Equal("marker agent", userAgents[0].Value)
+	s.True(request.Headers().HasAnyValue("X-Extra", "extra"))
+	s.True(request.Headers().HasAnyValue("Host", "localhost"))
+	s.True(request.Headers().HasAnyValue(config.DefaultLogMarkerHeaderName, "123456-1-abc"))
+	s.Equal("ping", string(request.Data()))
+}
+
+func (s *runTestSuite) TestMarkerDestination() {
+	addr := "waf.example.com"
+	port := 8080
+	protocol := "http"
+	input := test.NewInput(&schema.Input{DestAddr: &addr, Port: &port, Protocol: &protocol})
+
+	cfg := config.NewDefaultConfig()
+	s.Equal(&ftwhttp.Destination{DestAddr: addr, Port: port, Protocol: protocol},
+		markerDestination(config.NewRunnerConfiguration(cfg), input))
+
+	cfg.MarkerRequest.DestAddr = "backend.example.com"
+	cfg.MarkerRequest.Port = 8443
+	cfg.MarkerRequest.Protocol = "https"
+	s.Equal(&ftwhttp.Destination{DestAddr: "backend.example.com", Port: 8443, Protocol: "https"},
+		markerDestination(config.NewRunnerConfiguration(cfg), input))
+}
+
+func (s *runTestSuite) TestCheckMarker() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the WAF only logs the configured marker requests
+		if r.Method == http.MethodHead && r.URL.Path == "/marker" {
+			s.writeMarkerOrMessageToTestServerLog("", r)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	latency, err := CheckMarker(s.runnerConfig, s.dest)
+	s.Require().NoError(err)
+	s.Positive(latency)
+
+	s.runnerConfig.MarkerRequest.URI = "/status/200"
+	s.runnerConfig.MaxMarkerRetries = 2
+	_, err = CheckMarker(s.runnerConfig, s.dest)
+	s.ErrorContains(err, "can't find log marker")
+}
+
 func (s *runTestSuite) TestGetRequestFromData() {
 	data := "This is Springfield"
 	boolean := true
@@ -759,7 +919,7 @@ func (s *runTestSuite) TestGetRequestFromData() {
 		Protocol:            &s.dest.Protocol,
 		Data:                &data,
 	})
-	request, err := getRequestFromTest(input)
+	request, err := getRequestFromTest(input, test.InputExtensions{})
 	s.Require().NoError(err)
 
 	s.Equal(data, string(request.Data()))
@@ -778,7 +938,7 @@ func (s *runTestSuite) TestGetRequestFromEncodedData() {
 		Protocol:            &s.dest.Protocol,
 		Data:                &data,
 	})
-	request, err := getRequestFromTest(input)
+	request, err := getRequestFromTest(input, test.InputExtensions{})
 	s.Require().NoError(err)
 
 	s.Equal(data, string(request.Data()))
@@ -808,6 +968,195 @@ func (s *runTestSuite) TestTriggeredRules() {
 	s.Equal(triggeredRules, res.Stats.TriggeredRules, "Oops, triggered rules don't match expectation")
 }
 
+func (s *runTestSuite) TestAnomalyScores() {
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1"}, res.Stats.Success)
+	s.Equal([]string{"123456-2", "123456-3"}, res.Stats.Failed)
+
+	scores := &waflog.AnomalyScores{Inbound: 5}
+	s.Equal(map[string][]*waflog.AnomalyScores{
+		"123456-1": {scores},
+		"123456-2": {scores},
+		"123456-3": {scores, scores},
+	}, res.Stats.AnomalyScores)
+}
+
+func (s *runTestSuite) TestLogEntries() {
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1"}, res.Stats.Success)
+	s.Equal([]string{"123456-2"}, res.Stats.Failed)
+}
+
+func (s *runTestSuite) TestCloudRuleIds() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery == "attack" {
+			w.Header().Set("X-Rule-Id", "942100, 949110")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1"}, res.Stats.Success)
+	s.Equal([]string{"123456-2", "123456-3"}, res.Stats.Failed)
+	s.Equal(map[string][][]uint{
+		"123456-1": {{942100, 949110}},
+		"123456-2": {{942100, 949110}},
+		"123456-3": {{}},
+	}, res.Stats.TriggeredRules)
+}
+
+// correlationTestHandler logs an audit log entry for each request, including the transaction ID and
+// the request headers, and an entry of an unrelated request. No marker requests must be sent.
+func (s *runTestSuite) correlationTestHandler() http.HandlerFunc {
+	transactionCount := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.NotEqual("/status/200", r.URL.Path, "no marker requests must be sent")
+		transactionCount++
+		transactionId := fmt.Sprintf("tx-%d", transactionCount)
+		ruleIds := "[]"
+		if r.URL.RawQuery == "attack" {
+			ruleIds = `[{"id":942100}]`
+		}
+		s.writeTestServerLog(fmt.Sprintf(`{"transaction":{"unique_id":"other-tx","request":{"headers":{"Host":"other"}},"messages":[{"id":949110}]}}
+{"transaction":{"unique_id":"%s","request":{"headers":{"X-Crs-Test":"%s"}},"messages":%s}}
+`, transactionId, r.Header.Get(s.cfg.LogMarkerHeaderName), ruleIds))
+		w.Header().Set("X-Unique-Id", transactionId)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *runTestSuite) TestRequestIdCorrelation() {
+	s.ts.Config.Handler = s.correlationTestHandler()
+
+	s.Run("dry run", func() {
+		var buffer bytes.Buffer
+		s.runnerConfig.DryRun = true
+		_, err := Run(s.runnerConfig, s.ftwTests, output.NewOutput("plain", &buffer))
+		s.runnerConfig.DryRun = false
+		s.Require().NoError(err)
+		s.Regexp(`\nX-CRS-Test: 123456-1-[0-9a-f-]+\\r\\n\n`, buffer.String(), "the request ID must be rendered")
+	})
+
+	s.Run("run", func() {
+		s.runnerConfig.ArtifactsDir = filepath.Join(s.tempDir, "artifacts")
+		res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+		s.Equal([]string{"123456-1", "123456-2"}, res.Stats.Success)
+		s.Equal([]string{"123456-3"}, res.Stats.Failed)
+
+		request, err := os.ReadFile(filepath.Join(s.runnerConfig.ArtifactsDir, "123456-3-1", requestArtifact))
+		s.Require().NoError(err)
+		s.Regexp(`\r\nX-CRS-Test: 123456-3-[0-9a-f-]+\r\n`, string(request), "the artifact must contain the request ID that was sent")
+	})
+}
+
+func (s *runTestSuite) TestTransactionIdCorrelation() {
+	s.ts.Config.Handler = s.correlationTestHandler()
+
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1", "123456-2"}, res.Stats.Success)
+	s.Equal([]string{"123456-3"}, res.Stats.Failed)
+}
+
+func (s *runTestSuite) TestWindowCorrelation() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.NotEqual("/status/200", r.URL.Path, "no marker requests must be sent")
+		const layout = "Mon Jan 02 15:04:05.000000 2006"
+		now := time.Now()
+		s.writeTestServerLog(fmt.Sprintf(`[%s] [client 127.0.0.1] ModSecurity: Warning. [id "949110"] [unique_id "late"]
+[%s] [client 127.0.0.1] ModSecurity: Warning. [id "942100"] [unique_id "tx-1"]
+`, now.Add(-time.Minute).Format(layout), now.Format(layout)))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	// the entry written late for an earlier request is outside of the time window
+	s.Equal(map[string][][]uint{
+		"123456-1": {{942100}},
+	}, res.Stats.TriggeredRules)
+}
+
+func (s *runTestSuite) TestStageTLSInvalid() {
+	_, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.ErrorContains(err, `invalid TLS input of test 123456-1: tls: unknown version "1.4"`)
+}
+
+func (s *runTestSuite) TestResponseView() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusForbidden)
+		writer := gzip.NewWriter(w)
+		_, _ = writer.Write([]byte("<html><body>" + strings.Repeat("<p>Access denied</p>", 10) + "</body></html>"))
+		_ = writer.Close()
+		// flushing before the end of the handler makes the server use the chunked transfer encoding
+		w.(http.Flusher).Flush()
+	})
+
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1", "123456-3"}, res.Stats.Success)
+	s.Equal([]string{"123456-2"}, res.Stats.Failed)
+}
+
+func (s *runTestSuite) TestUnixSocketDestination() {
+	dir, err := os.MkdirTemp("", "ftw")
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "waf.sock")
+	listener, err := net.Listen("unix", socketPath)
+	s.Require().NoError(err)
+	markers := atomic.Int32{}
+	handler := s.getDefaultTestServerHandler(runTestLogLines)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(s.cfg.LogMarkerHeaderName) != "" {
+			markers.Add(1)
+		}
+		handler(w, r)
+	})}
+	go func() { _ = server.Serve(listener) }()
+	s.T().Cleanup(func() { _ = server.Close() })
+
+	protocol := ftwhttp.UnixProtocol
+	s.runnerConfig.TestOverride.Overrides.Protocol = &protocol
+	s.runnerConfig.TestOverride.Overrides.DestAddr = &socketPath
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1"}, res.Stats.Success)
+	s.Equal(int32(2), markers.Load(), "the marker requests must be sent to the socket")
+}
+
+func (s *runTestSuite) TestResolveDestination() {
+	markers := atomic.Int32{}
+	handler := s.getDefaultTestServerHandler(runTestLogLines)
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(s.cfg.LogMarkerHeaderName) != "" {
+			markers.Add(1)
+		}
+		handler(w, r)
+	})
+
+	destAddr := "waf.example.com"
+	s.runnerConfig.TestOverride.Overrides.DestAddr = &destAddr
+	s.runnerConfig.Resolve = []string{fmt.Sprintf("waf.example.com:%d:%s", s.dest.Port, s.dest.DestAddr)}
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1"}, res.Stats.Success)
+	s.Equal(int32(2), markers.Load(), "the marker requests must be sent to the resolved address")
+}
+
+func (s *runTestSuite) TestResolveInvalid() {
+	s.runnerConfig.Resolve = []string{"waf.example.com:80"}
+	_, err := Run(s.runnerConfig, []*test.FTWTest{}, s.out)
+	s.ErrorContains(err, `resolve: invalid entry "waf.example.com:80"`)
+}
+
 func (s *runTestSuite) TestEncodedRequest() {
 	client, err := ftwhttp.NewClientWithConfig(ftwhttp.NewClientConfig())
 	s.Require().NoError(err)
@@ -852,3 +1201,297 @@ func (s *runTestSuite) TestEncodedRequest_InvalidEncoding() {
 	err = RunStage(s.context, _check, schema.Test{}, stage)
 	s.Error(err, "failed to read request from test specification: illegal base64 data at input byte 4")
 }
+
+func (s *runTestSuite) TestShuffle() {
+	// enough tests that the shuffled order is unlikely to be the original one
+	var testYaml strings.Builder
+	testYaml.WriteString("---\nmeta:\n  author: \"tester\"\nrule_id: 123456\ntests:\n")
+	ids := []string{}
+	for testId := 1; testId <= 8; testId++ {
+		fmt.Fprintf(&testYaml, `  - test_id: %d
+    stages:
+      - input:
+          dest_addr: "%s"
+          port: %d
+          headers:
+            Host: "localhost"
+        output:
+          status: 200
+`, testId, s.dest.DestAddr, s.dest.Port)
+		ids = append(ids, fmt.Sprintf("123456-%d", testId))
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(testYaml.String()), "shuffle.yaml")
+	s.Require().NoError(err)
+	s.ftwTests = []*test.FTWTest{ftwTest}
+
+	s.runnerConfig.Output = output.Quiet
+	s.runnerConfig.Shuffle = true
+	s.runnerConfig.Seed = seed(1234)
+
+	first, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal(0, first.Stats.TotalFailed())
+	s.Require().NotNil(first.Stats.Seed)
+	s.Equal(int64(1234), *first.Stats.Seed)
+	s.ElementsMatch(ids, first.Stats.Success)
+	s.NotEqual(ids, first.Stats.Success)
+
+	second, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal(first.Stats.Success, second.Stats.Success, "the same seed must reproduce the same order")
+
+	s.runnerConfig.Shuffle = false
+	unshuffled, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Nil(unshuffled.Stats.Seed)
+	s.Equal(ids, unshuffled.Stats.Success)
+}
+
+func (s *runTestSuite) TestGeneratedBody() {
+	var buffer bytes.Buffer
+	s.runnerConfig.DryRun = true
+	_, err := Run(s.runnerConfig, s.ftwTests, output.NewOutput("plain", &buffer))
+	s.ErrorContains(err, "'body' can't be combined with 'data' or 'encoded_data'")
+
+	rendered := buffer.String()
+	s.Contains(rendered, "Content-Type: multipart/form-data; boundary=b\\r\\n\n")
+	s.Contains(rendered, "\\r\\n\n--b\\n\nContent-Disposition: form-data; name=\"file\"; filename=\"a.php\"\\n\n\\n\n<?php\\n\n--b--\\n\n",
+		"bare line feeds must be kept")
+	s.Contains(rendered, "Content-Type: application/json\\r\\n\n")
+	s.Contains(rendered, "Content-Length: 22\\r\\n\n")
+	s.Contains(rendered, `{"q":"<script>","n":1}`)
+}
+
+func (s *runTestSuite) TestChunkedBody() {
+	s.Run("render", func() {
+		var buffer bytes.Buffer
+		s.runnerConfig.DryRun = true
+		_, err := Run(s.runnerConfig, s.ftwTests, output.NewOutput("plain", &buffer))
+		s.Require().NoError(err)
+		s.Contains(buffer.String(), "Transfer-Encoding: chunked\\r\\n\nContent-Length: 47\\r\\n\n\\r\\n\n"+
+			"5;x\\r\\n\nunion\\r\\n\n7;x\\r\\n\n select\\r\\n\n0;x\\r\\n\nX-Trailer: 1\\r\\n\n\\r\\n\n")
+	})
+
+	s.Run("send", func() {
+		body := make(chan string, 1)
+		s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			body <- string(data)
+		})
+		s.runnerConfig.DryRun = false
+		res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+		s.Equal([]string{"123456-1"}, res.Stats.Success)
+		s.Equal("union select", <-body)
+	})
+}
+
+func (s *runTestSuite) TestWebSocketStage() {
+	s.Run("render", func() {
+		var buffer bytes.Buffer
+		s.runnerConfig.DryRun = true
+		_, err := Run(s.runnerConfig, s.ftwTests, output.NewOutput("plain", &buffer))
+		s.Require().NoError(err)
+		s.Contains(buffer.String(), "Upgrade: websocket\\r\\n\nConnection: Upgrade\\r\\n\n")
+		s.Contains(buffer.String(), "Sec-WebSocket-Version: 13\\r\\n\n")
+	})
+
+	s.Run("send", func() {
+		s.ts.Config.Handler = websocket.Handler(func(ws *websocket.Conn) {
+			for {
+				var message string
+				if err := websocket.Message.Receive(ws, &message); err != nil {
+					return
+				}
+				if err := websocket.Message.Send(ws, "echo: "+message); err != nil {
+					return
+				}
+			}
+		})
+		s.runnerConfig.DryRun = false
+		res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+		s.Equal([]string{"123456-1"}, res.Stats.Success)
+		s.Empty(res.Stats.Failed)
+	})
+}
+
+func (s *runTestSuite) TestExpectErrorCategory() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "reset" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		s.Require().NoError(err)
+		// closing with a linger time of 0 sends an RST instead of a FIN
+		_ = conn.(*net.TCPConn).SetLinger(0)
+		_ = conn.Close()
+	})
+
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-1"}, res.Stats.Success)
+	s.Equal([]string{"123456-2", "123456-3"}, res.Stats.Failed)
+	s.Equal(map[string][]ftwhttp.ErrorCategory{
+		"123456-1": {ftwhttp.ConnectionResetCategory},
+		"123456-2": {ftwhttp.ConnectionResetCategory},
+		"123456-3": {""},
+	}, res.Stats.ErrorCategories)
+}
+
+func (s *runTestSuite) TestCapture() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	// nothing listens for QUIC, the HTTP/3 stage expects the connection to time out
+	s.runnerConfig.ConnectTimeout = 100 * time.Millisecond
+
+	s.Run("failed stages as transcripts", func() {
+		s.runnerConfig.CaptureDir = filepath.Join(s.tempDir, "transcripts")
+		s.runnerConfig.CaptureFormat = config.TranscriptCaptureFormat
+		res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+		s.Equal([]string{"123456-2"}, res.Stats.Failed)
+
+		files, err := filepath.Glob(filepath.Join(s.runnerConfig.CaptureDir, "*"))
+		s.Require().NoError(err)
+		s.Equal([]string{filepath.Join(s.runnerConfig.CaptureDir, "123456-2-2.txt")}, files)
+		transcript, err := os.ReadFile(files[0])
+		s.Require().NoError(err)
+		s.Contains(string(transcript), "GET /blocked HTTP/1.1\r\n")
+		s.Contains(string(transcript), "HTTP/1.1 403 Forbidden\r\n")
+	})
+
+	s.Run("all stages as pcapng", func() {
+		s.runnerConfig.CaptureDir = filepath.Join(s.tempDir, "pcapng")
+		s.runnerConfig.CaptureFormat = config.PcapngCaptureFormat
+		s.runnerConfig.CaptureAllStages = true
+		_, err := Run(s.runnerConfig, s.ftwTests, s.out)
+		s.Require().NoError(err)
+
+		files, err := filepath.Glob(filepath.Join(s.runnerConfig.CaptureDir, "*"))
+		s.Require().NoError(err)
+		s.Len(files, 3)
+		s.NoFileExists(filepath.Join(s.runnerConfig.CaptureDir, "123456-3-1.pcapng"), "HTTP/3 stages must not be written")
+		data, err := os.ReadFile(filepath.Join(s.runnerConfig.CaptureDir, "123456-2-1.pcapng"))
+		s.Require().NoError(err)
+		// the section header block starts every pcapng file
+		s.Equal([]byte{0x0a, 0x0d, 0x0d, 0x0a}, data[:4])
+	})
+}
+
+func (s *runTestSuite) TestArtifacts() {
+	s.ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	s.runnerConfig.ArtifactsDir = filepath.Join(s.tempDir, "artifacts")
+
+	res, err := Run(s.runnerConfig, s.ftwTests, s.out)
+	s.Require().NoError(err)
+	s.Equal([]string{"123456-2"}, res.Stats.Failed)
+
+	folders, err := filepath.Glob(filepath.Join(s.runnerConfig.ArtifactsDir, "*"))
+	s.Require().NoError(err)
+	dir := filepath.Join(s.runnerConfig.ArtifactsDir, "123456-2-2")
+	s.Equal([]string{dir}, folders)
+
+	files, err := os.ReadDir(dir)
+	s.Require().NoError(err)
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	// the log is not written in cloud mode
+	s.ElementsMatch([]string{"request.http", "response.http", "test.yaml", "expected-output.yaml", "diagnosis.json"}, names)
+
+	request, err := os.ReadFile(filepath.Join(dir, "request.http"))
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(string(request), "GET /blocked HTTP/1.1\r\n"))
+	response, err := os.ReadFile(filepath.Join(dir, "response.http"))
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(string(response), "HTTP/1.1 403 Forbidden\r\n"))
+	testYaml, err := os.ReadFile(filepath.Join(dir, "test.yaml"))
+	s.Require().NoError(err)
+	s.Contains(string(testYaml), "description: \"a passing and a failing stage\"")
+	expectedOutput, err := os.ReadFile(filepath.Join(dir, "expected-output.yaml"))
+	s.Require().NoError(err)
+	s.Equal("status: 200\nresponse_contains: blocked\nresponse_view: raw\n", string(expectedOutput))
+
+	diagnosisJson, err := os.ReadFile(filepath.Join(dir, "diagnosis.json"))
+	s.Require().NoError(err)
+	var stageDiagnosis diagnosis
+	s.Require().NoError(json.Unmarshal(diagnosisJson, &stageDiagnosis))
+	s.Equal(diagnosis{
+		Test:            "123456-2",
+		Stage:           2,
+		FailedAssertion: "status",
+		Reason:          "unexpected status code 403",
+		StatusCode:      http.StatusForbidden,
+	}, stageDiagnosis)
+}
+
+func (s *runTestSuite) TestDryRun() {
+	s.Run("print requests", func() {
+		var buffer bytes.Buffer
+		s.runnerConfig.DryRun = true
+		res, err := Run(s.runnerConfig, s.ftwTests, output.NewOutput("plain", &buffer))
+		s.Require().NoError(err)
+		s.Equal(0, res.Stats.TotalFailed())
+		s.Equal(0, res.Stats.Run)
+
+		rendered := buffer.String()
+		destination := fmt.Sprintf("http://%s:%d", s.dest.DestAddr, s.dest.Port)
+		s.Contains(rendered, fmt.Sprintf("=> stage 1 of 123456-1 to %s\n", destination))
+		s.Contains(rendered, "POST /post HTTP/1.1\\r\\n\n")
+		s.Contains(rendered, "Content-Type: application/x-www-form-urlencoded\\r\\n\n")
+		s.Contains(rendered, "Content-Length: 15\\r\\n\n")
+		s.Contains(rendered, "\\r\\n\na=b+c&d=%3Ce%3E\n")
+		s.Contains(rendered, fmt.Sprintf("=> stage 2 of 123456-1 to %s\n", destination))
+		s.Contains(rendered, "Content-Disposition: form-data; name=\"fileRap\"; filename=\"test.txt\"\\r\\n\n")
+		s.Contains(rendered, "GET /?a=\\xff\\x00 HTTP/1.1\\r\\n\nHost: localhost\\r\\n\n\\r\\n\n")
+		s.NotContains(rendered, "123456-3")
+		s.Contains(rendered, fmt.Sprintf("=> stage 1 of 123456-4 to https://%s:%d over HTTP/3\n", s.dest.DestAddr, s.dest.Port))
+		s.Contains(rendered, "HEADERS frame\n:method: POST\n:scheme: https\n:authority: localhost\n:path: /h3\n")
+		s.Contains(rendered, "DATA frame, 3 bytes\na=1\n")
+		s.NotContains(rendered, "HTTP/3\\r\\n", "HTTP/3 requests must not be rendered as HTTP/1 messages")
+		s.Contains(rendered, "~ rendered 4 requests")
+
+		logContents, err := os.ReadFile(s.logFilePath)
+		s.Require().NoError(err)
+		s.Empty(logContents, "no request must be sent during a dry run")
+	})
+
+	s.Run("write requests to files", func() {
+		s.runnerConfig.DryRun = true
+		s.runnerConfig.DryRunDir = filepath.Join(s.tempDir, "requests")
+		_, err := Run(s.runnerConfig, s.ftwTests, output.NewOutput("quiet", &bytes.Buffer{}))
+		s.Require().NoError(err)
+
+		files, err := filepath.Glob(filepath.Join(s.runnerConfig.DryRunDir, "*.http"))
+		s.Require().NoError(err)
+		s.Len(files, 3)
+
+		raw, err := os.ReadFile(filepath.Join(s.runnerConfig.DryRunDir, "123456-2-1.http"))
+		s.Require().NoError(err)
+		s.Equal([]byte("GET /?a=\xff\x00 HTTP/1.1\r\nHost: localhost\r\n\r\n"), raw)
+
+		multipart, err := os.ReadFile(filepath.Join(s.runnerConfig.DryRunDir, "123456-1-2.http"))
+		s.Require().NoError(err)
+		s.Contains(string(multipart), "Some-file-test-here\r\n----------397236876--\r\n")
+		s.NotContains(strings.ReplaceAll(string(multipart), "\r\n", ""), "\n", "multipart bodies must only contain CRLF line endings")
+
+		frames, err := os.ReadFile(filepath.Join(s.runnerConfig.DryRunDir, "123456-4-1.h3"))
+		s.Require().NoError(err)
+		s.Equal(byte(0x01), frames[0], "the file must start with the HEADERS frame")
+		s.True(bytes.HasSuffix(frames, []byte{0x00, 0x03, 'a', '=', '1'}), "the file must end with the DATA frame")
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"io"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/output"
+	"github.com/coreruleset/go-ftw/v2/waflog"
+)
+
+// SendResult holds what was observed when sending a single stage with Send
+type SendResult struct {
+	// Response is the response of the server. Nil if no response could be read.
+	Response *ftwhttp.Response
+	// TriggeredRules contains the IDs of the rules found in the log entries for the request, or in the
+	// response in cloud mode
+	TriggeredRules []uint
+	// LogLines contains the log entries of the request
+	LogLines [][]byte
+}
+
+// Send runs a single stage outside of a test, exactly like `Run` runs a stage, including the
+// log correlation, and returns the response and the log entries for the request.
+// The output of the stage is not used, as there is nothing to assert.
+func Send(runnerConfig *config.RunnerConfig, stage schema.Stage) (*SendResult, error) {
+	logLines, err := waflog.NewFTWLogLines(runnerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanLogs(logLines)
+
+	client, err := ftwhttp.NewClient(runnerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer closeClient(client)
+
+	runContext := &TestRunContext{
+		RunnerConfig: runnerConfig,
+		Output:       output.NewOutput(string(output.Quiet), io.Discard),
+		Stats:        NewRunStats(),
+		Client:       client,
+		LogLines:     logLines,
+	}
+	ftwCheck, err := NewCheck(runContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// a test case is required for generating the IDs of the log markers
+	testCase := schema.Test{Stages: []schema.Stage{stage}}
+	if err := RunStage(runContext, ftwCheck, testCase, stage); err != nil {
+		return nil, err
+	}
+
+	result := &SendResult{Response: runContext.LastStageResponse}
+	// in cloud mode, the triggered rules can only be found in the response
+	if result.TriggeredRules, err = ftwCheck.GetTriggeredRules(); err != nil {
+		return nil, err
+	}
+	if notRunningInCloudMode(ftwCheck) {
+		if result.LogLines, err = logLines.GetMarkedLines(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"bytes"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+)
+
+func (s *runTestSuite) TestSend() {
+	autocompleteHeaders := true
+	stage := schema.Stage{
+		Input: schema.Input{
+			DestAddr:            &s.dest.DestAddr,
+			Port:                &s.dest.Port,
+			Protocol:            &s.dest.Protocol,
+			AutocompleteHeaders: &autocompleteHeaders,
+			OrderedHeaders:      []schema.HeaderTuple{{Name: "Host", Value: "localhost"}},
+		},
+	}
+
+	result, err := Send(s.runnerConfig, stage)
+	s.Require().NoError(err)
+	s.Require().NotNil(result.Response)
+	s.Equal(200, result.Response.Parsed.StatusCode)
+	s.Equal([]uint{920210, 920300, 949110, 980130}, result.TriggeredRules)
+	s.Require().Len(result.LogLines, 4)
+	s.True(bytes.Contains(result.LogLines[0], []byte(`[id "920210"]`)))
+}
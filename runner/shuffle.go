@@ -0,0 +1,57 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// shuffler determines the order in which test files and test cases are run.
+// A nil shuffler keeps the original order.
+type shuffler struct {
+	seed   int64
+	random *rand.Rand
+}
+
+// newShuffler creates a shuffler for the given seed. If the seed is nil, a new seed is
+// generated from the current time. The seed is retained so that the order can be reproduced.
+func newShuffler(fixedSeed *int64) *shuffler {
+	seed := time.Now().UnixNano()
+	if fixedSeed != nil {
+		seed = *fixedSeed
+	}
+	return &shuffler{
+		seed:   seed,
+		random: rand.New(rand.NewPCG(uint64(seed), 0)),
+	}
+}
+
+// Seed returns the seed used by the shuffler
+func (s *shuffler) Seed() int64 {
+	return s.seed
+}
+
+// order returns the indices 0..n-1 in the order in which the elements should be processed
+func (s *shuffler) order(n int) []int {
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	if s != nil {
+		s.random.Shuffle(n, func(i, j int) {
+			indices[i], indices[j] = indices[j], indices[i]
+		})
+	}
+	return indices
+}
+
+// shuffled returns a copy of the elements, in the order determined by the shuffler
+func shuffled[T any](s *shuffler, elements []T) []T {
+	result := make([]T, 0, len(elements))
+	for _, index := range s.order(len(elements)) {
+		result = append(result, elements[index])
+	}
+	return result
+}
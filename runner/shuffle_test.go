@@ -0,0 +1,60 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type shuffleTestSuite struct {
+	suite.Suite
+}
+
+func TestShuffleTestSuite(t *testing.T) {
+	suite.Run(t, new(shuffleTestSuite))
+}
+
+func (s *shuffleTestSuite) TestNilShufflerKeepsOrder() {
+	var sh *shuffler
+	s.Equal([]int{0, 1, 2, 3}, sh.order(4))
+	s.Equal([]string{"a", "b", "c"}, shuffled(sh, []string{"a", "b", "c"}))
+}
+
+func (s *shuffleTestSuite) TestSameSeedSameOrder() {
+	elements := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	first := newShuffler(seed(42))
+	second := newShuffler(seed(42))
+
+	for range 3 {
+		s.Equal(shuffled(first, elements), shuffled(second, elements))
+	}
+	s.ElementsMatch(elements, shuffled(newShuffler(seed(42)), elements))
+}
+
+func (s *shuffleTestSuite) TestDifferentSeedsDifferentOrder() {
+	elements := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	s.NotEqual(shuffled(newShuffler(seed(1)), elements), shuffled(newShuffler(seed(2)), elements))
+}
+
+func (s *shuffleTestSuite) TestGeneratedSeed() {
+	sh := newShuffler(nil)
+	s.NotZero(sh.Seed())
+
+	elements := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	s.Equal(shuffled(sh, elements), shuffled(newShuffler(seed(sh.Seed())), elements))
+}
+
+func (s *shuffleTestSuite) TestZeroSeed() {
+	sh := newShuffler(seed(0))
+	s.Zero(sh.Seed(), "0 is a valid seed")
+
+	elements := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	s.Equal(shuffled(sh, elements), shuffled(newShuffler(seed(0)), elements))
+}
+
+func seed(value int64) *int64 {
+	return &value
+}
@@ -14,7 +14,9 @@ import (
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
 	"github.com/rs/zerolog/log"
 
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 	"github.com/coreruleset/go-ftw/v2/output"
+	"github.com/coreruleset/go-ftw/v2/waflog"
 )
 
 // TestResult type are the values that the result of a test can have
@@ -39,16 +41,25 @@ type RunStats struct {
 	// Failed is a list containing the failed tests.
 	Failed []string `json:"failed"`
 	// Skipped is a list containing the tests that were skipped.
-	Skipped    []string `json:"skipped"`
-	Ignored    []string `json:"ignored"`
-	ForcedPass []string `json:"forced-pass"`
-	ForcedFail []string `json:"forced-fail"`
+	Skipped []string `json:"skipped"`
+	// SkipReasons maps skipped tests to the reason they were skipped for.
+	SkipReasons map[string]string `json:"skip-reasons,omitempty"`
+	Ignored     []string          `json:"ignored"`
+	ForcedPass  []string          `json:"forced-pass"`
+	ForcedFail  []string          `json:"forced-fail"`
 	// RunTime maps the time taken to run each test.
 	RunTime map[string]time.Duration `json:"runtime"`
 	// TotalTime is the duration over all runs, the sum of all individual run times.
 	TotalTime time.Duration `json:"total-time"`
 	// TriggeredRules maps triggered rules to stages of tests
 	TriggeredRules map[string][][]uint `json:"triggered-rules"`
+	// AnomalyScores maps the anomaly scores found in the log to stages of tests
+	AnomalyScores map[string][]*waflog.AnomalyScores `json:"anomaly-scores"`
+	// ErrorCategories maps the categories of the errors received instead of responses to stages
+	// of tests. The category of stages without an error is empty.
+	ErrorCategories map[string][]ftwhttp.ErrorCategory `json:"error-categories"`
+	// Seed is the seed that was used to shuffle the tests. Nil if the tests were not shuffled.
+	Seed *int64 `json:"seed,omitempty"`
 }
 
 // type rulesByStage struct {
@@ -58,16 +69,19 @@ type RunStats struct {
 // NewRunStats creates and initializes a new Stats struct.
 func NewRunStats() *RunStats {
 	return &RunStats{
-		Run:            0,
-		Success:        []string{},
-		Failed:         []string{},
-		Skipped:        []string{},
-		Ignored:        []string{},
-		ForcedPass:     []string{},
-		ForcedFail:     []string{},
-		RunTime:        make(map[string]time.Duration),
-		TotalTime:      0,
-		TriggeredRules: make(map[string][][]uint),
+		Run:             0,
+		Success:         []string{},
+		Failed:          []string{},
+		Skipped:         []string{},
+		SkipReasons:     make(map[string]string),
+		Ignored:         []string{},
+		ForcedPass:      []string{},
+		ForcedFail:      []string{},
+		RunTime:         make(map[string]time.Duration),
+		TotalTime:       0,
+		TriggeredRules:  make(map[string][][]uint),
+		AnomalyScores:   make(map[string][]*waflog.AnomalyScores),
+		ErrorCategories: make(map[string][]ftwhttp.ErrorCategory),
 	}
 }
 
@@ -97,10 +111,17 @@ func (stats *RunStats) addResultToStats(result TestResult, testCase *schema.Test
 	}
 }
 
-func (stats *RunStats) addStageResultToStats(testCase *schema.Test, stageTime time.Duration, triggeredRules []uint) {
+func (stats *RunStats) addSkippedResultToStats(testCase *schema.Test, reason string) {
+	stats.addResultToStats(Skipped, testCase)
+	stats.SkipReasons[testCase.IdString()] = reason
+}
+
+func (stats *RunStats) addStageResultToStats(testCase *schema.Test, stageTime time.Duration, triggeredRules []uint, anomalyScores *waflog.AnomalyScores, errorCategory ftwhttp.ErrorCategory) {
 	stats.RunTime[testCase.IdString()] += stageTime
 	byStage := stats.TriggeredRules[testCase.IdString()]
 	stats.TriggeredRules[testCase.IdString()] = append(byStage, slices.Clone(triggeredRules))
+	stats.AnomalyScores[testCase.IdString()] = append(stats.AnomalyScores[testCase.IdString()], anomalyScores)
+	stats.ErrorCategories[testCase.IdString()] = append(stats.ErrorCategories[testCase.IdString()], errorCategory)
 	stats.TotalTime += stageTime
 }
 
@@ -111,6 +132,9 @@ func (stats *RunStats) printSummary(out *output.Output) {
 			out.RawPrint(string(b))
 		} else {
 			out.Println(out.Message("+ run %d total tests in %s"), stats.Run, stats.TotalTime)
+			if stats.Seed != nil {
+				out.Println(out.Message("~ tests were shuffled using seed %d"), *stats.Seed)
+			}
 			out.Println(out.Message(">> skipped %d tests"), len(stats.Skipped))
 			if len(stats.Ignored) > 0 {
 				out.Println(out.Message("^ ignored %d tests"), len(stats.Ignored))
@@ -186,6 +210,9 @@ func (stats *RunStats) writeGitHubSummary() {
 	if len(stats.ForcedFail) > 0 {
 		fmt.Fprintf(&summary, "| 🔧 Forced Fail | %d |\n", len(stats.ForcedFail))
 	}
+	if stats.Seed != nil {
+		fmt.Fprintf(&summary, "| 🎲 Shuffle Seed | %d |\n", *stats.Seed)
+	}
 	fmt.Fprintf(&summary, "| ⏱️ Total Time | %s |\n\n", stats.TotalTime)
 
 	// Failed tests details in table format
@@ -9,6 +9,7 @@ import (
 
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/filter"
 	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 	"github.com/coreruleset/go-ftw/v2/output"
 	"github.com/coreruleset/go-ftw/v2/test"
@@ -23,6 +24,7 @@ type TestRunContext struct {
 	Include                *regexp.Regexp
 	Exclude                *regexp.Regexp
 	IncludeTags            *regexp.Regexp
+	Filter                 *filter.Expression
 	ShowTime               bool
 	ShowOnlyFailed         bool
 	StoreFailureWafLogs    bool
@@ -35,6 +37,18 @@ type TestRunContext struct {
 	LogLines               *waflog.FTWLogLines
 	CurrentStageDuration   time.Duration
 	currentStageStartTime  time.Time
+	// shuffler determines the order of test files and test cases. Nil if tests
+	// are run in their original order.
+	shuffler *shuffler
+	// correlator determines the log lines of a stage. It is created from the runner configuration
+	// on first use.
+	correlator logCorrelator
+	// stageInput contains the input extensions of the stage that is run
+	stageInput test.InputExtensions
+	// ftwTest is the test file of the stage that is run
+	ftwTest *test.FTWTest
+	// stageNumber is the 1-based position of the stage that is run in its test
+	stageNumber int
 	// LastStageResponse stores the response from the previous stage,
 	// used for follow_redirect functionality
 	LastStageResponse *ftwhttp.Response
@@ -43,6 +57,18 @@ type TestRunContext struct {
 	LastStageInput *test.Input
 }
 
+// logCorrelator returns the log correlator for the configured correlation strategy
+func (t *TestRunContext) logCorrelator() (logCorrelator, error) {
+	if t.correlator == nil {
+		correlator, err := newLogCorrelator(t.RunnerConfig.LogCorrelation)
+		if err != nil {
+			return nil, err
+		}
+		t.correlator = correlator
+	}
+	return t.correlator, nil
+}
+
 func (t *TestRunContext) StartTest() {
 }
 
@@ -55,8 +81,8 @@ func (t *TestRunContext) StartStage() {
 	t.CurrentStageDuration = time.Duration(0)
 }
 
-func (t *TestRunContext) EndStage(testCase *schema.Test, testResult TestResult, triggeredRules []uint) {
+func (t *TestRunContext) EndStage(testCase *schema.Test, testResult TestResult, triggeredRules []uint, anomalyScores *waflog.AnomalyScores, errorCategory ftwhttp.ErrorCategory) {
 	t.CurrentStageDuration = time.Since(t.currentStageStartTime)
 	t.Result = testResult
-	t.Stats.addStageResultToStats(testCase, t.CurrentStageDuration, triggeredRules)
+	t.Stats.addStageResultToStats(testCase, t.CurrentStageDuration, triggeredRules, anomalyScores, errorCategory)
 }
@@ -0,0 +1,89 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+	"github.com/coreruleset/go-ftw/v2/test"
+)
+
+// doWebSocket performs the handshake of a WebSocket stage with req, sends the messages of the
+// stage and receives the messages the check expects. The received messages are stored in the
+// check. The handshake response is returned.
+func doWebSocket(client *ftwhttp.Client, ftwCheck *FTWCheck, req *ftwhttp.Request, input *test.WebSocketInput) (*ftwhttp.Response, error) {
+	response, ws, err := client.WebSocket(req)
+	if err != nil || ws == nil {
+		if err == nil {
+			log.Debug().Msgf("Server didn't switch protocols, status: %d", response.Parsed.StatusCode)
+		}
+		return response, err
+	}
+	defer func() {
+		if err := ws.Close(); err != nil {
+			log.Debug().Err(err).Msg("Failed to close WebSocket")
+		}
+	}()
+
+	for index, message := range input.Messages {
+		if err := ws.Send(message); err != nil {
+			return response, fmt.Errorf("failed to send WebSocket message %d: %w", index+1, err)
+		}
+	}
+
+	received, err := receiveWebSocketMessages(ws, ftwCheck.expectedWebSocket)
+	ftwCheck.SetWebSocketMessages(received)
+	return response, err
+}
+
+// receiveWebSocketMessages receives messages until the expectation is met. Closing the WebSocket
+// and timeouts end receiving without an error.
+func receiveWebSocketMessages(ws *ftwhttp.WebSocket, expectation *test.WebSocketExpectation) ([][]byte, error) {
+	received := [][]byte{}
+	if expectation == nil || (expectation.Receive == 0 && len(expectation.ReceivedContains) == 0) {
+		return received, nil
+	}
+	for !webSocketExpectationMet(expectation, received) {
+		message, err := ws.Receive()
+		if err != nil {
+			var netErr net.Error
+			if errors.Is(err, io.EOF) || (errors.As(err, &netErr) && netErr.Timeout()) {
+				log.Debug().Msgf("Stopped receiving WebSocket messages after %d messages: %s", len(received), err)
+				return received, nil
+			}
+			return received, fmt.Errorf("failed to receive WebSocket message: %w", err)
+		}
+		received = append(received, message.Payload)
+	}
+	return received, nil
+}
+
+// webSocketExpectationMet returns true if enough messages have been received
+func webSocketExpectationMet(expectation *test.WebSocketExpectation, received [][]byte) bool {
+	if expectation.Receive > 0 {
+		return len(received) >= expectation.Receive
+	}
+	for _, regex := range expectation.ReceivedContains {
+		if !anyMessageMatches(regexp.MustCompile(regex), received) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyMessageMatches(regex *regexp.Regexp, messages [][]byte) bool {
+	for _, message := range messages {
+		if regex.Match(message) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ package test
 
 import (
 	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	yamlv4 "go.yaml.in/yaml/v4"
 
 	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 )
@@ -17,6 +18,14 @@ type Output schema.Output
 type FTWTest struct {
 	schema.FTWTest `yaml:",inline"`
 	FileName       string
+	// FilePath is the path of the file the test was loaded from, as found by GetTestsFromFiles
+	FilePath string `yaml:"-"`
+	// deprecations contains the deprecated fields used by each test, by test ID
+	deprecations map[uint][]string
+	// extensions contains the go-ftw specific fields of the stages of each test, by test ID
+	extensions map[uint][]StageExtensions
+	// testNodes contains the YAML of each test as it was read from the test file, by test ID
+	testNodes map[uint]*yamlv4.Node
 }
 
 func NewInput(input *schema.Input) *Input {
@@ -0,0 +1,52 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"slices"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+)
+
+// DeprecatedFields returns the names of the deprecated fields that the test case uses in the test
+// file, e.g. `stop_magic` or `log_contains`. The result is only valid for tests loaded from YAML,
+// as loading rewrites deprecated fields into their replacements.
+func (t *FTWTest) DeprecatedFields(testCase *schema.Test) []string {
+	return t.deprecations[testCase.TestId]
+}
+
+// findDeprecatedFields returns the names of the deprecated fields used by a test case. It must be
+// called before the test is post-processed.
+//
+//nolint:staticcheck
+func findDeprecatedFields(ftwTest *FTWTest, testCase *schema.Test) []string {
+	fields := []string{}
+	add := func(field string) {
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+
+	if ftwTest.Meta.Enabled != nil {
+		add("meta.enabled")
+	}
+	if testCase.TestTitle != "" {
+		add("test_title")
+	}
+	for _, stage := range testCase.Stages {
+		if stage.Input.Headers != nil {
+			add("input.headers")
+		}
+		if stage.Input.StopMagic != nil {
+			add("input.stop_magic")
+		}
+		if stage.Output.LogContains != "" {
+			add("output.log_contains")
+		}
+		if stage.Output.NoLogContains != "" {
+			add("output.no_log_contains")
+		}
+	}
+	return fields
+}
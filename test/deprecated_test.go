@@ -0,0 +1,76 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"testing"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+var deprecatedFieldsYaml = `---
+meta:
+  author: "tester"
+  enabled: true
+rule_id: 123456
+tests:
+  - test_id: 1
+    stages:
+      - input:
+          ordered_headers:
+            - name: Host
+              value: localhost
+          autocomplete_headers: false
+        output:
+          log:
+            expect_ids: [123456]
+  - test_title: "123456-2"
+    stages:
+      - input:
+          headers:
+            Host: localhost
+          stop_magic: true
+        output:
+          log_contains: "id \"123456\""
+      - input:
+          headers:
+            Host: localhost
+        output:
+          no_log_contains: "id \"123456\""
+`
+
+type deprecatedTestSuite struct {
+	suite.Suite
+}
+
+func (s *deprecatedTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func TestDeprecatedTestSuite(t *testing.T) {
+	suite.Run(t, new(deprecatedTestSuite))
+}
+
+func (s *deprecatedTestSuite) TestDeprecatedFields() {
+	ftwTest, err := GetTestFromYaml([]byte(deprecatedFieldsYaml), "123456.yaml")
+	s.Require().NoError(err)
+	s.Require().Len(ftwTest.Tests, 2)
+
+	s.Equal([]string{"meta.enabled"}, ftwTest.DeprecatedFields(&ftwTest.Tests[0]))
+	s.Equal([]string{
+		"meta.enabled",
+		"test_title",
+		"input.headers",
+		"input.stop_magic",
+		"output.log_contains",
+		"output.no_log_contains",
+	}, ftwTest.DeprecatedFields(&ftwTest.Tests[1]))
+}
+
+func (s *deprecatedTestSuite) TestDeprecatedFields_NotLoadedFromYaml() {
+	ftwTest := &FTWTest{}
+	s.Empty(ftwTest.DeprecatedFields(&schema.Test{TestId: 1}))
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	yamlv4 "go.yaml.in/yaml/v4"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+)
+
+// StageExtensions contains the fields of a stage that go-ftw supports in addition to the
+// fields of the test schema
+type StageExtensions struct {
+	Input  InputExtensions  `yaml:"input"`
+	Output OutputExtensions `yaml:"output"`
+}
+
+// InputExtensions contains the additional fields of `input`
+type InputExtensions struct {
+	// TLS replaces the TLS configuration of the config file for the request of the stage.
+	// Only the fields that are set are replaced.
+	TLS *config.TLSConfig `yaml:"tls,omitempty"`
+	// Body generates the body of the request from a structure. Can't be combined with `data` or
+	// `encoded_data`.
+	Body *ftwhttp.Body `yaml:"body,omitempty"`
+	// Chunked sends the body of the request with the chunked transfer encoding
+	Chunked *ftwhttp.ChunkedOptions `yaml:"chunked,omitempty"`
+	// WebSocket makes the stage a WebSocket stage: the request is the handshake, and the messages
+	// are sent after the server has switched protocols
+	WebSocket *WebSocketInput `yaml:"websocket,omitempty"`
+}
+
+// WebSocketInput contains the messages of a WebSocket stage
+type WebSocketInput struct {
+	Messages []ftwhttp.WebSocketMessage `yaml:"messages"`
+}
+
+// OutputExtensions contains the additional fields of `output`
+type OutputExtensions struct {
+	Log LogExtensions `yaml:"log"`
+	// ResponseView selects the view of the response that `response_contains` is matched against
+	ResponseView ResponseView `yaml:"response_view,omitempty"`
+	// WebSocket contains the expectations on the messages received in a WebSocket stage
+	WebSocket *WebSocketExpectation `yaml:"websocket,omitempty"`
+	// ExpectErrorCategory is the category of the error that is expected instead of a response,
+	// e.g. "connection_reset". Implies `expect_error`.
+	ExpectErrorCategory ftwhttp.ErrorCategory `yaml:"expect_error_category,omitempty"`
+}
+
+// WebSocketExpectation describes the messages expected from the server in a WebSocket stage.
+// Messages are received until Receive messages have arrived or, if Receive is 0, until every
+// regular expression of ReceivedContains has matched. Receiving also stops when the server closes
+// the WebSocket or the read timeout expires.
+type WebSocketExpectation struct {
+	// Receive is the number of messages to wait for
+	Receive int `yaml:"receive,omitempty"`
+	// ReceivedContains contains regular expressions that must each match a received message
+	ReceivedContains []string `yaml:"received_contains,omitempty"`
+	// NoReceivedContains contains regular expressions that must not match any received message
+	NoReceivedContains []string `yaml:"no_received_contains,omitempty"`
+}
+
+// ResponseView is a view of the response that assertions are made against
+type ResponseView string
+
+const (
+	// DecodedResponseView is the response with a body without transfer and content encodings.
+	// The raw view is used if the body can't be decoded.
+	DecodedResponseView ResponseView = "decoded"
+	// RawResponseView is the response as it was received. It is the default view.
+	RawResponseView ResponseView = "raw"
+)
+
+// LogExtensions contains the additional fields of `output.log`
+type LogExtensions struct {
+	// AnomalyScore contains the expected CRS anomaly scores
+	AnomalyScore *AnomalyScoreExpectation `yaml:"anomaly_score,omitempty"`
+	// ExpectEntries contains the details of log entries that are expected to be found
+	ExpectEntries []LogEntryExpectation `yaml:"expect_entries,omitempty"`
+}
+
+// LogEntryExpectation describes a log entry of a rule. A log entry matches if it has the rule ID
+// and all of the given details.
+type LogEntryExpectation struct {
+	Id uint `yaml:"id"`
+	// Msg is a regular expression that must match the message
+	Msg string `yaml:"msg,omitempty"`
+	// Severity is compared case-insensitively, e.g. "critical"
+	Severity string `yaml:"severity,omitempty"`
+	// Tags must all be present
+	Tags []string `yaml:"tags,omitempty"`
+	// Data is a regular expression that must match the logged data, e.g. the matched variable
+	Data string `yaml:"data,omitempty"`
+}
+
+// AnomalyScoreExpectation describes the expected inbound and outbound anomaly scores of a stage.
+// Scores without an expectation are not checked.
+type AnomalyScoreExpectation struct {
+	Inbound  *ScoreExpectation `yaml:"inbound,omitempty"`
+	Outbound *ScoreExpectation `yaml:"outbound,omitempty"`
+}
+
+// ScoreExpectation describes an expected score, either an exact value or a range. A plain number
+// in YAML is a shorthand for `equals`.
+type ScoreExpectation struct {
+	Equals *int `yaml:"equals,omitempty"`
+	Min    *int `yaml:"min,omitempty"`
+	Max    *int `yaml:"max,omitempty"`
+}
+
+// ftwTestExtensions is used to read the extensions of all stages of a test file
+type ftwTestExtensions struct {
+	Tests []struct {
+		Stages []StageExtensions `yaml:"stages"`
+	} `yaml:"tests"`
+}
+
+// UnmarshalYAML accepts a plain number as well as a mapping
+func (e *ScoreExpectation) UnmarshalYAML(node *yamlv4.Node) error {
+	if node.Kind == yamlv4.ScalarNode {
+		var score int
+		if err := node.Decode(&score); err != nil {
+			return err
+		}
+		e.Equals = &score
+		return nil
+	}
+	type plain ScoreExpectation
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	if e.Equals == nil && e.Min == nil && e.Max == nil {
+		return fmt.Errorf("line %d: expected a score, or at least one of 'equals', 'min' or 'max'", node.Line)
+	}
+	if e.Equals != nil && (e.Min != nil || e.Max != nil) {
+		return fmt.Errorf("line %d: 'equals' can't be combined with 'min' or 'max'", node.Line)
+	}
+	if e.Min != nil && e.Max != nil && *e.Min > *e.Max {
+		return fmt.Errorf("line %d: 'min' (%d) is greater than 'max' (%d)", node.Line, *e.Min, *e.Max)
+	}
+	return nil
+}
+
+// UnmarshalYAML accepts the known views only
+func (v *ResponseView) UnmarshalYAML(node *yamlv4.Node) error {
+	var view string
+	if err := node.Decode(&view); err != nil {
+		return err
+	}
+	switch ResponseView(view) {
+	case DecodedResponseView, RawResponseView:
+		*v = ResponseView(view)
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid 'response_view' %q, expected 'decoded' or 'raw'", node.Line, view)
+}
+
+// UnmarshalYAML validates the expectation, so that mistakes are reported when loading the test
+func (e *WebSocketExpectation) UnmarshalYAML(node *yamlv4.Node) error {
+	type plain WebSocketExpectation
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	if e.Receive < 0 {
+		return fmt.Errorf("line %d: 'receive' must not be negative", node.Line)
+	}
+	for _, regex := range slices.Concat(e.ReceivedContains, e.NoReceivedContains) {
+		if _, err := regexp.Compile(regex); err != nil {
+			return fmt.Errorf("line %d: invalid regular expression for received messages: %w", node.Line, err)
+		}
+	}
+	return nil
+}
+
+// UnmarshalYAML validates the expectation, so that mistakes are reported when loading the test
+func (e *LogEntryExpectation) UnmarshalYAML(node *yamlv4.Node) error {
+	type plain LogEntryExpectation
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	if e.Id == 0 {
+		return fmt.Errorf("line %d: the 'id' of an expected log entry is required", node.Line)
+	}
+	if _, err := regexp.Compile(e.Msg); err != nil {
+		return fmt.Errorf("line %d: invalid 'msg' regular expression: %w", node.Line, err)
+	}
+	if _, err := regexp.Compile(e.Data); err != nil {
+		return fmt.Errorf("line %d: invalid 'data' regular expression: %w", node.Line, err)
+	}
+	return nil
+}
+
+func (e *LogEntryExpectation) String() string {
+	details := []string{fmt.Sprintf("id %d", e.Id)}
+	if e.Msg != "" {
+		details = append(details, fmt.Sprintf("msg %q", e.Msg))
+	}
+	if e.Severity != "" {
+		details = append(details, fmt.Sprintf("severity %q", e.Severity))
+	}
+	if len(e.Tags) > 0 {
+		details = append(details, fmt.Sprintf("tags %q", e.Tags))
+	}
+	if e.Data != "" {
+		details = append(details, fmt.Sprintf("data %q", e.Data))
+	}
+	return strings.Join(details, ", ")
+}
+
+// Matches returns true if score meets the expectation
+func (e *ScoreExpectation) Matches(score int) bool {
+	if e.Equals != nil && score != *e.Equals {
+		return false
+	}
+	if e.Min != nil && score < *e.Min {
+		return false
+	}
+	if e.Max != nil && score > *e.Max {
+		return false
+	}
+	return true
+}
+
+func (e *ScoreExpectation) String() string {
+	if e.Equals != nil {
+		return fmt.Sprintf("%d", *e.Equals)
+	}
+	conditions := []string{}
+	if e.Min != nil {
+		conditions = append(conditions, fmt.Sprintf(">= %d", *e.Min))
+	}
+	if e.Max != nil {
+		conditions = append(conditions, fmt.Sprintf("<= %d", *e.Max))
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// StageExtensions returns the extensions of the stage with the given index of a test case.
+// The result is never nil.
+func (t *FTWTest) StageExtensions(testCase *schema.Test, stageIndex int) *StageExtensions {
+	stages := t.extensions[testCase.TestId]
+	if stageIndex < 0 || stageIndex >= len(stages) {
+		return &StageExtensions{}
+	}
+	return &stages[stageIndex]
+}
+
+// loadExtensions reads the extensions of all stages from the YAML of a test file. Must be called
+// after the test IDs have been set.
+func loadExtensions(ftwTest *FTWTest, testYaml []byte) error {
+	extensions := &ftwTestExtensions{}
+	if err := yamlv4.Unmarshal(testYaml, extensions); err != nil {
+		return err
+	}
+	ftwTest.extensions = make(map[uint][]StageExtensions, len(ftwTest.Tests))
+	for index, testExtensions := range extensions.Tests {
+		if index < len(ftwTest.Tests) {
+			ftwTest.extensions[ftwTest.Tests[index].TestId] = testExtensions.Stages
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"strings"
+	"testing"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
+)
+
+var extensionsYaml = `---
+meta:
+  author: "tester"
+rule_id: 920100
+tests:
+  - test_id: 5
+    stages:
+      - input:
+          uri: "/"
+        output:
+          log:
+            expect_ids: [920100]
+            anomaly_score:
+              inbound: 5
+              outbound:
+                min: 1
+                max: 4
+            expect_entries:
+              - id: 920100
+                msg: "^Invalid HTTP Request Line$"
+                severity: warning
+                tags: [attack-protocol, paranoia-level/1]
+                data: "REQUEST_LINE"
+              - id: 949110
+      - input:
+          uri: "/"
+          tls:
+            server_name: "bypass.example.com"
+            max_version: "1.2"
+            cipher_suites: [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256]
+            alpn: [http/1.1]
+        output:
+          status: 200
+          response_view: raw
+  - stages:
+      - input:
+          uri: "/"
+        output:
+          log:
+            anomaly_score:
+              inbound:
+                equals: 0
+`
+
+type extensionsTestSuite struct {
+	suite.Suite
+}
+
+func TestExtensionsTestSuite(t *testing.T) {
+	suite.Run(t, new(extensionsTestSuite))
+}
+
+func (s *extensionsTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *extensionsTestSuite) TestStageExtensions() {
+	ftwTest, err := GetTestFromYaml([]byte(extensionsYaml), "extensions.yaml")
+	s.Require().NoError(err)
+	s.Require().Len(ftwTest.Tests, 2)
+
+	anomalyScore := ftwTest.StageExtensions(&ftwTest.Tests[0], 0).Output.Log.AnomalyScore
+	s.Require().NotNil(anomalyScore)
+	s.Equal("5", anomalyScore.Inbound.String())
+	s.Equal(">= 1 and <= 4", anomalyScore.Outbound.String())
+
+	s.Equal([]LogEntryExpectation{
+		{
+			Id:       920100,
+			Msg:      "^Invalid HTTP Request Line$",
+			Severity: "warning",
+			Tags:     []string{"attack-protocol", "paranoia-level/1"},
+			Data:     "REQUEST_LINE",
+		},
+		{Id: 949110},
+	}, ftwTest.StageExtensions(&ftwTest.Tests[0], 0).Output.Log.ExpectEntries)
+	s.Equal(`id 920100, msg "^Invalid HTTP Request Line$", severity "warning", tags ["attack-protocol" "paranoia-level/1"], data "REQUEST_LINE"`,
+		ftwTest.StageExtensions(&ftwTest.Tests[0], 0).Output.Log.ExpectEntries[0].String())
+
+	s.Nil(ftwTest.StageExtensions(&ftwTest.Tests[0], 0).Input.TLS)
+
+	s.Nil(ftwTest.StageExtensions(&ftwTest.Tests[0], 1).Output.Log.AnomalyScore)
+	s.Equal(&config.TLSConfig{
+		ServerName:   "bypass.example.com",
+		MaxVersion:   "1.2",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		ALPN:         []string{"http/1.1"},
+	}, ftwTest.StageExtensions(&ftwTest.Tests[0], 1).Input.TLS)
+	s.Equal(RawResponseView, ftwTest.StageExtensions(&ftwTest.Tests[0], 1).Output.ResponseView)
+	s.Empty(ftwTest.StageExtensions(&ftwTest.Tests[0], 0).Output.ResponseView)
+	s.Nil(ftwTest.StageExtensions(&ftwTest.Tests[0], 2).Output.Log.AnomalyScore, "stages that don't exist have no extensions")
+
+	// the second test has the generated ID 2
+	anomalyScore = ftwTest.StageExtensions(&ftwTest.Tests[1], 0).Output.Log.AnomalyScore
+	s.Require().NotNil(anomalyScore)
+	s.Equal("0", anomalyScore.Inbound.String())
+	s.Nil(anomalyScore.Outbound)
+
+	s.Nil(ftwTest.StageExtensions(&schema.Test{TestId: 99}, 0).Output.Log.AnomalyScore)
+}
+
+func (s *extensionsTestSuite) TestInvalidScoreExpectations() {
+	tests := map[string]string{
+		"{}":                  "expected a score, or at least one of 'equals', 'min' or 'max'",
+		"{equals: 1, min: 0}": "'equals' can't be combined with 'min' or 'max'",
+		"{min: 5, max: 4}":    "'min' (5) is greater than 'max' (4)",
+		"five":                "cannot construct",
+	}
+	for value, expectedError := range tests {
+		s.Run(value, func() {
+			yaml := `---
+rule_id: 1
+tests:
+  - stages:
+      - input: {}
+        output:
+          log:
+            anomaly_score:
+              inbound: ` + value + "\n"
+			_, err := GetTestFromYaml([]byte(yaml), "invalid.yaml")
+			s.ErrorContains(err, expectedError)
+		})
+	}
+}
+
+func (s *extensionsTestSuite) TestInvalidResponseView() {
+	yaml := `---
+rule_id: 1
+tests:
+  - stages:
+      - input: {}
+        output:
+          response_view: gzip
+`
+	_, err := GetTestFromYaml([]byte(yaml), "invalid.yaml")
+	s.ErrorContains(err, `invalid 'response_view' "gzip", expected 'decoded' or 'raw'`)
+}
+
+func (s *extensionsTestSuite) TestWebSocketExtensions() {
+	yaml := `---
+rule_id: 1
+tests:
+  - stages:
+      - input:
+          websocket:
+            messages:
+              - content: "<script>"
+              - type: binary
+                encoded_content: "AAE="
+                fragments: 2
+                masking: unmasked
+        output:
+          status: 101
+          websocket:
+            receive: 2
+            received_contains: ["^echo"]
+`
+	ftwTest, err := GetTestFromYaml([]byte(yaml), "websocket.yaml")
+	s.Require().NoError(err)
+	extensions := ftwTest.StageExtensions(&ftwTest.Tests[0], 0)
+	s.Require().NotNil(extensions.Input.WebSocket)
+	s.Equal([]ftwhttp.WebSocketMessage{
+		{Content: "<script>"},
+		{Type: "binary", EncodedContent: "AAE=", Fragments: 2, Masking: ftwhttp.MaskingUnmasked},
+	}, extensions.Input.WebSocket.Messages)
+	s.Equal(&WebSocketExpectation{Receive: 2, ReceivedContains: []string{"^echo"}}, extensions.Output.WebSocket)
+}
+
+func (s *extensionsTestSuite) TestExpectErrorCategory() {
+	yaml := `---
+rule_id: 1
+tests:
+  - stages:
+      - input: {}
+        output:
+          expect_error_category: connection_reset
+`
+	ftwTest, err := GetTestFromYaml([]byte(yaml), "error.yaml")
+	s.Require().NoError(err)
+	s.Equal(ftwhttp.ConnectionResetCategory, ftwTest.StageExtensions(&ftwTest.Tests[0], 0).Output.ExpectErrorCategory)
+
+	_, err = GetTestFromYaml([]byte(strings.Replace(yaml, "connection_reset", "reset", 1)), "invalid.yaml")
+	s.ErrorContains(err, `invalid error category "reset"`)
+}
+
+func (s *extensionsTestSuite) TestInvalidWebSocketExtensions() {
+	tests := map[string]string{
+		"input: {websocket: {messages: [{type: foo}]}}":                         `invalid message type "foo"`,
+		"input: {websocket: {messages: [{masking: foo}]}}":                      `invalid masking "foo"`,
+		"input: {websocket: {messages: [{encoded_content: '!'}]}}":              "invalid encoded_content",
+		"input: {}\n        output: {websocket: {receive: -1}}":                 "'receive' must not be negative",
+		"input: {}\n        output: {websocket: {no_received_contains: ['(']}}": "invalid regular expression for received messages",
+	}
+	for value, expectedError := range tests {
+		s.Run(value, func() {
+			yaml := `---
+rule_id: 1
+tests:
+  - stages:
+      - ` + value + "\n"
+			_, err := GetTestFromYaml([]byte(yaml), "invalid.yaml")
+			s.ErrorContains(err, expectedError)
+		})
+	}
+}
+
+func (s *extensionsTestSuite) TestInvalidLogEntryExpectations() {
+	tests := map[string]string{
+		"{msg: foo}":         "the 'id' of an expected log entry is required",
+		"{id: 1, msg: '('}":  "invalid 'msg' regular expression",
+		"{id: 1, data: '['}": "invalid 'data' regular expression",
+	}
+	for value, expectedError := range tests {
+		s.Run(value, func() {
+			yaml := `---
+rule_id: 1
+tests:
+  - stages:
+      - input: {}
+        output:
+          log:
+            expect_entries:
+              - ` + value + "\n"
+			_, err := GetTestFromYaml([]byte(yaml), "invalid.yaml")
+			s.ErrorContains(err, expectedError)
+		})
+	}
+}
+
+func (s *extensionsTestSuite) TestScoreExpectationMatches() {
+	score := func(value int) *int { return &value }
+	s.True((&ScoreExpectation{Equals: score(5)}).Matches(5))
+	s.False((&ScoreExpectation{Equals: score(5)}).Matches(4))
+	s.True((&ScoreExpectation{Min: score(5)}).Matches(10))
+	s.False((&ScoreExpectation{Min: score(5)}).Matches(4))
+	s.True((&ScoreExpectation{Max: score(5)}).Matches(0))
+	s.False((&ScoreExpectation{Max: score(5)}).Matches(6))
+	s.True((&ScoreExpectation{Min: score(2), Max: score(3)}).Matches(3))
+	s.Equal(">= 2 and <= 3", (&ScoreExpectation{Min: score(2), Max: score(3)}).String())
+}
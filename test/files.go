@@ -41,6 +41,7 @@ func GetTestsFromFiles(globPattern string) ([]*FTWTest, error) {
 				filePath, err)
 			continue
 		}
+		ftwTest.FilePath = filePath
 
 		tests = append(tests, ftwTest)
 	}
@@ -75,6 +75,7 @@ func (s *filesTestSuite) TestGetTestFromYAML() {
 	for _, ft := range tests {
 		s.Equal("tester", ft.Meta.Author)
 		s.Equal("Description", ft.Meta.Description)
+		s.Equal(filename, ft.FilePath)
 
 		re := regexp.MustCompile("911100.*")
 
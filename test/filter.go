@@ -0,0 +1,32 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+
+	"github.com/coreruleset/go-ftw/v2/filter"
+)
+
+// FilterSubject returns the properties of a test case that can be matched by a filter expression.
+// The tags of the test case are combined with the tags from the file's metadata.
+func (t *FTWTest) FilterSubject(testCase *schema.Test) *filter.Subject {
+	tags := make([]string, 0, len(t.Meta.Tags)+len(testCase.Tags))
+	tags = append(tags, t.Meta.Tags...)
+	tags = append(tags, testCase.Tags...)
+
+	filePath := t.FilePath
+	if filePath == "" {
+		filePath = t.FileName
+	}
+
+	return &filter.Subject{
+		RuleId:   testCase.RuleId,
+		TestId:   testCase.TestId,
+		Tags:     tags,
+		FilePath: filePath,
+		Author:   t.Meta.Author,
+		Enabled:  t.Meta.Enabled == nil || *t.Meta.Enabled,
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"testing"
+
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type filterSubjectTestSuite struct {
+	suite.Suite
+}
+
+func TestFilterSubjectTestSuite(t *testing.T) {
+	suite.Run(t, new(filterSubjectTestSuite))
+}
+
+func (s *filterSubjectTestSuite) TestFilterSubject() {
+	disabled := false
+	ftwTest := &FTWTest{
+		FTWTest: schema.FTWTest{
+			Meta: schema.FTWTestMeta{
+				Author:  "tester",
+				Enabled: &disabled,
+				Tags:    []string{"platform-nginx"},
+			},
+			RuleId: 942100,
+		},
+		FileName: "942100.yaml",
+		FilePath: "tests/942100.yaml",
+	}
+	testCase := &schema.Test{
+		RuleId: 942100,
+		TestId: 2,
+		Tags:   []string{"paranoia-level/2"},
+	}
+
+	subject := ftwTest.FilterSubject(testCase)
+	s.Equal(uint(942100), subject.RuleId)
+	s.Equal(uint(2), subject.TestId)
+	s.Equal([]string{"platform-nginx", "paranoia-level/2"}, subject.Tags)
+	s.Equal("tests/942100.yaml", subject.FilePath)
+	s.Equal("tester", subject.Author)
+	s.False(subject.Enabled)
+	s.Equal(uint(2), subject.ParanoiaLevel())
+}
+
+func (s *filterSubjectTestSuite) TestFilterSubjectDefaults() {
+	ftwTest := &FTWTest{FileName: "942100.yaml"}
+	subject := ftwTest.FilterSubject(&schema.Test{})
+	s.True(subject.Enabled)
+	s.Equal("942100.yaml", subject.FilePath)
+	s.Empty(subject.Tags)
+}
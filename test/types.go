@@ -16,12 +16,14 @@ import (
 	"golang.org/x/exp/maps"
 
 	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/ftwhttp"
 )
 
 // ApplyInputOverride will check if config had global overrides and write that into the test.
 func ApplyInputOverrides(conf *config.RunnerConfig, input *Input) {
 	overrides := &conf.TestOverride.Overrides
 	applySimpleOverrides(overrides, input)
+	applyProtocolOverride(conf.Protocol, input)
 	applyDestAddrOverride(overrides, input)
 	applyHeadersOverride(overrides, input)
 	//nolint:staticcheck
@@ -115,6 +117,20 @@ func applySimpleOverrides(overrides *config.Overrides, input *Input) {
 	}
 }
 
+// applyProtocolOverride sets the version of the input to the protocol selected with --protocol
+func applyProtocolOverride(protocol config.Protocol, input *Input) {
+	var version string
+	switch {
+	case protocol == config.HTTP3Protocol:
+		version = ftwhttp.HTTP3Version
+	case protocol == config.HTTP1Protocol && input.GetVersion() == ftwhttp.HTTP3Version:
+		version = "HTTP/1.1"
+	default:
+		return
+	}
+	input.Version = &version
+}
+
 //nolint:staticcheck
 func applyHeadersOverride(overrides *config.Overrides, input *Input) {
 	if overrides.Headers == nil {
@@ -131,8 +147,12 @@ func postLoadTestFTWTest(ftwTest *FTWTest, fileName string) error {
 	if err := postLoadRuleId(ftwTest); err != nil {
 		return err
 	}
+	ftwTest.deprecations = make(map[uint][]string, len(ftwTest.Tests))
 	for index := 0; index < len(ftwTest.Tests); index++ {
-		postLoadTest(ftwTest.RuleId, uint(index+1), &ftwTest.Tests[index])
+		testCase := &ftwTest.Tests[index]
+		deprecatedFields := findDeprecatedFields(ftwTest, testCase)
+		postLoadTest(ftwTest.RuleId, uint(index+1), testCase)
+		ftwTest.deprecations[testCase.TestId] = deprecatedFields
 	}
 	return nil
 }
@@ -4,6 +4,7 @@
 package test
 
 import (
+	schema "github.com/coreruleset/ftw-tests-schema/v2/types"
 	yamlv4 "go.yaml.in/yaml/v4"
 )
 
@@ -18,6 +19,41 @@ func GetTestFromYaml(testYaml []byte, fileName string) (ftwTest *FTWTest, err er
 	if err := postLoadTestFTWTest(ftwTest, fileName); err != nil {
 		return nil, err
 	}
+	if err := loadExtensions(ftwTest, testYaml); err != nil {
+		return nil, err
+	}
+	if err := loadTestNodes(ftwTest, testYaml); err != nil {
+		return nil, err
+	}
 
 	return ftwTest, nil
 }
+
+// TestYaml returns the YAML of a test as it was written in the test file, including the fields
+// that go-ftw supports in addition to the test schema. Nil is returned if the test doesn't belong
+// to the file.
+func (t *FTWTest) TestYaml(testCase *schema.Test) ([]byte, error) {
+	node, ok := t.testNodes[testCase.TestId]
+	if !ok {
+		return nil, nil
+	}
+	return yamlv4.Marshal(node)
+}
+
+// loadTestNodes keeps the YAML of each test of a test file. Must be called after the test IDs
+// have been set.
+func loadTestNodes(ftwTest *FTWTest, testYaml []byte) error {
+	nodes := &struct {
+		Tests []yamlv4.Node `yaml:"tests"`
+	}{}
+	if err := yamlv4.Unmarshal(testYaml, nodes); err != nil {
+		return err
+	}
+	ftwTest.testNodes = make(map[uint]*yamlv4.Node, len(ftwTest.Tests))
+	for index := range nodes.Tests {
+		if index < len(ftwTest.Tests) {
+			ftwTest.testNodes[ftwTest.Tests[index].TestId] = &nodes.Tests[index]
+		}
+	}
+	return nil
+}
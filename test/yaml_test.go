@@ -105,3 +105,39 @@ tests:
 	s.Equal("Accept", orderedHeaders[3].Name)
 	s.Equal("*/*", orderedHeaders[3].Value)
 }
+
+func (s *yamlTestSuite) TestTestYaml() {
+	ftwTest, err := GetTestFromYaml([]byte(`---
+meta:
+  author: "tester"
+rule_id: 123456
+tests:
+  - test_id: 1
+    stages:
+      - input:
+          uri: "/first"
+  - test_id: 2
+    # the response is checked in a go-ftw extension
+    stages:
+      - input:
+          uri: "/second"
+        output:
+          response_view: raw
+`), "123456.yaml")
+	s.Require().NoError(err)
+
+	testYaml, err := ftwTest.TestYaml(&ftwTest.Tests[1])
+	s.Require().NoError(err)
+	s.Equal(`test_id: 2
+# the response is checked in a go-ftw extension
+stages:
+    - input:
+        uri: "/second"
+      output:
+        response_view: raw
+`, string(testYaml))
+
+	testYaml, err = ftwTest.TestYaml(&ftwTest.Tests[0])
+	s.Require().NoError(err)
+	s.Contains(string(testYaml), `uri: "/first"`)
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// These regexes find the anomaly scores that CRS writes to the log:
+//   - Inbound Anomaly Score Exceeded (Total Score: 5) (rule 949110)
+//   - Inbound Anomaly Score Exceeded (Total Inbound Score: 5 - SQLI=5,...) (rule 980130, CRS 3)
+//   - Outbound Anomaly Score Exceeded (score 4) (rule 980140, CRS 3)
+//   - Anomaly Scores: (Inbound Scores: blocking=5, ...) - (Outbound Scores: blocking=4, ...) (rule 980170)
+//   - tx.blocking_inbound_anomaly_score: 5, "tx.inbound_anomaly_score":"5" (audit logs)
+var (
+	inboundAnomalyScoreRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`Inbound Anomaly Score Exceeded \((?:Total (?:Inbound )?Score:|score) (\d+)`),
+		regexp.MustCompile(`Inbound Scores: blocking=(\d+)`),
+		regexp.MustCompile(`(?i)\btx\.(?:blocking_)?inbound_anomaly_score\\?"?\s*[:=]\s*\\?"?(\d+)`),
+	}
+	outboundAnomalyScoreRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`Outbound Anomaly Score Exceeded \((?:Total (?:Outbound )?Score:|score) (\d+)`),
+		regexp.MustCompile(`Outbound Scores: blocking=(\d+)`),
+		regexp.MustCompile(`(?i)\btx\.(?:blocking_)?outbound_anomaly_score\\?"?\s*[:=]\s*\\?"?(\d+)`),
+	}
+)
+
+// AnomalyScores contains the anomaly scores of a request
+type AnomalyScores struct {
+	Inbound  int `json:"inbound"`
+	Outbound int `json:"outbound"`
+}
+
+// AnomalyScores returns the highest inbound and outbound anomaly scores found in the log for the
+// current test. A score is 0 if it can't be found in the log, e.g., because no rule matched.
+func (ll *FTWLogLines) AnomalyScores() (*AnomalyScores, error) {
+	lines, err := ll.GetMarkedLines()
+	if err != nil {
+		return nil, err
+	}
+	scores := &AnomalyScores{}
+	for _, line := range lines {
+		scores.Inbound = max(scores.Inbound, findAnomalyScore(line, inboundAnomalyScoreRegexes))
+		scores.Outbound = max(scores.Outbound, findAnomalyScore(line, outboundAnomalyScoreRegexes))
+	}
+	return scores, nil
+}
+
+// findAnomalyScore returns the highest score matched by any of the regexes in line, 0 if there is none
+func findAnomalyScore(line []byte, regexes []*regexp.Regexp) int {
+	score := 0
+	for _, regex := range regexes {
+		for _, match := range regex.FindAllSubmatch(line, -1) {
+			// the regexes only match digits, but the number may still be out of range
+			value, err := strconv.Atoi(string(match[1]))
+			if err != nil {
+				continue
+			}
+			score = max(score, value)
+		}
+	}
+	return score
+}
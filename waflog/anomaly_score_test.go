@@ -0,0 +1,127 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/utils"
+)
+
+type anomalyScoreTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+func (s *anomalyScoreTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *anomalyScoreTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+}
+
+func TestAnomalyScoreTestSuite(t *testing.T) {
+	suite.Run(t, new(anomalyScoreTestSuite))
+}
+
+func (s *anomalyScoreTestSuite) newLogLines(lines ...string) *FTWLogLines {
+	startMarker, endMarker := generateLogMarkers(100000, 1)
+	startMarkerLine := "X-cRs-TeSt: " + startMarker
+	endMarkerLine := "X-cRs-TeSt: " + endMarker
+	logLines := fmt.Sprint(
+		// scores outside of the markers must be ignored
+		`[msg "Inbound Anomaly Score Exceeded (Total Score: 100)"]`, "\n",
+		startMarkerLine, "\n")
+	for _, line := range lines {
+		logLines += line + "\n"
+	}
+	logLines += endMarkerLine + "\n" + `[msg "Outbound Anomaly Score Exceeded (Total Score: 100)"]` + "\n"
+	filename, err := utils.CreateTempFileWithContent(s.tempDir, logLines, "test-errorlog-")
+	s.Require().NoError(err)
+	log, err := os.Open(filename)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = log.Close() })
+
+	ll := &FTWLogLines{
+		logFile:             log,
+		LogMarkerHeaderName: bytes.ToLower([]byte(config.DefaultLogMarkerHeaderName)),
+	}
+	ll.WithStartMarker([]byte(startMarkerLine))
+	ll.WithEndMarker([]byte(endMarkerLine))
+	return ll
+}
+
+func (s *anomalyScoreTestSuite) TestAnomalyScores() {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected AnomalyScores
+	}{
+		{
+			name:     "no scores",
+			lines:    []string{`ModSecurity: Warning. [id "920300"] [msg "Request Missing an Accept Header"]`},
+			expected: AnomalyScores{},
+		},
+		{
+			name: "blocking evaluation",
+			lines: []string{
+				`ModSecurity: Warning. Operator GE matched 5 at TX:anomaly_score. [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 8)"]`,
+				`ModSecurity: Warning. [id "959100"] [msg "Outbound Anomaly Score Exceeded (Total Score: 4)"]`,
+			},
+			expected: AnomalyScores{Inbound: 8, Outbound: 4},
+		},
+		{
+			name: "CRS 3 correlation",
+			lines: []string{
+				`[id "980130"] [msg "Inbound Anomaly Score Exceeded (Total Inbound Score: 10 - SQLI=10,XSS=0,RFI=0,LFI=0,RCE=0,PHPI=0,HTTP=0,SESS=0): individual paranoia level scores: 10, 0, 0, 0"]`,
+				`[id "980140"] [msg "Outbound Anomaly Score Exceeded (score 3): individual paranoia level scores: 3, 0, 0, 0"]`,
+			},
+			expected: AnomalyScores{Inbound: 10, Outbound: 3},
+		},
+		{
+			name: "CRS 4 reporting",
+			lines: []string{
+				`[id "980170"] [msg "Anomaly Scores: (Inbound Scores: blocking=13, detection=18, per_pl=13-5-0-0, threshold=5) - (Outbound Scores: blocking=2, detection=2, per_pl=2-0-0-0, threshold=4) - (SQLI=13, XSS=0, RFI=0, LFI=0, RCE=0, PHPI=0, HTTP=0, SESS=0, COMBINED_SCORE=13)"]`,
+			},
+			expected: AnomalyScores{Inbound: 13, Outbound: 2},
+		},
+		{
+			name: "audit log",
+			lines: []string{
+				`{"transaction":{"messages":[],"variables":{"tx.blocking_inbound_anomaly_score":"7","tx.inbound_anomaly_score_threshold":"5","tx.detection_inbound_anomaly_score":"12"}}}`,
+				`TX.outbound_anomaly_score=3 TX.outbound_anomaly_score_pl1=30`,
+			},
+			expected: AnomalyScores{Inbound: 7, Outbound: 3},
+		},
+		{
+			name: "highest score wins",
+			lines: []string{
+				`[msg "Inbound Anomaly Score Exceeded (Total Score: 5)"]`,
+				`[msg "Anomaly Scores: (Inbound Scores: blocking=15, detection=15, per_pl=15-0-0-0, threshold=5) - (Outbound Scores: blocking=0, detection=0, per_pl=0-0-0-0, threshold=4)"]`,
+			},
+			expected: AnomalyScores{Inbound: 15},
+		},
+	}
+	for _, test := range tests {
+		s.Run(test.name, func() {
+			scores, err := s.newLogLines(test.lines...).AnomalyScores()
+			s.Require().NoError(err)
+			s.Equal(test.expected, *scores)
+		})
+	}
+}
+
+func (s *anomalyScoreTestSuite) TestAnomalyScoresWithoutMarkers() {
+	ll := &FTWLogLines{}
+	_, err := ll.AnomalyScores()
+	s.ErrorContains(err, "both start and end marker must be set")
+}
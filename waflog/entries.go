@@ -0,0 +1,102 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// These regexes find the fields of error log entries written by ModSecurity and Coraza:
+//   - [msg "SQL Injection Attack"]
+//   - [msg \"SQL Injection Attack\"] (escaped quotes)
+var (
+	logFieldRegex        = regexp.MustCompile(`\[(\w+) "((?:[^"\\]|\\.)*)"\]`)
+	escapedLogFieldRegex = regexp.MustCompile(`\[(\w+) \\"(.*?)\\"\]`)
+)
+
+// severities maps the numeric severities to their names
+var severities = []string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+
+// LogEntry contains the details of a rule match found in the log
+type LogEntry struct {
+	RuleId uint   `json:"rule_id"`
+	Msg    string `json:"msg,omitempty"`
+	// Severity is the upper case name of the severity, e.g. CRITICAL
+	Severity string   `json:"severity,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Data     string   `json:"data,omitempty"`
+}
+
+// Entries returns the entries found in the log for the current test, in the order they were logged.
+// Lines without rule ID are ignored.
+func (ll *FTWLogLines) Entries() ([]*LogEntry, error) {
+	lines, err := ll.GetMarkedLines()
+	if err != nil {
+		return nil, err
+	}
+	entries := []*LogEntry{}
+	for _, line := range lines {
+		entries = append(entries, parseLogEntries(line)...)
+	}
+	return entries, nil
+}
+
+// parseLogEntries returns the entries of a single log line. Usually, there is one entry per line.
+// If a line contains more than one rule ID, the fields following an ID belong to that rule.
+func parseLogEntries(line []byte) []*LogEntry {
+	regex := logFieldRegex
+	unescape := unescapeLogValue
+	if bytes.Contains(line, []byte(`[id \"`)) {
+		regex = escapedLogFieldRegex
+		unescape = func(value string) string { return value }
+	}
+
+	entries := []*LogEntry{}
+	// fields before the first ID, such as file and line, belong to the first entry
+	pending := &LogEntry{}
+	current := pending
+	for _, match := range regex.FindAllSubmatch(line, -1) {
+		name := string(match[1])
+		value := unescape(string(match[2]))
+		switch name {
+		case "id":
+			ruleId, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				continue
+			}
+			if current == pending && current.RuleId == 0 {
+				current.RuleId = uint(ruleId)
+			} else {
+				current = &LogEntry{RuleId: uint(ruleId)}
+			}
+			entries = append(entries, current)
+		case "msg":
+			current.Msg = value
+		case "severity":
+			current.Severity = normalizeSeverity(value)
+		case "tag":
+			current.Tags = append(current.Tags, value)
+		case "data":
+			current.Data = value
+		}
+	}
+	return entries
+}
+
+func normalizeSeverity(severity string) string {
+	if level, err := strconv.Atoi(severity); err == nil && level >= 0 && level < len(severities) {
+		return severities[level]
+	}
+	return strings.ToUpper(severity)
+}
+
+func unescapeLogValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+	"github.com/coreruleset/go-ftw/v2/utils"
+)
+
+var modsecurityEntryLine = `[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. detected SQLi using libinjection with fingerprint 's&sos' [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "46"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: s&sos found within ARGS:id: 1' or \"1\"=\"1"] [severity "CRITICAL"] [ver "OWASP_CRS/3.3.0"] [tag "application-multi"] [tag "attack-sqli"] [tag "paranoia-level/1"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]`
+
+var corazaEntryLine = `[client "127.0.0.1"] Coraza: Warning. Matched "Operator ` + "`Rx'" + ` with parameter ..." [file "@owasp_crs/REQUEST-913-SCANNER-DETECTION.conf"] [line "10"] [id "913100"] [rev ""] [msg "Found User-Agent associated with security scanner"] [data "Matched Data: sqlmap found within REQUEST_HEADERS:User-Agent: sqlmap/1.7"] [severity "critical"] [ver "OWASP_CRS/4.0.0"] [maturity "0"] [accuracy "0"] [tag "attack-reputation-scanner"] [tag "paranoia-level/1"] [hostname "localhost"] [uri "/"] [unique_id "abc"]`
+
+type entriesTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+func (s *entriesTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *entriesTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+}
+
+func TestEntriesTestSuite(t *testing.T) {
+	suite.Run(t, new(entriesTestSuite))
+}
+
+func (s *entriesTestSuite) TestEntries() {
+	startMarker, endMarker := generateLogMarkers(942100, 1)
+	startMarkerLine := "X-cRs-TeSt: " + startMarker
+	endMarkerLine := "X-cRs-TeSt: " + endMarker
+	logLines := fmt.Sprint(
+		`[id "1"] [msg "before the start marker"]`, "\n",
+		startMarkerLine, "\n",
+		modsecurityEntryLine, "\n",
+		"a line without rule\n",
+		corazaEntryLine, "\n",
+		endMarkerLine, "\n")
+	filename, err := utils.CreateTempFileWithContent(s.tempDir, logLines, "test-errorlog-")
+	s.Require().NoError(err)
+	log, err := os.Open(filename)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = log.Close() })
+
+	ll := &FTWLogLines{
+		logFile:             log,
+		LogMarkerHeaderName: bytes.ToLower([]byte(config.DefaultLogMarkerHeaderName)),
+	}
+	ll.WithStartMarker([]byte(startMarkerLine))
+	ll.WithEndMarker([]byte(endMarkerLine))
+
+	entries, err := ll.Entries()
+	s.Require().NoError(err)
+	s.Equal([]*LogEntry{
+		{
+			RuleId:   942100,
+			Msg:      "SQL Injection Attack Detected via libinjection",
+			Severity: "CRITICAL",
+			Tags:     []string{"application-multi", "attack-sqli", "paranoia-level/1"},
+			Data:     `Matched Data: s&sos found within ARGS:id: 1' or "1"="1`,
+		},
+		{
+			RuleId:   913100,
+			Msg:      "Found User-Agent associated with security scanner",
+			Severity: "CRITICAL",
+			Tags:     []string{"attack-reputation-scanner", "paranoia-level/1"},
+			Data:     "Matched Data: sqlmap found within REQUEST_HEADERS:User-Agent: sqlmap/1.7",
+		},
+	}, entries)
+}
+
+func (s *entriesTestSuite) TestParseLogEntriesEscaped() {
+	line := `{"log":"ModSecurity: Warning. [file \"/rules/REQUEST-920.conf\"] [id \"920300\"] [msg \"Request Missing an Accept Header\"] [severity \"5\"] [tag \"attack-protocol\"]"}`
+	s.Equal([]*LogEntry{{
+		RuleId:   920300,
+		Msg:      "Request Missing an Accept Header",
+		Severity: "NOTICE",
+		Tags:     []string{"attack-protocol"},
+	}}, parseLogEntries([]byte(line)))
+}
+
+func (s *entriesTestSuite) TestParseLogEntriesMultipleIds() {
+	line := `[file "a.conf"] [id "1"] [msg "first"] [tag "a"] [id "2"] [msg "second"] [severity "warning"]`
+	s.Equal([]*LogEntry{
+		{RuleId: 1, Msg: "first", Tags: []string{"a"}},
+		{RuleId: 2, Msg: "second", Severity: "WARNING"},
+	}, parseLogEntries([]byte(line)))
+}
+
+func (s *entriesTestSuite) TestParseLogEntriesWithoutId() {
+	s.Empty(parseLogEntries([]byte(`[msg "no rule"] [id "abc"]`)))
+	s.Empty(parseLogEntries([]byte(`X-CRS-Test: 920100-1-start`)))
+}
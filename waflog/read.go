@@ -7,13 +7,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"regexp"
 	"strconv"
 
 	"slices"
 
-	"github.com/icza/backscanner"
 	"github.com/rs/zerolog/log"
 )
 
@@ -171,6 +169,12 @@ func (ll *FTWLogLines) GetMarkedLines() ([][]byte, error) {
 	}
 	log.Trace().Msg("Collecting marked lines")
 
+	if ll.windowClosed {
+		ll.computeWindowLines()
+		ll.markedLinesInitialized = true
+		return ll.markedLines, nil
+	}
+
 	if len(ll.startMarker) == 0 || len(ll.endMarker) == 0 {
 		return nil, errors.New("both start and end marker must be set before the log can be inspected")
 	}
@@ -187,40 +191,22 @@ func (ll *FTWLogLines) GetMarkedLines() ([][]byte, error) {
 }
 
 func (ll *FTWLogLines) computeMarkedLines() error {
-	fileInfo, err := ll.logFile.Stat()
-	if err != nil {
-		log.Error().Caller().Msg("cannot read file's size")
+	if err := ll.readNewLines(); err != nil {
 		return err
 	}
 
-	// Lines in modsec logging can be quite large
-	backscannerOptions := &backscanner.Options{
-		ChunkSize: 4096,
+	// end marker is the *last* marker in the log, start marker is the last one before it
+	end := ll.lastMarkerIndex(len(ll.lines), ll.endMarker)
+	if end < 0 {
+		log.Debug().Msg("end marker not found while collecting marked lines")
+		return nil
 	}
-	scanner := backscanner.NewOptions(ll.logFile, int(fileInfo.Size()), backscannerOptions)
-	startFound := false
-	endFound := false
-	// end marker is the *first* marker when reading backwards,
-	// start marker is the *last* marker
-	for {
-		line, _, err := scanner.LineBytes()
-		if err != nil {
-			if err != io.EOF {
-				log.Trace().Err(err)
-			}
-			break
-		}
-		lineLower := bytes.ToLower(line)
-
-		if !endFound {
-			// Skip lines until we find the end marker. Reading backwards, the lines we are looking for are
-			// between the end and start markers.
-			if bytes.Equal(lineLower, ll.endMarker) {
-				endFound = true
-			}
-			continue
-		}
-		if endFound && bytes.Equal(lineLower, ll.endMarker) {
+	start := ll.lastMarkerIndex(end, ll.startMarker)
+	if start < 0 {
+		log.Debug().Msg("start marker not found while collecting marked lines")
+	}
+	for _, line := range ll.lines[start+1 : end] {
+		if equalsMarker(line, ll.endMarker) {
 			// Found a duplicate end marker. This can happen when we force log
 			// flushing through `markAndFlush()`, where we resend the end marker until
 			// we see it in the log.
@@ -230,75 +216,131 @@ func (ll *FTWLogLines) computeMarkedLines() error {
 			// end markers.
 			log.Trace().Msg("Skipping duplicate end marker")
 			continue
-		} else if endFound && bytes.Equal(lineLower, ll.startMarker) {
-			startFound = true
-			break
 		}
-
-		saneCopy := make([]byte, len(line))
-		copy(saneCopy, line)
-		ll.markedLines = append(ll.markedLines, saneCopy)
-	}
-	if !startFound {
-		log.Debug().Msg("start marker not found while collecting marked lines")
+		ll.markedLines = append(ll.markedLines, line)
 	}
 
-	// Reverse the order to restore original log order
-	slices.Reverse(ll.markedLines)
-
 	log.Trace().Msgf("Found %d log lines: %s\n", len(ll.markedLines), bytes.Join(ll.markedLines, []byte{'\n'}))
 	return nil
 }
 
 // CheckLogForMarker reads the log file and searches for a marker line.
 // markerId is the ID of the current stage + suffix (for start / end), which is part of the marker line
-// readLimit is the maximum numbers of lines to check
+// readLimit is ignored, the log is read forwards and markers are found regardless of its size
+//
+// Deprecated: use FindMarker instead
 func (ll *FTWLogLines) CheckLogForMarker(markerId string, readLimit uint) []byte {
-	offset, err := ll.logFile.Seek(0, io.SeekEnd)
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("failed to seek end of log file")
+	return ll.FindMarker(markerId)
+}
+
+// FindMarker reads the lines appended to the log file since the last read and searches for a marker line.
+// markerId is the ID of the current stage + suffix (for start / end), which is part of the marker line
+func (ll *FTWLogLines) FindMarker(markerId string) []byte {
+	if err := ll.readNewLines(); err != nil {
+		log.Error().Caller().Err(err).Msg("failed to read log file")
 		return nil
 	}
 
-	// Lines in logging can be quite large
-	backscannerOptions := &backscanner.Options{
-		ChunkSize: 4096,
-	}
-	scanner := backscanner.NewOptions(ll.logFile, int(offset), backscannerOptions)
 	stageIDBytes := []byte(markerId)
-	crsHeaderBytes := bytes.ToLower([]byte(ll.LogMarkerHeaderName))
-
-	var line []byte
-	lineCounter := uint(0)
-	// Look for the header until EOF or `readLimit` lines at most
-	for {
-		if lineCounter > readLimit {
-			log.Debug().Msg("aborting search for marker")
-			return nil
+	for i := len(ll.markers) - 1; i >= 0; i-- {
+		line := bytes.ToLower(ll.lines[ll.markers[i]])
+		if bytes.Contains(line, stageIDBytes) {
+			return line
 		}
-		lineCounter++
+	}
+	log.Debug().Msgf("marker %s not found in the log", markerId)
+	return nil
+}
+
+// readNewLines appends the lines written to the log since the last read to the lines of the current stage
+func (ll *FTWLogLines) readNewLines() error {
+	ll.checkRotation()
+	if ll.lastLinePartial {
+		ll.truncateLines(len(ll.lines) - 1)
+		ll.lastLinePartial = false
+	}
 
-		line, _, err = scanner.LineBytes()
+	if ll.previousTail != nil {
+		// The last, incomplete line of the previous file is ignored, as the WAF doesn't write to it
+		// anymore once it has written to the new file
+		lines, _, err := ll.previousTail.readLines()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				log.Trace().Err(err).Msg("found EOF while looking for log marker")
-				return nil
-			} else {
-				log.Error().Err(err).Msg("failed to inspect next log line for marker")
-				return nil
-			}
+			return err
 		}
+		ll.appendLines(lines)
+	}
 
-		line = bytes.ToLower(line)
-		if bytes.Contains(line, crsHeaderBytes) {
-			break
+	lines, partial, err := ll.currentTail().readLines()
+	if err != nil {
+		return err
+	}
+	if ll.previousTail != nil && (len(lines) > 0 || len(partial) > 0) {
+		log.Debug().Msgf("ftw/waflog: closing log file %s from before the rotation", ll.logFilePath)
+		ll.closePreviousTail()
+	}
+	ll.appendLines(lines)
+	if len(partial) > 0 {
+		ll.appendLines([][]byte{partial})
+		ll.lastLinePartial = true
+	}
+	return nil
+}
+
+func (ll *FTWLogLines) appendLines(lines [][]byte) {
+	for _, line := range lines {
+		if isMarkerLine(line, ll.LogMarkerHeaderName) {
+			ll.markers = append(ll.markers, len(ll.lines))
 		}
+		ll.lines = append(ll.lines, line)
 	}
+}
 
-	// Found the header, now the line should also match the stage ID
-	if bytes.Contains(line, stageIDBytes) {
-		return line
+// truncateLines removes the lines from index length onwards
+func (ll *FTWLogLines) truncateLines(length int) {
+	ll.lines = ll.lines[:length]
+	for len(ll.markers) > 0 && ll.markers[len(ll.markers)-1] >= length {
+		ll.markers = ll.markers[:len(ll.markers)-1]
 	}
-	log.Debug().Msgf("found unexpected marker line while looking for %s: %s", markerId, line)
-	return nil
+}
+
+// discardLinesBefore removes the lines before the last occurrence of marker. If the marker hasn't
+// been read yet, all complete lines are removed, as they were logged before the marker.
+func (ll *FTWLogLines) discardLinesBefore(marker []byte) {
+	first := ll.lastMarkerIndex(len(ll.lines), marker)
+	if first < 0 {
+		first = len(ll.lines)
+		if ll.lastLinePartial {
+			first--
+		}
+	}
+	if first == 0 {
+		return
+	}
+	ll.lines = slices.Delete(ll.lines, 0, first)
+	markers := ll.markers[:0]
+	for _, index := range ll.markers {
+		if index >= first {
+			markers = append(markers, index-first)
+		}
+	}
+	ll.markers = markers
+}
+
+// lastMarkerIndex returns the index of the last line before index before that equals marker,
+// -1 if there is none
+func (ll *FTWLogLines) lastMarkerIndex(before int, marker []byte) int {
+	if len(marker) == 0 {
+		return -1
+	}
+	for index := before - 1; index >= 0; index-- {
+		if equalsMarker(ll.lines[index], marker) {
+			return index
+		}
+	}
+	return -1
+}
+
+// equalsMarker returns true if line is the lower case marker line
+func equalsMarker(line []byte, marker []byte) bool {
+	return len(line) == len(marker) && bytes.Equal(bytes.ToLower(line), marker)
 }
@@ -66,9 +66,9 @@ func (s *readTestSuite) TestReadCheckLogForMarkerNoMarkerAtEnd() {
 	s.T().Cleanup(func() { _ = ll.Cleanup() })
 
 	ll.WithStartMarker([]byte(startMarkerLine))
-	marker := ll.CheckLogForMarker(startMaker, 100)
+	marker := ll.FindMarker(startMaker)
 	s.Equal(string(marker), strings.ToLower(startMarkerLine), "unexpectedly missing start marker")
-	marker = ll.CheckLogForMarker(endMarker, 100)
+	marker = ll.FindMarker(endMarker)
 	s.Nil(marker, "unexpectedly found end marker")
 }
 
@@ -97,10 +97,12 @@ func (s *readTestSuite) TestReadCheckLogForMarkerWithMarkerAtEnd() {
 
 	ll.WithStartMarker([]byte(startMarkerLine))
 
-	marker := ll.CheckLogForMarker(endMarker, 100)
+	marker := ll.FindMarker(endMarker)
 	s.NotNil(marker, "no marker found")
 
 	s.Equal(marker, bytes.ToLower([]byte(endMarkerLine)), "found unexpected marker")
+	// the deprecated variant finds the same marker, the read limit is ignored
+	s.Equal(marker, ll.CheckLogForMarker(endMarker, 1))
 }
 
 // This test checks that the log lines are read correctly when the end marker is repeated multiple times.
@@ -427,7 +429,7 @@ func (s *readTestSuite) TestFTWLogLines_CheckForLogMarkerIn404() {
 	}
 	ll.WithStartMarker([]byte(startMarkerLine))
 	ll.WithEndMarker([]byte(endMarkerLine))
-	foundMarker := ll.CheckLogForMarker(endMarker, 100)
+	foundMarker := ll.FindMarker(endMarker)
 	s.Equal(strings.ToLower(endMarkerLine), strings.ToLower(string(foundMarker)))
 }
 
@@ -0,0 +1,61 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// checkRotation detects whether the log file has been rotated, i.e., replaced by a new file at the
+// same path, and reopens it. The previous file is still read until the WAF writes to the new one.
+// If the path still refers to the open file, it may have been truncated instead (e.g., by
+// logrotate's copytruncate). The tail detects that itself, by comparing the bytes it has read last.
+func (ll *FTWLogLines) checkRotation() {
+	if ll.logFile == nil || ll.logFilePath == "" {
+		return
+	}
+	openInfo, err := ll.logFile.Stat()
+	if err != nil {
+		log.Debug().Err(err).Msgf("ftw/waflog: failed to inspect log file %s", ll.logFilePath)
+		return
+	}
+	pathInfo, err := os.Stat(ll.logFilePath)
+	if err != nil {
+		// The file may have been moved away, and not yet recreated. The WAF keeps writing to
+		// the open file until it reopens the log, so there is nothing to do yet.
+		log.Debug().Err(err).Msgf("ftw/waflog: log file %s not found, it may be in the middle of a rotation", ll.logFilePath)
+		return
+	}
+	if os.SameFile(openInfo, pathInfo) {
+		return
+	}
+
+	file, err := os.Open(ll.logFilePath)
+	if err != nil {
+		log.Debug().Err(err).Msgf("ftw/waflog: failed to reopen rotated log file %s", ll.logFilePath)
+		return
+	}
+	log.Debug().Msgf("ftw/waflog: log file %s was rotated, reopening", ll.logFilePath)
+	ll.closePreviousTail()
+	ll.previousTail = ll.currentTail()
+	ll.logFile = file
+	ll.tail = newLogTail(file, 0)
+}
+
+// currentTail returns the tail of the current log file
+func (ll *FTWLogLines) currentTail() *logTail {
+	if ll.tail == nil || ll.tail.file != ll.logFile {
+		ll.tail = newLogTail(ll.logFile, 0)
+	}
+	return ll.tail
+}
+
+func (ll *FTWLogLines) closePreviousTail() {
+	if ll.previousTail != nil {
+		_ = ll.previousTail.file.Close()
+		ll.previousTail = nil
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+const rotationTestRuleLine = `[client 127.0.0.1] ModSecurity: Warning. [id "920300"] [msg "Request Missing an Accept Header"]`
+
+type rotationTestSuite struct {
+	suite.Suite
+	logFilePath string
+	ll          *FTWLogLines
+}
+
+func (s *rotationTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *rotationTestSuite) SetupTest() {
+	s.logFilePath = filepath.Join(s.T().TempDir(), "error.log")
+	s.writeLog("first line\n")
+
+	cfg := config.NewDefaultConfig()
+	cfg.LogFile = s.logFilePath
+	ll, err := NewFTWLogLines(config.NewRunnerConfiguration(cfg))
+	s.Require().NoError(err)
+	s.ll = ll
+	s.T().Cleanup(func() { _ = s.ll.Cleanup() })
+}
+
+func TestRotationTestSuite(t *testing.T) {
+	suite.Run(t, new(rotationTestSuite))
+}
+
+func (s *rotationTestSuite) writeLog(content string) {
+	s.Require().NoError(os.WriteFile(s.logFilePath, []byte(content), 0644))
+}
+
+func (s *rotationTestSuite) appendLog(content string) {
+	file, err := os.OpenFile(s.logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	s.Require().NoError(err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	s.Require().NoError(err)
+}
+
+// rotate moves the log file away and creates a new, empty one, like logrotate's default mode
+func (s *rotationTestSuite) rotate() {
+	s.Require().NoError(os.Rename(s.logFilePath, s.logFilePath+".1"))
+	s.writeLog("")
+}
+
+func (s *rotationTestSuite) markers() (string, string, string, string) {
+	startMarker, endMarker := generateLogMarkers(920300, 1)
+	return startMarker, endMarker, "X-cRs-TeSt: " + startMarker, "X-cRs-TeSt: " + endMarker
+}
+
+func (s *rotationTestSuite) TestMarkerFoundAfterRotation() {
+	startMarker, _, startMarkerLine, _ := s.markers()
+	s.rotate()
+	s.appendLog(startMarkerLine + "\n")
+
+	marker := s.ll.FindMarker(startMarker)
+	s.Equal(strings.ToLower(startMarkerLine), string(marker))
+	s.Nil(s.ll.previousTail, "the rotated log file should be closed once the WAF writes to the new file")
+}
+
+func (s *rotationTestSuite) TestMarkedLinesAfterRotation() {
+	_, _, startMarkerLine, endMarkerLine := s.markers()
+	s.rotate()
+	s.appendLog(startMarkerLine + "\n" + rotationTestRuleLine + "\n" + endMarkerLine + "\n")
+
+	s.ll.WithStartMarker([]byte(startMarkerLine))
+	s.ll.WithEndMarker([]byte(endMarkerLine))
+	rules, err := s.ll.TriggeredRules()
+	s.Require().NoError(err)
+	s.Equal([]uint{920300}, rules)
+	s.Nil(s.ll.previousTail)
+}
+
+func (s *rotationTestSuite) TestMarkedLinesAcrossRotation() {
+	startMarker, _, startMarkerLine, endMarkerLine := s.markers()
+	s.appendLog(startMarkerLine + "\n" + rotationTestRuleLine + "\n")
+	s.NotNil(s.ll.FindMarker(startMarker))
+
+	s.rotate()
+	s.appendLog(`[client 127.0.0.1] ModSecurity: Warning. [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 5)"]` + "\n" + endMarkerLine + "\n")
+
+	s.ll.WithStartMarker([]byte(startMarkerLine))
+	s.ll.WithEndMarker([]byte(endMarkerLine))
+	lines, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Require().Len(lines, 2)
+	s.Contains(string(lines[0]), "920300", "lines should be in log order")
+	s.Contains(string(lines[1]), "949110")
+}
+
+func (s *rotationTestSuite) TestMarkerInPreviousLogFile() {
+	startMarker, _, startMarkerLine, _ := s.markers()
+	// rotated, but the WAF still writes to the old file
+	s.Require().NoError(os.Rename(s.logFilePath, s.logFilePath+".1"))
+	s.writeLog("")
+	s.ll.checkRotation()
+	oldFile, err := os.OpenFile(s.logFilePath+".1", os.O_APPEND|os.O_WRONLY, 0644)
+	s.Require().NoError(err)
+	defer oldFile.Close()
+	_, err = oldFile.WriteString(startMarkerLine + "\n")
+	s.Require().NoError(err)
+
+	marker := s.ll.FindMarker(startMarker)
+	s.Equal(strings.ToLower(startMarkerLine), string(marker))
+	s.NotNil(s.ll.previousTail, "the rotated log file should be kept until the WAF writes to the new file")
+}
+
+func (s *rotationTestSuite) TestLinesOfPreviousStageDiscarded() {
+	_, _, startMarkerLine, endMarkerLine := s.markers()
+	s.appendLog(rotationTestRuleLine + "\n")
+	s.Require().NoError(s.ll.readNewLines())
+	// the start marker hasn't been read yet, so all lines read so far precede it
+	s.ll.WithStartMarker([]byte(startMarkerLine))
+	s.rotate()
+	s.appendLog(endMarkerLine + "\n")
+
+	s.ll.WithEndMarker([]byte(endMarkerLine))
+	lines, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Empty(lines)
+}
+
+func (s *rotationTestSuite) TestMarkerFoundAfterTruncation() {
+	s.appendLog(strings.Repeat("some older log line\n", 100))
+	s.Require().NoError(s.ll.readNewLines())
+	s.Greater(s.ll.tail.offset, int64(1000))
+
+	startMarker, _, startMarkerLine, _ := s.markers()
+	// copytruncate: the file keeps its inode, but starts over
+	s.Require().NoError(os.Truncate(s.logFilePath, 0))
+	s.appendLog(startMarkerLine + "\n")
+
+	marker := s.ll.FindMarker(startMarker)
+	s.Equal(strings.ToLower(startMarkerLine), string(marker))
+	s.Equal(int64(len(startMarkerLine)+1), s.ll.tail.offset)
+	s.Nil(s.ll.previousTail)
+}
+
+func (s *rotationTestSuite) TestMarkerFoundAfterTruncationBeyondOffset() {
+	s.appendLog(strings.Repeat("some older log line\n", 10))
+	s.Require().NoError(s.ll.readNewLines())
+
+	startMarker, _, startMarkerLine, _ := s.markers()
+	// copytruncate, and the WAF writes more than before until the log is read again, so that the
+	// marker is before the previous offset
+	s.Require().NoError(os.Truncate(s.logFilePath, 0))
+	s.appendLog(startMarkerLine + "\n" + strings.Repeat(rotationTestRuleLine+"\n", 10))
+	s.Require().Less(int64(len(startMarkerLine)), s.ll.tail.offset)
+
+	marker := s.ll.FindMarker(startMarker)
+	s.Equal(strings.ToLower(startMarkerLine), string(marker))
+	s.Nil(s.ll.previousTail)
+}
+
+func (s *rotationTestSuite) TestMissingLogFileKeepsHandle() {
+	startMarker, _, startMarkerLine, _ := s.markers()
+	s.appendLog(startMarkerLine + "\n")
+	s.Require().NoError(os.Rename(s.logFilePath, s.logFilePath+".1"))
+
+	marker := s.ll.FindMarker(startMarker)
+	s.Equal(strings.ToLower(startMarkerLine), string(marker))
+	s.Nil(s.ll.previousTail)
+}
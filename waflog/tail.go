@@ -0,0 +1,143 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/icza/backscanner"
+	"github.com/rs/zerolog/log"
+)
+
+// tailBufferSize is the maximum size of the read buffer, longer lines are still read completely
+const tailBufferSize = 64 * 1024
+
+// tailSignatureSize is the maximum number of bytes before the offset that are kept to detect
+// whether the file has been truncated and written again
+const tailSignatureSize = 64
+
+// logTail reads a log file forwards, continuing where the previous read stopped, so that every
+// byte of the log is only read once
+type logTail struct {
+	file *os.File
+	// offset is the position of the first byte that has not been read as part of a complete line
+	offset int64
+	// signature contains the bytes that precede offset. If they have changed, the file has been
+	// truncated (e.g., by logrotate's copytruncate), even if it has grown beyond offset since.
+	signature []byte
+}
+
+func newLogTail(file *os.File, offset int64) *logTail {
+	tail := &logTail{file: file, offset: offset}
+	tail.saveSignature()
+	return tail
+}
+
+// readLines returns the complete lines appended to the file since the last call, without the
+// trailing new line. An incomplete last line is returned separately, it will be read again
+// once it has been completed. If the file has been truncated, it is read from the beginning.
+func (t *logTail) readLines() ([][]byte, []byte, error) {
+	fileInfo, err := t.file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fileInfo.Size()
+	truncated, err := t.truncated(size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if truncated {
+		log.Debug().Msgf("ftw/waflog: log file %s was truncated, reading %d bytes from the beginning", t.file.Name(), size)
+		t.offset = 0
+		t.signature = nil
+	}
+	if size == t.offset {
+		return nil, nil, nil
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(t.file, t.offset, size-t.offset), int(min(size-t.offset, tailBufferSize)))
+	lines := [][]byte{}
+	defer func() {
+		if len(lines) > 0 {
+			t.saveSignature()
+		}
+	}()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return lines, line, nil
+		}
+		if err != nil {
+			return lines, nil, err
+		}
+		t.offset += int64(len(line))
+		lines = append(lines, line[:len(line)-1])
+	}
+}
+
+// truncated returns true if the file is smaller than the offset, or if the bytes before the offset
+// are not the ones that were read
+func (t *logTail) truncated(size int64) (bool, error) {
+	if size < t.offset {
+		return true, nil
+	}
+	if len(t.signature) == 0 {
+		return false, nil
+	}
+	current := make([]byte, len(t.signature))
+	if _, err := t.file.ReadAt(current, t.offset-int64(len(current))); err != nil {
+		return false, err
+	}
+	return !bytes.Equal(current, t.signature), nil
+}
+
+// saveSignature keeps the bytes before the offset, up to tailSignatureSize
+func (t *logTail) saveSignature() {
+	start := max(t.offset-tailSignatureSize, 0)
+	signature := make([]byte, t.offset-start)
+	if _, err := t.file.ReadAt(signature, start); err != nil {
+		log.Debug().Err(err).Msgf("ftw/waflog: failed to read log file %s, truncation is only detected if the file shrinks", t.file.Name())
+		signature = nil
+	}
+	t.signature = signature
+}
+
+// backlogOffset returns the offset of the start of the last lineCount lines of file
+func backlogOffset(file *os.File, lineCount uint) (int64, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := fileInfo.Size()
+	scanner := backscanner.NewOptions(file, int(offset), &backscanner.Options{ChunkSize: 4096})
+	// the last line is empty if the file ends with a new line
+	for count := uint(0); count <= lineCount; count++ {
+		line, position, err := scanner.LineBytes()
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset = int64(position)
+		if count == 0 && len(line) > 0 {
+			// the file doesn't end with a new line, the incomplete line counts
+			count++
+		}
+	}
+	return offset, nil
+}
+
+// isMarkerLine returns true if line contains the lower case header name of the log markers. Without
+// header name, every line could be a marker.
+func isMarkerLine(line []byte, headerName []byte) bool {
+	if len(headerName) == 0 {
+		return true
+	}
+	return bytes.Contains(bytes.ToLower(line), headerName)
+}
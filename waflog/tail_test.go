@@ -0,0 +1,290 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+type tailTestSuite struct {
+	suite.Suite
+	logFilePath string
+	logFile     *os.File
+}
+
+func (s *tailTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *tailTestSuite) SetupTest() {
+	s.logFilePath = filepath.Join(s.T().TempDir(), "error.log")
+	s.Require().NoError(os.WriteFile(s.logFilePath, nil, 0644))
+	var err error
+	s.logFile, err = os.Open(s.logFilePath)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = s.logFile.Close() })
+}
+
+func TestTailTestSuite(t *testing.T) {
+	suite.Run(t, new(tailTestSuite))
+}
+
+func (s *tailTestSuite) appendLog(content string) {
+	file, err := os.OpenFile(s.logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	s.Require().NoError(err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	s.Require().NoError(err)
+}
+
+func (s *tailTestSuite) readLines(tail *logTail) ([]string, string) {
+	lines, partial, err := tail.readLines()
+	s.Require().NoError(err)
+	result := []string{}
+	for _, line := range lines {
+		result = append(result, string(line))
+	}
+	return result, string(partial)
+}
+
+func (s *tailTestSuite) TestReadLinesOnlyReadsAppendedLines() {
+	tail := newLogTail(s.logFile, 0)
+	s.appendLog("line 1\nline 2\n")
+	lines, partial := s.readLines(tail)
+	s.Equal([]string{"line 1", "line 2"}, lines)
+	s.Empty(partial)
+
+	lines, _ = s.readLines(tail)
+	s.Empty(lines)
+
+	s.appendLog("line 3\n")
+	lines, _ = s.readLines(tail)
+	s.Equal([]string{"line 3"}, lines)
+}
+
+func (s *tailTestSuite) TestReadLinesIncompleteLine() {
+	tail := newLogTail(s.logFile, 0)
+	s.appendLog("line 1\nline")
+	lines, partial := s.readLines(tail)
+	s.Equal([]string{"line 1"}, lines)
+	s.Equal("line", partial)
+
+	s.appendLog(" 2\n")
+	lines, partial = s.readLines(tail)
+	s.Equal([]string{"line 2"}, lines)
+	s.Empty(partial)
+}
+
+func (s *tailTestSuite) TestReadLinesAfterTruncation() {
+	tail := newLogTail(s.logFile, 0)
+	s.appendLog("line 1\nline 2\n")
+	s.readLines(tail)
+
+	s.Require().NoError(os.Truncate(s.logFilePath, 0))
+	s.appendLog("line 3\n")
+	lines, _ := s.readLines(tail)
+	s.Equal([]string{"line 3"}, lines)
+}
+
+func (s *tailTestSuite) TestReadLinesAfterTruncationBeyondOffset() {
+	tail := newLogTail(s.logFile, 0)
+	s.appendLog("line 1\nline 2\n")
+	s.readLines(tail)
+
+	// the file grows beyond the previous offset before it is read again
+	s.Require().NoError(os.Truncate(s.logFilePath, 0))
+	s.appendLog("line 3 is longer\nline 4\n")
+	lines, _ := s.readLines(tail)
+	s.Equal([]string{"line 3 is longer", "line 4"}, lines)
+
+	s.appendLog("line 5\n")
+	lines, _ = s.readLines(tail)
+	s.Equal([]string{"line 5"}, lines)
+}
+
+func (s *tailTestSuite) TestReadLinesAfterTruncationToSameSize() {
+	tail := newLogTail(s.logFile, 0)
+	s.appendLog("line 1\n")
+	s.readLines(tail)
+
+	s.Require().NoError(os.Truncate(s.logFilePath, 0))
+	s.appendLog("line 2\n")
+	lines, _ := s.readLines(tail)
+	s.Equal([]string{"line 2"}, lines)
+}
+
+func (s *tailTestSuite) TestReadLinesAfterTruncationFromBacklogOffset() {
+	s.appendLog("line 1\nline 2\n")
+	tail := newLogTail(s.logFile, int64(len("line 1\n")))
+
+	s.Require().NoError(os.Truncate(s.logFilePath, 0))
+	s.appendLog("line 3 replaces both\n")
+	lines, _ := s.readLines(tail)
+	s.Equal([]string{"line 3 replaces both"}, lines)
+}
+
+func (s *tailTestSuite) TestBacklogOffset() {
+	s.appendLog("line 1\nline 2\nline 3\n")
+	tests := []struct {
+		lineCount uint
+		expected  int64
+	}{
+		{0, 21},
+		{1, 14},
+		{2, 7},
+		{3, 0},
+		{10, 0},
+	}
+	for _, tt := range tests {
+		s.Run(fmt.Sprint(tt.lineCount), func() {
+			offset, err := backlogOffset(s.logFile, tt.lineCount)
+			s.Require().NoError(err)
+			s.Equal(tt.expected, offset)
+		})
+	}
+}
+
+func (s *tailTestSuite) TestBacklogOffsetIncompleteLastLine() {
+	s.appendLog("line 1\nline 2\nline")
+	offset, err := backlogOffset(s.logFile, 2)
+	s.Require().NoError(err)
+	s.Equal(int64(7), offset)
+}
+
+func (s *tailTestSuite) TestBacklogOffsetEmptyFile() {
+	offset, err := backlogOffset(s.logFile, 10)
+	s.Require().NoError(err)
+	s.Equal(int64(0), offset)
+}
+
+func (s *tailTestSuite) TestMarkerBeyondBacklog() {
+	cfg := config.NewDefaultConfig()
+	cfg.LogFile = s.logFilePath
+	cfg.LogBacklogLines = 10
+	ll, err := NewFTWLogLines(config.NewRunnerConfiguration(cfg))
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = ll.Cleanup() })
+
+	startMarker, endMarker := generateLogMarkers(920300, 1)
+	startMarkerLine := "X-cRs-TeSt: " + startMarker
+	endMarkerLine := "X-cRs-TeSt: " + endMarker
+	// many more lines than the backlog are logged after the marker, e.g., by other clients
+	s.appendLog(startMarkerLine + "\n" + strings.Repeat(rotationTestRuleLine+"\n", 1000) + endMarkerLine + "\n")
+
+	s.Equal(strings.ToLower(startMarkerLine), string(ll.FindMarker(startMarker)))
+	ll.WithStartMarker([]byte(startMarkerLine))
+	s.Equal(strings.ToLower(endMarkerLine), string(ll.FindMarker(endMarker)))
+	ll.WithEndMarker([]byte(endMarkerLine))
+
+	lines, err := ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Len(lines, 1000)
+}
+
+func (s *tailTestSuite) TestLinesOfPreviousStagesDiscarded() {
+	ll := &FTWLogLines{
+		logFile:             s.logFile,
+		LogMarkerHeaderName: []byte("x-crs-test"),
+	}
+	for stage := range 3 {
+		startMarker, endMarker := generateLogMarkers(920300, uint(stage))
+		s.appendLog("X-CRS-Test: " + startMarker + "\n" + rotationTestRuleLine + "\n")
+		s.NotNil(ll.FindMarker(startMarker))
+		ll.WithStartMarker([]byte("X-CRS-Test: " + startMarker))
+		s.appendLog("X-CRS-Test: " + endMarker + "\n")
+		s.NotNil(ll.FindMarker(endMarker))
+		ll.WithEndMarker([]byte("X-CRS-Test: " + endMarker))
+
+		lines, err := ll.GetMarkedLines()
+		s.Require().NoError(err)
+		s.Len(lines, 1)
+		s.Len(ll.lines, 3, "only the lines of the current stage should be kept")
+	}
+}
+
+// writeSyntheticLog writes a log file with lineCount lines of a typical size
+func writeSyntheticLog(b *testing.B, lineCount int) string {
+	b.Helper()
+	logFilePath := filepath.Join(b.TempDir(), "error.log")
+	file, err := os.Create(logFilePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	line := `[Tue Jan 05 02:21:09.637731 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] ModSecurity: Warning. Match of "pm AppleWebKit Android" against "REQUEST_HEADERS:User-Agent" required. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-920-PROTOCOL-ENFORCEMENT.conf"] [line "1230"] [id "920300"] [msg "Request Missing an Accept Header"] [severity "NOTICE"] [hostname "localhost"] [uri "/"]` + "\n"
+	for range lineCount {
+		if _, err := file.WriteString(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return logFilePath
+}
+
+func benchmarkStages(b *testing.B, lineCount int) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	logFilePath := writeSyntheticLog(b, lineCount)
+	cfg := config.NewDefaultConfig()
+	cfg.LogFile = logFilePath
+	ll, err := NewFTWLogLines(config.NewRunnerConfiguration(cfg))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ll.Cleanup()
+	writer, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer writer.Close()
+
+	for i := 0; b.Loop(); i++ {
+		startMarker, endMarker := generateLogMarkers(920300, uint(i))
+		_, _ = writer.WriteString("X-CRS-Test: " + startMarker + "\n")
+		if ll.FindMarker(startMarker) == nil {
+			b.Fatal("start marker not found")
+		}
+		ll.WithStartMarker([]byte("X-CRS-Test: " + startMarker))
+		_, _ = writer.WriteString(rotationTestRuleLine + "\nX-CRS-Test: " + endMarker + "\n")
+		if ll.FindMarker(endMarker) == nil {
+			b.Fatal("end marker not found")
+		}
+		ll.WithEndMarker([]byte("X-CRS-Test: " + endMarker))
+		if _, err := ll.TriggeredRules(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The cost of a stage must not depend on the size of the log
+func BenchmarkStageSmallLog(b *testing.B) {
+	benchmarkStages(b, 1000)
+}
+
+func BenchmarkStageLargeLog(b *testing.B) {
+	benchmarkStages(b, 500000)
+}
+
+func BenchmarkOpenLargeLog(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	logFilePath := writeSyntheticLog(b, 500000)
+	cfg := config.NewDefaultConfig()
+	cfg.LogFile = logFilePath
+	runnerConfig := config.NewRunnerConfiguration(cfg)
+
+	for b.Loop() {
+		ll, err := NewFTWLogLines(runnerConfig)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = ll.Cleanup()
+	}
+}
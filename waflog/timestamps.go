@@ -0,0 +1,65 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"regexp"
+	"time"
+)
+
+// timestampFormat is a timestamp format found in WAF logs. The first group of regex matches the
+// fractional seconds, if present.
+type timestampFormat struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+// timestampFormats are the supported timestamp formats. Timestamps without time zone are in the
+// local time zone.
+var timestampFormats = []timestampFormat{
+	// Apache error log: [Tue Jan 05 02:21:09.637165 2021], ModSecurity v3 JSON audit log: Tue Jan  5 02:21:09 2021
+	{
+		regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ \d]\d \d{2}:\d{2}:\d{2}(\.\d+)? \d{4}`),
+		"Mon Jan _2 15:04:05 2006",
+	},
+	// nginx error log and Coraza audit log: 2021/01/05 02:21:09
+	{
+		regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?`),
+		"2006/01/02 15:04:05",
+	},
+	// RFC 3339: 2021-01-05T02:21:09.637165Z
+	{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(?:Z|[+-]\d{2}:\d{2})`),
+		time.RFC3339,
+	},
+	// Apache access log and ModSecurity v2 audit log: [05/Jan/2021:02:21:09.637165 +0000]
+	{
+		regexp.MustCompile(`\d{2}/(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)/\d{4}:\d{2}:\d{2}:\d{2}(\.\d+)? [+-]\d{4}`),
+		"02/Jan/2006:15:04:05 -0700",
+	},
+}
+
+// parseTimestamp returns the first timestamp of line and its precision, e.g. one second if the
+// timestamp has no fractional seconds. ok is false if the line has no timestamp.
+func parseTimestamp(line []byte) (timestamp time.Time, precision time.Duration, ok bool) {
+	first := -1
+	for _, format := range timestampFormats {
+		match := format.regex.FindSubmatchIndex(line)
+		if match == nil || (first >= 0 && match[0] >= first) {
+			continue
+		}
+		parsed, err := time.ParseInLocation(format.layout, string(line[match[0]:match[1]]), time.Local)
+		if err != nil {
+			continue
+		}
+		first = match[0]
+		timestamp = parsed
+		precision = time.Second
+		// match[2:4] is the fraction including the dot
+		for digits := match[3] - match[2] - 1; digits > 0 && precision > time.Nanosecond; digits-- {
+			precision /= 10
+		}
+	}
+	return timestamp, precision, first >= 0
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type timestampsTestSuite struct {
+	suite.Suite
+}
+
+func TestTimestampsTestSuite(t *testing.T) {
+	suite.Run(t, new(timestampsTestSuite))
+}
+
+func (s *timestampsTestSuite) TestParseTimestamp() {
+	tests := []struct {
+		name      string
+		line      string
+		timestamp time.Time
+		precision time.Duration
+	}{
+		{
+			"apache error log",
+			`[Tue Jan 05 02:21:09.637165 2021] [security2:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] ModSecurity: Warning. [id "920300"]`,
+			time.Date(2021, time.January, 5, 2, 21, 9, 637165000, time.Local),
+			time.Microsecond,
+		},
+		{
+			"modsecurity v3 json audit log",
+			`{"transaction":{"client_ip":"172.23.0.1","time_stamp":"Tue Jan  5 02:21:09 2021","server_id":"abc"}}`,
+			time.Date(2021, time.January, 5, 2, 21, 9, 0, time.Local),
+			time.Second,
+		},
+		{
+			"nginx error log",
+			`2021/01/05 02:21:09 [info] 33#33: *2 ModSecurity: Warning. [id "920300"]`,
+			time.Date(2021, time.January, 5, 2, 21, 9, 0, time.Local),
+			time.Second,
+		},
+		{
+			"rfc 3339",
+			`{"level":"error","ts":"2021-01-05T02:21:09.637Z","msg":"[id \"920300\"]"}`,
+			time.Date(2021, time.January, 5, 2, 21, 9, 637000000, time.UTC),
+			time.Millisecond,
+		},
+		{
+			"modsecurity v2 audit log",
+			`[05/Jan/2021:02:21:09.637165 +0100] YAbc 172.23.0.1 58998 172.23.0.2 80`,
+			time.Date(2021, time.January, 5, 1, 21, 9, 637165000, time.UTC),
+			time.Microsecond,
+		},
+		{
+			"first timestamp is used",
+			`2021/01/05 02:21:09 [error] request header "If-Modified-Since: Tue Jan  5 01:00:00 2021"`,
+			time.Date(2021, time.January, 5, 2, 21, 9, 0, time.Local),
+			time.Second,
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			timestamp, precision, ok := parseTimestamp([]byte(tt.line))
+			s.Require().True(ok)
+			s.True(tt.timestamp.Equal(timestamp), "expected %s, got %s", tt.timestamp, timestamp)
+			s.Equal(tt.precision, precision)
+		})
+	}
+}
+
+func (s *timestampsTestSuite) TestParseTimestampMissing() {
+	_, _, ok := parseTimestamp([]byte(rotationTestRuleLine))
+	s.False(ok)
+}
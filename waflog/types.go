@@ -8,14 +8,29 @@ import (
 	"os"
 	"regexp"
 	"slices"
+	"time"
 
 	"github.com/coreruleset/go-ftw/v2/config"
 )
 
 // FTWLogLines represents the filename to search for logs in a certain timespan
 type FTWLogLines struct {
-	logFilePath               string
-	logFile                   *os.File
+	logFilePath string
+	logFile     *os.File
+	// tail reads logFile forwards, it is created on first use if not set
+	tail *logTail
+	// previousTail reads the log file before the last rotation. The WAF may still write to it
+	// until it reopens the log file, so it is kept until the WAF writes to the new log file.
+	previousTail *logTail
+	// backlogLines is the number of lines at the end of the log file that are read when the
+	// log file is opened
+	backlogLines uint
+	// lines contains the lines read since the start of the current stage (start marker or window). If
+	// lastLinePartial is true, the last line is incomplete and is replaced on the next read.
+	lines           [][]byte
+	lastLinePartial bool
+	// markers contains the indexes of the lines in lines that contain the marker header name
+	markers                   []int
 	LogMarkerHeaderName       []byte
 	startMarker               []byte
 	endMarker                 []byte
@@ -23,8 +38,18 @@ type FTWLogLines struct {
 	markedLines               [][]byte
 	markedLinesInitialized    bool
 	triggeredRulesInitialized bool
-	runMode                   config.RunMode
-	customLogIdRegex          *regexp.Regexp
+	// windowClosed is true if the lines of the current stage were collected with OpenWindow and
+	// CloseWindow instead of markers. The window contains lines[:windowEnd].
+	windowClosed bool
+	windowEnd    int
+	// correlationId restricts the lines of the window to the lines containing it, if set
+	correlationId []byte
+	// timeWindowFrom and timeWindowTo restrict the lines of the window to the lines with a timestamp
+	// in between, if set
+	timeWindowFrom   time.Time
+	timeWindowTo     time.Time
+	runMode          config.RunMode
+	customLogIdRegex *regexp.Regexp
 }
 
 func (ll *FTWLogLines) StartMarker() []byte {
@@ -42,4 +67,9 @@ func (ll *FTWLogLines) reset() {
 	ll.markedLines = slices.Delete(ll.markedLines, 0, len(ll.markedLines))
 	ll.markedLinesInitialized = false
 	ll.triggeredRulesInitialized = false
+	ll.windowClosed = false
+	ll.windowEnd = 0
+	ll.correlationId = nil
+	ll.timeWindowFrom = time.Time{}
+	ll.timeWindowTo = time.Time{}
 }
@@ -22,6 +22,7 @@ func NewFTWLogLines(cfg *config.RunnerConfig) (*FTWLogLines, error) {
 	}
 	ll := &FTWLogLines{
 		logFilePath:         cfg.LogFilePath,
+		backlogLines:        cfg.LogBacklogLines,
 		runMode:             cfg.RunMode,
 		LogMarkerHeaderName: bytes.ToLower([]byte(cfg.LogMarkerHeaderName)),
 		customLogIdRegex:    customLogIdRegex,
@@ -38,10 +39,12 @@ func NewFTWLogLines(cfg *config.RunnerConfig) (*FTWLogLines, error) {
 	return ll, nil
 }
 
-// WithStartMarker resets the internal state of the log file checker and sets the start marker for the log file
+// WithStartMarker resets the internal state of the log file checker and sets the start marker for the log file.
+// Lines read before the start marker are discarded.
 func (ll *FTWLogLines) WithStartMarker(marker []byte) {
 	ll.reset()
 	ll.startMarker = bytes.ToLower(marker)
+	ll.discardLinesBefore(ll.startMarker)
 }
 
 // WithEndMarker sets the end marker for the log file
@@ -60,7 +63,11 @@ func (ll *FTWLogLines) WithCustomLogIdRegex(regex string) error {
 
 // Cleanup closes the log file
 func (ll *FTWLogLines) Cleanup() error {
-	if ll != nil && ll.logFile != nil {
+	if ll == nil {
+		return nil
+	}
+	ll.closePreviousTail()
+	if ll.logFile != nil {
 		return ll.logFile.Close()
 	}
 	return nil
@@ -70,9 +77,17 @@ func (ll *FTWLogLines) openLogFile() error {
 	// Using a log file is not required in cloud mode
 	if ll.runMode == config.DefaultRunMode {
 		if ll.logFilePath != "" && ll.logFile == nil {
-			var err error
-			ll.logFile, err = os.Open(ll.logFilePath)
-			return err
+			file, err := os.Open(ll.logFilePath)
+			if err != nil {
+				return err
+			}
+			offset, err := backlogOffset(file, ll.backlogLines)
+			if err != nil {
+				_ = file.Close()
+				return err
+			}
+			ll.logFile = file
+			ll.tail = newLogTail(file, offset)
 		}
 	}
 	return nil
@@ -0,0 +1,84 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OpenWindow resets the internal state of the log file checker and starts collecting the log lines
+// of the current stage. Lines written before the window is opened are discarded. This is the
+// alternative to marker lines, see WithStartMarker.
+func (ll *FTWLogLines) OpenWindow() error {
+	ll.reset()
+	if err := ll.readNewLines(); err != nil {
+		return err
+	}
+	// without marker, all complete lines precede the window
+	ll.discardLinesBefore(nil)
+	return nil
+}
+
+// CloseWindow stops collecting the log lines of the current stage. Only the lines written between
+// OpenWindow and CloseWindow are inspected. An incomplete last line is not part of the window.
+func (ll *FTWLogLines) CloseWindow() error {
+	if err := ll.readNewLines(); err != nil {
+		return err
+	}
+	ll.windowEnd = len(ll.lines)
+	if ll.lastLinePartial {
+		ll.windowEnd--
+	}
+	ll.windowClosed = true
+	return nil
+}
+
+// WithCorrelationId restricts the lines of the window to the lines containing id, ignoring case.
+// All lines of the window are inspected if id is empty.
+func (ll *FTWLogLines) WithCorrelationId(id []byte) {
+	ll.correlationId = bytes.ToLower(id)
+}
+
+// WithTimeWindow restricts the lines of the window to the lines with a timestamp between from and to.
+// Lines without timestamp are excluded. All lines of the window are inspected if from and to are zero.
+func (ll *FTWLogLines) WithTimeWindow(from time.Time, to time.Time) {
+	ll.timeWindowFrom = from
+	ll.timeWindowTo = to
+}
+
+// Correlated returns true if the lines of the current stage can be inspected, i.e., if both markers
+// are set or the window has been closed
+func (ll *FTWLogLines) Correlated() bool {
+	return ll.windowClosed || (len(ll.startMarker) > 0 && len(ll.endMarker) > 0)
+}
+
+func (ll *FTWLogLines) computeWindowLines() {
+	for _, line := range ll.lines[:ll.windowEnd] {
+		if len(ll.correlationId) > 0 && !bytes.Contains(bytes.ToLower(line), ll.correlationId) {
+			continue
+		}
+		if !ll.inTimeWindow(line) {
+			continue
+		}
+		ll.markedLines = append(ll.markedLines, line)
+	}
+	log.Trace().Msgf("Found %d log lines in window: %s\n", len(ll.markedLines), bytes.Join(ll.markedLines, []byte{'\n'}))
+}
+
+// inTimeWindow returns true if the timestamp of line is in the time window, or if no time window is set.
+// A timestamp without fractional seconds matches if any time of its second is in the window.
+func (ll *FTWLogLines) inTimeWindow(line []byte) bool {
+	if ll.timeWindowFrom.IsZero() && ll.timeWindowTo.IsZero() {
+		return true
+	}
+	timestamp, precision, ok := parseTimestamp(line)
+	if !ok {
+		log.Debug().Msgf("Ignoring log line without timestamp: %s", line)
+		return false
+	}
+	return timestamp.Add(precision).After(ll.timeWindowFrom) && !timestamp.After(ll.timeWindowTo)
+}
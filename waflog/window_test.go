@@ -0,0 +1,146 @@
+// Copyright 2024 OWASP CRS Project
+// SPDX-License-Identifier: Apache-2.0
+
+package waflog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/coreruleset/go-ftw/v2/config"
+)
+
+type windowTestSuite struct {
+	suite.Suite
+	logFilePath string
+	ll          *FTWLogLines
+}
+
+func (s *windowTestSuite) SetupSuite() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+}
+
+func (s *windowTestSuite) SetupTest() {
+	s.logFilePath = filepath.Join(s.T().TempDir(), "error.log")
+	s.Require().NoError(os.WriteFile(s.logFilePath, []byte("line before the test run\n"), 0644))
+
+	cfg := config.NewDefaultConfig()
+	cfg.LogFile = s.logFilePath
+	ll, err := NewFTWLogLines(config.NewRunnerConfiguration(cfg))
+	s.Require().NoError(err)
+	s.ll = ll
+	s.T().Cleanup(func() { _ = s.ll.Cleanup() })
+}
+
+func TestWindowTestSuite(t *testing.T) {
+	suite.Run(t, new(windowTestSuite))
+}
+
+func (s *windowTestSuite) appendLog(content string) {
+	file, err := os.OpenFile(s.logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	s.Require().NoError(err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	s.Require().NoError(err)
+}
+
+func (s *windowTestSuite) TestWindowContainsLinesWrittenWhileOpen() {
+	s.appendLog("line before the window\n")
+	s.Require().NoError(s.ll.OpenWindow())
+	s.False(s.ll.Correlated())
+	s.appendLog(rotationTestRuleLine + "\n")
+	s.Require().NoError(s.ll.CloseWindow())
+	s.True(s.ll.Correlated())
+	s.appendLog("line after the window\n")
+
+	lines, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Equal([][]byte{[]byte(rotationTestRuleLine)}, lines)
+
+	rules, err := s.ll.TriggeredRules()
+	s.Require().NoError(err)
+	s.Equal([]uint{920300}, rules)
+}
+
+func (s *windowTestSuite) TestWindowExcludesIncompleteLastLine() {
+	s.Require().NoError(s.ll.OpenWindow())
+	s.appendLog(rotationTestRuleLine + "\nincomplete")
+	s.Require().NoError(s.ll.CloseWindow())
+
+	lines, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Equal([][]byte{[]byte(rotationTestRuleLine)}, lines)
+}
+
+func (s *windowTestSuite) TestWindowWithCorrelationId() {
+	s.Require().NoError(s.ll.OpenWindow())
+	s.appendLog(`{"request":{"headers":{"X-CRS-Test":"920300-1-ABC"}},"messages":[{"id":920300}]}` + "\n" +
+		`{"request":{"headers":{"X-CRS-Test":"other"}},"messages":[{"id":949110}]}` + "\n")
+	s.Require().NoError(s.ll.CloseWindow())
+	s.ll.WithCorrelationId([]byte("920300-1-abc"))
+
+	rules, err := s.ll.TriggeredRules()
+	s.Require().NoError(err)
+	s.Equal([]uint{920300}, rules)
+}
+
+func (s *windowTestSuite) TestWindowWithTimeWindow() {
+	const layout = "Mon Jan 02 15:04:05.000000 2006"
+	sent := time.Date(2021, time.January, 5, 2, 21, 9, 500000000, time.Local)
+	received := sent.Add(100 * time.Millisecond)
+
+	s.Require().NoError(s.ll.OpenWindow())
+	s.appendLog(
+		// written late for the previous stage
+		"[" + sent.Add(-time.Second).Format(layout) + `] [client 127.0.0.1] ModSecurity: Warning. [id "949110"]` + "\n" +
+			"[" + sent.Add(50*time.Millisecond).Format(layout) + "] " + rotationTestRuleLine + "\n" +
+			// without fractional seconds, the second overlaps the window
+			sent.Format("2006/01/02 15:04:05") + ` [error] ModSecurity: Warning. [id "942100"]` + "\n" +
+			`[client 127.0.0.1] ModSecurity: Warning. [id "932100"]` + "\n" +
+			"[" + received.Add(time.Second).Format(layout) + `] [client 127.0.0.1] ModSecurity: Warning. [id "941100"]` + "\n")
+	s.Require().NoError(s.ll.CloseWindow())
+	s.ll.WithTimeWindow(sent, received)
+
+	rules, err := s.ll.TriggeredRules()
+	s.Require().NoError(err)
+	s.Equal([]uint{920300, 942100}, rules)
+}
+
+func (s *windowTestSuite) TestOpenWindowResetsPreviousStage() {
+	s.Require().NoError(s.ll.OpenWindow())
+	s.appendLog(rotationTestRuleLine + "\n")
+	s.Require().NoError(s.ll.CloseWindow())
+	s.ll.WithCorrelationId([]byte("920300"))
+	_, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.ll.OpenWindow())
+	s.False(s.ll.Correlated())
+	s.Require().NoError(s.ll.CloseWindow())
+	lines, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Empty(lines)
+	s.Nil(s.ll.correlationId)
+	s.True(s.ll.timeWindowFrom.IsZero())
+}
+
+func (s *windowTestSuite) TestMarkersAfterWindow() {
+	s.Require().NoError(s.ll.OpenWindow())
+	s.Require().NoError(s.ll.CloseWindow())
+
+	startMarker, endMarker := generateLogMarkers(920300, 1)
+	s.appendLog("X-CRS-Test: " + startMarker + "\n" + rotationTestRuleLine + "\nX-CRS-Test: " + endMarker + "\n")
+	s.ll.WithStartMarker([]byte("X-CRS-Test: " + startMarker))
+	s.False(s.ll.Correlated())
+	s.ll.WithEndMarker([]byte("X-CRS-Test: " + endMarker))
+	s.True(s.ll.Correlated())
+
+	lines, err := s.ll.GetMarkedLines()
+	s.Require().NoError(err)
+	s.Equal([][]byte{[]byte(rotationTestRuleLine)}, lines)
+}